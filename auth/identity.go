@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/YiniXu9506/devconG/config"
+)
+
+const wechatCode2SessionURL = "https://api.weixin.qq.com/sns/jscode2session"
+
+// ErrInvalidCode is returned when the identity provider rejects the login code
+var ErrInvalidCode = errors.New("invalid login code")
+
+// Identity is the user behind a mini program login code
+type Identity struct {
+	OpenID  string
+	UnionID string
+}
+
+// IdentityProvider exchanges a mini program login code for the identity of the user
+type IdentityProvider interface {
+	Code2Session(ctx context.Context, code string) (*Identity, error)
+}
+
+// WeChatProvider calls the wechat code2session API
+type WeChatProvider struct {
+	appID     string
+	appSecret string
+	endpoint  string
+	client    *http.Client
+}
+
+func NewWeChatProvider(appID, appSecret string) *WeChatProvider {
+	return &WeChatProvider{
+		appID:     appID,
+		appSecret: appSecret,
+		endpoint:  wechatCode2SessionURL,
+		client:    &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (p *WeChatProvider) Code2Session(ctx context.Context, code string) (*Identity, error) {
+	query := url.Values{}
+	query.Set("appid", p.appID)
+	query.Set("secret", p.appSecret)
+	query.Set("js_code", code)
+	query.Set("grant_type", "authorization_code")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("call code2session: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		OpenID  string `json:"openid"`
+		UnionID string `json:"unionid"`
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decode code2session response: %v", err)
+	}
+
+	switch {
+	// 40029: invalid code, 40163: code has been used
+	case body.ErrCode == 40029 || body.ErrCode == 40163:
+		return nil, ErrInvalidCode
+	case body.ErrCode != 0:
+		return nil, fmt.Errorf("code2session error %d: %s", body.ErrCode, body.ErrMsg)
+	case body.OpenID == "":
+		return nil, errors.New("code2session returned no openid")
+	}
+
+	return &Identity{OpenID: body.OpenID, UnionID: body.UnionID}, nil
+}
+
+// FakeProvider accepts any code and uses it as the open_id, for local development and tests only
+type FakeProvider struct{}
+
+func (FakeProvider) Code2Session(ctx context.Context, code string) (*Identity, error) {
+	if code == "" {
+		return nil, ErrInvalidCode
+	}
+	return &Identity{OpenID: "fake-" + code}, nil
+}
+
+// NewIdentityProvider builds the identity provider selected by the config
+func NewIdentityProvider(cfg config.AuthConfig) IdentityProvider {
+	if cfg.IdentityProvider == config.IdentityProviderFake {
+		return FakeProvider{}
+	}
+	return NewWeChatProvider(cfg.WeChat.AppID, cfg.WeChat.AppSecret)
+}
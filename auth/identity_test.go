@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestWeChatProvider calls a code2session server answering with body
+func newTestWeChatProvider(t *testing.T, body string) *WeChatProvider {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("appid") != "app" || r.URL.Query().Get("js_code") != "code" {
+			t.Errorf("got query %v", r.URL.Query())
+		}
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	p := NewWeChatProvider("app", "secret")
+	p.endpoint = server.URL
+	return p
+}
+
+func TestWeChatProvider(t *testing.T) {
+	identity, err := newTestWeChatProvider(t, `{"openid":"o-1","unionid":"u-1"}`).Code2Session(context.Background(), "code")
+	if err != nil || identity.OpenID != "o-1" || identity.UnionID != "u-1" {
+		t.Fatalf("got %+v, %v", identity, err)
+	}
+
+	if _, err := newTestWeChatProvider(t, `{"errcode":40163,"errmsg":"code been used"}`).Code2Session(context.Background(), "code"); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("got %v for a used code, want ErrInvalidCode", err)
+	}
+	if _, err := newTestWeChatProvider(t, `{"errcode":-1,"errmsg":"system busy"}`).Code2Session(context.Background(), "code"); err == nil || errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("got %v for a wechat error, want it reported", err)
+	}
+	if _, err := newTestWeChatProvider(t, `{}`).Code2Session(context.Background(), "code"); err == nil {
+		t.Fatal("accepted a response without openid")
+	}
+}
+
+func TestFakeProvider(t *testing.T) {
+	identity, err := FakeProvider{}.Code2Session(context.Background(), "alice")
+	if err != nil || identity.OpenID != "fake-alice" {
+		t.Fatalf("got %+v, %v", identity, err)
+	}
+	if _, err := (FakeProvider{}).Code2Session(context.Background(), ""); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("got %v for an empty code, want ErrInvalidCode", err)
+	}
+}
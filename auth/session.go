@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrInvalidSession is returned for malformed, forged or expired session tokens
+var ErrInvalidSession = errors.New("invalid session")
+
+// Session is the payload of a session token
+type Session struct {
+	OpenID    string `json:"open_id"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// IssueToken signs a session for openID valid for ttl, the token is `base64(payload).base64(hmac)`
+func IssueToken(secret string, openID string, ttl time.Duration) (string, *Session, error) {
+	session := &Session{OpenID: openID, ExpiresAt: time.Now().Add(ttl).Unix()}
+	payload, err := json.Marshal(session)
+	if err != nil {
+		return "", nil, err
+	}
+
+	encodedPayload := base64.RawURLEncoding.EncodeToString(payload)
+	return encodedPayload + "." + sign(secret, encodedPayload), session, nil
+}
+
+// VerifyToken checks the signature and expiry of a token issued by IssueToken
+func VerifyToken(secret string, token string) (*Session, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, ErrInvalidSession
+	}
+	if !hmac.Equal([]byte(parts[1]), []byte(sign(secret, parts[0]))) {
+		return nil, ErrInvalidSession
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidSession
+	}
+	var session Session
+	if err := json.Unmarshal(payload, &session); err != nil || session.OpenID == "" {
+		return nil, ErrInvalidSession
+	}
+	if time.Now().Unix() >= session.ExpiresAt {
+		return nil, ErrInvalidSession
+	}
+
+	return &session, nil
+}
+
+func sign(secret string, encodedPayload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(encodedPayload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
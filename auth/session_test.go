@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "test-session-secret"
+
+func TestIssueAndVerifyToken(t *testing.T) {
+	token, issued, err := IssueToken(testSecret, "alice", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := VerifyToken(testSecret, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.OpenID != "alice" || session.ExpiresAt != issued.ExpiresAt {
+		t.Fatalf("got session %+v, want %+v", session, issued)
+	}
+}
+
+func TestVerifyTokenRejects(t *testing.T) {
+	token, _, err := IssueToken(testSecret, "alice", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, _, err := IssueToken(testSecret, "alice", -time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(token, ".")
+	// bob's payload with alice's signature
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`{"open_id":"bob","exp":9999999999}`)) + "." + parts[1]
+
+	tests := []struct {
+		name   string
+		secret string
+		token  string
+	}{
+		{"other secret", "other-session-secret", token},
+		{"expired", testSecret, expired},
+		{"forged payload", testSecret, forged},
+		{"no signature", testSecret, parts[0]},
+		{"empty", testSecret, ""},
+		{"extra part", testSecret, token + ".x"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if session, err := VerifyToken(test.secret, test.token); !errors.Is(err, ErrInvalidSession) {
+				t.Fatalf("got %+v, %v, want ErrInvalidSession", session, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,544 @@
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/YiniXu9506/devconG/config"
+	"github.com/YiniXu9506/devconG/migrate"
+	"github.com/YiniXu9506/devconG/model"
+	"gorm.io/gorm"
+)
+
+// FormatVersion is the layout of the archive, restore refuses archives of later versions.
+// Version 2 added events, the rows of version 1 archives belong to the default event.
+const FormatVersion = 2
+
+const (
+	manifestFile = "manifest.json"
+	configFile   = "config.json"
+	// rows read or inserted per statement
+	batchSize = 500
+	// longest line of a table file
+	maxLineSize = 1 << 20
+)
+
+// table is a table of the dataset, its rows are written as json lines of the model struct
+type table struct {
+	name string
+	// columns rows are read in order of, and the fields holding them
+	key    []string
+	fields []string
+	model  interface{}
+	// rows the migrations insert, the archive replaces them
+	seeded string
+	// rows of the event with the id of the argument, empty for tables shared by the events,
+	// which are left out of the archive of one event
+	scope string
+}
+
+// tables of the dataset in the order they are restored, moderation leases, notifications,
+// webhooks and retention batches are left out, click totals are rebuilt from the clicks
+var tables = []table{
+	{"event_models", []string{"event_id"}, []string{"EventID"}, model.EventModel{}, fmt.Sprintf("event_id = %d", model.DefaultEventID), "event_id = ?"},
+	{"phrase_models", []string{"phrase_id"}, []string{"PhraseID"}, model.PhraseModel{}, "", "event_id = ?"},
+	{"phrase_audit_models", []string{"id"}, []string{"ID"}, model.PhraseAuditModel{}, "", "phrase_id IN (SELECT phrase_id FROM phrase_models WHERE event_id = ?)"},
+	{"user_models", []string{"event_id", "open_id"}, []string{"EventID", "OpenID"}, model.UserModel{}, "", "event_id = ?"},
+	{"phrase_click_models", []string{"id"}, []string{"ID"}, model.PhraseClickModel{}, "", "event_id = ?"},
+	{"phrase_click_rollup_models", []string{"id"}, []string{"ID"}, model.PhraseClickRollupModel{}, "", "event_id = ?"},
+	{"display_profile_models", []string{"name"}, []string{"Name"}, model.DisplayProfileModel{}, "", ""},
+}
+
+// Entry is a file of the archive with its checksum
+type Entry struct {
+	File string `json:"file"`
+	// table the rows of the file are restored to, empty for the config
+	Table  string `json:"table,omitempty"`
+	Rows   int64  `json:"rows"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest is the first file of the archive
+type Manifest struct {
+	FormatVersion int   `json:"format_version"`
+	CreatedAt     int64 `json:"created_at"`
+	// highest migration applied to the database backed up, restoring needs it applied too
+	SchemaVersion int    `json:"schema_version"`
+	Dialect       string `json:"dialect"`
+	// the event of an archive of one event, 0 for an archive of all events
+	EventID int `json:"event_id,omitempty"`
+	// the config the server ran with, credentials masked
+	Config Entry   `json:"config"`
+	Tables []Entry `json:"tables"`
+}
+
+// ChecksumFile is the file next to an archive holding its checksum in the format of sha256sum
+func ChecksumFile(path string) string {
+	return path + ".sha256"
+}
+
+// Write backs up the dataset read in one transaction and the config to a gzipped tar at path,
+// with its checksum in ChecksumFile(path). With an eventID only the rows of that event are backed up.
+func Write(ctx context.Context, db *gorm.DB, cfg *config.Config, path string, eventID int) (Manifest, error) {
+	manifest := Manifest{FormatVersion: FormatVersion, CreatedAt: time.Now().Unix(), EventID: eventID}
+
+	migrator, err := migrate.New(db)
+	if err != nil {
+		return manifest, err
+	}
+	manifest.Dialect = migrator.Dialect()
+	if manifest.SchemaVersion, err = migrator.Version(); err != nil {
+		return manifest, err
+	}
+
+	// tar needs the size of a file before its content, tables are dumped to files first
+	dir, err := ioutil.TempDir(filepath.Dir(path), ".backup-*")
+	if err != nil {
+		return manifest, err
+	}
+	defer os.RemoveAll(dir)
+
+	// a snapshot of all tables, clicks added meanwhile don't make the tables disagree
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, t := range tables {
+			if eventID != 0 && t.scope == "" {
+				continue
+			}
+			entry, err := dumpTable(tx, t, eventID, filepath.Join(dir, t.name+".jsonl"))
+			if err != nil {
+				return fmt.Errorf("back up %s: %w", t.name, err)
+			}
+			manifest.Tables = append(manifest.Tables, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return manifest, err
+	}
+
+	configData, err := json.MarshalIndent(cfg.Redacted(), "", "    ")
+	if err != nil {
+		return manifest, err
+	}
+	manifest.Config = Entry{File: configFile, SHA256: checksum(configData)}
+	manifestData, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		return manifest, err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return manifest, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	sum := sha256.New()
+	zw := gzip.NewWriter(io.MultiWriter(f, sum))
+	tw := tar.NewWriter(zw)
+	if err := addData(tw, manifestFile, manifestData); err != nil {
+		return manifest, err
+	}
+	if err := addData(tw, configFile, configData); err != nil {
+		return manifest, err
+	}
+	for _, entry := range manifest.Tables {
+		if err := addFile(tw, entry.File, filepath.Join(dir, entry.File)); err != nil {
+			return manifest, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return manifest, err
+	}
+	if err := zw.Close(); err != nil {
+		return manifest, err
+	}
+	if err := f.Sync(); err != nil {
+		return manifest, err
+	}
+	if err := f.Close(); err != nil {
+		return manifest, err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return manifest, err
+	}
+
+	line := fmt.Sprintf("%s  %s\n", hex.EncodeToString(sum.Sum(nil)), filepath.Base(path))
+	return manifest, ioutil.WriteFile(ChecksumFile(path), []byte(line), 0644)
+}
+
+// dumpTable writes the rows of a table, or of the event when eventID isn't 0, as json lines in the order of its key
+func dumpTable(tx *gorm.DB, t table, eventID int, path string) (Entry, error) {
+	entry := Entry{File: t.name + ".jsonl", Table: t.name}
+	f, err := os.Create(path)
+	if err != nil {
+		return entry, err
+	}
+	defer f.Close()
+
+	sum := sha256.New()
+	w := bufio.NewWriter(io.MultiWriter(f, sum))
+	encoder := json.NewEncoder(w)
+	sliceType := reflect.SliceOf(reflect.TypeOf(t.model))
+	key := strings.Join(t.key, ", ")
+	var last []interface{}
+	for {
+		rows := reflect.New(sliceType)
+		query := scoped(tx, t, eventID).Order(key).Limit(batchSize)
+		if last != nil {
+			// a row value compares the columns of a composite key in order
+			query = query.Where("("+key+") > ?", last)
+		}
+		if err := query.Find(rows.Interface()).Error; err != nil {
+			return entry, err
+		}
+
+		n := rows.Elem().Len()
+		for i := 0; i < n; i++ {
+			if err := encoder.Encode(rows.Elem().Index(i).Interface()); err != nil {
+				return entry, err
+			}
+		}
+		entry.Rows += int64(n)
+		if n < batchSize {
+			break
+		}
+		last = make([]interface{}, len(t.fields))
+		for i, field := range t.fields {
+			last[i] = rows.Elem().Index(n - 1).FieldByName(field).Interface()
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return entry, err
+	}
+	entry.SHA256 = hex.EncodeToString(sum.Sum(nil))
+	return entry, f.Close()
+}
+
+func addData(tw *tar.Writer, name string, data []byte) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: time.Now()}); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+func addFile(tw *tar.Writer, name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: info.Size(), ModTime: info.ModTime()}); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// walk calls fn with the manifest and then each other file of the archive
+func walk(path string, fn func(manifest Manifest, name string, r io.Reader) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return fmt.Errorf("%s is not a backup: %w", path, err)
+	}
+	tr := tar.NewReader(zr)
+
+	header, err := tr.Next()
+	if err != nil || header.Name != manifestFile {
+		return fmt.Errorf("%s is not a backup, it starts without %s", path, manifestFile)
+	}
+	var manifest Manifest
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return fmt.Errorf("read %s: %w", manifestFile, err)
+	}
+	if manifest.FormatVersion < 1 || manifest.FormatVersion > FormatVersion {
+		return fmt.Errorf("backup format version %d is not supported, this build reads versions up to %d", manifest.FormatVersion, FormatVersion)
+	}
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(manifest, header.Name, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// Verify checks the archive against ChecksumFile(path) when it exists, and each file against the manifest
+func Verify(path string) (Manifest, error) {
+	var manifest Manifest
+	if line, err := ioutil.ReadFile(ChecksumFile(path)); err == nil {
+		fields := strings.Fields(string(line))
+		if len(fields) == 0 {
+			return manifest, fmt.Errorf("%s is empty", ChecksumFile(path))
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return manifest, err
+		}
+		sum := sha256.New()
+		_, err = io.Copy(sum, f)
+		f.Close()
+		if err != nil {
+			return manifest, err
+		}
+		if hex.EncodeToString(sum.Sum(nil)) != fields[0] {
+			return manifest, fmt.Errorf("checksum of %s doesn't match %s", path, ChecksumFile(path))
+		}
+	} else if !os.IsNotExist(err) {
+		return manifest, err
+	}
+
+	seen := make(map[string]bool)
+	err := walk(path, func(m Manifest, name string, r io.Reader) error {
+		manifest = m
+		expected, ok := m.entry(name)
+		if !ok {
+			return fmt.Errorf("%s is not in the manifest", name)
+		}
+		sum := sha256.New()
+		rows, err := countLines(io.TeeReader(r, sum))
+		if err != nil {
+			return err
+		}
+		if hex.EncodeToString(sum.Sum(nil)) != expected.SHA256 {
+			return fmt.Errorf("checksum of %s doesn't match the manifest", name)
+		}
+		if expected.Table != "" && rows != expected.Rows {
+			return fmt.Errorf("%s has %d rows, the manifest says %d", name, rows, expected.Rows)
+		}
+		seen[name] = true
+		return nil
+	})
+	if err != nil {
+		return manifest, err
+	}
+	for _, entry := range append([]Entry{manifest.Config}, manifest.Tables...) {
+		if !seen[entry.File] {
+			return manifest, fmt.Errorf("%s of the manifest is missing", entry.File)
+		}
+	}
+	return manifest, nil
+}
+
+func (m Manifest) entry(name string) (Entry, bool) {
+	if name == m.Config.File {
+		return m.Config, true
+	}
+	for _, entry := range m.Tables {
+		if entry.File == name {
+			return entry, true
+		}
+	}
+	return Entry{}, false
+}
+
+func countLines(r io.Reader) (int64, error) {
+	var lines int64
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		lines += int64(bytes.Count(buf[:n], []byte("\n")))
+		if err == io.EOF {
+			return lines, nil
+		}
+		if err != nil {
+			return lines, err
+		}
+	}
+}
+
+// Config returns the config stored in the archive
+func Config(path string) ([]byte, error) {
+	var data []byte
+	err := walk(path, func(_ Manifest, name string, r io.Reader) error {
+		if name != configFile {
+			return nil
+		}
+		var err error
+		data, err = ioutil.ReadAll(r)
+		return err
+	})
+	if err == nil && data == nil {
+		err = fmt.Errorf("%s has no %s", path, configFile)
+	}
+	return data, err
+}
+
+// Restore verifies the archive and loads its tables into db, which must be migrated to the schema version
+// of the backup and hold none of the rows, or none of the rows of the event for the archive of one event.
+// Ids are kept, so phrases, clicks and audit records still match.
+func Restore(ctx context.Context, db *gorm.DB, path string) (Manifest, error) {
+	manifest, err := Verify(path)
+	if err != nil {
+		return manifest, err
+	}
+
+	migrator, err := migrate.New(db)
+	if err != nil {
+		return manifest, err
+	}
+	version, err := migrator.Version()
+	if err != nil {
+		return manifest, err
+	}
+	if version < manifest.SchemaVersion {
+		return manifest, fmt.Errorf("the database is at schema version %d, the backup needs %d, run migrate up first", version, manifest.SchemaVersion)
+	}
+	// TiDB assigns AUTO_RANDOM ids unless explicit ids are allowed for the session
+	explicitIDs := migrator.Dialect() == migrate.DialectTiDB
+
+	byName := make(map[string]table, len(tables))
+	for _, t := range tables {
+		byName[t.name] = t
+	}
+	for _, entry := range manifest.Tables {
+		if _, ok := byName[entry.Table]; !ok {
+			return manifest, fmt.Errorf("table %s of the backup is unknown", entry.Table)
+		}
+		t := byName[entry.Table]
+		if manifest.EventID != 0 && t.scope == "" {
+			return manifest, fmt.Errorf("table %s of the backup is shared by the events, it can't be in the backup of event %d", entry.Table, manifest.EventID)
+		}
+		var count int64
+		query := scoped(db.WithContext(ctx), t, manifest.EventID)
+		if t.seeded != "" {
+			query = query.Not(t.seeded)
+		}
+		if err := query.Count(&count).Error; err != nil {
+			return manifest, err
+		}
+		if count > 0 && manifest.EventID != 0 {
+			return manifest, fmt.Errorf("table %s holds %d rows of event %d, restore into a database without the event", entry.Table, count, manifest.EventID)
+		}
+		if count > 0 {
+			return manifest, fmt.Errorf("table %s holds %d rows, restore into an empty database", entry.Table, count)
+		}
+	}
+
+	err = walk(path, func(m Manifest, name string, r io.Reader) error {
+		entry, _ := m.entry(name)
+		if entry.Table == "" {
+			return nil
+		}
+		t := byName[entry.Table]
+		if t.seeded != "" {
+			if err := scoped(db.WithContext(ctx), t, m.EventID).Where(t.seeded).Delete(t.model).Error; err != nil {
+				return fmt.Errorf("restore %s: %w", entry.Table, err)
+			}
+		}
+		if err := loadTable(ctx, db, t, r, m.FormatVersion, explicitIDs); err != nil {
+			return fmt.Errorf("restore %s: %w", entry.Table, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return manifest, err
+	}
+	return manifest, rebuildClickTotals(ctx, db, manifest.EventID)
+}
+
+// rebuildClickTotals sums the restored clicks into the totals of their phrases, of all events when eventID is 0
+func rebuildClickTotals(ctx context.Context, db *gorm.DB, eventID int) error {
+	scope, args := "", []interface{}{}
+	if eventID != 0 {
+		scope, args = "WHERE event_id = ?", []interface{}{eventID}
+	}
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM phrase_click_total_models "+scope, args...).Error; err != nil {
+			return fmt.Errorf("rebuild click totals: %w", err)
+		}
+		if err := tx.Exec("INSERT INTO phrase_click_total_models (event_id, phrase_id, clicks) SELECT event_id, phrase_id, SUM(clicks) FROM all_phrase_clicks "+scope+" GROUP BY event_id, phrase_id", args...).Error; err != nil {
+			return fmt.Errorf("rebuild click totals: %w", err)
+		}
+		return nil
+	})
+}
+
+// scoped queries the rows of the table, only those of the event when eventID isn't 0
+func scoped(db *gorm.DB, t table, eventID int) *gorm.DB {
+	query := db.Table(t.name)
+	if eventID != 0 {
+		query = query.Where(t.scope, eventID)
+	}
+	return query
+}
+
+// loadTable inserts the json lines of a table batch by batch
+func loadTable(ctx context.Context, db *gorm.DB, t table, r io.Reader, formatVersion int, explicitIDs bool) error {
+	modelType := reflect.TypeOf(t.model)
+	sliceType := reflect.SliceOf(modelType)
+	insert := func(rows reflect.Value) error {
+		return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if explicitIDs {
+				if err := tx.Exec("SET @@allow_auto_random_explicit_insert = true").Error; err != nil {
+					return err
+				}
+			}
+			return tx.Table(t.name).Create(rows.Interface()).Error
+		})
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	rows := reflect.MakeSlice(sliceType, 0, batchSize)
+	for scanner.Scan() {
+		row := reflect.New(modelType)
+		if err := json.Unmarshal(scanner.Bytes(), row.Interface()); err != nil {
+			return err
+		}
+		// version 1 was written before events, its rows belong to the default event
+		if eventID := row.Elem().FieldByName("EventID"); formatVersion < 2 && eventID.IsValid() && eventID.Int() == 0 {
+			eventID.SetInt(model.DefaultEventID)
+		}
+		rows = reflect.Append(rows, row.Elem())
+		if rows.Len() == batchSize {
+			if err := insert(rows); err != nil {
+				return err
+			}
+			rows = reflect.MakeSlice(sliceType, 0, batchSize)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if rows.Len() > 0 {
+		return insert(rows)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/YiniXu9506/devconG/config"
+	"github.com/YiniXu9506/devconG/model"
+	"github.com/YiniXu9506/devconG/store"
+	"github.com/YiniXu9506/devconG/utils"
+	"gorm.io/gorm"
+)
+
+func openSQLite(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := utils.Open(config.DBConfig{Driver: config.DBDriverSQLite, Path: filepath.Join(t.TempDir(), "devcon.db"), MaxIdleConns: 2, MaxOpenConns: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		utils.Close(db)
+	})
+	if err := utils.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func testConfig(t *testing.T) *config.Config {
+	t.Helper()
+
+	loader, err := config.NewLoader("../config.dev", map[string]interface{}{
+		"db.driver":           config.DBDriverSQLite,
+		"auth.admin_token":    "test-admin-token",
+		"auth.session_secret": "test-session-secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loader.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// addWall adds an approved phrase with a click record of the same id and a user to the event
+func addWall(t *testing.T, st store.Store, id int, text string, clicks int) model.PhraseModel {
+	t.Helper()
+
+	phrase := model.PhraseModel{PhraseID: id, Text: text, GroupID: 1, Status: model.StatusApproved, CreateTime: 1, UpdateTime: 1}
+	if err := st.Phrases.Create(&phrase); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Clicks.AddMany([]model.PhraseClickModel{{ID: id, PhraseID: phrase.PhraseID, GroupID: 1, OpenID: "alice", Clicks: clicks, ClickTime: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Users.Upsert(model.UserModel{OpenID: "alice", NickName: "Alice"}); err != nil {
+		t.Fatal(err)
+	}
+	return phrase
+}
+
+// topPhrase is the text and clicks of the phrase with the most clicks
+func topPhrase(t *testing.T, st store.Store) (string, int) {
+	t.Helper()
+
+	phrases, err := st.Phrases.List(store.PhraseFilter{Statuses: []model.PhraseStatus{model.StatusApproved}, Sort: store.SortClicks, Desc: true}, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(phrases) == 0 {
+		return "", 0
+	}
+	return phrases[0].Text, phrases[0].Clicks
+}
+
+func TestWriteAndRestore(t *testing.T) {
+	db := openSQLite(t)
+	st := store.NewGorm(db)
+	addWall(t, st, 1, "hello", 3)
+	addWall(t, st, 2, "world", 5)
+	path := filepath.Join(t.TempDir(), "devcon.tar.gz")
+
+	manifest, err := Write(context.Background(), db, testConfig(t), path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.SchemaVersion == 0 || manifest.Dialect != "sqlite" || len(manifest.Tables) != len(tables) {
+		t.Fatalf("got manifest %+v", manifest)
+	}
+	if _, err := Verify(path); err != nil {
+		t.Fatal(err)
+	}
+	configData, err := Config(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(configData), "test-admin-token") || strings.Contains(string(configData), "test-session-secret") {
+		t.Fatalf("the config of the backup holds credentials: %s", configData)
+	}
+
+	target := openSQLite(t)
+	if _, err := Restore(context.Background(), target, path); err != nil {
+		t.Fatal(err)
+	}
+	restored := store.NewGorm(target)
+	if text, clicks := topPhrase(t, restored); text != "world" || clicks != 5 {
+		t.Fatalf("got top phrase %q with %d clicks after the restore, want world with 5", text, clicks)
+	}
+	if user, found, err := restored.Users.Get("alice"); err != nil || !found || user.NickName != "Alice" {
+		t.Fatalf("got user %+v, %v, %v", user, found, err)
+	}
+
+	// the target isn't empty anymore
+	if _, err := Restore(context.Background(), target, path); err == nil {
+		t.Fatal("restored into a database holding the rows")
+	}
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	db := openSQLite(t)
+	addWall(t, store.NewGorm(db), 1, "hello", 3)
+	path := filepath.Join(t.TempDir(), "devcon.tar.gz")
+	if _, err := Write(context.Background(), db, testConfig(t), path, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)/2] ^= 0xff
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(path); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Fatalf("got %v, want a checksum mismatch", err)
+	}
+	if _, err := Restore(context.Background(), openSQLite(t), path); err == nil {
+		t.Fatal("restored a corrupted archive")
+	}
+}
+
+func TestRestoreEvent(t *testing.T) {
+	db := openSQLite(t)
+	st := store.NewGorm(db)
+	meetup := model.EventModel{Slug: "meetup", Name: "Meetup", Settings: "{}"}
+	if err := st.Events.Create(&meetup); err != nil {
+		t.Fatal(err)
+	}
+	addWall(t, st.Event(meetup.EventID), 1, "hello", 3)
+	path := filepath.Join(t.TempDir(), "meetup.tar.gz")
+	manifest, err := Write(context.Background(), db, testConfig(t), path, meetup.EventID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.EventID != meetup.EventID {
+		t.Fatalf("got manifest of event %d, want %d", manifest.EventID, meetup.EventID)
+	}
+
+	// another database with a wall of the default event, ids are kept so they must not collide
+	target := openSQLite(t)
+	restored := store.NewGorm(target)
+	addWall(t, restored, 100, "default", 7)
+	if _, err := Restore(context.Background(), target, path); err != nil {
+		t.Fatal(err)
+	}
+	if text, clicks := topPhrase(t, restored.Event(meetup.EventID)); text != "hello" || clicks != 3 {
+		t.Fatalf("got top phrase %q with %d clicks in the event, want hello with 3", text, clicks)
+	}
+	if text, clicks := topPhrase(t, restored); text != "default" || clicks != 7 {
+		t.Fatalf("got top phrase %q with %d clicks in the default event, want default with 7", text, clicks)
+	}
+
+	if _, err := Restore(context.Background(), target, path); err == nil {
+		t.Fatal("restored the event into a database holding it")
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/YiniXu9506/devconG/backup"
+	"github.com/YiniXu9506/devconG/config"
+	"github.com/YiniXu9506/devconG/migrate"
+	"github.com/YiniXu9506/devconG/utils"
+)
+
+// runBackup snapshots phrases, clicks, users, display profiles and the config into one archive
+func runBackup(configManager *config.Manager, args []string) int {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	out := flags.String("out", fmt.Sprintf("devcon-%s.tar.gz", time.Now().Format("20060102-150405")), "archive to write, its checksum is written next to it")
+	event := flags.String("event", "", "slug of the only event to back up, all events by default")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	dbs, _ := connect(configManager.Get())
+	defer utils.Close(dbs...)
+
+	eventID := 0
+	if *event != "" {
+		var err error
+		if eventID, err = lookupEvent(dbs[0], *event); err != nil {
+			fmt.Fprintln(os.Stderr, "backup:", err)
+			return 1
+		}
+	}
+
+	manifest, err := backup.Write(context.Background(), dbs[0], configManager.Get(), *out, eventID)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "backup:", err)
+		return 1
+	}
+	if *event != "" {
+		fmt.Printf("backed up event %s of schema version %d to %s\n", *event, manifest.SchemaVersion, *out)
+	} else {
+		fmt.Printf("backed up schema version %d to %s\n", manifest.SchemaVersion, *out)
+	}
+	printManifest(manifest)
+	return 0
+}
+
+// runRestore loads an archive written by backup into an empty database, or the archive of one event
+// into a database without the event
+func runRestore(configManager *config.Manager, args []string) int {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	file := flags.String("file", "", "archive written by backup")
+	verify := flags.Bool("verify", false, "only check the archive against its checksums")
+	configOut := flags.String("config-out", "", "also write the config of the archive here, credentials are masked in it")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *file == "" {
+		fmt.Fprintln(os.Stderr, "restore: --file is required")
+		return 2
+	}
+
+	if *verify {
+		manifest, err := backup.Verify(*file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "restore:", err)
+			return 1
+		}
+		fmt.Printf("%s is intact, backed up at %s from schema version %d\n", *file, formatTime(manifest.CreatedAt), manifest.SchemaVersion)
+		printManifest(manifest)
+		return 0
+	}
+
+	db, err := utils.Open(configManager.Get().DB)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "restore: failed to connect database:", err)
+		return 1
+	}
+	defer utils.Close(db)
+	// the restored database gets the schema of this build, which reads the rows of older schema versions too
+	migrator, err := migrate.New(db)
+	if err == nil {
+		_, err = migrator.Up(0)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "restore: migrate:", err)
+		return 1
+	}
+
+	start := time.Now()
+	manifest, err := backup.Restore(context.Background(), db, *file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "restore:", err)
+		return 1
+	}
+	if manifest.EventID != 0 {
+		fmt.Printf("restored event %d of %s, backed up at %s, in %v\n", manifest.EventID, *file, formatTime(manifest.CreatedAt), time.Since(start).Round(time.Millisecond))
+	} else {
+		fmt.Printf("restored %s, backed up at %s, in %v\n", *file, formatTime(manifest.CreatedAt), time.Since(start).Round(time.Millisecond))
+	}
+	printManifest(manifest)
+
+	if *configOut != "" {
+		data, err := backup.Config(*file)
+		if err == nil {
+			err = ioutil.WriteFile(*configOut, data, 0644)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "restore: config:", err)
+			return 1
+		}
+		fmt.Printf("wrote the config to %s, fill in the masked credentials before using it\n", *configOut)
+	}
+	return 0
+}
+
+func printManifest(manifest backup.Manifest) {
+	for _, entry := range manifest.Tables {
+		fmt.Printf("  %-28s %d rows\n", entry.Table, entry.Rows)
+	}
+}
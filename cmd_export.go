@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/YiniXu9506/devconG/config"
+	"github.com/YiniXu9506/devconG/model"
+	"github.com/YiniXu9506/devconG/store"
+	"github.com/YiniXu9506/devconG/utils"
+)
+
+// phrases read from the store at a time
+const exportPageSize = 500
+
+// exportedPhrase is a line of the export
+type exportedPhrase struct {
+	store.PhraseWithClicks
+	StatusText    string              `json:"status_text"`
+	Distributions []store.GroupClicks `json:"distributions"`
+}
+
+var exportColumns = []string{"phrase_id", "text", "group_id", "open_id", "status", "clicks", "hot_group_id", "create_time", "update_time"}
+
+// runExport writes the phrases of an event in the primary database, most clicked first
+func runExport(configManager *config.Manager, args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", "csv", "csv, or jsonl for a json object with the clicks of each group per line")
+	status := flags.String("status", "approved", "comma separated statuses of the exported phrases")
+	out := flags.String("out", "", "file to write, stdout by default")
+	eventSlug := flags.String("event", "", "slug of the event to export, the default event by default")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *format != "csv" && *format != "jsonl" {
+		fmt.Fprintf(os.Stderr, "format must be csv or jsonl, got %q\n", *format)
+		return 2
+	}
+	statuses, err := model.ParsePhraseStatuses(*status)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer file.Close()
+		w = file
+	}
+
+	dbs, st := connect(configManager.Get())
+	defer utils.Close(dbs...)
+
+	eventID, err := lookupEvent(dbs[0], *eventSlug)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "export:", err)
+		return 1
+	}
+
+	n, err := exportPhrases(st.Event(eventID), store.PhraseFilter{Statuses: statuses, Sort: store.SortClicks, Desc: true}, *format, w)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "export:", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "exported %d phrases\n", n)
+	return 0
+}
+
+// exportPhrases pages through the phrases of the filter by keyset and writes them in the format
+func exportPhrases(st store.Store, filter store.PhraseFilter, format string, w io.Writer) (int, error) {
+	buffered := bufio.NewWriter(w)
+	csvWriter := csv.NewWriter(buffered)
+	encoder := json.NewEncoder(buffered)
+	if format == "csv" {
+		if err := csvWriter.Write(exportColumns); err != nil {
+			return 0, err
+		}
+	}
+
+	written := 0
+	for {
+		phrases, err := st.Phrases.List(filter, exportPageSize, 0)
+		if err != nil {
+			return written, err
+		}
+		if len(phrases) == 0 {
+			break
+		}
+		ids := make([]int, len(phrases))
+		for i, phrase := range phrases {
+			ids[i] = phrase.PhraseID
+		}
+		distributions, err := st.Clicks.Distributions(ids)
+		if err != nil {
+			return written, err
+		}
+
+		for _, phrase := range phrases {
+			line := exportedPhrase{PhraseWithClicks: phrase, StatusText: phrase.Status.String(), Distributions: distributions[phrase.PhraseID]}
+			if line.Distributions == nil {
+				line.Distributions = []store.GroupClicks{}
+			}
+			if format == "csv" {
+				// distributions are most clicks first
+				hotGroupID := ""
+				if len(line.Distributions) > 0 {
+					hotGroupID = strconv.Itoa(line.Distributions[0].GroupID)
+				}
+				err = csvWriter.Write([]string{
+					strconv.Itoa(phrase.PhraseID), phrase.Text, strconv.Itoa(phrase.GroupID), phrase.OpenID, phrase.Status.String(),
+					strconv.Itoa(phrase.Clicks), hotGroupID, strconv.FormatInt(phrase.CreateTime, 10), strconv.FormatInt(phrase.UpdateTime, 10),
+				})
+			} else {
+				err = encoder.Encode(line)
+			}
+			if err != nil {
+				return written, err
+			}
+			written++
+		}
+
+		last := phrases[len(phrases)-1]
+		filter.After = &store.PhraseKey{Value: int64(last.Clicks), PhraseID: last.PhraseID}
+		if len(phrases) < exportPageSize {
+			break
+		}
+	}
+
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		return written, err
+	}
+	return written, buffered.Flush()
+}
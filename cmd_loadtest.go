@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/YiniXu9506/devconG/config"
+	"github.com/YiniXu9506/devconG/loadtest"
+)
+
+// runLoadtest drives the HTTP API of a running server with virtual users and prints the latencies and error rates
+func runLoadtest(configManager *config.Manager, args []string) int {
+	cfg := configManager.Get()
+	flags := flag.NewFlagSet("loadtest", flag.ContinueOnError)
+	target := flags.String("target", fmt.Sprintf("http://127.0.0.1:%d", cfg.Server.ListenPort), "base url of the server")
+	users := flags.Int("users", 50, "virtual users")
+	duration := flags.Duration("duration", time.Minute, "how long the test runs")
+	rampUp := flags.Duration("ramp-up", 10*time.Second, "users start evenly over this long")
+	think := flags.Duration("think", time.Second, "mean pause of a user between two actions")
+	mix := flags.String("mix", "poll=60,click=30,phrase=5,profile=5", "weights of the actions of the users")
+	groups := flags.Int("groups", 5, "groups the users cheer for")
+	seedValue := flags.Int64("seed", 1, "seed of the actions of the users")
+	login := flags.String("login", loadtest.LoginMint, "mint to sign session tokens with auth.session_secret, code to log in at /login with the fake identity provider")
+	event := flags.String("event", "", "slug of the event the users take part in, the default event by default")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *event != "" {
+		*target = strings.TrimRight(*target, "/") + "/events/" + *event
+	}
+	actions, err := loadtest.ParseMix(*mix)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	// stop early on ctrl-c and still print the report
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Fprintf(os.Stderr, "load testing %s with %d users for %v\n", *target, *users, *duration)
+	report, err := loadtest.Run(ctx, loadtest.Options{
+		Target:        *target,
+		Users:         *users,
+		Duration:      *duration,
+		RampUp:        *rampUp,
+		Think:         *think,
+		Mix:           actions,
+		Groups:        *groups,
+		Seed:          *seedValue,
+		Login:         *login,
+		SessionSecret: cfg.Auth.SessionSecret,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "loadtest:", err)
+		return 2
+	}
+	printLoadReport(report)
+
+	for _, endpoint := range report.Endpoints {
+		if endpoint.Errors > 0 {
+			return 1
+		}
+	}
+	return 0
+}
+
+func printLoadReport(report loadtest.Report) {
+	w := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "ENDPOINT\tREQUESTS\tRPS\tERRORS\tERROR RATE\tP50\tP90\tP99\tMAX\t")
+	for _, e := range report.Endpoints {
+		fmt.Fprintf(w, "%s\t%d\t%.1f\t%d\t%.2f%%\t%v\t%v\t%v\t%v\t\n", e.Endpoint, e.Requests, e.RPS, e.Errors, e.ErrorRate*100,
+			e.P50.Round(time.Microsecond), e.P90.Round(time.Microsecond), e.P99.Round(time.Microsecond), e.Max.Round(time.Microsecond))
+	}
+	_ = w.Flush()
+
+	if len(report.ErrorSamples) > 0 {
+		fmt.Println("\nerrors:")
+		var samples []string
+		for sample := range report.ErrorSamples {
+			samples = append(samples, sample)
+		}
+		sort.Strings(samples)
+		for _, sample := range samples {
+			fmt.Printf("  %6d  %s\n", report.ErrorSamples[sample], sample)
+		}
+	}
+	fmt.Printf("\nran for %v\n", report.Duration.Round(time.Millisecond))
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/YiniXu9506/devconG/config"
+	"github.com/YiniXu9506/devconG/migrate"
+	"github.com/YiniXu9506/devconG/utils"
+)
+
+const migrateUsage = `usage: devcon [flags] migrate <command>
+
+commands:
+  status      list the migrations and whether they are applied
+  up [n]      apply all pending migrations, or the next n
+  down [n]    revert the last applied migration, or the last n`
+
+// runMigrate runs `migrate status|up|down` against the primary database and the cloud database if it is configured
+func runMigrate(configManager *config.Manager, args []string) int {
+	cfg := configManager.Get()
+	if len(args) == 0 || len(args) > 2 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	action := args[0]
+	steps := 0
+	if action == "down" {
+		steps = 1
+	}
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n <= 0 || action == "status" {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return 2
+		}
+		steps = n
+	}
+	if action != "status" && action != "up" && action != "down" {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	dbConfigs := map[string]config.DBConfig{"db": cfg.DB}
+	names := []string{"db"}
+	if cfg.CloudDB.Enabled() {
+		dbConfigs["cloud_db"] = cfg.CloudDB
+		names = append(names, "cloud_db")
+	}
+
+	for _, name := range names {
+		db, err := utils.Open(dbConfigs[name])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: failed to connect database: %v\n", name, err)
+			return 1
+		}
+		defer utils.Close(db)
+		migrator, err := migrate.New(db)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			return 1
+		}
+		fmt.Printf("%s (%s):\n", name, migrator.Dialect())
+
+		switch action {
+		case "status":
+			statuses, err := migrator.Status()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+				return 1
+			}
+			printMigrationStatus(statuses)
+		case "up", "down":
+			var done []migrate.Migration
+			if action == "up" {
+				done, err = migrator.Up(steps)
+			} else {
+				done, err = migrator.Down(steps)
+			}
+			for _, migration := range done {
+				fmt.Printf("  %s %04d_%s\n", action, migration.Version, migration.Name)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+				return 1
+			}
+			if len(done) == 0 {
+				fmt.Println("  nothing to do")
+			}
+		}
+	}
+	return 0
+}
+
+func printMigrationStatus(statuses []migrate.Status) {
+	w := tabwriter.NewWriter(os.Stdout, 2, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "  VERSION\tNAME\tAPPLIED AT")
+	for _, status := range statuses {
+		appliedAt := "pending"
+		if status.Applied {
+			appliedAt = time.Unix(status.ApplyTime, 0).Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "  %04d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+	}
+	_ = w.Flush()
+}
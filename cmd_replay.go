@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/YiniXu9506/devconG/config"
+	"github.com/YiniXu9506/devconG/traffic"
+)
+
+// runReplay sends the requests of a record file to a server at the recorded pace scaled by --speed
+func runReplay(configManager *config.Manager, args []string) int {
+	cfg := configManager.Get()
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	file := flags.String("file", cfg.Record.File, "record file written with record.enabled")
+	target := flags.String("target", fmt.Sprintf("http://127.0.0.1:%d", cfg.Server.ListenPort), "base url of the server")
+	speed := flags.Float64("speed", 1, "pace of the replay, 5 sends the requests five times faster than recorded")
+	concurrency := flags.Int("concurrency", 200, "requests in flight at most")
+	keepIDs := flags.Bool("keep-ids", false, "send the recorded phrase ids instead of mapping them onto the wall of the target")
+	event := flags.String("event", "", "slug of the event to send all requests to, the recorded events by default")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "replay:", err)
+		return 2
+	}
+	defer f.Close()
+
+	// stop early on ctrl-c and still print the report
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Fprintf(os.Stderr, "replaying %s against %s at %gx\n", *file, *target, *speed)
+	report, err := traffic.Replay(ctx, f, traffic.ReplayOptions{
+		Target:        *target,
+		Speed:         *speed,
+		Concurrency:   *concurrency,
+		SessionSecret: cfg.Auth.SessionSecret,
+		KeepPhraseIDs: *keepIDs,
+		Event:         *event,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "replay:", err)
+		return 2
+	}
+	printLoadReport(report.Report)
+	fmt.Printf("replayed %d requests, %d late, max lag %v\n", report.Requests, report.Late, report.MaxLag.Round(time.Millisecond))
+
+	for _, endpoint := range report.Endpoints {
+		if endpoint.Errors > 0 {
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/YiniXu9506/devconG/config"
+	"github.com/YiniXu9506/devconG/utils"
+	"github.com/YiniXu9506/devconG/webhook"
+)
+
+// runResetRound ends the round of an event with round.ended and deletes its clicks, phrases stay on the wall with no clicks
+func runResetRound(configManager *config.Manager, args []string) int {
+	flags := flag.NewFlagSet("reset-round", flag.ContinueOnError)
+	round := flags.String("round", "", "name of the ending round, round.ended is sent with its clicks before they are deleted")
+	yes := flags.Bool("yes", false, "delete the clicks, without it nothing is changed")
+	eventSlug := flags.String("event", "", "slug of the event of the round, the default event by default")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	dbs, st := connect(configManager.Get())
+	defer utils.Close(dbs...)
+
+	eventID, err := lookupEvent(dbs[0], *eventSlug)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "reset-round:", err)
+		return 1
+	}
+	st = st.Event(eventID)
+
+	total, err := st.Stats.TotalClicks()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "reset-round:", err)
+		return 1
+	}
+	if !*yes {
+		fmt.Fprintf(os.Stderr, "this deletes all %d clicks, run again with --yes to reset the round\n", total)
+		return 1
+	}
+
+	if *round != "" {
+		dispatcher := webhook.NewDispatcher(dbs[0], configManager)
+		// the event is queued, the delivery workers of the servers send it
+		ended, err := dispatcher.EndRound(context.Background(), eventID, *round)
+		dispatcher.Stop()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "reset-round: end round:", err)
+			return 1
+		}
+		if ended {
+			fmt.Printf("round %s ended with %d clicks\n", *round, total)
+		} else {
+			fmt.Printf("round %s had already ended\n", *round)
+		}
+	}
+
+	deleted, err := st.Clicks.Reset()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "reset-round:", err)
+		return 1
+	}
+	fmt.Printf("deleted %d click records\n", deleted)
+	return 0
+}
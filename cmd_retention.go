@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/YiniXu9506/devconG/config"
+	"github.com/YiniXu9506/devconG/retention"
+	"github.com/YiniXu9506/devconG/utils"
+)
+
+// runRetention compacts the click records older than retention.days once, whether or not retention.enabled is set
+func runRetention(configManager *config.Manager, args []string) int {
+	cfg := configManager.Get().Retention
+	flags := flag.NewFlagSet("retention", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "report what would be compacted without changing anything")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	dbs, _ := connect(configManager.Get())
+	defer utils.Close(dbs...)
+
+	// a run stopped with ctrl-c keeps the batches committed so far, the next run resumes
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	now := time.Now()
+	plan, err := retention.Preview(ctx, dbs[0], cfg, now)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "retention:", err)
+		return 1
+	}
+	fmt.Printf("click records before %s (%d days): %d of %d clicks\n", formatTime(plan.Cutoff), cfg.Days, plan.Records, plan.Clicks)
+	if plan.Records > 0 {
+		fmt.Printf("  clicked from %s to %s\n", formatTime(plan.MinClickTime), formatTime(plan.MaxClickTime))
+		fmt.Printf("  compact into %d rollups of %ds in %d batches of %d\n", plan.Rollups, cfg.BucketSeconds, plan.Batches, cfg.BatchSize)
+		if cfg.Action == config.RetentionActionArchive {
+			fmt.Printf("  archive to %s, then delete\n", cfg.ArchiveDir)
+		} else {
+			fmt.Println("  delete without an archive")
+		}
+	}
+	fmt.Printf("rollups: %d, batches compacted by earlier runs: %d\n", plan.ExistingRollups, plan.ArchivedBatches)
+	if *dryRun || plan.Records == 0 {
+		return 0
+	}
+
+	start := time.Now()
+	result, err := retention.Run(ctx, dbs[0], cfg, now)
+	fmt.Printf("compacted %d click records of %d clicks into %d rollups in %d batches in %v\n",
+		result.Records, result.Clicks, result.Rollups, result.Batches, time.Since(start).Round(time.Millisecond))
+	if len(result.Files) > 0 {
+		fmt.Printf("archived to %d files in %s\n", len(result.Files), cfg.ArchiveDir)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "retention:", err)
+		return 1
+	}
+	return 0
+}
+
+func formatTime(t int64) string {
+	return time.Unix(t, 0).Format("2006-01-02 15:04:05")
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/YiniXu9506/devconG/config"
+	"github.com/YiniXu9506/devconG/seed"
+	"github.com/YiniXu9506/devconG/utils"
+)
+
+// runSeed generates users, phrases and clicks of an event into the primary database
+func runSeed(configManager *config.Manager, args []string) int {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	phrases := flags.Int("phrases", 100, "phrases to generate")
+	clicks := flags.Int("clicks", 1000, "click records to generate")
+	users := flags.Int("users", 50, "users to generate")
+	seedValue := flags.Int64("seed", 1, "seed of the random generator, the same seed generates the same data")
+	groups := flags.Int("groups", 5, "groups the users and phrases belong to")
+	span := flags.Duration("span", 3*time.Hour, "time the generated activity spans")
+	end := flags.Int64("end", 0, "unix time the activity ends at, now by default")
+	eventSlug := flags.String("event", "", "slug of the event to seed, the default event by default")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	opts := seed.Options{
+		Phrases:  *phrases,
+		Clicks:   *clicks,
+		Users:    *users,
+		Seed:     *seedValue,
+		Groups:   *groups,
+		End:      time.Now(),
+		Duration: *span,
+	}
+	if *end > 0 {
+		opts.End = time.Unix(*end, 0)
+	}
+
+	dbs, st := connect(configManager.Get())
+	defer utils.Close(dbs...)
+
+	eventID, err := lookupEvent(dbs[0], *eventSlug)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "seed:", err)
+		return 1
+	}
+
+	start := time.Now()
+	result, err := seed.Generate(st.Event(eventID), opts)
+	fmt.Printf("seeded %d users, %d phrases and %d clicks in %v\n", result.Users, result.Phrases, result.Clicks, time.Since(start).Round(time.Millisecond))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "seed:", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/YiniXu9506/devconG/config"
+	"github.com/YiniXu9506/devconG/notify"
+	"github.com/YiniXu9506/devconG/retention"
+	"github.com/YiniXu9506/devconG/service"
+	"github.com/YiniXu9506/devconG/utils"
+	"github.com/YiniXu9506/devconG/webhook"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-contrib/pprof"
+	ginzap "github.com/gin-contrib/zap"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// runServe serves the APIs until SIGINT or SIGTERM
+func runServe(configManager *config.Manager, args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "serve takes no arguments, got %v\n", args)
+		return 2
+	}
+	cfg := configManager.Get()
+	zap.L().Sugar().Infof("loaded config:\n%v", cfg)
+
+	// viper runs each time a change occurs.
+	configManager.Watch()
+
+	r := gin.New()
+	r.Use(cors.Default())
+	pprof.Register(r)
+
+	r.Use(cors.Default())
+	//r.Use(ginzap.Ginzap(zap.L(), time.RFC3339, true))
+	r.Use(ginzap.RecoveryWithZap(zap.L(), true))
+
+	dbs, st := connect(cfg)
+	service := service.NewService(st, configManager, service.Workers{
+		Notifier:  notify.NewHub(dbs[0], configManager, notify.NewChannels(configManager)),
+		Webhooks:  webhook.NewDispatcher(dbs[0], configManager),
+		Retention: retention.NewJob(dbs[0], configManager),
+	})
+	service.Start(r)
+
+	srv := &http.Server{
+		Addr:    fmt.Sprintf(":%d", cfg.Server.ListenPort),
+		Handler: r,
+	}
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			zap.L().Sugar().Fatalf("listen: %v", err)
+		}
+	}()
+
+	// wait for interrupt signal to gracefully shutdown the server
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-quit
+	zap.L().Sugar().Infof("received %v, shutting down server...", sig)
+
+	// fail readiness first and give the load balancer time to notice, then drain in-flight requests
+	service.Drain()
+	time.Sleep(time.Duration(cfg.Server.DrainSeconds) * time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Server.ShutdownTimeoutSeconds)*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		zap.L().Sugar().Error("Error! Server forced to shutdown: ", err)
+	}
+
+	// stop cache goroutine and close db pools
+	service.Stop()
+	utils.Close(dbs...)
+
+	zap.L().Info("server exited")
+	return 0
+}
@@ -0,0 +1,711 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+	"go.uber.org/zap/zapcore"
+)
+
+// environment variables override the config file, e.g. DEVCON_DB_PASSWORD overrides db.password
+const envPrefix = "DEVCON"
+
+const redactedValue = "******"
+
+type ServerConfig struct {
+	ListenPort             int `mapstructure:"listen_port" json:"listen_port"`
+	ShutdownTimeoutSeconds int `mapstructure:"shutdown_timeout_seconds" json:"shutdown_timeout_seconds"`
+	// /readyz fails this long before the listener closes, so the load balancer sees the drain first
+	DrainSeconds int `mapstructure:"drain_seconds" json:"drain_seconds"`
+}
+
+// storage drivers
+const (
+	DBDriverMySQL  = "mysql"
+	DBDriverSQLite = "sqlite"
+)
+
+type DBConfig struct {
+	// mysql for TiDB and MySQL, sqlite for a local file
+	Driver string `mapstructure:"driver" json:"driver"`
+	// database file of the sqlite driver
+	Path     string `mapstructure:"path" json:"path"`
+	Host     string `mapstructure:"host" json:"host"`
+	Port     int    `mapstructure:"port" json:"port"`
+	User     string `mapstructure:"user" json:"user"`
+	Password string `mapstructure:"password" json:"password"`
+	Database string `mapstructure:"database" json:"database"`
+	// extra DSN parameters, e.g. charset=utf8mb4&parseTime=True&loc=Local
+	Params string `mapstructure:"params" json:"params"`
+
+	MaxIdleConns           int `mapstructure:"max_idle_conns" json:"max_idle_conns"`
+	MaxOpenConns           int `mapstructure:"max_open_conns" json:"max_open_conns"`
+	ConnMaxLifetimeSeconds int `mapstructure:"conn_max_lifetime_seconds" json:"conn_max_lifetime_seconds"`
+
+	// apply pending schema migrations at startup, turn it off to run `migrate up` before deploying instead
+	AutoMigrate bool `mapstructure:"auto_migrate" json:"auto_migrate"`
+}
+
+// share of newest and hot phrases in the mix, the rest are random phrases
+type MixConfig struct {
+	NewestRatio float64 `mapstructure:"newest_ratio" json:"newest_ratio"`
+	TopRatio    float64 `mapstructure:"top_ratio" json:"top_ratio"`
+}
+
+type CacheConfig struct {
+	// how often the phrase cache is rebuilt
+	IntervalSeconds int `mapstructure:"interval_seconds" json:"interval_seconds"`
+	// how many phrases are picked when rebuilding the cache
+	Size int `mapstructure:"size" json:"size"`
+	// mix used to pick phrases into the cache and for the default display profile
+	MixConfig `mapstructure:",squash"`
+}
+
+type SizeThreshold struct {
+	Clicks int `mapstructure:"clicks" json:"clicks"`
+	Size   int `mapstructure:"size" json:"size"`
+}
+
+type SpeedThreshold struct {
+	Clicks int `mapstructure:"clicks" json:"clicks"`
+	Speed  int `mapstructure:"speed" json:"speed"`
+}
+
+// thresholds mapping the clicks of a phrase to its font size and scrolling speed
+type AppearanceTables struct {
+	LtClicksSize  []SizeThreshold  `mapstructure:"lt_clicks_size" json:"lt_clicks_size,omitempty"`
+	LtClicksSpeed []SpeedThreshold `mapstructure:"lt_clicks_speed" json:"lt_clicks_speed,omitempty"`
+}
+
+// settings returned to the H5 clients by /h5_settings
+type H5Config struct {
+	PollingInterval  int `mapstructure:"polling_interval" json:"polling_interval"`
+	PhrasesLimit     int `mapstructure:"phrases_limit" json:"phrases_limit"`
+	AppearanceTables `mapstructure:",squash"`
+	// interpolate linearly between thresholds instead of stepping from one to the next
+	Interpolate bool `mapstructure:"interpolate" json:"interpolate"`
+	// tables overriding the default ones for phrases whose hot group is the key
+	Groups map[string]AppearanceTables `mapstructure:"groups" json:"groups,omitempty"`
+}
+
+// DefaultProfile is the display profile used when clients don't ask for one
+const DefaultProfile = "default"
+
+// display settings for one kind of screen, zero fields inherit from the default profile
+// except interpolate which is set per profile
+type ProfileConfig struct {
+	H5Config `mapstructure:",squash"`
+	// mix of newest, hot and random phrases, inherited when both ratios are zero
+	Mix MixConfig `mapstructure:"mix" json:"mix"`
+}
+
+// outbound notification channels
+const (
+	NotifyChannelLog     = "log"
+	NotifyChannelWebhook = "webhook"
+	NotifyChannelWeChat  = "wechat"
+)
+
+type WeChatSubscribeConfig struct {
+	// subscribe message template by event, events without a template are not sent
+	TemplateIDs map[string]string `mapstructure:"template_ids" json:"template_ids"`
+	// mini program page opened from the message
+	Page string `mapstructure:"page" json:"page"`
+}
+
+type NotifyConfig struct {
+	// outbound channels besides the in-app inbox
+	Channels             []string              `mapstructure:"channels" json:"channels"`
+	WebhookURL           string                `mapstructure:"webhook_url" json:"webhook_url"`
+	WeChatSubscribe      WeChatSubscribeConfig `mapstructure:"wechat_subscribe" json:"wechat_subscribe"`
+	MaxAttempts          int                   `mapstructure:"max_attempts" json:"max_attempts"`
+	RetryIntervalSeconds int                   `mapstructure:"retry_interval_seconds" json:"retry_interval_seconds"`
+}
+
+type ModerationConfig struct {
+	// how long a reviewer holds claimed phrases
+	LeaseSeconds int `mapstructure:"lease_seconds" json:"lease_seconds"`
+	// most phrases claimed at once
+	MaxClaim int `mapstructure:"max_claim" json:"max_claim"`
+	// reasons a reviewer picks from when rejecting a phrase
+	ReasonCodes []string `mapstructure:"reason_codes" json:"reason_codes"`
+}
+
+// DefaultGroupCount is the number of groups in the click distributions of an event without group_count
+const DefaultGroupCount = 5
+
+// settings stored with an event, zero fields inherit from the config file
+type EventConfig struct {
+	// display settings the profiles of the event inherit, in place of the h5 settings and the cache mix
+	ProfileConfig
+	// overrides the interpolate setting of the default profile when set
+	Interpolate *bool `json:"interpolate,omitempty"`
+	// groups of the event, phrases and clicks must name a group from 1 to it when set
+	GroupCount int              `json:"group_count,omitempty"`
+	Moderation ModerationConfig `json:"moderation"`
+}
+
+// capture of anonymized requests to a local file, for replaying them against a staging instance
+type RecordConfig struct {
+	// can be switched on and off while serving
+	Enabled bool   `mapstructure:"enabled" json:"enabled"`
+	File    string `mapstructure:"file" json:"file"`
+	// routes recorded
+	Paths []string `mapstructure:"paths" json:"paths"`
+}
+
+// actions of the retention job on click records older than retention.days
+const (
+	RetentionActionArchive = "archive"
+	RetentionActionDelete  = "delete"
+)
+
+// compaction of old click records into rollups, so analytic queries scan fewer rows
+type RetentionConfig struct {
+	// the job runs every interval_seconds while serving, the retention command runs it once
+	Enabled         bool `mapstructure:"enabled" json:"enabled"`
+	Days            int  `mapstructure:"days" json:"days"`
+	IntervalSeconds int  `mapstructure:"interval_seconds" json:"interval_seconds"`
+	// clicks of a user on a phrase within a bucket are compacted into one rollup
+	BucketSeconds int `mapstructure:"bucket_seconds" json:"bucket_seconds"`
+	// click records compacted per transaction
+	BatchSize int `mapstructure:"batch_size" json:"batch_size"`
+	// archive writes the compacted records to gzipped json lines in archive_dir before deleting them,
+	// delete only deletes them
+	Action     string `mapstructure:"action" json:"action"`
+	ArchiveDir string `mapstructure:"archive_dir" json:"archive_dir"`
+}
+
+// delivery of outbound webhooks to event organizers' systems
+type WebhooksConfig struct {
+	MaxAttempts          int `mapstructure:"max_attempts" json:"max_attempts"`
+	RetryIntervalSeconds int `mapstructure:"retry_interval_seconds" json:"retry_interval_seconds"`
+	TimeoutSeconds       int `mapstructure:"timeout_seconds" json:"timeout_seconds"`
+}
+
+type LogConfig struct {
+	Level  string `mapstructure:"level" json:"level"`
+	Format string `mapstructure:"format" json:"format"`
+	File   string `mapstructure:"file" json:"file"`
+}
+
+// identity providers used by /login
+const (
+	IdentityProviderWeChat = "wechat"
+	IdentityProviderFake   = "fake"
+)
+
+type WeChatConfig struct {
+	AppID     string `mapstructure:"app_id" json:"app_id"`
+	AppSecret string `mapstructure:"app_secret" json:"app_secret"`
+}
+
+type AuthConfig struct {
+	// token required by the management portal APIs
+	AdminToken string `mapstructure:"admin_token" json:"admin_token"`
+	// key signing the session tokens of mini program users
+	SessionSecret     string `mapstructure:"session_secret" json:"session_secret"`
+	SessionTTLSeconds int    `mapstructure:"session_ttl_seconds" json:"session_ttl_seconds"`
+	// wechat, or fake which accepts any code as open_id for local development
+	IdentityProvider string       `mapstructure:"identity_provider" json:"identity_provider"`
+	WeChat           WeChatConfig `mapstructure:"wechat" json:"wechat"`
+}
+
+type Config struct {
+	Server ServerConfig `mapstructure:"server" json:"server"`
+	DB     DBConfig     `mapstructure:"db" json:"db"`
+	// optional second database, disabled when host is empty
+	CloudDB DBConfig    `mapstructure:"cloud_db" json:"cloud_db"`
+	Cache   CacheConfig `mapstructure:"cache" json:"cache"`
+	H5      H5Config    `mapstructure:"h5" json:"h5"`
+	// display profiles by name, the default profile is made of the h5 settings and the cache mix
+	Profiles   map[string]ProfileConfig `mapstructure:"profiles" json:"profiles,omitempty"`
+	Notify     NotifyConfig             `mapstructure:"notify" json:"notify"`
+	Webhooks   WebhooksConfig           `mapstructure:"webhooks" json:"webhooks"`
+	Moderation ModerationConfig         `mapstructure:"moderation" json:"moderation"`
+	Record     RecordConfig             `mapstructure:"record" json:"record"`
+	Retention  RetentionConfig          `mapstructure:"retention" json:"retention"`
+	Log        LogConfig                `mapstructure:"log" json:"log"`
+	Auth       AuthConfig               `mapstructure:"auth" json:"auth"`
+}
+
+func setDefaults(v *viper.Viper) {
+	v.SetDefault("server.listen_port", 8080)
+	v.SetDefault("server.shutdown_timeout_seconds", 15)
+	v.SetDefault("server.drain_seconds", 5)
+
+	for _, prefix := range []string{"db", "cloud_db"} {
+		v.SetDefault(prefix+".driver", DBDriverMySQL)
+		v.SetDefault(prefix+".path", "./devcon.db")
+		v.SetDefault(prefix+".auto_migrate", true)
+		v.SetDefault(prefix+".host", "")
+		v.SetDefault(prefix+".port", 4000)
+		v.SetDefault(prefix+".user", "root")
+		v.SetDefault(prefix+".password", "")
+		v.SetDefault(prefix+".database", "test")
+		v.SetDefault(prefix+".params", "charset=utf8mb4&parseTime=True&loc=Local")
+		v.SetDefault(prefix+".max_idle_conns", 10)
+		v.SetDefault(prefix+".max_open_conns", 500)
+		v.SetDefault(prefix+".conn_max_lifetime_seconds", 3600)
+	}
+	v.SetDefault("db.host", "127.0.0.1")
+	v.SetDefault("cloud_db.port", 0)
+	v.SetDefault("cloud_db.path", "")
+
+	v.SetDefault("cache.interval_seconds", 3)
+	v.SetDefault("cache.size", 30)
+	v.SetDefault("cache.newest_ratio", 0.3)
+	v.SetDefault("cache.top_ratio", 0.3)
+
+	v.SetDefault("h5.polling_interval", 10)
+	v.SetDefault("h5.phrases_limit", 100)
+	v.SetDefault("h5.interpolate", false)
+
+	v.SetDefault("notify.channels", []string{})
+	v.SetDefault("notify.webhook_url", "")
+	v.SetDefault("notify.wechat_subscribe.page", "")
+	v.SetDefault("notify.max_attempts", 5)
+	v.SetDefault("notify.retry_interval_seconds", 30)
+
+	v.SetDefault("webhooks.max_attempts", 8)
+	v.SetDefault("webhooks.retry_interval_seconds", 10)
+	v.SetDefault("webhooks.timeout_seconds", 10)
+
+	v.SetDefault("moderation.lease_seconds", 300)
+	v.SetDefault("moderation.max_claim", 50)
+	v.SetDefault("moderation.reason_codes", []string{"spam", "offensive", "duplicate", "off_topic", "other"})
+
+	v.SetDefault("record.enabled", false)
+	v.SetDefault("record.file", "./traffic.jsonl")
+	v.SetDefault("record.paths", []string{"/phrases", "/phrase", "/phrase_hot"})
+
+	v.SetDefault("retention.enabled", false)
+	v.SetDefault("retention.days", 30)
+	v.SetDefault("retention.interval_seconds", 3600)
+	v.SetDefault("retention.bucket_seconds", 3600)
+	v.SetDefault("retention.batch_size", 5000)
+	v.SetDefault("retention.action", RetentionActionArchive)
+	v.SetDefault("retention.archive_dir", "./archive")
+
+	v.SetDefault("log.level", "info")
+	v.SetDefault("log.format", "console")
+	v.SetDefault("log.file", "./server.log")
+
+	v.SetDefault("auth.admin_token", "")
+	v.SetDefault("auth.session_secret", "")
+	v.SetDefault("auth.session_ttl_seconds", 7*24*3600)
+	v.SetDefault("auth.identity_provider", IdentityProviderWeChat)
+	v.SetDefault("auth.wechat.app_id", "")
+	v.SetDefault("auth.wechat.app_secret", "")
+}
+
+// Loader reads the config file and applies environment variable and flag overrides
+type Loader struct {
+	v *viper.Viper
+}
+
+// NewLoader reads the json config file named fileName (without extension) from the working directory.
+// overrides, keyed by config path such as "db.host", take precedence over both the file and the environment.
+func NewLoader(fileName string, overrides map[string]interface{}) (*Loader, error) {
+	v := viper.New()
+
+	v.SetConfigName(fileName) // name of config file (without extension)
+	v.SetConfigType("json")   // REQUIRED if the config file does not have the extension in the name
+	v.AddConfigPath("./")     // path to look for the config file in
+
+	setDefaults(v)
+
+	v.SetEnvPrefix(envPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+
+	if err := v.ReadInConfig(); err != nil {
+		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
+			return nil, fmt.Errorf("config file %q not found: %v", fileName, err)
+		}
+		return nil, fmt.Errorf("read config file %q: %v", fileName, err)
+	}
+
+	for key, value := range overrides {
+		v.Set(key, value)
+	}
+
+	return &Loader{v: v}, nil
+}
+
+// Load decodes and validates the current settings
+func (l *Loader) Load() (*Config, error) {
+	var cfg Config
+	if err := l.v.Unmarshal(&cfg); err != nil {
+		return nil, fmt.Errorf("decode config: %v", err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+// Watch calls fn each time the config file changes
+func (l *Loader) Watch(fn func(name string)) {
+	l.v.OnConfigChange(func(e fsnotify.Event) {
+		fn(e.Name)
+	})
+	l.v.WatchConfig()
+}
+
+// Validate reports every invalid setting at once
+func (cfg *Config) Validate() error {
+	var errs []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(cfg.Server.ListenPort > 0 && cfg.Server.ListenPort <= 65535, "server.listen_port must be between 1 and 65535, got %d", cfg.Server.ListenPort)
+	check(cfg.Server.ShutdownTimeoutSeconds > 0, "server.shutdown_timeout_seconds must be positive, got %d", cfg.Server.ShutdownTimeoutSeconds)
+	check(cfg.Server.DrainSeconds >= 0, "server.drain_seconds must not be negative, got %d", cfg.Server.DrainSeconds)
+
+	errs = append(errs, cfg.DB.validate("db")...)
+	if cfg.CloudDB.Enabled() {
+		errs = append(errs, cfg.CloudDB.validate("cloud_db")...)
+	}
+
+	check(cfg.Cache.IntervalSeconds > 0, "cache.interval_seconds must be positive, got %d", cfg.Cache.IntervalSeconds)
+	check(cfg.Cache.Size > 0, "cache.size must be positive, got %d", cfg.Cache.Size)
+	check(cfg.Cache.NewestRatio >= 0 && cfg.Cache.TopRatio >= 0 && cfg.Cache.NewestRatio+cfg.Cache.TopRatio <= 1,
+		"cache.newest_ratio and cache.top_ratio must be non-negative and sum up to at most 1, got %v and %v", cfg.Cache.NewestRatio, cfg.Cache.TopRatio)
+
+	errs = append(errs, cfg.H5.validate("h5")...)
+	for name := range cfg.Profiles {
+		if _, err := cfg.Profile(name); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	for _, channel := range cfg.Notify.Channels {
+		switch channel {
+		case NotifyChannelLog:
+		case NotifyChannelWebhook:
+			check(cfg.Notify.WebhookURL != "", "notify.webhook_url is required by the webhook channel")
+		case NotifyChannelWeChat:
+			check(cfg.Auth.WeChat.AppID != "" && cfg.Auth.WeChat.AppSecret != "", "auth.wechat.app_id and auth.wechat.app_secret are required by the wechat channel")
+		default:
+			check(false, "notify.channels must be log, webhook or wechat, got %q", channel)
+		}
+	}
+	check(cfg.Notify.MaxAttempts > 0, "notify.max_attempts must be positive, got %d", cfg.Notify.MaxAttempts)
+	check(cfg.Notify.RetryIntervalSeconds > 0, "notify.retry_interval_seconds must be positive, got %d", cfg.Notify.RetryIntervalSeconds)
+
+	check(cfg.Webhooks.MaxAttempts > 0, "webhooks.max_attempts must be positive, got %d", cfg.Webhooks.MaxAttempts)
+	check(cfg.Webhooks.RetryIntervalSeconds > 0, "webhooks.retry_interval_seconds must be positive, got %d", cfg.Webhooks.RetryIntervalSeconds)
+	check(cfg.Webhooks.TimeoutSeconds > 0, "webhooks.timeout_seconds must be positive, got %d", cfg.Webhooks.TimeoutSeconds)
+
+	check(cfg.Moderation.LeaseSeconds > 0, "moderation.lease_seconds must be positive, got %d", cfg.Moderation.LeaseSeconds)
+	check(cfg.Moderation.MaxClaim > 0, "moderation.max_claim must be positive, got %d", cfg.Moderation.MaxClaim)
+	check(len(cfg.Moderation.ReasonCodes) > 0, "moderation.reason_codes must not be empty")
+
+	check(!cfg.Record.Enabled || cfg.Record.File != "", "record.file is required when record.enabled is set")
+
+	check(cfg.Retention.Days > 0, "retention.days must be positive, got %d", cfg.Retention.Days)
+	check(cfg.Retention.IntervalSeconds > 0, "retention.interval_seconds must be positive, got %d", cfg.Retention.IntervalSeconds)
+	check(cfg.Retention.BucketSeconds > 0, "retention.bucket_seconds must be positive, got %d", cfg.Retention.BucketSeconds)
+	check(cfg.Retention.BatchSize > 0, "retention.batch_size must be positive, got %d", cfg.Retention.BatchSize)
+	switch cfg.Retention.Action {
+	case RetentionActionArchive:
+		check(cfg.Retention.ArchiveDir != "", "retention.archive_dir is required by the archive action")
+	case RetentionActionDelete:
+	default:
+		check(false, "retention.action must be archive or delete, got %q", cfg.Retention.Action)
+	}
+
+	var level zapcore.Level
+	check(level.UnmarshalText([]byte(cfg.Log.Level)) == nil, "log.level %q is not a valid level", cfg.Log.Level)
+	check(cfg.Log.Format == "json" || cfg.Log.Format == "console", "log.format must be json or console, got %q", cfg.Log.Format)
+	check(cfg.Log.File != "", "log.file is required")
+
+	check(cfg.Auth.AdminToken != "", "auth.admin_token is required")
+	check(len(cfg.Auth.SessionSecret) >= 16, "auth.session_secret must be at least 16 characters")
+	check(cfg.Auth.SessionTTLSeconds > 0, "auth.session_ttl_seconds must be positive, got %d", cfg.Auth.SessionTTLSeconds)
+	switch cfg.Auth.IdentityProvider {
+	case IdentityProviderWeChat:
+		check(cfg.Auth.WeChat.AppID != "" && cfg.Auth.WeChat.AppSecret != "", "auth.wechat.app_id and auth.wechat.app_secret are required by the wechat identity provider")
+	case IdentityProviderFake:
+	default:
+		check(false, "auth.identity_provider must be wechat or fake, got %q", cfg.Auth.IdentityProvider)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config:\n  - %s", strings.Join(errs, "\n  - "))
+	}
+	return nil
+}
+
+func (c DBConfig) validate(prefix string) []string {
+	var errs []string
+	switch c.Driver {
+	case DBDriverMySQL:
+		errs = append(errs, c.validateMySQL(prefix)...)
+	case DBDriverSQLite:
+		if c.Path == "" {
+			errs = append(errs, fmt.Sprintf("%s.path is required by the sqlite driver", prefix))
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("%s.driver must be mysql or sqlite, got %q", prefix, c.Driver))
+	}
+	// migrations hold their lock on one connection and run on another
+	if c.MaxOpenConns < 2 {
+		errs = append(errs, fmt.Sprintf("%s.max_open_conns must be at least 2, got %d", prefix, c.MaxOpenConns))
+	}
+	if c.MaxIdleConns < 0 || c.MaxIdleConns > c.MaxOpenConns {
+		errs = append(errs, fmt.Sprintf("%s.max_idle_conns must be between 0 and max_open_conns, got %d", prefix, c.MaxIdleConns))
+	}
+	if c.ConnMaxLifetimeSeconds < 0 {
+		errs = append(errs, fmt.Sprintf("%s.conn_max_lifetime_seconds must not be negative, got %d", prefix, c.ConnMaxLifetimeSeconds))
+	}
+	return errs
+}
+
+func (c DBConfig) validateMySQL(prefix string) []string {
+	var errs []string
+	if c.Host == "" {
+		errs = append(errs, fmt.Sprintf("%s.host is required", prefix))
+	}
+	if c.Port <= 0 || c.Port > 65535 {
+		errs = append(errs, fmt.Sprintf("%s.port must be between 1 and 65535, got %d", prefix, c.Port))
+	}
+	if c.User == "" {
+		errs = append(errs, fmt.Sprintf("%s.user is required", prefix))
+	}
+	if c.Database == "" {
+		errs = append(errs, fmt.Sprintf("%s.database is required", prefix))
+	}
+	return errs
+}
+
+func (c H5Config) validate(prefix string) []string {
+	var errs []string
+	if c.PollingInterval <= 0 {
+		errs = append(errs, fmt.Sprintf("%s.polling_interval must be positive, got %d", prefix, c.PollingInterval))
+	}
+	if c.PhrasesLimit <= 0 {
+		errs = append(errs, fmt.Sprintf("%s.phrases_limit must be positive, got %d", prefix, c.PhrasesLimit))
+	}
+	if len(c.LtClicksSize) == 0 {
+		errs = append(errs, fmt.Sprintf("%s.lt_clicks_size must not be empty", prefix))
+	}
+	if len(c.LtClicksSpeed) == 0 {
+		errs = append(errs, fmt.Sprintf("%s.lt_clicks_speed must not be empty", prefix))
+	}
+	errs = append(errs, c.AppearanceTables.validate(prefix)...)
+	for group, tables := range c.Groups {
+		if _, err := strconv.Atoi(group); err != nil {
+			errs = append(errs, fmt.Sprintf("%s.groups key %q must be a group id", prefix, group))
+		}
+		errs = append(errs, tables.validate(fmt.Sprintf("%s.groups.%s", prefix, group))...)
+	}
+	return errs
+}
+
+// Profile returns the named display profile with inherited settings filled in
+func (cfg *Config) Profile(name string) (ProfileConfig, error) {
+	if name == "" {
+		name = DefaultProfile
+	}
+	profile, ok := cfg.Profiles[name]
+	if !ok && name != DefaultProfile {
+		return ProfileConfig{}, fmt.Errorf("unknown profile %q", name)
+	}
+
+	profile = profile.WithDefaults(ProfileConfig{H5Config: cfg.H5, Mix: cfg.Cache.MixConfig})
+	if err := profile.Validate("profiles." + name); err != nil {
+		return ProfileConfig{}, err
+	}
+	return profile, nil
+}
+
+// WithDefaults fills zero fields of the profile from def
+func (p ProfileConfig) WithDefaults(def ProfileConfig) ProfileConfig {
+	if p.PollingInterval == 0 {
+		p.PollingInterval = def.PollingInterval
+	}
+	if p.PhrasesLimit == 0 {
+		p.PhrasesLimit = def.PhrasesLimit
+	}
+	if len(p.LtClicksSize) == 0 {
+		p.LtClicksSize = def.LtClicksSize
+	}
+	if len(p.LtClicksSpeed) == 0 {
+		p.LtClicksSpeed = def.LtClicksSpeed
+	}
+	if p.Groups == nil {
+		p.Groups = def.Groups
+	}
+	if p.Mix.NewestRatio == 0 && p.Mix.TopRatio == 0 {
+		p.Mix = def.Mix
+	}
+	return p
+}
+
+// Validate checks a profile after inherited settings are filled in
+func (p ProfileConfig) Validate(prefix string) error {
+	errs := p.H5Config.validate(prefix)
+	if p.Mix.NewestRatio < 0 || p.Mix.TopRatio < 0 || p.Mix.NewestRatio+p.Mix.TopRatio > 1 {
+		errs = append(errs, fmt.Sprintf("%s.mix ratios must be non-negative and sum up to at most 1, got %v and %v", prefix, p.Mix.NewestRatio, p.Mix.TopRatio))
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n  - "))
+	}
+	return nil
+}
+
+// Display is the default display profile of the event, def is the default profile of the config file
+func (e EventConfig) Display(def ProfileConfig) ProfileConfig {
+	profile := e.ProfileConfig.WithDefaults(def)
+	profile.Interpolate = def.Interpolate
+	if e.Interpolate != nil {
+		profile.Interpolate = *e.Interpolate
+	}
+	return profile
+}
+
+// Groups is the number of groups of the event
+func (e EventConfig) Groups() int {
+	if e.GroupCount > 0 {
+		return e.GroupCount
+	}
+	return DefaultGroupCount
+}
+
+// HasGroup reports whether phrases and clicks can name the group, any group when group_count is not set
+func (e EventConfig) HasGroup(groupID int) bool {
+	return e.GroupCount == 0 || (groupID >= 1 && groupID <= e.GroupCount)
+}
+
+// WithDefaults fills zero fields of the moderation settings from def
+func (m ModerationConfig) WithDefaults(def ModerationConfig) ModerationConfig {
+	if m.LeaseSeconds == 0 {
+		m.LeaseSeconds = def.LeaseSeconds
+	}
+	if m.MaxClaim == 0 {
+		m.MaxClaim = def.MaxClaim
+	}
+	if len(m.ReasonCodes) == 0 {
+		m.ReasonCodes = def.ReasonCodes
+	}
+	return m
+}
+
+// Validate checks the settings of an event after inherited settings are filled in from the default
+// display profile and the moderation settings of the config file
+func (e EventConfig) Validate(prefix string, def ProfileConfig, moderation ModerationConfig) error {
+	var errs []string
+	if err := e.Display(def).Validate(prefix); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if e.GroupCount < 0 {
+		errs = append(errs, fmt.Sprintf("%s.group_count must not be negative, got %d", prefix, e.GroupCount))
+	}
+	m := e.Moderation.WithDefaults(moderation)
+	if m.LeaseSeconds <= 0 {
+		errs = append(errs, fmt.Sprintf("%s.moderation.lease_seconds must be positive, got %d", prefix, m.LeaseSeconds))
+	}
+	if m.MaxClaim <= 0 {
+		errs = append(errs, fmt.Sprintf("%s.moderation.max_claim must be positive, got %d", prefix, m.MaxClaim))
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n  - "))
+	}
+	return nil
+}
+
+// tables may be empty, the caller decides whether that falls back to other tables
+func (c AppearanceTables) validate(prefix string) []string {
+	var errs []string
+	for i, t := range c.LtClicksSize {
+		if i > 0 && t.Clicks <= c.LtClicksSize[i-1].Clicks {
+			errs = append(errs, fmt.Sprintf("%s.lt_clicks_size[%d].clicks must be greater than the previous threshold", prefix, i))
+		}
+		if t.Size <= 0 {
+			errs = append(errs, fmt.Sprintf("%s.lt_clicks_size[%d].size must be positive", prefix, i))
+		}
+	}
+	for i, t := range c.LtClicksSpeed {
+		if i > 0 && t.Clicks <= c.LtClicksSpeed[i-1].Clicks {
+			errs = append(errs, fmt.Sprintf("%s.lt_clicks_speed[%d].clicks must be greater than the previous threshold", prefix, i))
+		}
+		if t.Speed <= 0 {
+			errs = append(errs, fmt.Sprintf("%s.lt_clicks_speed[%d].speed must be positive", prefix, i))
+		}
+	}
+	return errs
+}
+
+// Enabled reports whether the database is configured
+func (c DBConfig) Enabled() bool {
+	if c.Driver == DBDriverSQLite {
+		return c.Path != ""
+	}
+	return c.Host != "" && c.Port > 0
+}
+
+// DSN builds the data source name of the driver
+func (c DBConfig) DSN() string {
+	if c.Driver == DBDriverSQLite {
+		// writers wait for each other instead of failing with SQLITE_BUSY, readers don't block the writer
+		return fmt.Sprintf("file:%s?_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate", c.Path)
+	}
+
+	credentials := c.User
+	if c.Password != "" {
+		credentials = fmt.Sprintf("%s:%s", c.User, c.Password)
+	}
+	return fmt.Sprintf("%s@tcp(%s:%d)/%s?%s", credentials, c.Host, c.Port, c.Database, c.Params)
+}
+
+// Redacted returns a copy of the config with credentials masked, safe to print
+func (cfg *Config) Redacted() *Config {
+	redacted := *cfg
+	redacted.DB.Password = redact(cfg.DB.Password)
+	redacted.CloudDB.Password = redact(cfg.CloudDB.Password)
+	redacted.Auth.AdminToken = redact(cfg.Auth.AdminToken)
+	redacted.Auth.SessionSecret = redact(cfg.Auth.SessionSecret)
+	redacted.Auth.WeChat.AppSecret = redact(cfg.Auth.WeChat.AppSecret)
+	redacted.Notify.WebhookURL = redactURL(cfg.Notify.WebhookURL)
+	return &redacted
+}
+
+func (cfg *Config) String() string {
+	var b strings.Builder
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(cfg.Redacted()); err != nil {
+		return fmt.Sprintf("<unprintable config: %v>", err)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return redactedValue
+}
+
+// redactURL keeps the scheme and the host of the url, its path and query often carry a token
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return redact(raw)
+	}
+	return u.Scheme + "://" + u.Host + "/" + redactedValue
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// testOverrides complete config.dev.json, which leaves the credentials to the environment
+var testOverrides = map[string]interface{}{
+	"db.driver":           DBDriverSQLite,
+	"auth.admin_token":    "test-admin-token",
+	"auth.session_secret": "test-session-secret",
+}
+
+func loadTestConfig(t *testing.T, overrides map[string]interface{}) (*Config, error) {
+	t.Helper()
+
+	merged := make(map[string]interface{})
+	for key, value := range testOverrides {
+		merged[key] = value
+	}
+	for key, value := range overrides {
+		merged[key] = value
+	}
+	loader, err := NewLoader("../config.dev", merged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loader.Load()
+}
+
+func TestLoad(t *testing.T) {
+	cfg, err := loadTestConfig(t, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DB.Driver != DBDriverSQLite || cfg.Auth.AdminToken != "test-admin-token" {
+		t.Fatalf("overrides not applied: driver %q, admin token %q", cfg.DB.Driver, cfg.Auth.AdminToken)
+	}
+	if cfg.Server.ListenPort != 8080 || cfg.Cache.Size != 30 {
+		t.Fatalf("file not read: listen port %d, cache size %d", cfg.Server.ListenPort, cfg.Cache.Size)
+	}
+}
+
+func TestLoadEnvironment(t *testing.T) {
+	os.Setenv("DEVCON_SERVER_LISTEN_PORT", "9090")
+	defer os.Unsetenv("DEVCON_SERVER_LISTEN_PORT")
+
+	cfg, err := loadTestConfig(t, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.ListenPort != 9090 {
+		t.Fatalf("got listen port %d, want 9090 from the environment", cfg.Server.ListenPort)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides map[string]interface{}
+		want      string
+	}{
+		{"listen port", map[string]interface{}{"server.listen_port": 70000}, "server.listen_port"},
+		{"admin token", map[string]interface{}{"auth.admin_token": ""}, "auth.admin_token is required"},
+		{"session secret", map[string]interface{}{"auth.session_secret": "short"}, "auth.session_secret"},
+		{"cache ratios", map[string]interface{}{"cache.newest_ratio": 0.8, "cache.top_ratio": 0.5}, "cache.newest_ratio"},
+		{"notify channel", map[string]interface{}{"notify.channels": []string{"pager"}}, "notify.channels"},
+		{"webhook channel", map[string]interface{}{"notify.channels": []string{"webhook"}}, "notify.webhook_url"},
+		{"retention action", map[string]interface{}{"retention.action": "drop"}, "retention.action"},
+		{"identity provider", map[string]interface{}{"auth.identity_provider": IdentityProviderWeChat}, "auth.wechat.app_id"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := loadTestConfig(t, test.overrides)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("got %v, want an error about %s", err, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateReportsAll(t *testing.T) {
+	_, err := loadTestConfig(t, map[string]interface{}{"server.listen_port": 0, "auth.admin_token": ""})
+	if err == nil || !strings.Contains(err.Error(), "server.listen_port") || !strings.Contains(err.Error(), "auth.admin_token") {
+		t.Fatalf("got %v, want both errors", err)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg, err := loadTestConfig(t, map[string]interface{}{
+		"db.password":        "db-password",
+		"notify.webhook_url": "https://hooks.example.com/services/T000/B000/secret-token?key=k",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	printed := cfg.String()
+	for _, secret := range []string{"db-password", "test-admin-token", "test-session-secret", "secret-token", "key=k"} {
+		if strings.Contains(printed, secret) {
+			t.Errorf("printed config holds %q", secret)
+		}
+	}
+	if redacted := cfg.Redacted().Notify.WebhookURL; redacted != "https://hooks.example.com/"+redactedValue {
+		t.Errorf("got webhook url %q, want the scheme and host kept", redacted)
+	}
+	if cfg.Auth.AdminToken != "test-admin-token" {
+		t.Errorf("Redacted changed the config")
+	}
+}
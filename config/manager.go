@@ -0,0 +1,103 @@
+package config
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Snapshot is one validated version of the config
+type Snapshot struct {
+	Config   *Config `json:"config"`
+	Version  uint64  `json:"version"`
+	LoadedAt int64   `json:"loaded_at"`
+}
+
+// Manager holds the effective config and swaps it atomically when the config file changes.
+// Server, database and log settings are only read at startup, changes to them are kept out
+// of the effective config until the process restarts. The other settings are read on each use,
+// or pushed to the components built from them by the subscribers.
+type Manager struct {
+	loader  *Loader
+	current atomic.Value // *Snapshot
+
+	// mu serializes reloads and guards subscribers
+	mu          sync.Mutex
+	subscribers []func(*Config)
+}
+
+func NewManager(loader *Loader) (*Manager, error) {
+	cfg, err := loader.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manager{loader: loader}
+	m.current.Store(&Snapshot{Config: cfg, Version: 1, LoadedAt: time.Now().Unix()})
+	return m, nil
+}
+
+// Get returns the effective config, callers must not modify it
+func (m *Manager) Get() *Config {
+	return m.Snapshot().Config
+}
+
+func (m *Manager) Snapshot() *Snapshot {
+	return m.current.Load().(*Snapshot)
+}
+
+// Subscribe registers fn to be called with the new config after each successful reload
+func (m *Manager) Subscribe(fn func(*Config)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.subscribers = append(m.subscribers, fn)
+}
+
+// Reload re-validates the settings and swaps them in, the old config is kept if validation fails
+func (m *Manager) Reload() (*Snapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old := m.Snapshot()
+	cfg, err := m.loader.Load()
+	if err != nil {
+		return old, err
+	}
+
+	// settings which require a restart
+	if !reflect.DeepEqual(cfg.Server, old.Config.Server) ||
+		!reflect.DeepEqual(cfg.DB, old.Config.DB) ||
+		!reflect.DeepEqual(cfg.CloudDB, old.Config.CloudDB) ||
+		!reflect.DeepEqual(cfg.Log, old.Config.Log) {
+		zap.L().Warn("server, db, cloud_db and log settings changed, they take effect after restart")
+	}
+	cfg.Server = old.Config.Server
+	cfg.DB = old.Config.DB
+	cfg.CloudDB = old.Config.CloudDB
+	cfg.Log = old.Config.Log
+
+	snapshot := &Snapshot{Config: cfg, Version: old.Version + 1, LoadedAt: time.Now().Unix()}
+	m.current.Store(snapshot)
+
+	for _, fn := range m.subscribers {
+		fn(cfg)
+	}
+
+	return snapshot, nil
+}
+
+// Watch reloads the config each time the config file changes
+func (m *Manager) Watch() {
+	m.loader.Watch(func(name string) {
+		snapshot, err := m.Reload()
+		if err != nil {
+			zap.L().Sugar().Errorf("Error! Reload config %v, keep version %v: %v", name, snapshot.Version, err)
+			return
+		}
+		zap.L().Sugar().Infof("config %v reloaded, version %v", name, snapshot.Version)
+	})
+}
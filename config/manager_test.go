@@ -0,0 +1,60 @@
+package config
+
+import "testing"
+
+func newTestManager(t *testing.T) (*Manager, *Loader) {
+	t.Helper()
+
+	loader, err := NewLoader("../config.dev", testOverrides)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewManager(loader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, loader
+}
+
+func TestReload(t *testing.T) {
+	m, loader := newTestManager(t)
+	var pushed []*Config
+	m.Subscribe(func(cfg *Config) {
+		pushed = append(pushed, cfg)
+	})
+
+	// the file changed
+	loader.v.Set("cache.size", 40)
+	loader.v.Set("server.listen_port", 9090)
+	snapshot, err := m.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Version != 2 || m.Get() != snapshot.Config || m.Get().Cache.Size != 40 {
+		t.Fatalf("got version %d with cache size %d, want version 2 with 40", snapshot.Version, m.Get().Cache.Size)
+	}
+	if m.Get().Server.ListenPort != 8080 {
+		t.Fatalf("got listen port %d, want 8080 until restart", m.Get().Server.ListenPort)
+	}
+	if len(pushed) != 1 || pushed[0] != snapshot.Config {
+		t.Fatalf("subscriber got %v, want the new config", pushed)
+	}
+}
+
+func TestReloadInvalid(t *testing.T) {
+	m, loader := newTestManager(t)
+	called := false
+	m.Subscribe(func(cfg *Config) {
+		called = true
+	})
+	old := m.Snapshot()
+
+	loader.v.Set("cache.interval_seconds", 0)
+	snapshot, err := m.Reload()
+	if err == nil {
+		t.Fatal("reloaded an invalid config")
+	}
+	if snapshot != old || m.Snapshot() != old || called {
+		t.Fatalf("got version %d, subscriber called %v, want version %d kept", m.Snapshot().Version, called, old.Version)
+	}
+}
@@ -1,6 +1,6 @@
 module github.com/YiniXu9506/devconG
 
-go 1.14
+go 1.16
 
 require (
 	github.com/fsnotify/fsnotify v1.4.9
@@ -9,12 +9,14 @@ require (
 	github.com/gin-contrib/zap v0.0.1
 	github.com/gin-gonic/gin v1.7.2
 	github.com/go-sql-driver/mysql v1.6.0
+	github.com/mattn/go-sqlite3 v1.14.6
 	github.com/natefinch/lumberjack v2.0.0+incompatible
 	github.com/pingcap/log v0.0.0-20210625125904-98ed8e2eb1c7
 	github.com/rs/cors v1.8.0
 	github.com/spf13/viper v1.8.1
 	go.uber.org/zap v1.17.0
 	gorm.io/driver/mysql v1.1.1
+	gorm.io/driver/sqlite v1.1.4
 	gorm.io/gorm v1.21.11
 	gorm.io/plugin/dbresolver v1.1.0
 )
@@ -0,0 +1,457 @@
+package loadtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/YiniXu9506/devconG/auth"
+)
+
+// how virtual users get their session tokens
+const (
+	// sign tokens with the session secret shared with the target
+	LoginMint = "mint"
+	// exchange codes at POST /login, the target needs the fake identity provider
+	LoginCode = "code"
+)
+
+// endpoints of the report
+const (
+	EndpointLogin   = "POST /login"
+	EndpointPoll    = "GET /phrases"
+	EndpointClick   = "POST /phrase_hot"
+	EndpointPhrase  = "POST /phrase"
+	EndpointProfile = "POST /user"
+)
+
+const (
+	// pause between two taps of a burst
+	tapInterval = 150 * time.Millisecond
+	// clients send the taps of this long together
+	flushInterval = time.Second
+	// mean taps of a burst
+	meanBurstTaps = 10
+	textLetters   = "abcdefghijklmnopqrstuvwxyz0123456789"
+)
+
+// Mix weighs the actions of virtual users
+type Mix struct {
+	// poll the wall
+	Poll float64
+	// tap a phrase of the wall in a burst
+	Click float64
+	// submit a phrase
+	Phrase float64
+	// update the user profile
+	Profile float64
+}
+
+// ParseMix reads weights like poll=60,click=30,phrase=5,profile=5, actions left out weigh 0
+func ParseMix(value string) (Mix, error) {
+	var mix Mix
+	for _, item := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(parts) != 2 {
+			return mix, fmt.Errorf("mix item %q must be <action>=<weight>", item)
+		}
+		weight, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil || weight < 0 {
+			return mix, fmt.Errorf("weight of %s must be a non negative number, got %q", parts[0], parts[1])
+		}
+		switch parts[0] {
+		case "poll":
+			mix.Poll = weight
+		case "click":
+			mix.Click = weight
+		case "phrase":
+			mix.Phrase = weight
+		case "profile":
+			mix.Profile = weight
+		default:
+			return mix, fmt.Errorf("unknown action %q, must be poll, click, phrase or profile", parts[0])
+		}
+	}
+	if mix.Poll+mix.Click+mix.Phrase+mix.Profile == 0 {
+		return mix, errors.New("mix must weigh at least one action")
+	}
+	return mix, nil
+}
+
+// Options describes a load test run
+type Options struct {
+	// base url of the API
+	Target   string
+	Users    int
+	Duration time.Duration
+	// users start evenly over this long
+	RampUp time.Duration
+	// mean pause of a user between two actions
+	Think time.Duration
+	Mix   Mix
+	// groups the users cheer for, numbered from 1
+	Groups int
+	// the same seed makes users take the same actions
+	Seed int64
+	// LoginMint or LoginCode
+	Login string
+	// secret the target signs session tokens with, for LoginMint
+	SessionSecret string
+}
+
+// EndpointReport sums the requests to an endpoint
+type EndpointReport struct {
+	Endpoint  string        `json:"endpoint"`
+	Requests  int           `json:"requests"`
+	Errors    int           `json:"errors"`
+	ErrorRate float64       `json:"error_rate"`
+	RPS       float64       `json:"rps"`
+	P50       time.Duration `json:"p50"`
+	P90       time.Duration `json:"p90"`
+	P99       time.Duration `json:"p99"`
+	Max       time.Duration `json:"max"`
+}
+
+// Report is the result of a run
+type Report struct {
+	Duration  time.Duration    `json:"duration"`
+	Endpoints []EndpointReport `json:"endpoints"`
+	// errors by message, to tell what failed
+	ErrorSamples map[string]int `json:"error_samples"`
+}
+
+// Stats collects the latencies and errors of the requests to each endpoint
+type Stats struct {
+	mu        sync.Mutex
+	latencies map[string][]time.Duration
+	errors    map[string]int
+	samples   map[string]int
+}
+
+func NewStats() *Stats {
+	return &Stats{
+		latencies: make(map[string][]time.Duration),
+		errors:    make(map[string]int),
+		samples:   make(map[string]int),
+	}
+}
+
+// Record adds a request, err is nil if it succeeded
+func (s *Stats) Record(endpoint string, latency time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.latencies[endpoint] = append(s.latencies[endpoint], latency)
+	if err != nil {
+		s.errors[endpoint]++
+		s.samples[fmt.Sprintf("%s: %v", endpoint, err)]++
+	}
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted))*p+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+// Report sums the requests recorded over elapsed
+func (s *Stats) Report(elapsed time.Duration) Report {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := Report{Duration: elapsed, ErrorSamples: s.samples}
+	for endpoint, latencies := range s.latencies {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		report.Endpoints = append(report.Endpoints, EndpointReport{
+			Endpoint:  endpoint,
+			Requests:  len(latencies),
+			Errors:    s.errors[endpoint],
+			ErrorRate: float64(s.errors[endpoint]) / float64(len(latencies)),
+			RPS:       float64(len(latencies)) / elapsed.Seconds(),
+			P50:       percentile(latencies, 0.5),
+			P90:       percentile(latencies, 0.9),
+			P99:       percentile(latencies, 0.99),
+			Max:       latencies[len(latencies)-1],
+		})
+	}
+	sort.Slice(report.Endpoints, func(i, j int) bool { return report.Endpoints[i].Endpoint < report.Endpoints[j].Endpoint })
+	return report
+}
+
+// wallPhrase is a phrase of GET /phrases
+type wallPhrase struct {
+	PhraseID int `json:"phrase_id"`
+	Clicks   int `json:"clicks"`
+}
+
+// runner shares the client and the stats between the virtual users
+type runner struct {
+	opts   Options
+	client *http.Client
+	stats  *Stats
+}
+
+// user is a virtual user, it polls the wall and acts on what it sees
+type user struct {
+	*runner
+	n       int
+	group   int
+	token   string
+	rand    *rand.Rand
+	wall    []wallPhrase
+	actions []float64
+}
+
+// Run drives the API with virtual users until the duration passes or ctx is done
+func Run(ctx context.Context, opts Options) (Report, error) {
+	if opts.Users <= 0 || opts.Duration <= 0 || opts.Groups <= 0 {
+		return Report{}, errors.New("users, duration and groups must be positive")
+	}
+	if opts.Login == LoginMint && opts.SessionSecret == "" {
+		return Report{}, errors.New("minting session tokens needs the session secret of the target")
+	}
+	if opts.Login != LoginMint && opts.Login != LoginCode {
+		return Report{}, fmt.Errorf("login must be %s or %s, got %q", LoginMint, LoginCode, opts.Login)
+	}
+
+	r := &runner{
+		opts: opts,
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{MaxIdleConns: opts.Users, MaxIdleConnsPerHost: opts.Users},
+		},
+		stats: NewStats(),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Duration)
+	defer cancel()
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for n := 1; n <= opts.Users; n++ {
+		u := &user{
+			runner:  r,
+			n:       n,
+			group:   (n-1)%opts.Groups + 1,
+			rand:    rand.New(rand.NewSource(opts.Seed + int64(n))),
+			actions: []float64{opts.Mix.Poll, opts.Mix.Click, opts.Mix.Phrase, opts.Mix.Profile},
+		}
+		delay := opts.RampUp * time.Duration(n-1) / time.Duration(opts.Users)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if sleep(ctx, delay) {
+				u.run(ctx)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return r.stats.Report(time.Since(start)), nil
+}
+
+// sleep waits for d, it returns false if ctx was done first
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (u *user) run(ctx context.Context) {
+	if err := u.login(ctx); err != nil {
+		return
+	}
+	for ctx.Err() == nil {
+		switch u.pick(u.actions) {
+		case 0:
+			u.poll(ctx)
+		case 1:
+			u.burst(ctx)
+		case 2:
+			u.submitPhrase(ctx)
+		case 3:
+			u.updateProfile(ctx)
+		}
+		think := time.Duration(u.rand.ExpFloat64() * float64(u.opts.Think))
+		if !sleep(ctx, think) {
+			return
+		}
+	}
+}
+
+func (u *user) pick(weights []float64) int {
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	x := u.rand.Float64() * total
+	for i, w := range weights {
+		if x < w {
+			return i
+		}
+		x -= w
+	}
+	return len(weights) - 1
+}
+
+func (u *user) openID() string {
+	return fmt.Sprintf("loadtest-%d-%d", u.opts.Seed, u.n)
+}
+
+func (u *user) login(ctx context.Context) error {
+	if u.opts.Login == LoginMint {
+		token, _, err := auth.IssueToken(u.opts.SessionSecret, u.openID(), u.opts.Duration+time.Hour)
+		u.token = token
+		return err
+	}
+	var session struct {
+		Token string `json:"token"`
+	}
+	err := u.call(ctx, EndpointLogin, http.MethodPost, "/login", map[string]string{"code": u.openID()}, &session)
+	u.token = session.Token
+	return err
+}
+
+func (u *user) poll(ctx context.Context) {
+	var wall []wallPhrase
+	if err := u.call(ctx, EndpointPoll, http.MethodGet, "/phrases", nil, &wall); err == nil {
+		u.wall = wall
+	}
+}
+
+// burst taps a phrase of the wall quickly, hot phrases are tapped more,
+// the taps are sent together every flushInterval like the mini program does
+func (u *user) burst(ctx context.Context) {
+	if len(u.wall) == 0 {
+		u.poll(ctx)
+		if len(u.wall) == 0 {
+			return
+		}
+	}
+	weights := make([]float64, len(u.wall))
+	for i, phrase := range u.wall {
+		weights[i] = float64(phrase.Clicks + 1)
+	}
+	phrase := u.wall[u.pick(weights)]
+
+	taps := 1 + int(u.rand.ExpFloat64()*meanBurstTaps)
+	pending := 0
+	lastFlush := time.Now()
+	for i := 0; i < taps; i++ {
+		pending++
+		if time.Since(lastFlush) >= flushInterval || i == taps-1 {
+			body := []map[string]int{{"phrase_id": phrase.PhraseID, "clicks": pending, "group_id": u.group}}
+			if err := u.call(ctx, EndpointClick, http.MethodPost, "/phrase_hot", body, nil); err != nil && ctx.Err() != nil {
+				return
+			}
+			pending = 0
+			lastFlush = time.Now()
+		}
+		if i == taps-1 {
+			break
+		}
+		jitter := time.Duration(u.rand.Int63n(int64(tapInterval)))
+		if !sleep(ctx, tapInterval/2+jitter) {
+			return
+		}
+	}
+}
+
+func (u *user) submitPhrase(ctx context.Context) {
+	text := make([]byte, 8)
+	for i := range text {
+		text[i] = textLetters[u.rand.Intn(len(textLetters))]
+	}
+	_ = u.call(ctx, EndpointPhrase, http.MethodPost, "/phrase", map[string]interface{}{"text": string(text), "group_id": u.group}, nil)
+}
+
+func (u *user) updateProfile(ctx context.Context) {
+	profile := map[string]interface{}{
+		"nick_name": fmt.Sprintf("loadtest%d", u.n),
+		"sex":       u.rand.Intn(3) + 1,
+		"province":  "北京",
+		"city":      "北京",
+	}
+	_ = u.call(ctx, EndpointProfile, http.MethodPost, "/user", profile, nil)
+}
+
+// call sends a request and decodes `d` of the response into data, non 2xx statuses and
+// responses with `c` other than 0 are errors. Requests cut off at the end of the run are not recorded.
+func (u *user) call(ctx context.Context, endpoint, method, path string, body interface{}, data interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(u.opts.Target, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if u.token != "" {
+		req.Header.Set("Authorization", "Bearer "+u.token)
+	}
+
+	start := time.Now()
+	err = u.do(req, data)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	u.stats.Record(endpoint, time.Since(start), err)
+	return err
+}
+
+func (u *user) do(req *http.Request, data interface{}) error {
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var envelope struct {
+		C int             `json:"c"`
+		D json.RawMessage `json:"d"`
+		M string          `json:"m"`
+	}
+	if err := json.Unmarshal(b, &envelope); err != nil {
+		return fmt.Errorf("status %d, response is not json", resp.StatusCode)
+	}
+	if resp.StatusCode/100 != 2 || envelope.C != 0 {
+		return fmt.Errorf("status %d, c %d", resp.StatusCode, envelope.C)
+	}
+	if data != nil {
+		return json.Unmarshal(envelope.D, data)
+	}
+	return nil
+}
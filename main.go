@@ -3,71 +3,161 @@ package main
 import (
 	"flag"
 	"fmt"
+	"os"
+	"sort"
+	"time"
 
+	"github.com/YiniXu9506/devconG/config"
 	"github.com/YiniXu9506/devconG/log"
-	"github.com/YiniXu9506/devconG/service"
+	"github.com/YiniXu9506/devconG/model"
+	"github.com/YiniXu9506/devconG/store"
 	"github.com/YiniXu9506/devconG/utils"
 
-	"github.com/fsnotify/fsnotify"
-	"github.com/gin-contrib/cors"
-	"github.com/gin-contrib/pprof"
-	ginzap "github.com/gin-contrib/zap"
-	"github.com/gin-gonic/gin"
-	"github.com/spf13/viper"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gorm.io/gorm"
 )
 
-var config *viper.Viper
 var configFileName = flag.String("f", "config", "customize the filename.")
 var hostName = flag.String("h", "127.0.0.1", "Connect to host.")
 var port = flag.Int("P", 4000, "the database ports.")
+var user = flag.String("u", "root", "the database user, the password is read from DEVCON_DB_PASSWORD.")
+var database = flag.String("D", "test", "the database name.")
 var cloudHostName = flag.String("ch", "", "Connect to host.")
 var cloudPort = flag.Int("CP", 0, "the database ports.")
 var serverPort = flag.Int("l", 8080, "Port number listenling.")
+var shutdownTimeout = flag.Duration("t", 15*time.Second, "Graceful shutdown timeout.")
 
-func initConfigure(configFileName string) *viper.Viper {
-	v := viper.New()
+// flagOverrides maps flags given on the command line to config keys, flags left at their defaults don't override
+func flagOverrides() map[string]interface{} {
+	overrides := make(map[string]interface{})
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "h":
+			overrides["db.host"] = *hostName
+		case "P":
+			overrides["db.port"] = *port
+		case "u":
+			overrides["db.user"] = *user
+		case "D":
+			overrides["db.database"] = *database
+		case "ch":
+			overrides["cloud_db.host"] = *cloudHostName
+		case "CP":
+			overrides["cloud_db.port"] = *cloudPort
+		case "l":
+			overrides["server.listen_port"] = *serverPort
+		case "t":
+			overrides["server.shutdown_timeout_seconds"] = int(shutdownTimeout.Seconds())
+		}
+	})
+	return overrides
+}
 
-	v.SetConfigName(configFileName) // name of config file (without extension)
-	v.SetConfigType("json")         // REQUIRED if the config file does not have the extension in the name
-	v.AddConfigPath("./")           // path to look for the config file in
+func initConfigure(configFileName string) *config.Manager {
+	loader, err := config.NewLoader(configFileName, flagOverrides())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 
-	if err := v.ReadInConfig(); err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
-			panic(" Config file not found; ignore error if desired")
-		} else {
-			panic("Config file was found but another error was produced")
-		}
+	manager, err := config.NewManager(loader)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
-	// viper runs each time a change occurs.
-	v.WatchConfig()
 
-	v.OnConfigChange(func(e fsnotify.Event) {
-		fmt.Println("Config file changed:", e.Name)
-	})
-	return v
+	return manager
 }
 
-func init() {
-	// initial log
-	log.SetLogs(zap.InfoLevel, log.LOGFORMAT_CONSOLE, "./server.log")
+// command is a subcommand of the binary, it runs after the config is loaded and the logs are set up
+type command struct {
+	usage string
+	run   func(cfg *config.Manager, args []string) int
+}
+
+var commands = map[string]command{
+	"serve":       {"serve the APIs, the default command", runServe},
+	"migrate":     {"migrate status|up|down the database schema", runMigrate},
+	"seed":        {"seed users, phrases and clicks for development and load tests", runSeed},
+	"export":      {"export phrases with their clicks as csv or json lines", runExport},
+	"reset-round": {"end the current round and clear the clicks for the next one", runResetRound},
+	"loadtest":    {"drive the HTTP API of a server with virtual users and report latencies", runLoadtest},
+	"backup":      {"back up phrases, clicks, users, display profiles and the config into one archive", runBackup},
+	"restore":     {"restore an archive written by backup into an empty database", runRestore},
+	"replay":      {"replay recorded requests against a server at a multiple of their pace", runReplay},
+	"retention":   {"compact click records older than retention.days into rollups, or report what would be with --dry-run", runRetention},
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [command] [command flags]\n\ncommands:\n", os.Args[0])
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(flag.CommandLine.Output(), "  %-12s %s\n", name, commands[name].usage)
+	}
+	fmt.Fprintf(flag.CommandLine.Output(), "\nflags:\n")
+	flag.PrintDefaults()
 }
 
 func main() {
+	flag.Usage = usage
 	flag.Parse()
-	config = initConfigure(*configFileName)
 
-	r := gin.New()
-	r.Use(cors.Default())
-	pprof.Register(r)
+	name := "serve"
+	if flag.NArg() > 0 {
+		name = flag.Arg(0)
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", name)
+		usage()
+		os.Exit(2)
+	}
 
-	r.Use(cors.Default())
-	//r.Use(ginzap.Ginzap(zap.L(), time.RFC3339, true))
-	r.Use(ginzap.RecoveryWithZap(zap.L(), true))
+	configManager := initConfigure(*configFileName)
+	cfg := configManager.Get()
 
-	dbs := utils.TiDBConnect(*hostName, *port, *cloudHostName, *cloudPort)
-	service := service.NewService(dbs, config)
-	service.Start(r)
+	// initial log
+	var logLevel zapcore.Level
+	_ = logLevel.UnmarshalText([]byte(cfg.Log.Level))
+	log.SetLogs(logLevel, cfg.Log.Format, cfg.Log.File)
 
-	r.Run(fmt.Sprintf(":%d", *serverPort))
+	code := cmd.run(configManager, commandArgs())
+	// flush buffered logs
+	_ = zap.L().Sync()
+	os.Exit(code)
+}
+
+// commandArgs are the arguments after the command name
+func commandArgs() []string {
+	if flag.NArg() == 0 {
+		return nil
+	}
+	return flag.Args()[1:]
+}
+
+// connect opens the databases the way every command does, the store reads and writes the primary one
+func connect(cfg *config.Config) ([]*gorm.DB, store.Store) {
+	dbs := utils.Connect(cfg.DB, cfg.CloudDB)
+	return dbs, store.NewGorm(dbs[0])
+}
+
+// lookupEvent returns the id of the event of the --event flag, an empty slug is the default event
+func lookupEvent(db *gorm.DB, slug string) (int, error) {
+	if slug == "" {
+		return model.DefaultEventID, nil
+	}
+	var event model.EventModel
+	res := db.Where("slug = ?", slug).Limit(1).Find(&event)
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return 0, fmt.Errorf("unknown event %q", slug)
+	}
+	return event.EventID, nil
 }
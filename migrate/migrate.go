@@ -0,0 +1,497 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// schema dialects, TiDB runs the mysql migrations unless it has its own version of a step
+const (
+	DialectMySQL  = "mysql"
+	DialectTiDB   = "tidb"
+	DialectSQLite = "sqlite"
+)
+
+// the migrations of each dialect are in migrations/<dialect>/<version>_<name>.<up|down>.sql
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// Migration is a versioned step of the schema
+type Migration struct {
+	Version int
+	Name    string
+	// statements applying and reverting the step
+	Up   []Statement
+	Down []Statement
+}
+
+// Statement is a statement of a migration, it runs only if all its conditions hold
+type Statement struct {
+	SQL        string
+	Conditions []Condition
+}
+
+// Condition is a `-- @if index|column <table> <name> exists|missing` line before a statement. MySQL can't
+// drop or add an index or a column only if it exists or is missing, the conditions make such statements
+// safe to run on the databases set up before migrations existed and to run again.
+type Condition struct {
+	// index or column
+	Kind   string
+	Table  string
+	Name   string
+	Exists bool
+}
+
+const conditionPrefix = "-- @if "
+
+// Status is a migration and whether it has been applied
+type Status struct {
+	Version   int    `json:"version"`
+	Name      string `json:"name"`
+	Applied   bool   `json:"applied"`
+	ApplyTime int64  `json:"apply_time"`
+}
+
+// table `schema_migrations` schema, the applied migrations
+type schemaMigration struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	ApplyTime int64
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+const createSchemaMigrations = "CREATE TABLE IF NOT EXISTS `schema_migrations` (" +
+	"`version` bigint NOT NULL, `name` varchar(255) NOT NULL, `apply_time` bigint NOT NULL, PRIMARY KEY (`version`))"
+
+// SQLite has no advisory locks, the process migrating it holds the row of `schema_migrations_lock`
+const createSchemaMigrationsLock = "CREATE TABLE IF NOT EXISTS `schema_migrations_lock` (" +
+	"`id` integer NOT NULL, `owner` text NOT NULL, `lock_time` integer NOT NULL, PRIMARY KEY (`id`))"
+
+const (
+	// lockName is the advisory lock of MySQL and TiDB held while migrating
+	lockName = "devcon_schema_migrations"
+	// lockTimeout is how long servers started at once wait for the one migrating,
+	// a lock row of SQLite older than it was left by a crashed process and is taken over
+	lockTimeout = 10 * time.Minute
+)
+
+// Migrator applies and reverts the migrations of a database
+type Migrator struct {
+	db         *gorm.DB
+	dialect    string
+	migrations []Migration
+}
+
+// New loads the migrations of the dialect of db and creates `schema_migrations` if it doesn't exist
+func New(db *gorm.DB) (*Migrator, error) {
+	dialect, err := detectDialect(db)
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := load(dialect)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Exec(createSchemaMigrations).Error; err != nil {
+		return nil, fmt.Errorf("create schema_migrations: %w", err)
+	}
+	if dialect == DialectSQLite {
+		if err := db.Exec(createSchemaMigrationsLock).Error; err != nil {
+			return nil, fmt.Errorf("create schema_migrations_lock: %w", err)
+		}
+	}
+	return &Migrator{db: db, dialect: dialect, migrations: migrations}, nil
+}
+
+// detectDialect tells TiDB from MySQL by its version string, both use the mysql driver
+func detectDialect(db *gorm.DB) (string, error) {
+	if db.Dialector.Name() == DialectSQLite {
+		return DialectSQLite, nil
+	}
+	var version string
+	if err := db.Raw("SELECT VERSION()").Scan(&version).Error; err != nil {
+		return "", fmt.Errorf("detect database version: %w", err)
+	}
+	if strings.Contains(version, "TiDB") {
+		return DialectTiDB, nil
+	}
+	return DialectMySQL, nil
+}
+
+// load reads the migrations of the dialect ordered by version
+func load(dialect string) ([]Migration, error) {
+	dirs := []string{dialect}
+	if dialect == DialectTiDB {
+		// steps in tidb replace the mysql ones of the same version
+		dirs = []string{DialectMySQL, DialectTiDB}
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, dir := range dirs {
+		entries, err := fs.ReadDir(migrationFiles, path.Join("migrations", dir))
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			version, name, direction, err := parseFileName(entry.Name())
+			if err != nil {
+				return nil, err
+			}
+			content, err := fs.ReadFile(migrationFiles, path.Join("migrations", dir, entry.Name()))
+			if err != nil {
+				return nil, err
+			}
+
+			migration, ok := byVersion[version]
+			if !ok {
+				migration = &Migration{Version: version, Name: name}
+				byVersion[version] = migration
+			}
+			if migration.Name != name {
+				return nil, fmt.Errorf("migration %d is named both %q and %q", version, migration.Name, name)
+			}
+			statements, err := splitStatements(string(content))
+			if err != nil {
+				return nil, fmt.Errorf("migration file %s/%s: %w", dir, entry.Name(), err)
+			}
+			if direction == "up" {
+				migration.Up = statements
+			} else {
+				migration.Down = statements
+			}
+		}
+	}
+
+	var migrations []Migration
+	for _, migration := range byVersion {
+		if migration.Up == nil || migration.Down == nil {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// parseFileName splits 0001_phrases.up.sql into 1, phrases and up
+func parseFileName(fileName string) (int, string, string, error) {
+	base := strings.TrimSuffix(fileName, ".sql")
+	dot := strings.LastIndex(base, ".")
+	underscore := strings.Index(base, "_")
+	if base == fileName || dot < 0 || underscore < 0 || underscore > dot {
+		return 0, "", "", fmt.Errorf("migration file %q must be named <version>_<name>.<up|down>.sql", fileName)
+	}
+	direction := base[dot+1:]
+	if direction != "up" && direction != "down" {
+		return 0, "", "", fmt.Errorf("migration file %q must be named <version>_<name>.<up|down>.sql", fileName)
+	}
+	version, err := strconv.Atoi(base[:underscore])
+	if err != nil || version <= 0 {
+		return 0, "", "", fmt.Errorf("migration file %q must start with a positive version", fileName)
+	}
+	return version, base[underscore+1 : dot], direction, nil
+}
+
+// splitStatements splits a file into statements ending with ; at the end of a line, -- comment lines are dropped
+// except for the conditions of the next statement.
+// The mysql driver runs one statement per Exec unless multiStatements is set in the DSN.
+func splitStatements(content string) ([]Statement, error) {
+	statements := []Statement{}
+	var current []string
+	var conditions []Condition
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, conditionPrefix) {
+			condition, err := parseCondition(trimmed)
+			if err != nil {
+				return nil, err
+			}
+			conditions = append(conditions, condition)
+			continue
+		}
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current = append(current, line)
+		if strings.HasSuffix(trimmed, ";") {
+			statement := strings.TrimSuffix(strings.TrimSpace(strings.Join(current, "\n")), ";")
+			statements = append(statements, Statement{SQL: statement, Conditions: conditions})
+			current, conditions = nil, nil
+		}
+	}
+	if len(current) > 0 {
+		statements = append(statements, Statement{SQL: strings.TrimSpace(strings.Join(current, "\n")), Conditions: conditions})
+	} else if len(conditions) > 0 {
+		return nil, fmt.Errorf("condition %q is not followed by a statement", conditionPrefix+conditions[0].String())
+	}
+	return statements, nil
+}
+
+// parseCondition parses `-- @if index phrase_models idx_phrase_click missing`
+func parseCondition(line string) (Condition, error) {
+	fields := strings.Fields(strings.TrimPrefix(line, conditionPrefix))
+	if len(fields) != 4 || (fields[0] != "index" && fields[0] != "column") || (fields[3] != "exists" && fields[3] != "missing") {
+		return Condition{}, fmt.Errorf("condition %q must be %sindex|column <table> <name> exists|missing", line, conditionPrefix)
+	}
+	return Condition{Kind: fields[0], Table: fields[1], Name: fields[2], Exists: fields[3] == "exists"}, nil
+}
+
+func (c Condition) String() string {
+	state := "missing"
+	if c.Exists {
+		state = "exists"
+	}
+	return strings.Join([]string{c.Kind, c.Table, c.Name, state}, " ")
+}
+
+// holds checks the conditions of the statement against the schema of the database
+func (m *Migrator) holds(tx *gorm.DB, statement Statement) (bool, error) {
+	for _, c := range statement.Conditions {
+		var query string
+		switch {
+		case m.dialect == DialectSQLite && c.Kind == "index":
+			query = "SELECT count(*) FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND name = ?"
+		case m.dialect == DialectSQLite:
+			query = "SELECT count(*) FROM pragma_table_info(?) WHERE name = ?"
+		case c.Kind == "index":
+			query = "SELECT count(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = ? AND index_name = ?"
+		default:
+			query = "SELECT count(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?"
+		}
+		var count int64
+		if err := tx.Raw(query, c.Table, c.Name).Scan(&count).Error; err != nil {
+			return false, fmt.Errorf("check %s: %w", c, err)
+		}
+		if (count > 0) != c.Exists {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Dialect is the dialect the migrations were loaded for
+func (m *Migrator) Dialect() string {
+	return m.dialect
+}
+
+func (m *Migrator) applied() (map[int]schemaMigration, error) {
+	var rows []schemaMigration
+	if err := m.db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int]schemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// Version is the highest applied version, 0 if none is applied
+func (m *Migrator) Version() (int, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+	version := 0
+	for v := range applied {
+		if v > version {
+			version = v
+		}
+	}
+	return version, nil
+}
+
+// Status lists the known migrations oldest first, then applied versions this build doesn't know
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	var statuses []Status
+	for _, migration := range m.migrations {
+		row, ok := applied[migration.Version]
+		statuses = append(statuses, Status{Version: migration.Version, Name: migration.Name, Applied: ok, ApplyTime: row.ApplyTime})
+		delete(applied, migration.Version)
+	}
+	var unknown []Status
+	for _, row := range applied {
+		unknown = append(unknown, Status{Version: row.Version, Name: row.Name, Applied: true, ApplyTime: row.ApplyTime})
+	}
+	sort.Slice(unknown, func(i, j int) bool { return unknown[i].Version < unknown[j].Version })
+	return append(statuses, unknown...), nil
+}
+
+// Up applies the pending migrations oldest first, at most steps of them when steps is positive.
+// It returns the applied migrations, including the ones applied before an error.
+func (m *Migrator) Up(steps int) ([]Migration, error) {
+	unlock, err := m.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for _, migration := range m.migrations {
+		if steps > 0 && len(done) == steps {
+			break
+		}
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		err := m.run(migration.Up, func(tx *gorm.DB) error {
+			return tx.Create(&schemaMigration{Version: migration.Version, Name: migration.Name, ApplyTime: time.Now().Unix()}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("apply migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Down reverts the applied migrations newest first, at most steps of them when steps is positive.
+// It returns the reverted migrations, including the ones reverted before an error.
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	unlock, err := m.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[int]bool, len(m.migrations))
+	for _, migration := range m.migrations {
+		known[migration.Version] = true
+	}
+	for version, row := range applied {
+		if !known[version] {
+			// reverting older migrations past it would leave the schema in an unknown state
+			return nil, fmt.Errorf("migration %d_%s is applied but unknown to this build", version, row.Name)
+		}
+	}
+
+	var done []Migration
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		if steps > 0 && len(done) == steps {
+			break
+		}
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		err := m.run(migration.Down, func(tx *gorm.DB) error {
+			return tx.Delete(&schemaMigration{}, migration.Version).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("revert migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// run executes the statements whose conditions hold and records the migration in one transaction.
+// MySQL and TiDB commit DDL implicitly, so a failed step there may be partly applied. Its tables and views
+// are created with IF NOT EXISTS or OR REPLACE, and its changes of indexes and columns carry conditions
+// skipping the ones already made, so the step can be applied again once the cause of the failure is fixed.
+func (m *Migrator) run(statements []Statement, record func(tx *gorm.DB) error) error {
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		for _, statement := range statements {
+			ok, err := m.holds(tx, statement)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			if err := tx.Exec(statement.SQL).Error; err != nil {
+				return err
+			}
+		}
+		return record(tx)
+	})
+}
+
+// lock waits until no other process migrates the database, such as servers of a deployment started at once,
+// and returns the func letting the others go on
+func (m *Migrator) lock() (func(), error) {
+	if m.dialect == DialectSQLite {
+		return m.lockRow()
+	}
+
+	// the lock belongs to the session, it's taken and released on one connection of the pool
+	sqlDB, err := m.db.DB()
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var locked sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", lockName, int(lockTimeout.Seconds())).Scan(&locked); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("lock migrations: %w", err)
+	}
+	if locked.Int64 != 1 {
+		conn.Close()
+		return nil, fmt.Errorf("another process has been migrating the database for %v", lockTimeout)
+	}
+	return func() {
+		var released sql.NullInt64
+		if err := conn.QueryRowContext(ctx, "SELECT RELEASE_LOCK(?)", lockName).Scan(&released); err != nil {
+			zap.L().Sugar().Error("Error! Unlock migrations: ", err)
+		}
+		// closing the connection releases the lock too
+		conn.Close()
+	}, nil
+}
+
+// lockRow inserts the row of schema_migrations_lock, waiting while another process holds it
+func (m *Migrator) lockRow() (func(), error) {
+	owner := fmt.Sprintf("%d-%d", os.Getpid(), time.Now().UnixNano())
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		// a lock older than lockTimeout was left by a crashed process
+		if err := m.db.Exec("DELETE FROM `schema_migrations_lock` WHERE `id` = 1 AND `lock_time` < ?", time.Now().Add(-lockTimeout).Unix()).Error; err != nil {
+			return nil, fmt.Errorf("lock migrations: %w", err)
+		}
+		err := m.db.Exec("INSERT INTO `schema_migrations_lock` (`id`, `owner`, `lock_time`) VALUES (1, ?, ?)", owner, time.Now().Unix()).Error
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("another process has been migrating the database for %v: %w", lockTimeout, err)
+		}
+		time.Sleep(time.Second)
+	}
+	return func() {
+		if err := m.db.Exec("DELETE FROM `schema_migrations_lock` WHERE `id` = 1 AND `owner` = ?", owner).Error; err != nil {
+			zap.L().Sugar().Error("Error! Unlock migrations: ", err)
+		}
+	}, nil
+}
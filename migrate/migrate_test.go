@@ -0,0 +1,230 @@
+package migrate
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openSQLite opens an empty SQLite database, utils.Open can't be used as utils migrates through this package
+func openSQLite(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "devcon.db")), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func newTestMigrator(t *testing.T) (*Migrator, *gorm.DB) {
+	t.Helper()
+
+	db := openSQLite(t)
+	m, err := New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, db
+}
+
+func TestParseFileName(t *testing.T) {
+	version, name, direction, err := parseFileName("0007_events.down.sql")
+	if err != nil || version != 7 || name != "events" || direction != "down" {
+		t.Fatalf("got %d, %q, %q, %v", version, name, direction, err)
+	}
+	for _, fileName := range []string{"0007_events.sql", "events.up.sql", "0000_events.up.sql", "0007_events.sideways.sql", "0007_events.up.txt"} {
+		if _, _, _, err := parseFileName(fileName); err == nil {
+			t.Errorf("parsed %q", fileName)
+		}
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	statements, err := splitStatements(`-- a comment
+CREATE TABLE a (
+  id integer
+);
+
+-- @if index a idx_a missing
+-- @if column a id exists
+CREATE INDEX idx_a ON a (id);
+DROP TABLE b`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Statement{
+		{SQL: "CREATE TABLE a (\n  id integer\n)"},
+		{SQL: "CREATE INDEX idx_a ON a (id)", Conditions: []Condition{{Kind: "index", Table: "a", Name: "idx_a"}, {Kind: "column", Table: "a", Name: "id", Exists: true}}},
+		{SQL: "DROP TABLE b"},
+	}
+	if !reflect.DeepEqual(statements, want) {
+		t.Fatalf("got %+v, want %+v", statements, want)
+	}
+
+	for _, content := range []string{"CREATE TABLE a (id integer);\n-- @if index a idx_a missing\n", "-- @if index a idx_a absent\nDROP INDEX idx_a;"} {
+		if _, err := splitStatements(content); err == nil {
+			t.Errorf("split %q", content)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	steps := make(map[string][]string)
+	for _, dialect := range []string{DialectMySQL, DialectTiDB, DialectSQLite} {
+		migrations, err := load(dialect)
+		if err != nil {
+			t.Fatalf("load %s: %v", dialect, err)
+		}
+		for i, migration := range migrations {
+			if migration.Version != i+1 {
+				t.Fatalf("%s migrations skip from %d to %d", dialect, i, migration.Version)
+			}
+			steps[dialect] = append(steps[dialect], migration.Name)
+		}
+	}
+	// the dialects share the steps
+	if !reflect.DeepEqual(steps[DialectMySQL], steps[DialectSQLite]) || !reflect.DeepEqual(steps[DialectMySQL], steps[DialectTiDB]) {
+		t.Fatalf("got steps %v", steps)
+	}
+}
+
+func TestUpAndDown(t *testing.T) {
+	m, db := newTestMigrator(t)
+	latest := m.migrations[len(m.migrations)-1].Version
+
+	if applied, err := m.Up(2); err != nil || len(applied) != 2 {
+		t.Fatalf("got %d applied, %v, want 2", len(applied), err)
+	}
+	if applied, err := m.Up(0); err != nil || len(applied) != latest-2 {
+		t.Fatalf("got %d applied, %v, want the rest", len(applied), err)
+	}
+	if version, err := m.Version(); err != nil || version != latest {
+		t.Fatalf("got version %d, %v, want %d", version, err, latest)
+	}
+	if applied, err := m.Up(0); err != nil || len(applied) != 0 {
+		t.Fatalf("got %d applied, %v on an up to date database", len(applied), err)
+	}
+
+	statuses, err := m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range statuses {
+		if !status.Applied || status.ApplyTime == 0 {
+			t.Fatalf("got status %+v, want applied", status)
+		}
+	}
+
+	if reverted, err := m.Down(1); err != nil || len(reverted) != 1 || reverted[0].Version != latest {
+		t.Fatalf("got %v, %v, want the latest reverted", reverted, err)
+	}
+	if reverted, err := m.Down(0); err != nil || len(reverted) != latest-1 {
+		t.Fatalf("got %d reverted, %v, want the rest", len(reverted), err)
+	}
+	if db.Migrator().HasTable("phrase_models") {
+		t.Fatal("phrase_models is left after reverting all migrations")
+	}
+
+	// up again after down
+	if _, err := m.Up(0); err != nil {
+		t.Fatal(err)
+	}
+	if !db.Migrator().HasTable("phrase_click_total_models") {
+		t.Fatal("phrase_click_total_models is missing")
+	}
+}
+
+func TestDownUnknownVersion(t *testing.T) {
+	m, db := newTestMigrator(t)
+	if _, err := m.Up(0); err != nil {
+		t.Fatal(err)
+	}
+	// applied by a newer build
+	if err := db.Create(&schemaMigration{Version: 999, Name: "future", ApplyTime: 1}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if reverted, err := m.Down(1); err == nil {
+		t.Fatalf("reverted %v past an unknown migration", reverted)
+	}
+	statuses, err := m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := statuses[len(statuses)-1]; last.Version != 999 || !last.Applied {
+		t.Fatalf("got last status %+v, want the unknown migration", last)
+	}
+}
+
+func TestHolds(t *testing.T) {
+	m, db := newTestMigrator(t)
+	if err := db.Exec("CREATE TABLE a (id integer)").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("CREATE INDEX idx_a ON a (id)").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		condition Condition
+		want      bool
+	}{
+		{Condition{Kind: "index", Table: "a", Name: "idx_a", Exists: true}, true},
+		{Condition{Kind: "index", Table: "a", Name: "idx_b", Exists: true}, false},
+		{Condition{Kind: "column", Table: "a", Name: "id", Exists: false}, false},
+		{Condition{Kind: "column", Table: "a", Name: "name", Exists: false}, true},
+	}
+	for _, test := range tests {
+		if holds, err := m.holds(db, Statement{Conditions: []Condition{test.condition}}); err != nil || holds != test.want {
+			t.Errorf("%v: got %v, %v, want %v", test.condition, holds, err, test.want)
+		}
+	}
+}
+
+func TestLockRow(t *testing.T) {
+	m, db := newTestMigrator(t)
+
+	unlock, err := m.lockRow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	locked := make(chan struct{})
+	go func() {
+		if unlock, err := m.lockRow(); err == nil {
+			unlock()
+		}
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("took a held lock")
+	case <-time.After(100 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case <-locked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("didn't take the released lock")
+	}
+
+	// left by a crashed process
+	if err := db.Exec("INSERT INTO `schema_migrations_lock` (`id`, `owner`, `lock_time`) VALUES (1, 'crashed', ?)", time.Now().Add(-2*lockTimeout).Unix()).Error; err != nil {
+		t.Fatal(err)
+	}
+	unlock, err = m.lockRow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+}
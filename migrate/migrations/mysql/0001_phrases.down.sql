@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS `user_models`;
+DROP TABLE IF EXISTS `phrase_click_models`;
+DROP TABLE IF EXISTS `phrase_models`;
@@ -0,0 +1,48 @@
+CREATE TABLE IF NOT EXISTS `phrase_models` (
+  `phrase_id` bigint NOT NULL AUTO_INCREMENT,
+  `text` varchar(60) DEFAULT NULL,
+  `group_id` bigint DEFAULT NULL,
+  `open_id` longtext,
+  `status` bigint DEFAULT NULL,
+  `create_time` bigint DEFAULT NULL,
+  `update_time` bigint DEFAULT NULL,
+  PRIMARY KEY (`phrase_id`),
+  UNIQUE KEY `text` (`text`),
+  KEY `idx_phrase_status_create` (`status`, `create_time`),
+  KEY `idx_phrase_status_update` (`status`, `update_time`)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE IF NOT EXISTS `phrase_click_models` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `phrase_id` bigint DEFAULT NULL,
+  `group_id` bigint DEFAULT NULL,
+  `open_id` longtext,
+  `clicks` bigint DEFAULT NULL,
+  `click_time` bigint DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_phrase_click` (`phrase_id`, `group_id`, `clicks`)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE IF NOT EXISTS `user_models` (
+  `open_id` varchar(191) NOT NULL,
+  `nick_name` longtext,
+  `sex` bigint DEFAULT NULL,
+  `province` longtext,
+  `city` longtext,
+  `head_img_url` longtext,
+  PRIMARY KEY (`open_id`)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+-- databases set up before migrations existed got their indexes from AutoMigrate or create_table.sql,
+-- the ones named differently are replaced by the indexes above
+-- @if index phrase_models idx_phrase_models_status exists
+ALTER TABLE `phrase_models` DROP KEY `idx_phrase_models_status`;
+-- @if index phrase_models idx_phrase_status_create missing
+ALTER TABLE `phrase_models` ADD KEY `idx_phrase_status_create` (`status`, `create_time`);
+-- @if index phrase_models idx_phrase_status_update missing
+ALTER TABLE `phrase_models` ADD KEY `idx_phrase_status_update` (`status`, `update_time`);
+-- @if index phrase_click_models idx_phrase_clicks exists
+-- @if index phrase_click_models idx_phrase_click missing
+ALTER TABLE `phrase_click_models` RENAME INDEX `idx_phrase_clicks` TO `idx_phrase_click`;
+-- @if index phrase_click_models idx_phrase_clicks exists
+ALTER TABLE `phrase_click_models` DROP KEY `idx_phrase_clicks`;
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS `display_profile_models` (
+  `name` varchar(64) NOT NULL,
+  `settings` text,
+  `update_time` bigint DEFAULT NULL,
+  PRIMARY KEY (`name`)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
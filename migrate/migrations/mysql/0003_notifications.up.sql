@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS `notification_models` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `open_id` varchar(191) DEFAULT NULL,
+  `event` varchar(32) DEFAULT NULL,
+  `phrase_id` bigint DEFAULT NULL,
+  `text` varchar(60) DEFAULT NULL,
+  `clicks` bigint DEFAULT NULL,
+  `dedup_key` varchar(128) DEFAULT NULL,
+  `is_read` boolean DEFAULT NULL,
+  `create_time` bigint DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_notification_dedup` (`dedup_key`),
+  KEY `idx_notification_open_id` (`open_id`)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE IF NOT EXISTS `notification_delivery_models` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `notification_id` bigint DEFAULT NULL,
+  `channel` varchar(32) DEFAULT NULL,
+  `status` bigint DEFAULT NULL,
+  `attempts` bigint DEFAULT NULL,
+  `next_attempt_time` bigint DEFAULT NULL,
+  `last_error` text,
+  `update_time` bigint DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_notification_channel` (`notification_id`, `channel`),
+  KEY `idx_delivery_status_time` (`status`, `next_attempt_time`)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS `phrase_claim_models`;
+DROP TABLE IF EXISTS `phrase_audit_models`;
@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS `phrase_audit_models` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `phrase_id` bigint DEFAULT NULL,
+  `actor` varchar(64) DEFAULT NULL,
+  `action` varchar(32) DEFAULT NULL,
+  `old_text` varchar(60) DEFAULT NULL,
+  `new_text` varchar(60) DEFAULT NULL,
+  `old_status` bigint DEFAULT NULL,
+  `new_status` bigint DEFAULT NULL,
+  `reason_code` varchar(32) DEFAULT NULL,
+  `reason` varchar(255) DEFAULT NULL,
+  `create_time` bigint DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_phrase_audit_phrase` (`phrase_id`),
+  KEY `idx_phrase_audit_actor` (`actor`),
+  KEY `idx_phrase_audit_action` (`action`),
+  KEY `idx_phrase_audit_time` (`create_time`)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE IF NOT EXISTS `phrase_claim_models` (
+  `phrase_id` bigint NOT NULL,
+  `reviewer` varchar(64) DEFAULT NULL,
+  `claim_time` bigint DEFAULT NULL,
+  `lease_until` bigint DEFAULT NULL,
+  PRIMARY KEY (`phrase_id`),
+  KEY `idx_phrase_claim_reviewer` (`reviewer`),
+  KEY `idx_phrase_claim_lease` (`lease_until`)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
@@ -0,0 +1,51 @@
+CREATE TABLE IF NOT EXISTS `webhook_subscription_models` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `url` varchar(512) DEFAULT NULL,
+  `secret` varchar(64) DEFAULT NULL,
+  `events` varchar(512) DEFAULT NULL,
+  `description` varchar(255) DEFAULT NULL,
+  `enabled` boolean DEFAULT NULL,
+  `create_time` bigint DEFAULT NULL,
+  `update_time` bigint DEFAULT NULL,
+  PRIMARY KEY (`id`)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE IF NOT EXISTS `webhook_event_models` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `event` varchar(32) DEFAULT NULL,
+  `payload` text,
+  `dedup_key` varchar(128) DEFAULT NULL,
+  `create_time` bigint DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_webhook_event_dedup` (`dedup_key`),
+  KEY `idx_webhook_event` (`event`)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE IF NOT EXISTS `webhook_delivery_models` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `event_id` bigint DEFAULT NULL,
+  `subscription_id` bigint DEFAULT NULL,
+  `status` bigint DEFAULT NULL,
+  `attempts` bigint DEFAULT NULL,
+  `next_attempt_time` bigint DEFAULT NULL,
+  `last_status_code` bigint DEFAULT NULL,
+  `last_error` text,
+  `create_time` bigint DEFAULT NULL,
+  `update_time` bigint DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_webhook_delivery_event` (`event_id`),
+  KEY `idx_webhook_delivery_subscription` (`subscription_id`),
+  KEY `idx_webhook_delivery_status_time` (`status`, `next_attempt_time`)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE IF NOT EXISTS `webhook_attempt_models` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `delivery_id` bigint DEFAULT NULL,
+  `attempt` bigint DEFAULT NULL,
+  `status_code` bigint DEFAULT NULL,
+  `error` text,
+  `duration_ms` bigint DEFAULT NULL,
+  `attempt_time` bigint DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_webhook_attempt_delivery` (`delivery_id`)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
@@ -0,0 +1,5 @@
+DROP VIEW IF EXISTS `all_phrase_clicks`;
+-- @if index phrase_click_models idx_phrase_click_time exists
+ALTER TABLE `phrase_click_models` DROP KEY `idx_phrase_click_time`;
+DROP TABLE IF EXISTS `click_archive_models`;
+DROP TABLE IF EXISTS `phrase_click_rollup_models`;
@@ -0,0 +1,36 @@
+-- click records older than retention.days are compacted into rollups, analytic queries
+-- read both through all_phrase_clicks
+CREATE TABLE IF NOT EXISTS `phrase_click_rollup_models` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `bucket_time` bigint DEFAULT NULL,
+  `phrase_id` bigint DEFAULT NULL,
+  `group_id` bigint DEFAULT NULL,
+  `open_id` varchar(191) DEFAULT NULL,
+  `clicks` bigint DEFAULT NULL,
+  `click_time` bigint DEFAULT NULL,
+  `records` bigint DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_phrase_click_rollup` (`bucket_time`, `phrase_id`, `group_id`, `open_id`)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE IF NOT EXISTS `click_archive_models` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `file` varchar(512) DEFAULT NULL,
+  `records` bigint DEFAULT NULL,
+  `clicks` bigint DEFAULT NULL,
+  `first_record` bigint DEFAULT NULL,
+  `min_click_time` bigint DEFAULT NULL,
+  `max_click_time` bigint DEFAULT NULL,
+  `create_time` bigint DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `idx_click_archive_time` (`create_time`)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+-- the retention job picks the oldest click records first
+-- @if index phrase_click_models idx_phrase_click_time missing
+ALTER TABLE `phrase_click_models` ADD KEY `idx_phrase_click_time` (`click_time`);
+
+CREATE OR REPLACE VIEW `all_phrase_clicks` AS
+  SELECT `phrase_id`, `group_id`, `open_id`, `clicks`, `click_time` FROM `phrase_click_models`
+  UNION ALL
+  SELECT `phrase_id`, `group_id`, `open_id`, `clicks`, `click_time` FROM `phrase_click_rollup_models`;
@@ -0,0 +1,39 @@
+-- fails when a text is used by several events, remove the other events' phrases first
+CREATE OR REPLACE VIEW `all_phrase_clicks` AS
+  SELECT `phrase_id`, `group_id`, `open_id`, `clicks`, `click_time` FROM `phrase_click_models`
+  UNION ALL
+  SELECT `phrase_id`, `group_id`, `open_id`, `clicks`, `click_time` FROM `phrase_click_rollup_models`;
+
+-- @if column user_models event_id exists
+DELETE FROM `user_models` WHERE `event_id` <> 1;
+-- @if index user_models PRIMARY exists
+ALTER TABLE `user_models` DROP PRIMARY KEY;
+-- @if index user_models PRIMARY missing
+ALTER TABLE `user_models` ADD PRIMARY KEY (`open_id`);
+-- @if column user_models event_id exists
+ALTER TABLE `user_models` DROP COLUMN `event_id`;
+
+-- @if column phrase_click_rollup_models event_id exists
+ALTER TABLE `phrase_click_rollup_models` DROP COLUMN `event_id`;
+
+-- @if index phrase_click_models idx_phrase_click_event_time exists
+ALTER TABLE `phrase_click_models` DROP KEY `idx_phrase_click_event_time`;
+-- @if column phrase_click_models event_id exists
+ALTER TABLE `phrase_click_models` DROP COLUMN `event_id`;
+
+-- @if index phrase_models idx_phrase_status_update exists
+ALTER TABLE `phrase_models` DROP KEY `idx_phrase_status_update`;
+-- @if index phrase_models idx_phrase_status_update missing
+ALTER TABLE `phrase_models` ADD KEY `idx_phrase_status_update` (`status`, `update_time`);
+-- @if index phrase_models idx_phrase_status_create exists
+ALTER TABLE `phrase_models` DROP KEY `idx_phrase_status_create`;
+-- @if index phrase_models idx_phrase_status_create missing
+ALTER TABLE `phrase_models` ADD KEY `idx_phrase_status_create` (`status`, `create_time`);
+-- @if index phrase_models idx_phrase_event_text exists
+ALTER TABLE `phrase_models` DROP KEY `idx_phrase_event_text`;
+-- @if index phrase_models text missing
+ALTER TABLE `phrase_models` ADD UNIQUE KEY `text` (`text`);
+-- @if column phrase_models event_id exists
+ALTER TABLE `phrase_models` DROP COLUMN `event_id`;
+
+DROP TABLE IF EXISTS `event_models`;
@@ -0,0 +1,52 @@
+-- events share the database, a phrase text is unique within its event and a user
+-- has a profile per event
+CREATE TABLE IF NOT EXISTS `event_models` (
+  `event_id` bigint NOT NULL AUTO_INCREMENT,
+  `slug` varchar(64) NOT NULL,
+  `name` varchar(255) DEFAULT NULL,
+  `settings` text,
+  `create_time` bigint DEFAULT NULL,
+  `update_time` bigint DEFAULT NULL,
+  PRIMARY KEY (`event_id`),
+  UNIQUE KEY `idx_event_slug` (`slug`)
+) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+-- the rows written before events existed belong to the default event
+INSERT IGNORE INTO `event_models` (`event_id`, `slug`, `name`, `settings`, `create_time`, `update_time`)
+  VALUES (1, 'default', 'Default', '{}', UNIX_TIMESTAMP(), UNIX_TIMESTAMP());
+
+-- @if column phrase_models event_id missing
+ALTER TABLE `phrase_models` ADD COLUMN `event_id` bigint NOT NULL DEFAULT 1;
+-- @if index phrase_models text exists
+ALTER TABLE `phrase_models` DROP KEY `text`;
+-- @if index phrase_models idx_phrase_event_text missing
+ALTER TABLE `phrase_models` ADD UNIQUE KEY `idx_phrase_event_text` (`event_id`, `text`);
+-- @if index phrase_models idx_phrase_status_create exists
+ALTER TABLE `phrase_models` DROP KEY `idx_phrase_status_create`;
+-- @if index phrase_models idx_phrase_status_create missing
+ALTER TABLE `phrase_models` ADD KEY `idx_phrase_status_create` (`event_id`, `status`, `create_time`);
+-- @if index phrase_models idx_phrase_status_update exists
+ALTER TABLE `phrase_models` DROP KEY `idx_phrase_status_update`;
+-- @if index phrase_models idx_phrase_status_update missing
+ALTER TABLE `phrase_models` ADD KEY `idx_phrase_status_update` (`event_id`, `status`, `update_time`);
+
+-- @if column phrase_click_models event_id missing
+ALTER TABLE `phrase_click_models` ADD COLUMN `event_id` bigint NOT NULL DEFAULT 1;
+-- @if index phrase_click_models idx_phrase_click_event_time missing
+ALTER TABLE `phrase_click_models` ADD KEY `idx_phrase_click_event_time` (`event_id`, `click_time`);
+
+-- @if column phrase_click_rollup_models event_id missing
+ALTER TABLE `phrase_click_rollup_models` ADD COLUMN `event_id` bigint NOT NULL DEFAULT 1;
+
+-- TiDB changes one thing per statement, the primary key is dropped and added apart
+-- @if column user_models event_id missing
+ALTER TABLE `user_models` ADD COLUMN `event_id` bigint NOT NULL DEFAULT 1;
+-- @if index user_models PRIMARY exists
+ALTER TABLE `user_models` DROP PRIMARY KEY;
+-- @if index user_models PRIMARY missing
+ALTER TABLE `user_models` ADD PRIMARY KEY (`event_id`, `open_id`);
+
+CREATE OR REPLACE VIEW `all_phrase_clicks` AS
+  SELECT `event_id`, `phrase_id`, `group_id`, `open_id`, `clicks`, `click_time` FROM `phrase_click_models`
+  UNION ALL
+  SELECT `event_id`, `phrase_id`, `group_id`, `open_id`, `clicks`, `click_time` FROM `phrase_click_rollup_models`;
@@ -0,0 +1,7 @@
+-- @if index notification_models idx_notification_event_open_id exists
+ALTER TABLE `notification_models` DROP KEY `idx_notification_event_open_id`;
+-- @if column notification_models event_id exists
+ALTER TABLE `notification_models` DROP COLUMN `event_id`;
+
+-- @if column webhook_subscription_models event_id exists
+ALTER TABLE `webhook_subscription_models` DROP COLUMN `event_id`;
@@ -0,0 +1,12 @@
+-- webhook subscriptions and notifications belong to an event, the existing subscriptions to the default
+-- event and the existing notifications to the event of their phrase
+-- @if column webhook_subscription_models event_id missing
+ALTER TABLE `webhook_subscription_models` ADD COLUMN `event_id` bigint NOT NULL DEFAULT 1;
+
+-- @if column notification_models event_id missing
+ALTER TABLE `notification_models` ADD COLUMN `event_id` bigint NOT NULL DEFAULT 1;
+-- @if index notification_models idx_notification_event_open_id missing
+ALTER TABLE `notification_models` ADD KEY `idx_notification_event_open_id` (`event_id`, `open_id`);
+UPDATE `notification_models` SET `event_id` = (
+  SELECT `event_id` FROM `phrase_models` WHERE `phrase_models`.`phrase_id` = `notification_models`.`phrase_id`
+) WHERE `phrase_id` IN (SELECT `phrase_id` FROM `phrase_models`);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS `phrase_click_total_models`;
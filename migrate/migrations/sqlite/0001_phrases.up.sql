@@ -0,0 +1,38 @@
+CREATE TABLE IF NOT EXISTS `phrase_models` (
+  `phrase_id` integer,
+  `text` text,
+  `group_id` integer,
+  `open_id` text,
+  `status` integer,
+  `create_time` integer,
+  `update_time` integer,
+  PRIMARY KEY (`phrase_id`)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `text` ON `phrase_models` (`text`);
+CREATE INDEX IF NOT EXISTS `idx_phrase_status_create` ON `phrase_models` (`status`, `create_time`);
+CREATE INDEX IF NOT EXISTS `idx_phrase_status_update` ON `phrase_models` (`status`, `update_time`);
+
+CREATE TABLE IF NOT EXISTS `phrase_click_models` (
+  `id` integer,
+  `phrase_id` integer,
+  `group_id` integer,
+  `open_id` text,
+  `clicks` integer,
+  `click_time` integer,
+  PRIMARY KEY (`id`)
+);
+CREATE INDEX IF NOT EXISTS `idx_phrase_click` ON `phrase_click_models` (`phrase_id`, `group_id`, `clicks`);
+
+CREATE TABLE IF NOT EXISTS `user_models` (
+  `open_id` text,
+  `nick_name` text,
+  `sex` integer,
+  `province` text,
+  `city` text,
+  `head_img_url` text,
+  PRIMARY KEY (`open_id`)
+);
+
+-- databases set up before migrations existed got their indexes from AutoMigrate, the status index
+-- is replaced by the ones above
+DROP INDEX IF EXISTS `idx_phrase_models_status`;
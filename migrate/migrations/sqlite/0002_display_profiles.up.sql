@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS `display_profile_models` (
+  `name` text,
+  `settings` text,
+  `update_time` integer,
+  PRIMARY KEY (`name`)
+);
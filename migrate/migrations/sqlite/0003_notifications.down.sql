@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS `notification_delivery_models`;
+DROP TABLE IF EXISTS `notification_models`;
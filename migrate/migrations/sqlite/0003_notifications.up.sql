@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS `notification_models` (
+  `id` integer,
+  `open_id` text,
+  `event` text,
+  `phrase_id` integer,
+  `text` text,
+  `clicks` integer,
+  `dedup_key` text,
+  `is_read` numeric,
+  `create_time` integer,
+  PRIMARY KEY (`id`)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_notification_dedup` ON `notification_models` (`dedup_key`);
+CREATE INDEX IF NOT EXISTS `idx_notification_open_id` ON `notification_models` (`open_id`);
+
+CREATE TABLE IF NOT EXISTS `notification_delivery_models` (
+  `id` integer,
+  `notification_id` integer,
+  `channel` text,
+  `status` integer,
+  `attempts` integer,
+  `next_attempt_time` integer,
+  `last_error` text,
+  `update_time` integer,
+  PRIMARY KEY (`id`)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_notification_channel` ON `notification_delivery_models` (`notification_id`, `channel`);
+CREATE INDEX IF NOT EXISTS `idx_delivery_status_time` ON `notification_delivery_models` (`status`, `next_attempt_time`);
@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS `phrase_audit_models` (
+  `id` integer,
+  `phrase_id` integer,
+  `actor` text,
+  `action` text,
+  `old_text` text,
+  `new_text` text,
+  `old_status` integer,
+  `new_status` integer,
+  `reason_code` text,
+  `reason` text,
+  `create_time` integer,
+  PRIMARY KEY (`id`)
+);
+CREATE INDEX IF NOT EXISTS `idx_phrase_audit_phrase` ON `phrase_audit_models` (`phrase_id`);
+CREATE INDEX IF NOT EXISTS `idx_phrase_audit_actor` ON `phrase_audit_models` (`actor`);
+CREATE INDEX IF NOT EXISTS `idx_phrase_audit_action` ON `phrase_audit_models` (`action`);
+CREATE INDEX IF NOT EXISTS `idx_phrase_audit_time` ON `phrase_audit_models` (`create_time`);
+
+CREATE TABLE IF NOT EXISTS `phrase_claim_models` (
+  `phrase_id` integer,
+  `reviewer` text,
+  `claim_time` integer,
+  `lease_until` integer,
+  PRIMARY KEY (`phrase_id`)
+);
+CREATE INDEX IF NOT EXISTS `idx_phrase_claim_reviewer` ON `phrase_claim_models` (`reviewer`);
+CREATE INDEX IF NOT EXISTS `idx_phrase_claim_lease` ON `phrase_claim_models` (`lease_until`);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS `webhook_attempt_models`;
+DROP TABLE IF EXISTS `webhook_delivery_models`;
+DROP TABLE IF EXISTS `webhook_event_models`;
+DROP TABLE IF EXISTS `webhook_subscription_models`;
@@ -0,0 +1,51 @@
+CREATE TABLE IF NOT EXISTS `webhook_subscription_models` (
+  `id` integer,
+  `url` text,
+  `secret` text,
+  `events` text,
+  `description` text,
+  `enabled` numeric,
+  `create_time` integer,
+  `update_time` integer,
+  PRIMARY KEY (`id`)
+);
+
+CREATE TABLE IF NOT EXISTS `webhook_event_models` (
+  `id` integer,
+  `event` text,
+  `payload` text,
+  `dedup_key` text,
+  `create_time` integer,
+  PRIMARY KEY (`id`)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_webhook_event_dedup` ON `webhook_event_models` (`dedup_key`);
+CREATE INDEX IF NOT EXISTS `idx_webhook_event` ON `webhook_event_models` (`event`);
+
+CREATE TABLE IF NOT EXISTS `webhook_delivery_models` (
+  `id` integer,
+  `event_id` integer,
+  `subscription_id` integer,
+  `status` integer,
+  `attempts` integer,
+  `next_attempt_time` integer,
+  `last_status_code` integer,
+  `last_error` text,
+  `create_time` integer,
+  `update_time` integer,
+  PRIMARY KEY (`id`)
+);
+CREATE INDEX IF NOT EXISTS `idx_webhook_delivery_event` ON `webhook_delivery_models` (`event_id`);
+CREATE INDEX IF NOT EXISTS `idx_webhook_delivery_subscription` ON `webhook_delivery_models` (`subscription_id`);
+CREATE INDEX IF NOT EXISTS `idx_webhook_delivery_status_time` ON `webhook_delivery_models` (`status`, `next_attempt_time`);
+
+CREATE TABLE IF NOT EXISTS `webhook_attempt_models` (
+  `id` integer,
+  `delivery_id` integer,
+  `attempt` integer,
+  `status_code` integer,
+  `error` text,
+  `duration_ms` integer,
+  `attempt_time` integer,
+  PRIMARY KEY (`id`)
+);
+CREATE INDEX IF NOT EXISTS `idx_webhook_attempt_delivery` ON `webhook_attempt_models` (`delivery_id`);
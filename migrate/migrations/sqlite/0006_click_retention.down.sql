@@ -0,0 +1,4 @@
+DROP VIEW IF EXISTS `all_phrase_clicks`;
+DROP INDEX IF EXISTS `idx_phrase_click_time`;
+DROP TABLE IF EXISTS `click_archive_models`;
+DROP TABLE IF EXISTS `phrase_click_rollup_models`;
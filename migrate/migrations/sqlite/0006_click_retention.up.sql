@@ -0,0 +1,35 @@
+-- click records older than retention.days are compacted into rollups, analytic queries
+-- read both through all_phrase_clicks
+CREATE TABLE IF NOT EXISTS `phrase_click_rollup_models` (
+  `id` integer,
+  `bucket_time` integer,
+  `phrase_id` integer,
+  `group_id` integer,
+  `open_id` text,
+  `clicks` integer,
+  `click_time` integer,
+  `records` integer,
+  PRIMARY KEY (`id`)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_phrase_click_rollup` ON `phrase_click_rollup_models` (`bucket_time`, `phrase_id`, `group_id`, `open_id`);
+
+CREATE TABLE IF NOT EXISTS `click_archive_models` (
+  `id` integer,
+  `file` text,
+  `records` integer,
+  `clicks` integer,
+  `first_record` integer,
+  `min_click_time` integer,
+  `max_click_time` integer,
+  `create_time` integer,
+  PRIMARY KEY (`id`)
+);
+CREATE INDEX IF NOT EXISTS `idx_click_archive_time` ON `click_archive_models` (`create_time`);
+
+-- the retention job picks the oldest click records first
+CREATE INDEX IF NOT EXISTS `idx_phrase_click_time` ON `phrase_click_models` (`click_time`);
+
+CREATE VIEW IF NOT EXISTS `all_phrase_clicks` AS
+  SELECT `phrase_id`, `group_id`, `open_id`, `clicks`, `click_time` FROM `phrase_click_models`
+  UNION ALL
+  SELECT `phrase_id`, `group_id`, `open_id`, `clicks`, `click_time` FROM `phrase_click_rollup_models`;
@@ -0,0 +1,75 @@
+-- fails when a text is used by several events, remove the other events' phrases first.
+-- SQLite can't drop the event_id columns, the tables are rebuilt without them.
+DROP VIEW IF EXISTS `all_phrase_clicks`;
+
+CREATE TABLE `user_models_single` (
+  `open_id` text,
+  `nick_name` text,
+  `sex` integer,
+  `province` text,
+  `city` text,
+  `head_img_url` text,
+  PRIMARY KEY (`open_id`)
+);
+INSERT INTO `user_models_single` (`open_id`, `nick_name`, `sex`, `province`, `city`, `head_img_url`)
+  SELECT `open_id`, `nick_name`, `sex`, `province`, `city`, `head_img_url` FROM `user_models` WHERE `event_id` = 1;
+DROP TABLE `user_models`;
+ALTER TABLE `user_models_single` RENAME TO `user_models`;
+
+CREATE TABLE `phrase_click_rollup_models_single` (
+  `id` integer,
+  `bucket_time` integer,
+  `phrase_id` integer,
+  `group_id` integer,
+  `open_id` text,
+  `clicks` integer,
+  `click_time` integer,
+  `records` integer,
+  PRIMARY KEY (`id`)
+);
+INSERT INTO `phrase_click_rollup_models_single` (`id`, `bucket_time`, `phrase_id`, `group_id`, `open_id`, `clicks`, `click_time`, `records`)
+  SELECT `id`, `bucket_time`, `phrase_id`, `group_id`, `open_id`, `clicks`, `click_time`, `records` FROM `phrase_click_rollup_models`;
+DROP TABLE `phrase_click_rollup_models`;
+ALTER TABLE `phrase_click_rollup_models_single` RENAME TO `phrase_click_rollup_models`;
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_phrase_click_rollup` ON `phrase_click_rollup_models` (`bucket_time`, `phrase_id`, `group_id`, `open_id`);
+
+CREATE TABLE `phrase_click_models_single` (
+  `id` integer,
+  `phrase_id` integer,
+  `group_id` integer,
+  `open_id` text,
+  `clicks` integer,
+  `click_time` integer,
+  PRIMARY KEY (`id`)
+);
+INSERT INTO `phrase_click_models_single` (`id`, `phrase_id`, `group_id`, `open_id`, `clicks`, `click_time`)
+  SELECT `id`, `phrase_id`, `group_id`, `open_id`, `clicks`, `click_time` FROM `phrase_click_models`;
+DROP TABLE `phrase_click_models`;
+ALTER TABLE `phrase_click_models_single` RENAME TO `phrase_click_models`;
+CREATE INDEX IF NOT EXISTS `idx_phrase_click` ON `phrase_click_models` (`phrase_id`, `group_id`, `clicks`);
+CREATE INDEX IF NOT EXISTS `idx_phrase_click_time` ON `phrase_click_models` (`click_time`);
+
+CREATE TABLE `phrase_models_single` (
+  `phrase_id` integer,
+  `text` text,
+  `group_id` integer,
+  `open_id` text,
+  `status` integer,
+  `create_time` integer,
+  `update_time` integer,
+  PRIMARY KEY (`phrase_id`)
+);
+INSERT INTO `phrase_models_single` (`phrase_id`, `text`, `group_id`, `open_id`, `status`, `create_time`, `update_time`)
+  SELECT `phrase_id`, `text`, `group_id`, `open_id`, `status`, `create_time`, `update_time` FROM `phrase_models`;
+DROP TABLE `phrase_models`;
+ALTER TABLE `phrase_models_single` RENAME TO `phrase_models`;
+CREATE UNIQUE INDEX IF NOT EXISTS `text` ON `phrase_models` (`text`);
+CREATE INDEX IF NOT EXISTS `idx_phrase_status_create` ON `phrase_models` (`status`, `create_time`);
+CREATE INDEX IF NOT EXISTS `idx_phrase_status_update` ON `phrase_models` (`status`, `update_time`);
+
+CREATE VIEW `all_phrase_clicks` AS
+  SELECT `phrase_id`, `group_id`, `open_id`, `clicks`, `click_time` FROM `phrase_click_models`
+  UNION ALL
+  SELECT `phrase_id`, `group_id`, `open_id`, `clicks`, `click_time` FROM `phrase_click_rollup_models`;
+
+DROP TABLE IF EXISTS `event_models`;
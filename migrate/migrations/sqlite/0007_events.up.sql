@@ -0,0 +1,51 @@
+-- events share the database, a phrase text is unique within its event and a user
+-- has a profile per event
+CREATE TABLE IF NOT EXISTS `event_models` (
+  `event_id` integer,
+  `slug` text NOT NULL,
+  `name` text,
+  `settings` text,
+  `create_time` integer,
+  `update_time` integer,
+  PRIMARY KEY (`event_id`)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_event_slug` ON `event_models` (`slug`);
+
+-- the rows written before events existed belong to the default event
+INSERT OR IGNORE INTO `event_models` (`event_id`, `slug`, `name`, `settings`, `create_time`, `update_time`)
+  VALUES (1, 'default', 'Default', '{}', strftime('%s', 'now'), strftime('%s', 'now'));
+
+ALTER TABLE `phrase_models` ADD COLUMN `event_id` integer NOT NULL DEFAULT 1;
+DROP INDEX IF EXISTS `text`;
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_phrase_event_text` ON `phrase_models` (`event_id`, `text`);
+DROP INDEX IF EXISTS `idx_phrase_status_create`;
+CREATE INDEX IF NOT EXISTS `idx_phrase_status_create` ON `phrase_models` (`event_id`, `status`, `create_time`);
+DROP INDEX IF EXISTS `idx_phrase_status_update`;
+CREATE INDEX IF NOT EXISTS `idx_phrase_status_update` ON `phrase_models` (`event_id`, `status`, `update_time`);
+
+ALTER TABLE `phrase_click_models` ADD COLUMN `event_id` integer NOT NULL DEFAULT 1;
+CREATE INDEX IF NOT EXISTS `idx_phrase_click_event_time` ON `phrase_click_models` (`event_id`, `click_time`);
+
+ALTER TABLE `phrase_click_rollup_models` ADD COLUMN `event_id` integer NOT NULL DEFAULT 1;
+
+-- SQLite can't change a primary key, the users table is rebuilt
+CREATE TABLE `user_models_events` (
+  `event_id` integer NOT NULL DEFAULT 1,
+  `open_id` text,
+  `nick_name` text,
+  `sex` integer,
+  `province` text,
+  `city` text,
+  `head_img_url` text,
+  PRIMARY KEY (`event_id`, `open_id`)
+);
+INSERT INTO `user_models_events` (`event_id`, `open_id`, `nick_name`, `sex`, `province`, `city`, `head_img_url`)
+  SELECT 1, `open_id`, `nick_name`, `sex`, `province`, `city`, `head_img_url` FROM `user_models`;
+DROP TABLE `user_models`;
+ALTER TABLE `user_models_events` RENAME TO `user_models`;
+
+DROP VIEW IF EXISTS `all_phrase_clicks`;
+CREATE VIEW `all_phrase_clicks` AS
+  SELECT `event_id`, `phrase_id`, `group_id`, `open_id`, `clicks`, `click_time` FROM `phrase_click_models`
+  UNION ALL
+  SELECT `event_id`, `phrase_id`, `group_id`, `open_id`, `clicks`, `click_time` FROM `phrase_click_rollup_models`;
@@ -0,0 +1,35 @@
+-- SQLite can't drop the event_id columns, the tables are rebuilt without them
+CREATE TABLE `notification_models_single` (
+  `id` integer,
+  `open_id` text,
+  `event` text,
+  `phrase_id` integer,
+  `text` text,
+  `clicks` integer,
+  `dedup_key` text,
+  `is_read` numeric,
+  `create_time` integer,
+  PRIMARY KEY (`id`)
+);
+INSERT INTO `notification_models_single` (`id`, `open_id`, `event`, `phrase_id`, `text`, `clicks`, `dedup_key`, `is_read`, `create_time`)
+  SELECT `id`, `open_id`, `event`, `phrase_id`, `text`, `clicks`, `dedup_key`, `is_read`, `create_time` FROM `notification_models`;
+DROP TABLE `notification_models`;
+ALTER TABLE `notification_models_single` RENAME TO `notification_models`;
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_notification_dedup` ON `notification_models` (`dedup_key`);
+CREATE INDEX IF NOT EXISTS `idx_notification_open_id` ON `notification_models` (`open_id`);
+
+CREATE TABLE `webhook_subscription_models_single` (
+  `id` integer,
+  `url` text,
+  `secret` text,
+  `events` text,
+  `description` text,
+  `enabled` numeric,
+  `create_time` integer,
+  `update_time` integer,
+  PRIMARY KEY (`id`)
+);
+INSERT INTO `webhook_subscription_models_single` (`id`, `url`, `secret`, `events`, `description`, `enabled`, `create_time`, `update_time`)
+  SELECT `id`, `url`, `secret`, `events`, `description`, `enabled`, `create_time`, `update_time` FROM `webhook_subscription_models`;
+DROP TABLE `webhook_subscription_models`;
+ALTER TABLE `webhook_subscription_models_single` RENAME TO `webhook_subscription_models`;
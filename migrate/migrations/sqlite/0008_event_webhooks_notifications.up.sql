@@ -0,0 +1,9 @@
+-- webhook subscriptions and notifications belong to an event, the existing subscriptions to the default
+-- event and the existing notifications to the event of their phrase
+ALTER TABLE `webhook_subscription_models` ADD COLUMN `event_id` integer NOT NULL DEFAULT 1;
+
+ALTER TABLE `notification_models` ADD COLUMN `event_id` integer NOT NULL DEFAULT 1;
+CREATE INDEX IF NOT EXISTS `idx_notification_event_open_id` ON `notification_models` (`event_id`, `open_id`);
+UPDATE `notification_models` SET `event_id` = (
+  SELECT `event_id` FROM `phrase_models` WHERE `phrase_models`.`phrase_id` = `notification_models`.`phrase_id`
+) WHERE `phrase_id` IN (SELECT `phrase_id` FROM `phrase_models`);
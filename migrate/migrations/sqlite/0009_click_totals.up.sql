@@ -0,0 +1,13 @@
+-- the total clicks of each phrase, kept with the click records so phrase lists sort and filter by clicks
+-- without summing all_phrase_clicks
+CREATE TABLE IF NOT EXISTS `phrase_click_total_models` (
+  `event_id` integer NOT NULL DEFAULT 1,
+  `phrase_id` integer NOT NULL,
+  `clicks` integer,
+  PRIMARY KEY (`event_id`, `phrase_id`)
+);
+CREATE INDEX IF NOT EXISTS `idx_phrase_click_total_event` ON `phrase_click_total_models` (`event_id`, `clicks`);
+
+DELETE FROM `phrase_click_total_models`;
+INSERT INTO `phrase_click_total_models` (`event_id`, `phrase_id`, `clicks`)
+  SELECT `event_id`, `phrase_id`, SUM(`clicks`) FROM `all_phrase_clicks` GROUP BY `event_id`, `phrase_id`;
@@ -3,29 +3,202 @@ package model
 // table `phrase_click_model` schema
 type PhraseClickModel struct {
 	ID        int    `gorm:"primaryKey" json:"id"`
+	EventID   int    `gorm:"index:idx_phrase_click_event_time,priority:1;not null;default:1" json:"event_id"`
 	PhraseID  int    `gorm:"index:idx_phrase_click" json:"phrase_id"`
 	GroupID   int    `gorm:"index:idx_phrase_click" json:"group_id"`
 	OpenID    string `json:"open_id"`
 	Clicks    int    `gorm:"index:idx_phrase_click" json:"clicks"`
-	ClickTime int64  `json:"click_time"`
+	ClickTime int64  `gorm:"index:idx_phrase_click_event_time,priority:2" json:"click_time"`
 }
 
-// table `phrase_model` schema
+// table `phrase_click_rollup_models` schema, the clicks of a user on a phrase within a bucket,
+// compacted from click records older than retention.days
+type PhraseClickRollupModel struct {
+	ID         int    `gorm:"primaryKey" json:"id"`
+	EventID    int    `gorm:"not null;default:1" json:"event_id"`
+	BucketTime int64  `gorm:"uniqueIndex:idx_phrase_click_rollup,priority:1" json:"bucket_time"`
+	PhraseID   int    `gorm:"uniqueIndex:idx_phrase_click_rollup,priority:2" json:"phrase_id"`
+	GroupID    int    `gorm:"uniqueIndex:idx_phrase_click_rollup,priority:3" json:"group_id"`
+	OpenID     string `gorm:"uniqueIndex:idx_phrase_click_rollup,priority:4;size:191" json:"open_id"`
+	Clicks     int    `json:"clicks"`
+	// time of the last click compacted into it
+	ClickTime int64 `json:"click_time"`
+	// click records compacted into it
+	Records int `json:"records"`
+}
+
+// table `phrase_click_total_models` schema, the total clicks of a phrase, updated with the click records
+// so phrase lists sort and filter by clicks without summing them
+type PhraseClickTotalModel struct {
+	EventID  int `gorm:"primaryKey;autoIncrement:false;index:idx_phrase_click_total_event,priority:1;default:1" json:"event_id"`
+	PhraseID int `gorm:"primaryKey;autoIncrement:false" json:"phrase_id"`
+	Clicks   int `gorm:"index:idx_phrase_click_total_event,priority:2" json:"clicks"`
+}
+
+// table `click_archive_models` schema, a batch of click records compacted by the retention job
+type ClickArchiveModel struct {
+	ID int `gorm:"primaryKey" json:"id"`
+	// gzipped json lines of the records, empty when they were deleted without an archive
+	File         string `gorm:"size:512" json:"file"`
+	Records      int    `json:"records"`
+	Clicks       int    `json:"clicks"`
+	FirstRecord  int    `json:"first_record"`
+	MinClickTime int64  `json:"min_click_time"`
+	MaxClickTime int64  `json:"max_click_time"`
+	CreateTime   int64  `gorm:"index:idx_click_archive_time" json:"create_time"`
+}
+
+// table `phrase_model` schema, the phrase list of an event pages through a status by create or update time
 type PhraseModel struct {
-	PhraseID   int    `gorm:"primaryKey" json:"phrase_id"`
-	Text       string `gorm:"uniqueIndex:text;size:60" json:"text"`
-	GroupID    int    `json:"group_id"`
-	OpenID     string `json:"open_id"`
-	Status     int    `gorm:"index" json:"status"`
-	CreateTime int64  `json:"create_time"`
-	UpdateTime int64  `json:"update_time"`
+	PhraseID   int          `gorm:"primaryKey" json:"phrase_id"`
+	EventID    int          `gorm:"uniqueIndex:idx_phrase_event_text,priority:1;index:idx_phrase_status_create,priority:1;index:idx_phrase_status_update,priority:1;not null;default:1" json:"event_id"`
+	Text       string       `gorm:"uniqueIndex:idx_phrase_event_text,priority:2;size:60" json:"text"`
+	GroupID    int          `json:"group_id"`
+	OpenID     string       `json:"open_id"`
+	Status     PhraseStatus `gorm:"index:idx_phrase_status_create,priority:2;index:idx_phrase_status_update,priority:2" json:"status"`
+	CreateTime int64        `gorm:"index:idx_phrase_status_create,priority:3" json:"create_time"`
+	UpdateTime int64        `gorm:"index:idx_phrase_status_update,priority:3" json:"update_time"`
 }
 
+// table `user_models` schema, a user has a profile per event it joined
 type UserModel struct {
-	OpenID     string `gorm:"primaryKey" json:"open_id" binding:"required"`
+	EventID    int    `gorm:"primaryKey;autoIncrement:false;default:1" json:"event_id"`
+	OpenID     string `gorm:"primaryKey;size:191" json:"open_id"`
 	NickName   string `json:"nick_name"`
 	Sex        int    `json:"sex"`
 	Province   string `json:"province"`
 	City       string `json:"city"`
 	HeadImgURL string `json:"headimgurl"`
 }
+
+// the event the rows written before events existed belong to, unscoped requests use it
+const (
+	DefaultEventID   = 1
+	DefaultEventSlug = "default"
+)
+
+// table `event_models` schema, a conference, meetup or hackathon with its own wall
+type EventModel struct {
+	EventID int    `gorm:"primaryKey" json:"event_id"`
+	Slug    string `gorm:"uniqueIndex:idx_event_slug;size:64" json:"slug"`
+	Name    string `gorm:"size:255" json:"name"`
+	// json of the event's config.EventConfig, unset keys fall back to the config file
+	Settings   string `gorm:"type:text" json:"settings"`
+	CreateTime int64  `json:"create_time"`
+	UpdateTime int64  `json:"update_time"`
+}
+
+// table `display_profile_models` schema, display profiles edited at runtime
+type DisplayProfileModel struct {
+	Name       string `gorm:"primaryKey;size:64" json:"name"`
+	Settings   string `gorm:"type:text" json:"settings"`
+	UpdateTime int64  `json:"update_time"`
+}
+
+// table `notification_models` schema, the in-app inbox of phrase authors
+type NotificationModel struct {
+	ID       int    `gorm:"primaryKey" json:"id"`
+	EventID  int    `gorm:"index:idx_notification_event_open_id,priority:1;not null;default:1" json:"event_id"`
+	OpenID   string `gorm:"index:idx_notification_open_id;index:idx_notification_event_open_id,priority:2;size:191" json:"open_id"`
+	Event    string `gorm:"size:32" json:"event"`
+	PhraseID int    `json:"phrase_id"`
+	Text     string `gorm:"size:60" json:"text"`
+	Clicks   int    `json:"clicks"`
+	// the same notification is stored and delivered once
+	DedupKey   string `gorm:"uniqueIndex:idx_notification_dedup;size:128" json:"-"`
+	IsRead     bool   `json:"is_read"`
+	CreateTime int64  `json:"create_time"`
+}
+
+// table `notification_delivery_models` schema, delivery of a notification to one outbound channel
+type NotificationDeliveryModel struct {
+	ID              int    `gorm:"primaryKey" json:"id"`
+	NotificationID  int    `gorm:"uniqueIndex:idx_notification_channel" json:"notification_id"`
+	Channel         string `gorm:"uniqueIndex:idx_notification_channel;size:32" json:"channel"`
+	Status          int    `gorm:"index:idx_delivery_status_time" json:"status"`
+	Attempts        int    `json:"attempts"`
+	NextAttemptTime int64  `gorm:"index:idx_delivery_status_time" json:"next_attempt_time"`
+	LastError       string `gorm:"type:text" json:"last_error"`
+	UpdateTime      int64  `json:"update_time"`
+}
+
+// table `phrase_audit_models` schema, a change of a phrase made through the management portal
+type PhraseAuditModel struct {
+	ID       int    `gorm:"primaryKey" json:"id"`
+	PhraseID int    `gorm:"index:idx_phrase_audit_phrase" json:"phrase_id"`
+	Actor    string `gorm:"index:idx_phrase_audit_actor;size:64" json:"actor"`
+	Action   string `gorm:"index:idx_phrase_audit_action;size:32" json:"action"`
+	// text and status before and after the change
+	OldText   string       `gorm:"size:60" json:"old_text"`
+	NewText   string       `gorm:"size:60" json:"new_text"`
+	OldStatus PhraseStatus `json:"old_status"`
+	NewStatus PhraseStatus `json:"new_status"`
+	// reason code of a moderation decision, one of moderation.reason_codes
+	ReasonCode string `gorm:"size:32" json:"reason_code"`
+	Reason     string `gorm:"size:255" json:"reason"`
+	CreateTime int64  `gorm:"index:idx_phrase_audit_time" json:"create_time"`
+}
+
+// table `phrase_claim_models` schema, a pending phrase claimed by a reviewer of the moderation queue
+type PhraseClaimModel struct {
+	PhraseID  int    `gorm:"primaryKey;autoIncrement:false" json:"phrase_id"`
+	Reviewer  string `gorm:"index:idx_phrase_claim_reviewer;size:64" json:"reviewer"`
+	ClaimTime int64  `json:"claim_time"`
+	// other reviewers can claim the phrase after the lease expires
+	LeaseUntil int64 `gorm:"index:idx_phrase_claim_lease" json:"lease_until"`
+}
+
+// table `webhook_subscription_models` schema, an endpoint of event organizers' systems
+type WebhookSubscriptionModel struct {
+	ID int `gorm:"primaryKey" json:"id"`
+	// the event whose webhook events it receives
+	EventID int    `gorm:"not null;default:1" json:"event_id"`
+	URL     string `gorm:"size:512" json:"url"`
+	// key signing the payloads, only returned when the subscription is created
+	Secret string `gorm:"size:64" json:"-"`
+	// comma separated events, * subscribes to all events
+	Events      string `gorm:"size:512" json:"events"`
+	Description string `gorm:"size:255" json:"description"`
+	Enabled     bool   `json:"enabled"`
+	CreateTime  int64  `json:"create_time"`
+	UpdateTime  int64  `json:"update_time"`
+}
+
+// table `webhook_event_models` schema, an event emitted to the webhook subscriptions
+type WebhookEventModel struct {
+	ID    int    `gorm:"primaryKey" json:"id"`
+	Event string `gorm:"index:idx_webhook_event;size:32" json:"event"`
+	// json data of the event
+	Payload string `gorm:"type:text" json:"payload"`
+	// the same event is emitted once
+	DedupKey   string `gorm:"uniqueIndex:idx_webhook_event_dedup;size:128" json:"-"`
+	CreateTime int64  `json:"create_time"`
+}
+
+// table `webhook_delivery_models` schema, delivery of an event to one subscription
+type WebhookDeliveryModel struct {
+	ID              int    `gorm:"primaryKey" json:"id"`
+	EventID         int    `gorm:"index:idx_webhook_delivery_event" json:"event_id"`
+	SubscriptionID  int    `gorm:"index:idx_webhook_delivery_subscription" json:"subscription_id"`
+	Status          int    `gorm:"index:idx_webhook_delivery_status_time" json:"status"`
+	Attempts        int    `json:"attempts"`
+	NextAttemptTime int64  `gorm:"index:idx_webhook_delivery_status_time" json:"next_attempt_time"`
+	LastStatusCode  int    `json:"last_status_code"`
+	LastError       string `gorm:"type:text" json:"last_error"`
+	CreateTime      int64  `json:"create_time"`
+	UpdateTime      int64  `json:"update_time"`
+}
+
+// table `webhook_attempt_models` schema, one http request of a delivery
+type WebhookAttemptModel struct {
+	ID          int    `gorm:"primaryKey" json:"id"`
+	DeliveryID  int    `gorm:"index:idx_webhook_attempt_delivery" json:"delivery_id"`
+	Attempt     int    `json:"attempt"`
+	StatusCode  int    `json:"status_code"`
+	Error       string `gorm:"type:text" json:"error"`
+	DurationMs  int64  `json:"duration_ms"`
+	AttemptTime int64  `json:"attempt_time"`
+}
+
+// open_id of the phrases and clicks of deleted users starts with it
+const AnonymousOpenIDPrefix = "anon-"
@@ -0,0 +1,136 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PhraseStatus is the moderation state of a phrase, stored as an int in `phrase_models`.status
+type PhraseStatus int
+
+const (
+	// submitted, waiting for review
+	StatusPending PhraseStatus = 1
+	// reviewed, shown on the wall
+	StatusApproved PhraseStatus = 2
+	// removed by an admin
+	StatusDeleted PhraseStatus = 3
+	// turned down in review
+	StatusRejected PhraseStatus = 4
+	// approved but taken off the wall for now
+	StatusHidden PhraseStatus = 5
+)
+
+var phraseStatusNames = map[PhraseStatus]string{
+	StatusPending:  "pending",
+	StatusApproved: "approved",
+	StatusDeleted:  "deleted",
+	StatusRejected: "rejected",
+	StatusHidden:   "hidden",
+}
+
+// transitions allowed by review and admin edits
+var phraseStatusTransitions = map[PhraseStatus][]PhraseStatus{
+	StatusPending:  {StatusApproved, StatusRejected, StatusDeleted},
+	StatusApproved: {StatusHidden, StatusDeleted},
+	StatusHidden:   {StatusApproved, StatusDeleted},
+	StatusRejected: {StatusDeleted},
+}
+
+// statuses a phrase is restored to from each status, the status it had before is preferred
+var phraseStatusRestores = map[PhraseStatus][]PhraseStatus{
+	StatusRejected: {StatusPending},
+	StatusDeleted:  {StatusPending, StatusApproved},
+	StatusHidden:   {StatusApproved},
+}
+
+func (s PhraseStatus) String() string {
+	if name, ok := phraseStatusNames[s]; ok {
+		return name
+	}
+	return strconv.Itoa(int(s))
+}
+
+func (s PhraseStatus) Valid() bool {
+	_, ok := phraseStatusNames[s]
+	return ok
+}
+
+// ParsePhraseStatus accepts the name or the number of a status
+func ParsePhraseStatus(value string) (PhraseStatus, error) {
+	value = strings.TrimSpace(value)
+	for status, name := range phraseStatusNames {
+		if name == value {
+			return status, nil
+		}
+	}
+	if number, err := strconv.Atoi(value); err == nil && PhraseStatus(number).Valid() {
+		return PhraseStatus(number), nil
+	}
+	return 0, fmt.Errorf("unknown phrase status %q", value)
+}
+
+// UnmarshalJSON accepts the number or the name of a status, statuses are always written as numbers
+func (s *PhraseStatus) UnmarshalJSON(data []byte) error {
+	value := string(data)
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		value = unquoted
+	}
+	// no status given
+	if value == "null" || value == "" || value == "0" {
+		*s = 0
+		return nil
+	}
+	status, err := ParsePhraseStatus(value)
+	if err != nil {
+		return err
+	}
+	*s = status
+	return nil
+}
+
+// ParsePhraseStatuses parses a comma separated list of statuses
+func ParsePhraseStatuses(value string) ([]PhraseStatus, error) {
+	var statuses []PhraseStatus
+	for _, item := range strings.Split(value, ",") {
+		status, err := ParsePhraseStatus(item)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+func contains(statuses []PhraseStatus, status PhraseStatus) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition checks a phrase may move from s to to
+func (s PhraseStatus) Transition(to PhraseStatus) error {
+	if !to.Valid() {
+		return fmt.Errorf("unknown phrase status %v", to)
+	}
+	if !contains(phraseStatusTransitions[s], to) {
+		return fmt.Errorf("phrase status can't change from %v to %v", s, to)
+	}
+	return nil
+}
+
+// Restore returns the status a phrase in s is restored to, previous is the status it had before
+func (s PhraseStatus) Restore(previous PhraseStatus) (PhraseStatus, error) {
+	targets, ok := phraseStatusRestores[s]
+	if !ok {
+		return 0, fmt.Errorf("%v phrases can't be restored", s)
+	}
+	if contains(targets, previous) {
+		return previous, nil
+	}
+	return targets[0], nil
+}
@@ -0,0 +1,75 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParsePhraseStatus(t *testing.T) {
+	for _, value := range []string{"approved", " approved", "2"} {
+		if status, err := ParsePhraseStatus(value); err != nil || status != StatusApproved {
+			t.Fatalf("got %v, %v for %q, want approved", status, err, value)
+		}
+	}
+	for _, value := range []string{"", "6", "archived"} {
+		if status, err := ParsePhraseStatus(value); err == nil {
+			t.Fatalf("got %v for %q, want an error", status, value)
+		}
+	}
+
+	var req struct {
+		Status PhraseStatus `json:"status"`
+	}
+	for body, want := range map[string]PhraseStatus{`{"status":"hidden"}`: StatusHidden, `{"status":4}`: StatusRejected, `{}`: 0} {
+		req.Status = 0
+		if err := json.Unmarshal([]byte(body), &req); err != nil || req.Status != want {
+			t.Fatalf("got %v, %v for %s, want %v", req.Status, err, body, want)
+		}
+	}
+}
+
+func TestTransition(t *testing.T) {
+	tests := []struct {
+		from, to PhraseStatus
+		ok       bool
+	}{
+		{StatusPending, StatusApproved, true},
+		{StatusPending, StatusRejected, true},
+		{StatusPending, StatusHidden, false},
+		{StatusApproved, StatusHidden, true},
+		{StatusApproved, StatusRejected, false},
+		{StatusHidden, StatusApproved, true},
+		{StatusRejected, StatusApproved, false},
+		{StatusRejected, StatusDeleted, true},
+		{StatusDeleted, StatusApproved, false},
+		{StatusApproved, PhraseStatus(9), false},
+	}
+	for _, test := range tests {
+		if err := test.from.Transition(test.to); (err == nil) != test.ok {
+			t.Errorf("%v to %v: got %v, want allowed %v", test.from, test.to, err, test.ok)
+		}
+	}
+}
+
+func TestRestore(t *testing.T) {
+	tests := []struct {
+		from, previous, want PhraseStatus
+	}{
+		{StatusRejected, StatusPending, StatusPending},
+		{StatusDeleted, StatusApproved, StatusApproved},
+		{StatusDeleted, StatusRejected, StatusPending},
+		// no audit record of the last change
+		{StatusDeleted, 0, StatusPending},
+		{StatusHidden, StatusApproved, StatusApproved},
+	}
+	for _, test := range tests {
+		if got, err := test.from.Restore(test.previous); err != nil || got != test.want {
+			t.Errorf("restore %v from before %v: got %v, %v, want %v", test.from, test.previous, got, err, test.want)
+		}
+	}
+	for _, status := range []PhraseStatus{StatusPending, StatusApproved} {
+		if got, err := status.Restore(StatusPending); err == nil {
+			t.Errorf("restored a %v phrase to %v", status, got)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/YiniXu9506/devconG/config"
+	"github.com/YiniXu9506/devconG/model"
+	"go.uber.org/zap"
+)
+
+const (
+	wechatAccessTokenURL   = "https://api.weixin.qq.com/cgi-bin/token"
+	wechatSubscribeSendURL = "https://api.weixin.qq.com/cgi-bin/message/subscribe/send"
+)
+
+// Channel delivers notifications outside the app
+type Channel interface {
+	Name() string
+	Send(ctx context.Context, n *model.NotificationModel) error
+}
+
+// NewChannels builds the outbound channels enabled in the config
+func NewChannels(cfg *config.Manager) []Channel {
+	var channels []Channel
+	for _, name := range cfg.Get().Notify.Channels {
+		switch name {
+		case config.NotifyChannelLog:
+			channels = append(channels, LogChannel{})
+		case config.NotifyChannelWebhook:
+			channels = append(channels, NewWebhookChannel(cfg.Get().Notify.WebhookURL))
+		case config.NotifyChannelWeChat:
+			channels = append(channels, NewWeChatSubscribeChannel(cfg))
+		}
+	}
+	return channels
+}
+
+// LogChannel writes notifications to the log, for local development
+type LogChannel struct{}
+
+func (LogChannel) Name() string {
+	return config.NotifyChannelLog
+}
+
+func (LogChannel) Send(ctx context.Context, n *model.NotificationModel) error {
+	zap.L().Sugar().Infof("notify %v: %v phrase %v %q clicks %v", n.OpenID, n.Event, n.PhraseID, n.Text, n.Clicks)
+	return nil
+}
+
+// WebhookChannel posts notifications as json to a url
+type WebhookChannel struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookChannel(url string) *WebhookChannel {
+	return &WebhookChannel{
+		url:    url,
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (w *WebhookChannel) Name() string {
+	return config.NotifyChannelWebhook
+}
+
+func (w *WebhookChannel) Send(ctx context.Context, n *model.NotificationModel) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded %v", resp.Status)
+	}
+	return nil
+}
+
+// WeChatSubscribeChannel sends wechat subscribe messages,
+// the templates get the phrase text as thing1 and the event as phrase2
+type WeChatSubscribeChannel struct {
+	config *config.Manager
+	client *http.Client
+
+	mu               sync.Mutex
+	accessToken      string
+	accessTokenUntil time.Time
+}
+
+func NewWeChatSubscribeChannel(cfg *config.Manager) *WeChatSubscribeChannel {
+	return &WeChatSubscribeChannel{
+		config: cfg,
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (w *WeChatSubscribeChannel) Name() string {
+	return config.NotifyChannelWeChat
+}
+
+var eventText = map[string]string{
+	EventPhraseApproved: "已通过",
+	EventPhraseRejected: "未通过",
+	EventPhraseDeleted:  "已删除",
+	EventPhraseHot:      "上热门",
+}
+
+func (w *WeChatSubscribeChannel) Send(ctx context.Context, n *model.NotificationModel) error {
+	cfg := w.config.Get()
+	templateID, ok := cfg.Notify.WeChatSubscribe.TemplateIDs[n.Event]
+	if !ok {
+		return nil
+	}
+
+	accessToken, err := w.getAccessToken(ctx, cfg.Auth.WeChat)
+	if err != nil {
+		return err
+	}
+
+	type value struct {
+		Value string `json:"value"`
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"touser":      n.OpenID,
+		"template_id": templateID,
+		"page":        cfg.Notify.WeChatSubscribe.Page,
+		"data": map[string]value{
+			"thing1":  {Value: n.Text},
+			"phrase2": {Value: eventText[n.Event]},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if err := w.call(ctx, http.MethodPost, wechatSubscribeSendURL+"?access_token="+url.QueryEscape(accessToken), body, &result); err != nil {
+		return err
+	}
+	if result.ErrCode != 0 {
+		return fmt.Errorf("subscribe send error %d: %s", result.ErrCode, result.ErrMsg)
+	}
+	return nil
+}
+
+func (w *WeChatSubscribeChannel) getAccessToken(ctx context.Context, app config.WeChatConfig) (string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.accessToken != "" && time.Now().Before(w.accessTokenUntil) {
+		return w.accessToken, nil
+	}
+
+	query := url.Values{}
+	query.Set("grant_type", "client_credential")
+	query.Set("appid", app.AppID)
+	query.Set("secret", app.AppSecret)
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+		ErrCode     int    `json:"errcode"`
+		ErrMsg      string `json:"errmsg"`
+	}
+	if err := w.call(ctx, http.MethodGet, wechatAccessTokenURL+"?"+query.Encode(), nil, &result); err != nil {
+		return "", err
+	}
+	if result.ErrCode != 0 || result.AccessToken == "" {
+		return "", fmt.Errorf("get access token error %d: %s", result.ErrCode, result.ErrMsg)
+	}
+
+	// refresh a minute before it expires
+	w.accessToken = result.AccessToken
+	w.accessTokenUntil = time.Now().Add(time.Duration(result.ExpiresIn)*time.Second - time.Minute)
+	return w.accessToken, nil
+}
+
+func (w *WeChatSubscribeChannel) call(ctx context.Context, method string, url string, body []byte, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("wechat responded " + resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
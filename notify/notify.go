@@ -0,0 +1,358 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/YiniXu9506/devconG/config"
+	"github.com/YiniXu9506/devconG/model"
+	"github.com/YiniXu9506/devconG/utils"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// notification events
+const (
+	EventPhraseApproved = "phrase.approved"
+	EventPhraseRejected = "phrase.rejected"
+	EventPhraseDeleted  = "phrase.deleted"
+	EventPhraseHot      = "phrase.hot"
+)
+
+// delivery status of a notification on an outbound channel
+const (
+	DeliveryPending = 1
+	DeliverySent    = 2
+	DeliveryFailed  = 3
+)
+
+const (
+	// how often due deliveries and phrases which got clicks are processed
+	pollInterval = 3 * time.Second
+	// deliveries picked per poll
+	deliveryBatchSize = 100
+	sendTimeout       = 10 * time.Second
+	// clicked phrases waiting for the hot check, more are dropped
+	clickQueueSize = 4096
+)
+
+// Notification is a message to the author of a phrase, in the inbox of the event of the phrase
+type Notification struct {
+	EventID  int
+	OpenID   string
+	Event    string
+	PhraseID int
+	Text     string
+	Clicks   int
+	// notifications with the same key are stored and delivered once
+	DedupKey string
+}
+
+// Notifier notifies phrase authors
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// ThresholdsFunc returns the lt_clicks_size thresholds of an event
+type ThresholdsFunc func(eventID int) []config.SizeThreshold
+
+// Hub stores notifications in the in-app inbox and delivers them to the outbound channels with retries
+type Hub struct {
+	db     *gorm.DB
+	config *config.Manager
+
+	// mu guards channels and thresholds
+	mu       sync.Mutex
+	channels map[string]Channel
+	// thresholds of the events, h5.lt_clicks_size of the config file when unset
+	thresholds ThresholdsFunc
+
+	clickedCh chan int
+	stopOnce  sync.Once
+	stopCh    chan struct{}
+	doneCh    chan struct{}
+}
+
+func NewHub(db *gorm.DB, cfg *config.Manager, channels []Channel) *Hub {
+	hub := &Hub{
+		db:        db,
+		config:    cfg,
+		clickedCh: make(chan int, clickQueueSize),
+		stopCh:    make(chan struct{}),
+		doneCh:    make(chan struct{}),
+	}
+	hub.SetChannels(channels)
+	go periodDeliver(hub)
+	return hub
+}
+
+// SetChannels replaces the outbound channels, such as after notify.channels was reloaded.
+// Pending deliveries to a channel which is no longer enabled fail.
+func (h *Hub) SetChannels(channels []Channel) {
+	byName := make(map[string]Channel, len(channels))
+	for _, channel := range channels {
+		byName[channel.Name()] = channel
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.channels = byName
+}
+
+func (h *Hub) channel(name string) (Channel, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	channel, ok := h.channels[name]
+	return channel, ok
+}
+
+// Notify stores the notification and queues it for every outbound channel, duplicates are ignored
+func (h *Hub) Notify(ctx context.Context, n Notification) error {
+	// users who deleted their account are not notified
+	if n.OpenID == "" || strings.HasPrefix(n.OpenID, model.AnonymousOpenIDPrefix) {
+		return nil
+	}
+
+	now := time.Now().Unix()
+	record := model.NotificationModel{
+		EventID:    n.EventID,
+		OpenID:     n.OpenID,
+		Event:      n.Event,
+		PhraseID:   n.PhraseID,
+		Text:       n.Text,
+		Clicks:     n.Clicks,
+		DedupKey:   n.DedupKey,
+		CreateTime: now,
+	}
+
+	return h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return nil
+		}
+
+		h.mu.Lock()
+		channels := h.channels
+		h.mu.Unlock()
+		for name := range channels {
+			if err := tx.Create(&model.NotificationDeliveryModel{
+				NotificationID:  record.ID,
+				Channel:         name,
+				Status:          DeliveryPending,
+				NextAttemptTime: now,
+				UpdateTime:      now,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// StatusEvent is the event of a phrase status transition, empty if authors aren't notified of it
+func StatusEvent(fromStatus, toStatus model.PhraseStatus) string {
+	switch {
+	case toStatus == model.StatusApproved && fromStatus == model.StatusPending:
+		return EventPhraseApproved
+	case toStatus == model.StatusRejected:
+		return EventPhraseRejected
+	case toStatus == model.StatusDeleted:
+		return EventPhraseDeleted
+	}
+	return ""
+}
+
+// PhraseStatusChanged notifies the author of the phrase, phrase holds the new status
+func (h *Hub) PhraseStatusChanged(ctx context.Context, phrase model.PhraseModel, fromStatus model.PhraseStatus) {
+	event := StatusEvent(fromStatus, phrase.Status)
+	if event == "" || fromStatus == phrase.Status {
+		return
+	}
+
+	if err := h.Notify(ctx, Notification{
+		EventID:  phrase.EventID,
+		OpenID:   phrase.OpenID,
+		Event:    event,
+		PhraseID: phrase.PhraseID,
+		Text:     phrase.Text,
+		DedupKey: fmt.Sprintf("%s:%d:%d", event, phrase.PhraseID, phrase.UpdateTime),
+	}); err != nil {
+		zap.L().Sugar().Errorf("Error! Notify %v of phrase %v: %v", event, phrase.PhraseID, err)
+	}
+}
+
+// ClicksAdded queues the phrase for the hot check, it never blocks the caller
+func (h *Hub) ClicksAdded(phraseID int) {
+	select {
+	case h.clickedCh <- phraseID:
+	default:
+		zap.L().Sugar().Warnf("click queue is full, skip hot check of phrase %v", phraseID)
+	}
+}
+
+// HotThresholds sets the thresholds the clicks of phrases are checked against, by the event of the phrase
+func (h *Hub) HotThresholds(fn ThresholdsFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.thresholds = fn
+}
+
+// Stop terminates the background delivery goroutine and waits for it to exit
+func (h *Hub) Stop() {
+	h.stopOnce.Do(func() {
+		close(h.stopCh)
+	})
+	<-h.doneCh
+}
+
+// checkHot notifies the author when the clicks of the phrase reached a threshold of lt_clicks_size,
+// only the highest threshold reached is notified and each threshold once
+func (h *Hub) checkHot(phraseID int) {
+	type phraseClicks struct {
+		EventID int
+		OpenID  string
+		Text    string
+		Clicks  int
+	}
+
+	var phrase phraseClicks
+	if err := h.db.Raw("SELECT a.event_id, a.open_id, a.text, sum(b.clicks) as clicks FROM phrase_models as a INNER JOIN all_phrase_clicks as b ON a.phrase_id = b.phrase_id WHERE a.phrase_id = ? GROUP BY a.event_id, a.open_id, a.text", phraseID).
+		Scan(&phrase).Error; err != nil {
+		zap.L().Sugar().Error("Error! Get clicks of phrase for hot check: ", err)
+		return
+	}
+
+	h.mu.Lock()
+	thresholdsOf := h.thresholds
+	h.mu.Unlock()
+
+	thresholds := h.config.Get().H5.LtClicksSize
+	if thresholdsOf != nil {
+		thresholds = thresholdsOf(phrase.EventID)
+	}
+	reached := HotThreshold(phrase.Clicks, thresholds)
+	if reached == 0 {
+		return
+	}
+
+	if err := h.Notify(context.Background(), Notification{
+		EventID:  phrase.EventID,
+		OpenID:   phrase.OpenID,
+		Event:    EventPhraseHot,
+		PhraseID: phraseID,
+		Text:     phrase.Text,
+		Clicks:   reached,
+		DedupKey: fmt.Sprintf("%s:%d:%d", EventPhraseHot, phraseID, reached),
+	}); err != nil {
+		zap.L().Sugar().Errorf("Error! Notify %v of phrase %v: %v", EventPhraseHot, phraseID, err)
+	}
+}
+
+// HotThreshold returns the highest threshold of lt_clicks_size the clicks reached, 0 if none
+func HotThreshold(clicks int, thresholds []config.SizeThreshold) int {
+	reached := 0
+	for _, t := range thresholds {
+		if clicks >= t.Clicks {
+			reached = t.Clicks
+		}
+	}
+	return reached
+}
+
+// deliverDue sends the pending deliveries whose next attempt is due
+func (h *Hub) deliverDue() {
+	notifyConfig := h.config.Get().Notify
+	now := time.Now().Unix()
+
+	var deliveries []model.NotificationDeliveryModel
+	if err := h.db.Where("status = ? AND next_attempt_time <= ?", DeliveryPending, now).
+		Order("next_attempt_time").
+		Limit(deliveryBatchSize).
+		Find(&deliveries).Error; err != nil {
+		zap.L().Sugar().Error("Error! Get due notification deliveries: ", err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		attempts := delivery.Attempts + 1
+		// backoff doubles the retry interval after each failed attempt, up to an hour
+		backoff := utils.Backoff(notifyConfig.RetryIntervalSeconds, delivery.Attempts)
+
+		// claim the delivery, other instances skip it until the next attempt is due
+		claim := h.db.Model(&model.NotificationDeliveryModel{}).
+			Where("id = ? AND attempts = ?", delivery.ID, delivery.Attempts).
+			Updates(map[string]interface{}{"attempts": attempts, "next_attempt_time": now + backoff, "update_time": now})
+		if claim.Error != nil || claim.RowsAffected == 0 {
+			continue
+		}
+
+		err := h.send(delivery)
+		updates := map[string]interface{}{"update_time": time.Now().Unix()}
+		switch {
+		case err == nil:
+			updates["status"] = DeliverySent
+			updates["last_error"] = ""
+		case attempts >= notifyConfig.MaxAttempts:
+			updates["status"] = DeliveryFailed
+			updates["last_error"] = err.Error()
+		default:
+			updates["last_error"] = err.Error()
+		}
+		if err != nil {
+			zap.L().Sugar().Warnf("deliver notification %v to %v, attempt %v: %v", delivery.NotificationID, delivery.Channel, attempts, err)
+		}
+
+		if err := h.db.Model(&model.NotificationDeliveryModel{}).Where("id = ?", delivery.ID).Updates(updates).Error; err != nil {
+			zap.L().Sugar().Error("Error! Update notification delivery: ", err)
+		}
+	}
+}
+
+func (h *Hub) send(delivery model.NotificationDeliveryModel) error {
+	channel, ok := h.channel(delivery.Channel)
+	if !ok {
+		return fmt.Errorf("channel %v is not enabled", delivery.Channel)
+	}
+
+	var notification model.NotificationModel
+	if err := h.db.Where("id = ?", delivery.NotificationID).First(&notification).Error; err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+	return channel.Send(ctx, &notification)
+}
+
+func periodDeliver(hub *Hub) {
+	defer close(hub.doneCh)
+
+	// phrases clicked since the last poll
+	clicked := make(map[int]bool)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case phraseID := <-hub.clickedCh:
+			clicked[phraseID] = true
+		case <-ticker.C:
+			for phraseID := range clicked {
+				hub.checkHot(phraseID)
+			}
+			clicked = make(map[int]bool)
+			hub.deliverDue()
+		case <-hub.stopCh:
+			return
+		}
+	}
+}
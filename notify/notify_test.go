@@ -0,0 +1,252 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/YiniXu9506/devconG/config"
+	"github.com/YiniXu9506/devconG/model"
+	"github.com/YiniXu9506/devconG/utils"
+	"gorm.io/gorm"
+)
+
+func newTestHub(t *testing.T, overrides map[string]interface{}, channels ...Channel) (*Hub, *gorm.DB) {
+	t.Helper()
+
+	settings := map[string]interface{}{
+		"db.driver":           config.DBDriverSQLite,
+		"auth.admin_token":    "test-admin-token",
+		"auth.session_secret": "test-session-secret",
+	}
+	for key, value := range overrides {
+		settings[key] = value
+	}
+	loader, err := config.NewLoader("../config.dev", settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.NewManager(loader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := utils.Open(config.DBConfig{Driver: config.DBDriverSQLite, Path: filepath.Join(t.TempDir(), "devcon.db"), MaxIdleConns: 2, MaxOpenConns: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		utils.Close(db)
+	})
+	if err := utils.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	// the tests run the polls themselves
+	hub := NewHub(db, cfg, channels)
+	hub.Stop()
+	return hub, db
+}
+
+// fakeChannel records the notifications it was sent and fails the first failures sends
+type fakeChannel struct {
+	mu       sync.Mutex
+	failures int
+	sent     []model.NotificationModel
+}
+
+func (c *fakeChannel) Name() string {
+	return config.NotifyChannelLog
+}
+
+func (c *fakeChannel) Send(ctx context.Context, n *model.NotificationModel) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.failures > 0 {
+		c.failures--
+		return errors.New("unavailable")
+	}
+	c.sent = append(c.sent, *n)
+	return nil
+}
+
+// retryNow makes the pending deliveries due
+func retryNow(t *testing.T, db *gorm.DB) {
+	t.Helper()
+
+	if err := db.Model(&model.NotificationDeliveryModel{}).Where("status = ?", DeliveryPending).Update("next_attempt_time", 0).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func countNotifications(t *testing.T, db *gorm.DB) int64 {
+	t.Helper()
+
+	var count int64
+	if err := db.Model(&model.NotificationModel{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestNotifyDedup(t *testing.T) {
+	channel := &fakeChannel{}
+	h, db := newTestHub(t, nil, channel)
+
+	n := Notification{EventID: model.DefaultEventID, OpenID: "alice", Event: EventPhraseApproved, PhraseID: 1, Text: "hello", DedupKey: "phrase.approved:1:10"}
+	for i := 0; i < 2; i++ {
+		if err := h.Notify(context.Background(), n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// deleted accounts aren't notified
+	for _, openID := range []string{"", model.AnonymousOpenIDPrefix + "1"} {
+		if err := h.Notify(context.Background(), Notification{EventID: model.DefaultEventID, OpenID: openID, Event: EventPhraseApproved, PhraseID: 2, DedupKey: openID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if count := countNotifications(t, db); count != 1 {
+		t.Fatalf("got %d notifications, want one", count)
+	}
+	var deliveries int64
+	if err := db.Model(&model.NotificationDeliveryModel{}).Count(&deliveries).Error; err != nil || deliveries != 1 {
+		t.Fatalf("got %d deliveries, %v, want one", deliveries, err)
+	}
+
+	h.deliverDue()
+	if len(channel.sent) != 1 || channel.sent[0].OpenID != "alice" {
+		t.Fatalf("got sent %+v, want the notification once", channel.sent)
+	}
+}
+
+func TestStatusEvent(t *testing.T) {
+	tests := []struct {
+		from, to model.PhraseStatus
+		want     string
+	}{
+		{model.StatusPending, model.StatusApproved, EventPhraseApproved},
+		{model.StatusHidden, model.StatusApproved, ""},
+		{model.StatusPending, model.StatusRejected, EventPhraseRejected},
+		{model.StatusApproved, model.StatusDeleted, EventPhraseDeleted},
+		{model.StatusApproved, model.StatusHidden, ""},
+	}
+	for _, test := range tests {
+		if got := StatusEvent(test.from, test.to); got != test.want {
+			t.Errorf("got %q from %v to %v, want %q", got, test.from, test.to, test.want)
+		}
+	}
+}
+
+func TestCheckHot(t *testing.T) {
+	h, db := newTestHub(t, nil)
+
+	phrase := model.PhraseModel{EventID: model.DefaultEventID, OpenID: "alice", Text: "hello", GroupID: 1, Status: model.StatusApproved}
+	if err := db.Create(&phrase).Error; err != nil {
+		t.Fatal(err)
+	}
+	click := func(clicks int) {
+		if err := db.Create(&model.PhraseClickModel{EventID: model.DefaultEventID, PhraseID: phrase.PhraseID, GroupID: 1, Clicks: clicks}).Error; err != nil {
+			t.Fatal(err)
+		}
+		h.checkHot(phrase.PhraseID)
+	}
+	hot := func() []model.NotificationModel {
+		var notifications []model.NotificationModel
+		if err := db.Where("event = ?", EventPhraseHot).Order("id").Find(&notifications).Error; err != nil {
+			t.Fatal(err)
+		}
+		return notifications
+	}
+
+	// the thresholds of lt_clicks_size in config.dev.json start at 20 and 50 clicks
+	click(10)
+	if notifications := hot(); len(notifications) != 0 {
+		t.Fatalf("got %+v below the thresholds", notifications)
+	}
+	click(15)
+	click(5)
+	click(40)
+	notifications := hot()
+	if len(notifications) != 2 || notifications[0].Clicks != 20 || notifications[1].Clicks != 50 || notifications[0].OpenID != "alice" {
+		t.Fatalf("got %+v, want each threshold once", notifications)
+	}
+
+	h.HotThresholds(func(eventID int) []config.SizeThreshold {
+		return []config.SizeThreshold{{Clicks: 60, Size: 40}}
+	})
+	click(1)
+	if notifications := hot(); len(notifications) != 3 || notifications[2].Clicks != 60 {
+		t.Fatalf("got %+v, want the threshold of the event", notifications)
+	}
+}
+
+func TestDeliveryRetries(t *testing.T) {
+	channel := &fakeChannel{failures: 2}
+	h, db := newTestHub(t, map[string]interface{}{"notify.max_attempts": 3}, channel)
+	if err := h.Notify(context.Background(), Notification{EventID: model.DefaultEventID, OpenID: "alice", Event: EventPhraseApproved, PhraseID: 1, DedupKey: "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	h.deliverDue()
+	// the retry isn't due yet
+	h.deliverDue()
+	var delivery model.NotificationDeliveryModel
+	if err := db.First(&delivery).Error; err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Status != DeliveryPending || delivery.Attempts != 1 || delivery.LastError == "" {
+		t.Fatalf("got delivery %+v after a failed attempt, want it pending", delivery)
+	}
+
+	retryNow(t, db)
+	h.deliverDue()
+	retryNow(t, db)
+	h.deliverDue()
+	if err := db.First(&delivery).Error; err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Status != DeliverySent || delivery.Attempts != 3 || delivery.LastError != "" || len(channel.sent) != 1 {
+		t.Fatalf("got delivery %+v, want it sent at the third attempt", delivery)
+	}
+}
+
+func TestDeliveryFailsAfterMaxAttempts(t *testing.T) {
+	channel := &fakeChannel{failures: 3}
+	h, db := newTestHub(t, map[string]interface{}{"notify.max_attempts": 2}, channel)
+	if err := h.Notify(context.Background(), Notification{EventID: model.DefaultEventID, OpenID: "alice", Event: EventPhraseApproved, PhraseID: 1, DedupKey: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		retryNow(t, db)
+		h.deliverDue()
+	}
+
+	var delivery model.NotificationDeliveryModel
+	if err := db.First(&delivery).Error; err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Status != DeliveryFailed || delivery.Attempts != 2 || channel.failures != 1 {
+		t.Fatalf("got delivery %+v, want it failed after 2 attempts", delivery)
+	}
+}
+
+func TestDeliveryToDisabledChannel(t *testing.T) {
+	h, db := newTestHub(t, map[string]interface{}{"notify.max_attempts": 1}, &fakeChannel{})
+	if err := h.Notify(context.Background(), Notification{EventID: model.DefaultEventID, OpenID: "alice", Event: EventPhraseApproved, PhraseID: 1, DedupKey: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	h.SetChannels(nil)
+	h.deliverDue()
+
+	var delivery model.NotificationDeliveryModel
+	if err := db.First(&delivery).Error; err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Status != DeliveryFailed {
+		t.Fatalf("got delivery %+v, want it failed", delivery)
+	}
+}
@@ -0,0 +1,84 @@
+package provider
+
+import (
+	"strconv"
+
+	"github.com/YiniXu9506/devconG/config"
+)
+
+// a point of a lookup table: phrases with less clicks than Clicks get Value
+type threshold struct {
+	Clicks int
+	Value  int
+}
+
+func sizeThresholds(table []config.SizeThreshold) []threshold {
+	thresholds := make([]threshold, 0, len(table))
+	for _, t := range table {
+		thresholds = append(thresholds, threshold{Clicks: t.Clicks, Value: t.Size})
+	}
+	return thresholds
+}
+
+func speedThresholds(table []config.SpeedThreshold) []threshold {
+	thresholds := make([]threshold, 0, len(table))
+	for _, t := range table {
+		thresholds = append(thresholds, threshold{Clicks: t.Clicks, Value: t.Speed})
+	}
+	return thresholds
+}
+
+// lookupThreshold resolves clicks against thresholds sorted by clicks ascending.
+// without interpolation, it returns the value of the first threshold whose clicks are greater than the given clicks,
+// phrases beyond the last threshold get the last value.
+// with interpolation, thresholds are points of a curve and the value is linear between two neighbouring points,
+// clamped to the first and last value.
+func lookupThreshold(thresholds []threshold, clicks int, interpolate bool) int {
+	if len(thresholds) == 0 {
+		return 0
+	}
+
+	if !interpolate {
+		for _, t := range thresholds {
+			if clicks < t.Clicks {
+				return t.Value
+			}
+		}
+		return thresholds[len(thresholds)-1].Value
+	}
+
+	if clicks <= thresholds[0].Clicks {
+		return thresholds[0].Value
+	}
+	for i := 1; i < len(thresholds); i++ {
+		lower, upper := thresholds[i-1], thresholds[i]
+		if clicks < upper.Clicks {
+			ratio := float64(clicks-lower.Clicks) / float64(upper.Clicks-lower.Clicks)
+			return lower.Value + int(ratio*float64(upper.Value-lower.Value))
+		}
+	}
+	return thresholds[len(thresholds)-1].Value
+}
+
+// tablesForGroup returns the tables of the hot group, falling back to the default tables
+func tablesForGroup(h5 config.H5Config, groupID int) config.AppearanceTables {
+	tables := h5.AppearanceTables
+	if groupTables, ok := h5.Groups[strconv.Itoa(groupID)]; ok {
+		if len(groupTables.LtClicksSize) > 0 {
+			tables.LtClicksSize = groupTables.LtClicksSize
+		}
+		if len(groupTables.LtClicksSpeed) > 0 {
+			tables.LtClicksSpeed = groupTables.LtClicksSpeed
+		}
+	}
+	return tables
+}
+
+// ResolveAppearance fills in size and speed of each phrase, so all clients render the same
+func ResolveAppearance(phrases []ScrollingPhrasesResponse, h5 config.H5Config) {
+	for i := range phrases {
+		tables := tablesForGroup(h5, phrases[i].HotGroupID)
+		phrases[i].Size = lookupThreshold(sizeThresholds(tables.LtClicksSize), phrases[i].Clicks, h5.Interpolate)
+		phrases[i].Speed = lookupThreshold(speedThresholds(tables.LtClicksSpeed), phrases[i].Clicks, h5.Interpolate)
+	}
+}
@@ -0,0 +1,311 @@
+package provider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/YiniXu9506/devconG/config"
+	"github.com/YiniXu9506/devconG/model"
+	"github.com/YiniXu9506/devconG/store"
+	"go.uber.org/zap"
+)
+
+const (
+	// how often events edited on other instances are picked up
+	eventRefreshInterval = 10 * time.Second
+	// unknown slugs refresh the events at most this often, so requests naming random slugs can't flood the database
+	unknownSlugRefreshInterval = time.Second
+)
+
+var eventSlugPattern = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+
+var (
+	ErrUnknownEvent = errors.New("unknown event")
+	ErrEventExists  = errors.New("an event with the slug already exists")
+	ErrInvalidEvent = errors.New("invalid event")
+)
+
+// Event is an event with its settings decoded
+type Event struct {
+	ID   int    `json:"event_id"`
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+	// settings stored with the event, zero fields inherit from the config file
+	Settings   config.EventConfig `json:"settings"`
+	CreateTime int64              `json:"create_time"`
+	UpdateTime int64              `json:"update_time"`
+}
+
+func decodeEvent(record model.EventModel) (Event, error) {
+	event := Event{ID: record.EventID, Slug: record.Slug, Name: record.Name, CreateTime: record.CreateTime, UpdateTime: record.UpdateTime}
+	if record.Settings != "" {
+		if err := json.Unmarshal([]byte(record.Settings), &event.Settings); err != nil {
+			return event, fmt.Errorf("decode settings of event %v: %w", record.Slug, err)
+		}
+	}
+	return event, nil
+}
+
+// EventsProvider resolves the events requests are scoped to, and their settings over the config file
+type EventsProvider struct {
+	events   store.EventRepo
+	config   *config.Manager
+	profiles *ProfilesProvider
+
+	bySlug map[string]Event
+	byID   map[int]Event
+	mu     sync.RWMutex
+	// refreshMu serializes refreshes, lastRefresh is when the last one started
+	refreshMu   sync.Mutex
+	lastRefresh time.Time
+	stopOnce    sync.Once
+	stopCh      chan struct{}
+	doneCh      chan struct{}
+}
+
+func NewEventsProvider(events store.EventRepo, cfg *config.Manager, profiles *ProfilesProvider) *EventsProvider {
+	ep := &EventsProvider{
+		events:   events,
+		config:   cfg,
+		profiles: profiles,
+		bySlug:   make(map[string]Event),
+		byID:     make(map[int]Event),
+		stopCh:   make(chan struct{}),
+		doneCh:   make(chan struct{}),
+	}
+	ep.refreshAfter(0)
+	go periodRefreshEvents(ep)
+	return ep
+}
+
+// Default is the event of requests without an event
+func (ep *EventsProvider) Default() Event {
+	ep.mu.RLock()
+	defer ep.mu.RUnlock()
+
+	if event, ok := ep.byID[model.DefaultEventID]; ok {
+		return event
+	}
+	return Event{ID: model.DefaultEventID, Slug: model.DefaultEventSlug}
+}
+
+// Resolve returns the event of the slug, an unknown slug refreshes the events early to pick up events
+// created on other instances
+func (ep *EventsProvider) Resolve(slug string) (Event, error) {
+	if event, ok := ep.bySlugOf(slug); ok {
+		return event, nil
+	}
+	if !eventSlugPattern.MatchString(slug) {
+		return Event{}, ErrUnknownEvent
+	}
+
+	ep.refreshAfter(unknownSlugRefreshInterval)
+	if event, ok := ep.bySlugOf(slug); ok {
+		return event, nil
+	}
+	return Event{}, ErrUnknownEvent
+}
+
+func (ep *EventsProvider) bySlugOf(slug string) (Event, bool) {
+	ep.mu.RLock()
+	defer ep.mu.RUnlock()
+
+	event, ok := ep.bySlug[slug]
+	return event, ok
+}
+
+// Get returns the event of the id
+func (ep *EventsProvider) Get(id int) (Event, error) {
+	ep.mu.RLock()
+	event, ok := ep.byID[id]
+	ep.mu.RUnlock()
+	if ok {
+		return event, nil
+	}
+	return ep.load(ep.events.Get(id))
+}
+
+// load keeps an event missing from the last refresh
+func (ep *EventsProvider) load(record model.EventModel, found bool, err error) (Event, error) {
+	if err != nil {
+		return Event{}, err
+	}
+	if !found {
+		return Event{}, ErrUnknownEvent
+	}
+	event, err := decodeEvent(record)
+	if err != nil {
+		return Event{}, err
+	}
+	ep.put(event)
+	return event, nil
+}
+
+func (ep *EventsProvider) put(event Event) {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+
+	if old, ok := ep.byID[event.ID]; ok {
+		delete(ep.bySlug, old.Slug)
+	}
+	ep.byID[event.ID] = event
+	ep.bySlug[event.Slug] = event
+}
+
+// List returns the events in the order they were created
+func (ep *EventsProvider) List() []Event {
+	ep.mu.RLock()
+	events := make([]Event, 0, len(ep.byID))
+	for _, event := range ep.byID {
+		events = append(events, event)
+	}
+	ep.mu.RUnlock()
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].ID < events[j].ID
+	})
+	return events
+}
+
+// validate checks the settings with inherited settings filled in
+func (ep *EventsProvider) validate(slug string, settings config.EventConfig) error {
+	if err := settings.Validate("events."+slug, ep.profiles.DefaultProfile(), ep.config.Get().Moderation); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+	return nil
+}
+
+// Create validates and stores a new event, an empty name is the slug
+func (ep *EventsProvider) Create(slug, name string, settings config.EventConfig) (Event, error) {
+	if !eventSlugPattern.MatchString(slug) {
+		return Event{}, fmt.Errorf("%w: slug must match %v", ErrInvalidEvent, eventSlugPattern)
+	}
+	if err := ep.validate(slug, settings); err != nil {
+		return Event{}, err
+	}
+	if name == "" {
+		name = slug
+	}
+	encoded, err := json.Marshal(settings)
+	if err != nil {
+		return Event{}, err
+	}
+
+	now := time.Now().Unix()
+	record := model.EventModel{Slug: slug, Name: name, Settings: string(encoded), CreateTime: now, UpdateTime: now}
+	if err := ep.events.Create(&record); err != nil {
+		if errors.Is(err, store.ErrDuplicate) {
+			return Event{}, ErrEventExists
+		}
+		return Event{}, err
+	}
+
+	event := Event{ID: record.EventID, Slug: slug, Name: name, Settings: settings, CreateTime: now, UpdateTime: now}
+	ep.put(event)
+	return event, nil
+}
+
+// Update validates and replaces the name and the settings of an event, an empty name keeps the name
+func (ep *EventsProvider) Update(slug, name string, settings config.EventConfig) (Event, error) {
+	event, err := ep.Resolve(slug)
+	if err != nil {
+		return Event{}, err
+	}
+	if err := ep.validate(slug, settings); err != nil {
+		return Event{}, err
+	}
+	if name == "" {
+		name = event.Name
+	}
+	encoded, err := json.Marshal(settings)
+	if err != nil {
+		return Event{}, err
+	}
+
+	now := time.Now().Unix()
+	if err := ep.events.Update(model.EventModel{EventID: event.ID, Name: name, Settings: string(encoded), UpdateTime: now}); err != nil {
+		return Event{}, err
+	}
+
+	event.Name = name
+	event.Settings = settings
+	event.UpdateTime = now
+	ep.put(event)
+	return event, nil
+}
+
+// Profile returns the display profile of the event, an empty name is its default profile
+func (ep *EventsProvider) Profile(event Event, name string) (config.ProfileConfig, error) {
+	return ep.profiles.ForEvent(name, event.Settings)
+}
+
+// Moderation returns the moderation settings of the event
+func (ep *EventsProvider) Moderation(event Event) config.ModerationConfig {
+	return event.Settings.Moderation.WithDefaults(ep.config.Get().Moderation)
+}
+
+// Stop terminates the background refresh goroutine and waits for it to exit
+func (ep *EventsProvider) Stop() {
+	ep.stopOnce.Do(func() {
+		close(ep.stopCh)
+	})
+	<-ep.doneCh
+}
+
+// refreshAfter refreshes the events unless the last refresh started less than interval ago
+func (ep *EventsProvider) refreshAfter(interval time.Duration) {
+	ep.refreshMu.Lock()
+	defer ep.refreshMu.Unlock()
+
+	if time.Since(ep.lastRefresh) < interval {
+		return
+	}
+	ep.lastRefresh = time.Now()
+	ep.refresh()
+}
+
+// refresh reloads the events, callers hold refreshMu
+func (ep *EventsProvider) refresh() {
+	records, err := ep.events.List()
+	if err != nil {
+		zap.L().Sugar().Error("Error! Load events: ", err)
+		return
+	}
+
+	bySlug := make(map[string]Event, len(records))
+	byID := make(map[int]Event, len(records))
+	for _, record := range records {
+		event, err := decodeEvent(record)
+		if err != nil {
+			zap.L().Sugar().Error("Error! ", err)
+			continue
+		}
+		bySlug[event.Slug] = event
+		byID[event.ID] = event
+	}
+
+	ep.mu.Lock()
+	ep.bySlug = bySlug
+	ep.byID = byID
+	ep.mu.Unlock()
+}
+
+func periodRefreshEvents(events *EventsProvider) {
+	defer close(events.doneCh)
+
+	ticker := time.NewTicker(eventRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			events.refreshAfter(0)
+		case <-events.stopCh:
+			return
+		}
+	}
+}
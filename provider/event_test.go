@@ -0,0 +1,93 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/YiniXu9506/devconG/config"
+	"github.com/YiniXu9506/devconG/model"
+	"github.com/YiniXu9506/devconG/store"
+)
+
+func testConfig(t *testing.T) *config.Manager {
+	t.Helper()
+
+	loader, err := config.NewLoader("../config.dev", map[string]interface{}{
+		"db.driver":           config.DBDriverSQLite,
+		"auth.admin_token":    "test-admin-token",
+		"auth.session_secret": "test-session-secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.NewManager(loader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// countingEvents counts the reads of the events
+type countingEvents struct {
+	store.EventRepo
+	reads int32
+}
+
+func (r *countingEvents) List() ([]model.EventModel, error) {
+	atomic.AddInt32(&r.reads, 1)
+	return r.EventRepo.List()
+}
+
+func (r *countingEvents) GetBySlug(slug string) (model.EventModel, bool, error) {
+	atomic.AddInt32(&r.reads, 1)
+	return r.EventRepo.GetBySlug(slug)
+}
+
+func newTestEventsProvider(t *testing.T, events store.EventRepo) *EventsProvider {
+	t.Helper()
+
+	cfg := testConfig(t)
+	profiles := NewProfilesProvider(store.NewMemory().Profiles, cfg)
+	t.Cleanup(profiles.Stop)
+	ep := NewEventsProvider(events, cfg, profiles)
+	t.Cleanup(ep.Stop)
+	return ep
+}
+
+func TestResolveUnknownSlugs(t *testing.T) {
+	events := &countingEvents{EventRepo: store.NewMemory().Events}
+	ep := newTestEventsProvider(t, events)
+
+	for i := 0; i < 100; i++ {
+		if _, err := ep.Resolve(fmt.Sprintf("random-%d", i)); !errors.Is(err, ErrUnknownEvent) {
+			t.Fatalf("got %v, want ErrUnknownEvent", err)
+		}
+	}
+	// the first read is at startup, the unknown slugs read the events once more within the interval
+	if reads := atomic.LoadInt32(&events.reads); reads > 2 {
+		t.Fatalf("unknown slugs read the events %d times, want at most 2", reads)
+	}
+}
+
+func TestResolveEventOfAnotherInstance(t *testing.T) {
+	events := store.NewMemory().Events
+	ep := newTestEventsProvider(t, events)
+
+	// created on another instance after the last refresh
+	ep.refreshMu.Lock()
+	ep.lastRefresh = ep.lastRefresh.Add(-unknownSlugRefreshInterval)
+	ep.refreshMu.Unlock()
+	if err := events.Create(&model.EventModel{Slug: "meetup", Name: "Meetup", Settings: "{}"}); err != nil {
+		t.Fatal(err)
+	}
+
+	event, err := ep.Resolve("meetup")
+	if err != nil || event.Slug != "meetup" {
+		t.Fatalf("got %v, %v, want the new event", event, err)
+	}
+	if event := ep.Default(); event.ID != model.DefaultEventID {
+		t.Fatalf("got default event %v", event)
+	}
+}
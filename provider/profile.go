@@ -0,0 +1,218 @@
+package provider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/YiniXu9506/devconG/config"
+	"github.com/YiniXu9506/devconG/model"
+	"github.com/YiniXu9506/devconG/store"
+	"go.uber.org/zap"
+)
+
+// how often profiles edited on other instances are picked up
+const profileRefreshInterval = 10 * time.Second
+
+var profileNamePattern = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+
+var ErrUnknownProfile = errors.New("unknown profile")
+
+const (
+	ProfileSourceConfig  = "config"
+	ProfileSourceRuntime = "runtime"
+)
+
+type ProfileInfo struct {
+	Name    string               `json:"name"`
+	Source  string               `json:"source"`
+	Profile config.ProfileConfig `json:"profile"`
+}
+
+// ProfilesProvider resolves display profiles from the config file, overridden by profiles edited at runtime
+type ProfilesProvider struct {
+	profiles store.ProfileRepo
+	config   *config.Manager
+
+	runtimeProfiles map[string]config.ProfileConfig
+	mu              sync.RWMutex
+	stopOnce        sync.Once
+	stopCh          chan struct{}
+	doneCh          chan struct{}
+}
+
+func NewProfilesProvider(profiles store.ProfileRepo, cfg *config.Manager) *ProfilesProvider {
+	pp := &ProfilesProvider{
+		profiles:        profiles,
+		config:          cfg,
+		runtimeProfiles: make(map[string]config.ProfileConfig),
+		stopCh:          make(chan struct{}),
+		doneCh:          make(chan struct{}),
+	}
+	pp.refresh()
+	go periodRefreshProfiles(pp)
+	return pp
+}
+
+// DefaultProfile is the h5 settings and cache mix, overridden by a runtime "default" profile,
+// events inherit their display settings from it
+func (pp *ProfilesProvider) DefaultProfile() config.ProfileConfig {
+	cfg := pp.config.Get()
+	base := config.ProfileConfig{H5Config: cfg.H5, Mix: cfg.Cache.MixConfig}
+
+	pp.mu.RLock()
+	defer pp.mu.RUnlock()
+	if profile, ok := pp.runtimeProfiles[config.DefaultProfile]; ok {
+		return profile.WithDefaults(base)
+	}
+	return base
+}
+
+// Get returns the effective profile, an empty name is the default profile
+func (pp *ProfilesProvider) Get(name string) (config.ProfileConfig, error) {
+	return pp.ForEvent(name, config.EventConfig{})
+}
+
+// ForEvent returns the effective profile of an event, its profiles inherit the display settings of the event
+func (pp *ProfilesProvider) ForEvent(name string, event config.EventConfig) (config.ProfileConfig, error) {
+	if name == "" {
+		name = config.DefaultProfile
+	}
+
+	base := event.Display(pp.DefaultProfile())
+	if name == config.DefaultProfile {
+		return base, nil
+	}
+
+	pp.mu.RLock()
+	profile, ok := pp.runtimeProfiles[name]
+	pp.mu.RUnlock()
+	if !ok {
+		profile, ok = pp.config.Get().Profiles[name]
+	}
+	if !ok {
+		return config.ProfileConfig{}, ErrUnknownProfile
+	}
+
+	return profile.WithDefaults(base), nil
+}
+
+// List returns all effective profiles sorted by name
+func (pp *ProfilesProvider) List() []ProfileInfo {
+	sources := map[string]string{config.DefaultProfile: ProfileSourceConfig}
+	for name := range pp.config.Get().Profiles {
+		sources[name] = ProfileSourceConfig
+	}
+	pp.mu.RLock()
+	for name := range pp.runtimeProfiles {
+		sources[name] = ProfileSourceRuntime
+	}
+	pp.mu.RUnlock()
+
+	var profiles []ProfileInfo
+	for name, source := range sources {
+		profile, err := pp.Get(name)
+		if err != nil {
+			continue
+		}
+		profiles = append(profiles, ProfileInfo{Name: name, Source: source, Profile: profile})
+	}
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].Name < profiles[j].Name
+	})
+	return profiles
+}
+
+// Save validates the profile and stores it, it overrides the profile of the same name in the config file
+func (pp *ProfilesProvider) Save(name string, profile config.ProfileConfig) error {
+	if !profileNamePattern.MatchString(name) {
+		return fmt.Errorf("profile name must match %v", profileNamePattern)
+	}
+
+	base := config.ProfileConfig{H5Config: pp.config.Get().H5, Mix: pp.config.Get().Cache.MixConfig}
+	if name != config.DefaultProfile {
+		base = pp.DefaultProfile()
+	}
+	if err := profile.WithDefaults(base).Validate("profiles." + name); err != nil {
+		return err
+	}
+
+	settings, err := json.Marshal(profile)
+	if err != nil {
+		return err
+	}
+
+	if err := pp.profiles.Save(model.DisplayProfileModel{Name: name, Settings: string(settings), UpdateTime: time.Now().Unix()}); err != nil {
+		return err
+	}
+
+	pp.mu.Lock()
+	pp.runtimeProfiles[name] = profile
+	pp.mu.Unlock()
+	return nil
+}
+
+// Delete removes a runtime profile, a profile of the same name in the config file takes effect again
+func (pp *ProfilesProvider) Delete(name string) error {
+	found, err := pp.profiles.Delete(name)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrUnknownProfile
+	}
+
+	pp.mu.Lock()
+	delete(pp.runtimeProfiles, name)
+	pp.mu.Unlock()
+	return nil
+}
+
+// Stop terminates the background refresh goroutine and waits for it to exit
+func (pp *ProfilesProvider) Stop() {
+	pp.stopOnce.Do(func() {
+		close(pp.stopCh)
+	})
+	<-pp.doneCh
+}
+
+func (pp *ProfilesProvider) refresh() {
+	records, err := pp.profiles.List()
+	if err != nil {
+		zap.L().Sugar().Error("Error! Load display profiles: ", err)
+		return
+	}
+
+	runtimeProfiles := make(map[string]config.ProfileConfig, len(records))
+	for _, record := range records {
+		var profile config.ProfileConfig
+		if err := json.Unmarshal([]byte(record.Settings), &profile); err != nil {
+			zap.L().Sugar().Errorf("Error! Decode display profile %v: %v", record.Name, err)
+			continue
+		}
+		runtimeProfiles[record.Name] = profile
+	}
+
+	pp.mu.Lock()
+	pp.runtimeProfiles = runtimeProfiles
+	pp.mu.Unlock()
+}
+
+func periodRefreshProfiles(profiles *ProfilesProvider) {
+	defer close(profiles.doneCh)
+
+	ticker := time.NewTicker(profileRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			profiles.refresh()
+		case <-profiles.stopCh:
+			return
+		}
+	}
+}
@@ -1,15 +1,15 @@
 package provider
 
 import (
-	"database/sql"
-	"fmt"
 	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/YiniXu9506/devconG/config"
 	"github.com/YiniXu9506/devconG/model"
+	"github.com/YiniXu9506/devconG/store"
 	"go.uber.org/zap"
-	"gorm.io/gorm"
 )
 
 type ScrollingPhrasesResponse struct {
@@ -18,249 +18,384 @@ type ScrollingPhrasesResponse struct {
 	Clicks         int    `json:"clicks"`
 	HotGroupID     int    `json:"hot_group_id"`
 	HotGroupClicks int    `json:"hot_group_clicks"`
+	// font size and scrolling speed resolved from the h5 settings
+	Size  int `json:"size"`
+	Speed int `json:"speed"`
 }
 
-type PhrasesCacheProvider struct {
-	db            *gorm.DB
-	cachedPhrases []ScrollingPhrasesResponse
-	mu            sync.RWMutex
+// indexes of cachedPhrases
+const (
+	newestSegment = iota
+	topSegment
+	randomSegment
+	segmentCount
+)
+
+// partitions of events whose phrases were not read for this long are dropped, the default event's is kept
+const partitionIdleTimeout = 10 * time.Minute
+
+// cachePartition is the cached phrases of one event
+type cachePartition struct {
+	// unix time of the last read, atomic
+	lastRead int64
+	// cached newest, hot and random phrases, one slice per segment
+	cachedPhrases [segmentCount][]ScrollingPhrasesResponse
+	// populated turns true once the partition has been filled successfully
+	populated bool
+	// closed after the first fill of the partition, successful or not
+	filled chan struct{}
 }
 
-type TopClicksPhraseModel struct {
-	Clicks   int `json:"clicks"`
-	PhraseID int `json:"phrase_id"`
-	GroupID  int `json:"group_id"`
+type PhrasesCacheProvider struct {
+	store store.Store
+	cfg   config.CacheConfig
+	// partition of each event by event id, created when the phrases of the event are first read
+	partitions map[int]*cachePartition
+	mu         sync.RWMutex
+	stopOnce   sync.Once
+	stopCh     chan struct{}
+	doneCh     chan struct{}
+	// resetCh restarts the update ticker after the interval changed
+	resetCh chan struct{}
 }
 
-func NewPhrasesCacheProvider(db *gorm.DB) *PhrasesCacheProvider {
+func NewPhrasesCacheProvider(st store.Store, cfg config.CacheConfig) *PhrasesCacheProvider {
+	// the default event's partition is filled by the first update like before events existed
+	defaultPartition := &cachePartition{filled: make(chan struct{})}
+	close(defaultPartition.filled)
+
 	phraseCache := &PhrasesCacheProvider{
-		db:            db,
-		cachedPhrases: make([]ScrollingPhrasesResponse, 0, 100),
+		store:      st,
+		cfg:        cfg,
+		partitions: map[int]*cachePartition{model.DefaultEventID: defaultPartition},
+		stopCh:     make(chan struct{}),
+		doneCh:     make(chan struct{}),
+		resetCh:    make(chan struct{}, 1),
 	}
 	go periodUpdateCache(phraseCache)
 	return phraseCache
 }
 
+// partition returns the partition of the event, a new partition is filled before it is returned
+func (cp *PhrasesCacheProvider) partition(eventID int) *cachePartition {
+	cp.mu.RLock()
+	partition, ok := cp.partitions[eventID]
+	cp.mu.RUnlock()
+
+	if !ok {
+		cp.mu.Lock()
+		partition, ok = cp.partitions[eventID]
+		if !ok {
+			partition = &cachePartition{lastRead: time.Now().Unix(), filled: make(chan struct{})}
+			cp.partitions[eventID] = partition
+		}
+		cp.mu.Unlock()
+
+		if !ok {
+			cp.updatePartition(eventID)
+			close(partition.filled)
+		}
+	}
+
+	// requests arriving while a new partition is filled wait for it
+	<-partition.filled
+	atomic.StoreInt64(&partition.lastRead, time.Now().Unix())
+	return partition
+}
+
 /* if the counts of reviewed phrase are less than the limit, set the limit to reviewedPhraseCount
 calculate and update phrases:
-append 30% neweset phrases, whose status need to be reviewd
-append 30% hot phrases
-append 40% random phrases
+append newest_ratio (30% by default) neweset phrases, whose status need to be reviewd
+append top_ratio (30% by default) hot phrases
+append the rest as random phrases
 */
-func getReturnPhraseCount(limit int, reviewedPhraseCount int, db *gorm.DB) (int, int, int) {
+func getReturnPhraseCount(limit int, reviewedPhraseCount int, mix config.MixConfig) (int, int, int) {
 	if reviewedPhraseCount < limit {
 		limit = reviewedPhraseCount
 	}
 
-	newestPhrasesCount := int(float64(limit) * 0.3)
-	topNPhrasesCount := int(float64(limit) * 0.3)
+	newestPhrasesCount := int(float64(limit) * mix.NewestRatio)
+	topNPhrasesCount := int(float64(limit) * mix.TopRatio)
 
 	return newestPhrasesCount, topNPhrasesCount, limit
 }
 
-// get scrolling phrase from phraseCache according to limit
-func (cp *PhrasesCacheProvider) GetScrollingPhrases(limit int) []ScrollingPhrasesResponse {
+// get scrolling phrase of an event from its cache partition according to limit and the mix of newest, hot and random phrases
+func (cp *PhrasesCacheProvider) GetScrollingPhrases(eventID int, limit int, mix config.MixConfig) []ScrollingPhrasesResponse {
+	partition := cp.partition(eventID)
+
 	cp.mu.RLock()
+	defer cp.mu.RUnlock()
 
 	var phrase []ScrollingPhrasesResponse
 
-	reviewedPhraseCount := len(cp.cachedPhrases)
-	newestPhrasesCount, topNPhrasesCount, limit := getReturnPhraseCount(limit, reviewedPhraseCount, cp.db)
-	randeomPhraseCount := limit - newestPhrasesCount - topNPhrasesCount
+	reviewedPhraseCount := 0
+	for _, segment := range partition.cachedPhrases {
+		reviewedPhraseCount += len(segment)
+	}
+	newestPhrasesCount, topNPhrasesCount, limit := getReturnPhraseCount(limit, reviewedPhraseCount, mix)
 
-	// sliceGap uses to slice phrase
-	sliceGap := int(float64(reviewedPhraseCount) * 0.3)
+	var counts [segmentCount]int
+	counts[newestSegment] = minInt(newestPhrasesCount, len(partition.cachedPhrases[newestSegment]))
+	counts[topSegment] = minInt(topNPhrasesCount, len(partition.cachedPhrases[topSegment]))
+	counts[randomSegment] = minInt(limit-counts[newestSegment]-counts[topSegment], len(partition.cachedPhrases[randomSegment]))
 
-	phrase = append(phrase, cp.cachedPhrases[:newestPhrasesCount]...)
-	phrase = append(phrase, cp.cachedPhrases[sliceGap:sliceGap+topNPhrasesCount]...)
-	phrase = append(phrase, cp.cachedPhrases[2*sliceGap:2*sliceGap+randeomPhraseCount]...)
+	for i, segment := range partition.cachedPhrases {
+		phrase = append(phrase, segment[:counts[i]]...)
+	}
+	// fill up with the leftovers when a segment has less phrases than the mix asks for
+	for i, segment := range partition.cachedPhrases {
+		if len(phrase) >= limit {
+			break
+		}
+		rest := segment[counts[i]:]
+		phrase = append(phrase, rest[:minInt(limit-len(phrase), len(rest))]...)
+	}
 
 	rand.Shuffle(len(phrase), func(i, j int) {
 		phrase[i], phrase[j] = phrase[j], phrase[i]
 	})
 
+	return phrase
+}
+
+// ApplyConfig swaps the cache settings, they are used from the next update on
+func (cp *PhrasesCacheProvider) ApplyConfig(cfg config.CacheConfig) {
+	cp.mu.Lock()
+	intervalChanged := cp.cfg.IntervalSeconds != cfg.IntervalSeconds
+	cp.cfg = cfg
+	cp.mu.Unlock()
+
+	if intervalChanged {
+		select {
+		case cp.resetCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (cp *PhrasesCacheProvider) cacheConfig() config.CacheConfig {
+	cp.mu.RLock()
 	defer cp.mu.RUnlock()
 
-	return phrase
+	return cp.cfg
 }
 
-func CacheNPhrases(id int, cp *PhrasesCacheProvider, c chan ScrollingPhrasesResponse) {
-	var phrase ScrollingPhrasesResponse
-	var phraseRecord model.PhraseModel
-	var phraseClicksDistribution []TopClicksPhraseModel
-	var topClickGroup TopClicksPhraseModel
-	totalClicks := 0
-	defer func() {
-		c <- phrase
-	}()
-	if err := cp.db.Debug().Table("phrase_models").
-		Select("phrase_id, text, group_id").
-		Where("phrase_id = ?", id).
-		Find(&phraseRecord).Error; err != nil {
-		zap.L().Sugar().Error("Error! Retrive phrase from db: ", err)
-		return
+// IsPopulated reports whether the partition of the default event has been filled at least once.
+// The partitions of the other events are filled on their first read, before it is answered,
+// so readiness only waits for the default event.
+func (cp *PhrasesCacheProvider) IsPopulated() bool {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	return cp.partitions[model.DefaultEventID].populated
+}
+
+// Stop terminates the background update goroutine and waits for it to exit
+func (cp *PhrasesCacheProvider) Stop() {
+	cp.stopOnce.Do(func() {
+		close(cp.stopCh)
+	})
+	<-cp.doneCh
+}
+
+// cachePhrases gets the text, total clicks and the group with the most clicks of the phrases
+func cachePhrases(st store.Store, ids []int) (map[int]ScrollingPhrasesResponse, error) {
+	phraseRecords, err := st.Phrases.GetMany(ids)
+	if err != nil {
+		return nil, err
 	}
 
-	// find out phrase click distributions
-	if err := cp.db.Debug().Table("phrase_click_models").
-		Select("sum(clicks) as clicks, phrase_id, group_id").
-		Where("phrase_id = ?", id).
-		Group("phrase_id, group_id").
-		Order("clicks desc").
-		Find(&phraseClicksDistribution).Error; err != nil {
-		zap.L().Sugar().Error("Error! Retrive top clicks group: ", err)
-		return
+	// find out phrase click distributions, most clicks first
+	distributions, err := st.Clicks.Distributions(ids)
+	if err != nil {
+		return nil, err
 	}
 
-	if len(phraseClicksDistribution) == 0 {
-		topClickGroup.GroupID = phraseRecord.GroupID
-		totalClicks = 0
-	} else {
+	cachedByID := make(map[int]ScrollingPhrasesResponse, len(phraseRecords))
+	for _, phraseRecord := range phraseRecords {
+		phrase := ScrollingPhrasesResponse{
+			PhraseID:   phraseRecord.PhraseID,
+			Text:       phraseRecord.Text,
+			HotGroupID: phraseRecord.GroupID,
+		}
+
 		// sum up clicks for phrase
-		for _, distribution := range phraseClicksDistribution {
-			totalClicks = totalClicks + distribution.Clicks
+		for _, distribution := range distributions[phraseRecord.PhraseID] {
+			phrase.Clicks += distribution.Clicks
+		}
+		if groups := distributions[phraseRecord.PhraseID]; len(groups) > 0 {
+			phrase.HotGroupClicks = groups[0].Clicks
+			phrase.HotGroupID = groups[0].GroupID
 		}
 
-		topClickGroup.Clicks = phraseClicksDistribution[0].Clicks
-		topClickGroup.GroupID = phraseClicksDistribution[0].GroupID
+		cachedByID[phrase.PhraseID] = phrase
 	}
-
-	phrase.PhraseID = phraseRecord.PhraseID
-	phrase.Text = phraseRecord.Text
-	phrase.Clicks = totalClicks
-	phrase.HotGroupClicks = topClickGroup.Clicks
-	phrase.HotGroupID = topClickGroup.GroupID
-
+	return cachedByID, nil
 }
 
-func getNewestNPhrase(db *gorm.DB, newestPhrasesCount int, c chan []model.PhraseModel) {
-	var newestPhrases []model.PhraseModel
-
-	defer func() {
-		c <- newestPhrases
-	}()
-
+func getNewestNPhrase(phrases store.PhraseRepo, newestPhrasesCount int, c chan []model.PhraseModel) {
 	// get newest-N phrases
-	if err := db.Table("phrase_models").
-		Where("status = ?", 2).
-		Order("update_time desc").
-		Limit(newestPhrasesCount).
-		Find(&newestPhrases).Error; err != nil {
+	newestPhrases, err := phrases.Newest(model.StatusApproved, newestPhrasesCount)
+	if err != nil {
 		zap.L().Sugar().Error("Error! Get newest-N phrases: ", err)
-		return
 	}
+	c <- newestPhrases
 }
 
-func getTopNPhrase(db *gorm.DB, topNPhrasesCount int, c chan []TopClicksPhraseModel) {
-	var topClicksPhrases []TopClicksPhraseModel
-	defer func() {
-		c <- topClicksPhrases
-	}()
-
-	if err := db.Debug().Raw("SELECT sum(clicks) as clicks, a.phrase_id FROM phrase_models as a INNER JOIN phrase_click_models as b ON a.phrase_id = b.phrase_id and a.status = 2 group by a.phrase_id order by clicks desc limit @limit", sql.Named("limit", topNPhrasesCount)).
-		Scan(&topClicksPhrases).Error; err != nil {
+func getTopNPhrase(stats store.StatsRepo, topNPhrasesCount int, c chan []store.PhraseClicks) {
+	topClicksPhrases, err := stats.TopPhrases(topNPhrasesCount)
+	if err != nil {
 		zap.L().Sugar().Error("Error! Get top N clicks phrases: ", err)
-		return
 	}
+	c <- topClicksPhrases
 }
 
-func getRandomNPhrase(db *gorm.DB, randomNPhrasesCount int, c chan []model.PhraseModel) {
-	var randomPickPhrases []model.PhraseModel
-	defer func() {
-		c <- randomPickPhrases
-	}()
-
-	if err := db.Debug().Raw("SELECT * FROM phrase_models where status = 2 ORDER BY RAND() LIMIT ?", randomNPhrasesCount).
-		Scan(&randomPickPhrases).Error; err != nil {
+func getRandomNPhrase(phrases store.PhraseRepo, randomNPhrasesCount int, c chan []model.PhraseModel) {
+	randomPickPhrases, err := phrases.Random(model.StatusApproved, randomNPhrasesCount)
+	if err != nil {
 		zap.L().Sugar().Error("Error! Get random phrases: ", err)
-		return
 	}
+	c <- randomPickPhrases
 }
 
+// updateCache refreshes the partitions and drops the ones of events not read for a while
 func (cp *PhrasesCacheProvider) updateCache() {
+	idleSince := time.Now().Add(-partitionIdleTimeout).Unix()
+
+	cp.mu.Lock()
+	eventIDs := make([]int, 0, len(cp.partitions))
+	for eventID, partition := range cp.partitions {
+		if eventID != model.DefaultEventID && atomic.LoadInt64(&partition.lastRead) < idleSince {
+			delete(cp.partitions, eventID)
+			continue
+		}
+		eventIDs = append(eventIDs, eventID)
+	}
+	cp.mu.Unlock()
+
+	for _, eventID := range eventIDs {
+		cp.updatePartition(eventID)
+	}
+}
+
+func (cp *PhrasesCacheProvider) updatePartition(eventID int) {
+	st := cp.store.Event(eventID)
 
-	c := make(chan ScrollingPhrasesResponse)
 	newestNPhraseC := make(chan []model.PhraseModel)
-	topNPhraseC := make(chan []TopClicksPhraseModel)
+	topNPhraseC := make(chan []store.PhraseClicks)
 	randomPhraseC := make(chan []model.PhraseModel)
 
 	var newestPhrases, randomPickPhrases []model.PhraseModel
-	var topClicksPhrases []TopClicksPhraseModel
+	var topClicksPhrases []store.PhraseClicks
 
 	start := time.Now()
 
-	var reviewedPhraseCount int
-	limit := 30
+	cfg := cp.cacheConfig()
+	limit := cfg.Size
 
-	if err := cp.db.Raw("Select count(*) from phrase_models where status=2").
-		Find(&reviewedPhraseCount).Error; err != nil {
+	reviewedPhraseCount, err := st.Phrases.CountByStatus(model.StatusApproved)
+	if err != nil {
 		zap.L().Sugar().Error("Error! Select reviewed phrases counts: ", err)
 		return
 	}
 
-	newestPhrasesCount, topNPhrasesCount, limit := getReturnPhraseCount(limit, reviewedPhraseCount, cp.db)
+	newestPhrasesCount, topNPhrasesCount, limit := getReturnPhraseCount(limit, reviewedPhraseCount, cfg.MixConfig)
 
-	fmt.Printf("count %v %v %v\n", newestPhrasesCount, topNPhrasesCount, limit)
+	zap.L().Sugar().Debugf("phrase cache of event %v mixes %v newest and %v top phrases out of %v", eventID, newestPhrasesCount, topNPhrasesCount, limit)
 
 	// get newest-N phrases
-	go getNewestNPhrase(cp.db, newestPhrasesCount, newestNPhraseC)
+	go getNewestNPhrase(st.Phrases, newestPhrasesCount, newestNPhraseC)
 
 	// get top-N click phrases
-	go getTopNPhrase(cp.db, topNPhrasesCount, topNPhraseC)
+	go getTopNPhrase(st.Stats, topNPhrasesCount, topNPhraseC)
 
 	// get more random phrase
-	go getRandomNPhrase(cp.db, (limit-topNPhrasesCount-newestPhrasesCount)*4, randomPhraseC)
+	go getRandomNPhrase(st.Phrases, (limit-topNPhrasesCount-newestPhrasesCount)*4, randomPhraseC)
 
 	newestPhrases = <-newestNPhraseC
 	topClicksPhrases = <-topNPhraseC
 	randomPickPhrases = <-randomPhraseC
 
-	// de-duplicate phrase
+	// de-duplicate phrase, a phrase stays in the first segment it was picked for
 	allIDs := make(map[int]bool)
-	var allIDSorted []int
+	var allIDSorted [segmentCount][]int
 	for _, item := range newestPhrases {
-		if res, ok := allIDs[item.PhraseID]; !ok || !res {
-			allIDSorted = append(allIDSorted, item.PhraseID)
+		if !allIDs[item.PhraseID] {
+			allIDSorted[newestSegment] = append(allIDSorted[newestSegment], item.PhraseID)
 		}
-
 		allIDs[item.PhraseID] = true
 	}
 	for _, item := range topClicksPhrases {
-		if res, ok := allIDs[item.PhraseID]; !ok || !res {
-			allIDSorted = append(allIDSorted, item.PhraseID)
+		if !allIDs[item.PhraseID] {
+			allIDSorted[topSegment] = append(allIDSorted[topSegment], item.PhraseID)
 		}
 		allIDs[item.PhraseID] = true
 	}
 	for _, item := range randomPickPhrases {
-		if res, ok := allIDs[item.PhraseID]; !ok || !res {
-			allIDSorted = append(allIDSorted, item.PhraseID)
+		if !allIDs[item.PhraseID] {
+			allIDSorted[randomSegment] = append(allIDSorted[randomSegment], item.PhraseID)
 		}
 		allIDs[item.PhraseID] = true
 	}
 
-	for _, id := range allIDSorted {
-		go CacheNPhrases(id, cp, c)
+	ids := make([]int, 0, len(allIDs))
+	for id := range allIDs {
+		ids = append(ids, id)
 	}
 
-	var phrases []ScrollingPhrasesResponse
-	for _ = range allIDSorted {
-		phrase := <-c
-		if phrase.PhraseID == 0 && len(phrase.Text) == 0 {
-			continue
+	cachedByID, err := cachePhrases(st, ids)
+	if err != nil {
+		zap.L().Sugar().Error("Error! Retrive phrases to cache: ", err)
+		return
+	}
+
+	var phrases [segmentCount][]ScrollingPhrasesResponse
+	for i, ids := range allIDSorted {
+		for _, id := range ids {
+			if phrase, ok := cachedByID[id]; ok {
+				phrases[i] = append(phrases[i], phrase)
+			}
 		}
-		phrases = append(phrases, phrase)
 	}
-	zap.L().Sugar().Infof("update phrase cache cost: %v", time.Since(start))
+	zap.L().Sugar().Infof("update phrase cache of event %d cost: %v", eventID, time.Since(start))
 	cp.mu.Lock()
-	cp.cachedPhrases = phrases
+	// the partition may have been dropped meanwhile
+	if partition, ok := cp.partitions[eventID]; ok {
+		partition.cachedPhrases = phrases
+		partition.populated = true
+	}
 	cp.mu.Unlock()
 }
 
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
 func periodUpdateCache(cache *PhrasesCacheProvider) {
-	ticker := time.NewTicker(3 * time.Second)
+	defer close(cache.doneCh)
+
+	newTicker := func() *time.Ticker {
+		return time.NewTicker(time.Duration(cache.cacheConfig().IntervalSeconds) * time.Second)
+	}
+
+	ticker := newTicker()
+	defer func() {
+		ticker.Stop()
+	}()
 	for {
-		<-ticker.C
-		cache.updateCache()
+		select {
+		case <-ticker.C:
+			cache.updateCache()
+		case <-cache.resetCh:
+			ticker.Stop()
+			ticker = newTicker()
+		case <-cache.stopCh:
+			return
+		}
 	}
 }
 
@@ -0,0 +1,140 @@
+package response
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/YiniXu9506/devconG/utils"
+)
+
+// Code is `c` of the response envelope, clients branch on it
+type Code int
+
+const (
+	CodeOK Code = 0
+	// the server failed, the request may succeed when retried
+	CodeInternal Code = 1
+	// the request is malformed or breaks a rule, it fails the same way when retried
+	CodeBadRequest Code = 2
+	// the server can't serve yet, such as before the phrase cache is filled
+	CodeUnavailable Code = 3
+	// the admin token, the session or the login code is invalid
+	CodeUnauthorized Code = -1
+	// the item already exists, or the action was already done
+	CodeDuplicate Code = 10001
+	// the text of a phrase is empty or too long
+	CodeInvalidText Code = 10002
+	// the item doesn't exist
+	CodeNotFound Code = 11001
+)
+
+// statuses maps the codes to HTTP statuses, codes missing from it are 500
+var statuses = map[Code]int{
+	CodeOK:           http.StatusOK,
+	CodeInternal:     http.StatusInternalServerError,
+	CodeBadRequest:   http.StatusBadRequest,
+	CodeUnavailable:  http.StatusServiceUnavailable,
+	CodeUnauthorized: http.StatusUnauthorized,
+	CodeDuplicate:    http.StatusConflict,
+	CodeInvalidText:  http.StatusBadRequest,
+	CodeNotFound:     http.StatusNotFound,
+}
+
+// Status is the HTTP status responses of the code are sent with
+func (code Code) Status() int {
+	if status, ok := statuses[code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// Languages of the messages, the first is the default
+const (
+	LangEn = "en"
+	LangZh = "zh"
+)
+
+// Error is a registered error response, its message is localized by the language of the request
+type Error struct {
+	Code Code
+	// messages by language
+	messages map[string]string
+	// appended to the message, such as the field a validation failed on
+	detail string
+	// the error behind an internal error, logged but never sent
+	cause error
+}
+
+// registry holds the errors by English message, a message is registered once
+var registry = make(map[string]*Error)
+
+func register(code Code, en, zh string) *Error {
+	if _, ok := registry[en]; ok {
+		panic(fmt.Sprintf("response: error %q registered twice", en))
+	}
+	e := &Error{Code: code, messages: map[string]string{LangEn: en, LangZh: zh}}
+	registry[en] = e
+	return e
+}
+
+// the registered errors, handlers respond with these or a copy carrying a detail or a cause
+var (
+	ErrInternal       = register(CodeInternal, "internal error", "服务器内部错误")
+	ErrBadRequest     = register(CodeBadRequest, "invalid request", "请求参数错误")
+	ErrNotReady       = register(CodeUnavailable, "phrase cache not populated", "弹幕缓存尚未就绪")
+	ErrDatabase       = register(CodeUnavailable, "database unavailable", "数据库不可用")
+	ErrShuttingDown   = register(CodeUnavailable, "shutting down", "服务正在停止")
+	ErrInvalidToken   = register(CodeUnauthorized, "invalid token", "管理员 token 无效")
+	ErrInvalidSession = register(CodeUnauthorized, "invalid session", "登录已失效，请重新登录")
+	ErrInvalidCode    = register(CodeUnauthorized, "invalid code", "登录 code 无效")
+	ErrDuplicate      = register(CodeDuplicate, "An existing item already exists", "已存在相同内容")
+	ErrRoundEnded     = register(CodeDuplicate, "The round has already ended", "本轮已结束")
+	ErrInvalidText    = register(CodeInvalidText, fmt.Sprintf("Text must be 1 to %d characters", utils.MaxTextLength), fmt.Sprintf("内容需为 1 到 %d 个字", utils.MaxTextLength))
+	ErrNotFound       = register(CodeNotFound, "Nonexistent", "不存在")
+	ErrPhraseNotFound = register(CodeNotFound, "This phrase does not exist", "弹幕不存在")
+	ErrUnknownEvent   = register(CodeBadRequest, "unknown event", "活动不存在")
+	ErrUnknownGroup   = register(CodeBadRequest, "unknown group_id", "分组不存在")
+	ErrUnknownProfile = register(CodeBadRequest, "unknown profile", "展示配置不存在")
+)
+
+// Error is the English message with the detail
+func (e *Error) Error() string {
+	return e.Message(LangEn)
+}
+
+// Unwrap is the cause of an internal error
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Message is the message in the language with the detail, the English one for other languages
+func (e *Error) Message(lang string) string {
+	message, ok := e.messages[lang]
+	if !ok {
+		message = e.messages[LangEn]
+	}
+	if e.detail != "" {
+		message += ": " + e.detail
+	}
+	return message
+}
+
+// WithDetail returns a copy of the error whose message ends with the detail
+func (e *Error) WithDetail(format string, args ...interface{}) *Error {
+	copied := *e
+	copied.detail = fmt.Sprintf(format, args...)
+	return &copied
+}
+
+// Wrap returns a copy of the error caused by err, the cause is logged with the request id and not sent
+func (e *Error) Wrap(err error) *Error {
+	copied := *e
+	copied.cause = err
+	return &copied
+}
+
+// Is matches copies of the same registered error
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code && t.messages[LangEn] == e.messages[LangEn]
+}
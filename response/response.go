@@ -0,0 +1,100 @@
+package response
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	// RequestIDHeader carries the request id, a valid id sent by the client is kept
+	RequestIDHeader = "X-Request-ID"
+
+	requestIDKey = "request_id"
+)
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// Envelope is the body of every response
+type Envelope struct {
+	// CodeOK on success
+	C Code `json:"c"`
+	// the data on success, an empty string otherwise
+	D interface{} `json:"d"`
+	// the message of an error in the language of the request
+	M string `json:"m"`
+	// the request id, to find the logs of a failed request
+	R string `json:"r"`
+}
+
+// RequestID gives the request an id, sends it back in RequestIDHeader and logs the causes of failed requests with it
+func RequestID(c *gin.Context) {
+	id := c.GetHeader(RequestIDHeader)
+	if !requestIDPattern.MatchString(id) {
+		id = newRequestID()
+	}
+	c.Set(requestIDKey, id)
+	c.Header(RequestIDHeader, id)
+
+	c.Next()
+
+	if len(c.Errors) > 0 {
+		zap.L().Sugar().Errorf("Error! Request %v %v %v failed with %d: %v", id, c.Request.Method, c.Request.URL.Path, c.Writer.Status(), c.Errors.String())
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// GetRequestID is the id RequestID gave the request
+func GetRequestID(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
+
+// Lang is the language of the messages, from the first language of the Accept-Language header
+func Lang(c *gin.Context) string {
+	accept := strings.ToLower(strings.TrimSpace(c.GetHeader("Accept-Language")))
+	if strings.HasPrefix(accept, LangZh) {
+		return LangZh
+	}
+	return LangEn
+}
+
+// OK responds with the data, nil data is sent as an empty string
+func OK(c *gin.Context, data interface{}) {
+	if data == nil {
+		data = ""
+	}
+	c.JSON(CodeOK.Status(), Envelope{C: CodeOK, D: data, R: GetRequestID(c)})
+}
+
+// Fail responds with the error, errors other than *Error are internal errors
+func Fail(c *gin.Context, err error) {
+	c.JSON(failure(c, err))
+}
+
+// Abort responds with the error like Fail and stops the handlers after the current one
+func Abort(c *gin.Context, err error) {
+	c.AbortWithStatusJSON(failure(c, err))
+}
+
+func failure(c *gin.Context, err error) (int, Envelope) {
+	var e *Error
+	if !errors.As(err, &e) {
+		e = ErrInternal.Wrap(err)
+	}
+	if e.cause != nil {
+		_ = c.Error(e.cause)
+	}
+	return e.Code.Status(), Envelope{C: e.Code, D: "", M: e.Message(Lang(c)), R: GetRequestID(c)}
+}
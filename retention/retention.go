@@ -0,0 +1,351 @@
+package retention
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/YiniXu9506/devconG/config"
+	"github.com/YiniXu9506/devconG/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// ids deleted per statement, SQLite limits the variables of a statement
+const deleteChunkSize = 500
+
+// errCompacted is returned when another instance compacted records of the batch first,
+// the batch is rolled back and the next one picked
+var errCompacted = errors.New("click records were compacted by another instance")
+
+// Plan is what a run would compact, reported by a dry run
+type Plan struct {
+	// records with a click time before it are compacted
+	Cutoff       int64 `json:"cutoff"`
+	Records      int64 `json:"records"`
+	Clicks       int64 `json:"clicks"`
+	MinClickTime int64 `json:"min_click_time"`
+	MaxClickTime int64 `json:"max_click_time"`
+	// rollups the records compact into, some may be merged into existing rollups
+	Rollups int64 `json:"rollups"`
+	Batches int64 `json:"batches"`
+	// state left by earlier runs
+	ExistingRollups int64 `json:"existing_rollups"`
+	ArchivedBatches int64 `json:"archived_batches"`
+}
+
+// Result is what a run compacted
+type Result struct {
+	Batches int64    `json:"batches"`
+	Records int64    `json:"records"`
+	Clicks  int64    `json:"clicks"`
+	Rollups int64    `json:"rollups"`
+	Files   []string `json:"files,omitempty"`
+}
+
+type rollupKey struct {
+	BucketTime int64
+	PhraseID   int
+	GroupID    int
+	OpenID     string
+}
+
+// Cutoff is the click time before which records are compacted
+func Cutoff(cfg config.RetentionConfig, now time.Time) int64 {
+	return now.Add(-time.Duration(cfg.Days) * 24 * time.Hour).Unix()
+}
+
+// Preview reports what Run would compact without changing anything
+func Preview(ctx context.Context, db *gorm.DB, cfg config.RetentionConfig, now time.Time) (Plan, error) {
+	plan := Plan{Cutoff: Cutoff(cfg, now)}
+	db = db.WithContext(ctx)
+
+	if err := db.Raw("SELECT COUNT(*), COALESCE(SUM(clicks), 0), COALESCE(MIN(click_time), 0), COALESCE(MAX(click_time), 0) FROM phrase_click_models WHERE click_time < ?", plan.Cutoff).
+		Row().Scan(&plan.Records, &plan.Clicks, &plan.MinClickTime, &plan.MaxClickTime); err != nil {
+		return plan, err
+	}
+	if err := db.Raw("SELECT COUNT(*) FROM (SELECT 1 FROM phrase_click_models WHERE click_time < ? GROUP BY click_time - click_time % ?, phrase_id, group_id, open_id) as r", plan.Cutoff, cfg.BucketSeconds).
+		Row().Scan(&plan.Rollups); err != nil {
+		return plan, err
+	}
+	plan.Batches = (plan.Records + int64(cfg.BatchSize) - 1) / int64(cfg.BatchSize)
+
+	if err := db.Model(&model.PhraseClickRollupModel{}).Count(&plan.ExistingRollups).Error; err != nil {
+		return plan, err
+	}
+	if err := db.Model(&model.ClickArchiveModel{}).Count(&plan.ArchivedBatches).Error; err != nil {
+		return plan, err
+	}
+	return plan, nil
+}
+
+// Run compacts the records older than retention.days batch by batch, oldest first. Each batch is
+// committed on its own, so a run stopped halfway resumes with the records left at the next run.
+func Run(ctx context.Context, db *gorm.DB, cfg config.RetentionConfig, now time.Time) (Result, error) {
+	var result Result
+	cutoff := Cutoff(cfg, now)
+	// key of the pseudonyms in the archives of the run, it is never written so users can't be recovered
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return result, err
+	}
+	for ctx.Err() == nil {
+		batch, err := compactBatch(ctx, db, cfg, cutoff, key)
+		if errors.Is(err, errCompacted) {
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+		if batch.Records == 0 {
+			break
+		}
+		result.Batches++
+		result.Records += int64(batch.Records)
+		result.Clicks += int64(batch.Clicks)
+		result.Rollups += int64(batch.rollups)
+		if batch.File != "" {
+			result.Files = append(result.Files, batch.File)
+		}
+	}
+	return result, ctx.Err()
+}
+
+type batchResult struct {
+	model.ClickArchiveModel
+	rollups int
+}
+
+// compactBatch compacts the oldest batch_size records before cutoff, archived open_ids are replaced by pseudonyms of key
+func compactBatch(ctx context.Context, db *gorm.DB, cfg config.RetentionConfig, cutoff int64, key []byte) (batchResult, error) {
+	var batch batchResult
+	db = db.WithContext(ctx)
+
+	var records []model.PhraseClickModel
+	if err := db.Where("click_time < ?", cutoff).
+		Order("click_time, id").
+		Limit(cfg.BatchSize).
+		Find(&records).Error; err != nil {
+		return batch, err
+	}
+	if len(records) == 0 {
+		return batch, nil
+	}
+
+	ids := make([]int, len(records))
+	rollups := make(map[rollupKey]*model.PhraseClickRollupModel)
+	batch.FirstRecord = records[0].ID
+	batch.MinClickTime = records[0].ClickTime
+	for i, record := range records {
+		ids[i] = record.ID
+		batch.Clicks += record.Clicks
+		if record.ClickTime > batch.MaxClickTime {
+			batch.MaxClickTime = record.ClickTime
+		}
+
+		key := rollupKey{
+			BucketTime: record.ClickTime - record.ClickTime%int64(cfg.BucketSeconds),
+			PhraseID:   record.PhraseID,
+			GroupID:    record.GroupID,
+			OpenID:     record.OpenID,
+		}
+		rollup, ok := rollups[key]
+		if !ok {
+			// the phrase decides the event, records of a key share it
+			rollup = &model.PhraseClickRollupModel{EventID: record.EventID, BucketTime: key.BucketTime, PhraseID: key.PhraseID, GroupID: key.GroupID, OpenID: key.OpenID}
+			rollups[key] = rollup
+		}
+		rollup.Clicks += record.Clicks
+		rollup.Records++
+		if record.ClickTime > rollup.ClickTime {
+			rollup.ClickTime = record.ClickTime
+		}
+	}
+	batch.Records = len(records)
+	batch.rollups = len(rollups)
+	batch.CreateTime = time.Now().Unix()
+
+	// the archive is named after the first record, a batch retried after a failure overwrites it
+	if cfg.Action == config.RetentionActionArchive {
+		batch.File = filepath.Join(cfg.ArchiveDir, fmt.Sprintf("phrase_clicks-%s-%d.jsonl.gz",
+			time.Unix(batch.MinClickTime, 0).UTC().Format("20060102"), batch.FirstRecord))
+		if err := writeArchive(batch.File, records, key); err != nil {
+			return batch, fmt.Errorf("archive click records: %w", err)
+		}
+	}
+
+	// the same order in all instances, concurrent batches don't deadlock on the rollups
+	sorted := make([]*model.PhraseClickRollupModel, 0, len(rollups))
+	for _, rollup := range rollups {
+		sorted = append(sorted, rollup)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.BucketTime != b.BucketTime {
+			return a.BucketTime < b.BucketTime
+		}
+		if a.PhraseID != b.PhraseID {
+			return a.PhraseID < b.PhraseID
+		}
+		if a.GroupID != b.GroupID {
+			return a.GroupID < b.GroupID
+		}
+		return a.OpenID < b.OpenID
+	})
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// records deleted by another instance were rolled up by it
+		var deleted int64
+		for start := 0; start < len(ids); start += deleteChunkSize {
+			end := start + deleteChunkSize
+			if end > len(ids) {
+				end = len(ids)
+			}
+			res := tx.Where("id IN ?", ids[start:end]).Delete(&model.PhraseClickModel{})
+			if res.Error != nil {
+				return res.Error
+			}
+			deleted += res.RowsAffected
+		}
+		if deleted != int64(len(ids)) {
+			return errCompacted
+		}
+
+		for _, rollup := range sorted {
+			res := tx.Model(&model.PhraseClickRollupModel{}).
+				Where("bucket_time = ? AND phrase_id = ? AND group_id = ? AND open_id = ?", rollup.BucketTime, rollup.PhraseID, rollup.GroupID, rollup.OpenID).
+				Updates(map[string]interface{}{
+					"clicks":     gorm.Expr("clicks + ?", rollup.Clicks),
+					"records":    gorm.Expr("records + ?", rollup.Records),
+					"click_time": gorm.Expr("CASE WHEN click_time < ? THEN ? ELSE click_time END", rollup.ClickTime, rollup.ClickTime),
+				})
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				if err := tx.Create(rollup).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		return tx.Create(&batch.ClickArchiveModel).Error
+	})
+	return batch, err
+}
+
+// pseudonym maps an open_id to the same pseudonym within the archives of a run
+func pseudonym(key []byte, openID string) string {
+	if openID == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(openID))
+	return "u-" + hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// writeArchive writes the records with pseudonymous open_ids as gzipped json lines, the file appears once it is complete.
+// Users who erase their account later can't be found in the archives.
+func writeArchive(file string, records []model.PhraseClickModel, key []byte) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	zw := gzip.NewWriter(tmp)
+	encoder := json.NewEncoder(zw)
+	for _, record := range records {
+		record.OpenID = pseudonym(key, record.OpenID)
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// Job runs the compaction every retention.interval_seconds while retention.enabled is set,
+// instances serving the same database compact different batches
+type Job struct {
+	db     *gorm.DB
+	config *config.Manager
+
+	stopOnce sync.Once
+	cancel   context.CancelFunc
+	doneCh   chan struct{}
+}
+
+func NewJob(db *gorm.DB, cfg *config.Manager) *Job {
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &Job{
+		db:     db,
+		config: cfg,
+		cancel: cancel,
+		doneCh: make(chan struct{}),
+	}
+	go periodRun(ctx, job)
+	return job
+}
+
+// Stop interrupts a running compaction, the batch in progress is rolled back, and waits for it to exit
+func (j *Job) Stop() {
+	j.stopOnce.Do(j.cancel)
+	<-j.doneCh
+}
+
+func (j *Job) run(ctx context.Context) {
+	cfg := j.config.Get().Retention
+	if !cfg.Enabled {
+		return
+	}
+	start := time.Now()
+	result, err := Run(ctx, j.db, cfg, start)
+	if err != nil && ctx.Err() == nil {
+		zap.L().Sugar().Error("Error! Compact click records: ", err)
+	}
+	if result.Records > 0 {
+		zap.L().Sugar().Infof("retention compacted %d click records of %d clicks into %d rollups in %d batches in %v",
+			result.Records, result.Clicks, result.Rollups, result.Batches, time.Since(start).Round(time.Millisecond))
+	}
+}
+
+func periodRun(ctx context.Context, job *Job) {
+	defer close(job.doneCh)
+
+	for {
+		// the interval is read again after each run, reloaded settings apply to the next one
+		timer := time.NewTimer(time.Duration(job.config.Get().Retention.IntervalSeconds) * time.Second)
+		select {
+		case <-timer.C:
+			job.run(ctx)
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package retention
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/YiniXu9506/devconG/config"
+	"github.com/YiniXu9506/devconG/model"
+	"github.com/YiniXu9506/devconG/utils"
+	"gorm.io/gorm"
+)
+
+func openSQLite(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := utils.Open(config.DBConfig{Driver: config.DBDriverSQLite, Path: filepath.Join(t.TempDir(), "devcon.db"), MaxIdleConns: 2, MaxOpenConns: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		utils.Close(db)
+	})
+	if err := utils.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func testRetentionConfig(t *testing.T, action string) config.RetentionConfig {
+	return config.RetentionConfig{
+		Enabled:       true,
+		Days:          30,
+		BucketSeconds: 3600,
+		BatchSize:     3,
+		Action:        action,
+		ArchiveDir:    t.TempDir(),
+	}
+}
+
+// addClicks stores click records of two users on a phrase, the old ones are in the same hour
+func addClicks(t *testing.T, db *gorm.DB, now time.Time) {
+	t.Helper()
+
+	old := now.Add(-40 * 24 * time.Hour).Truncate(time.Hour).Unix()
+	records := []model.PhraseClickModel{
+		{EventID: model.DefaultEventID, PhraseID: 1, GroupID: 1, OpenID: "alice", Clicks: 3, ClickTime: old},
+		{EventID: model.DefaultEventID, PhraseID: 1, GroupID: 1, OpenID: "alice", Clicks: 4, ClickTime: old + 60},
+		{EventID: model.DefaultEventID, PhraseID: 1, GroupID: 1, OpenID: "bob", Clicks: 5, ClickTime: old + 120},
+		{EventID: model.DefaultEventID, PhraseID: 1, GroupID: 1, OpenID: "alice", Clicks: 6, ClickTime: old + 180},
+		{EventID: model.DefaultEventID, PhraseID: 1, GroupID: 1, OpenID: "alice", Clicks: 7, ClickTime: now.Unix()},
+	}
+	if err := db.Create(&records).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func totalClicks(t *testing.T, db *gorm.DB) int64 {
+	t.Helper()
+
+	var total int64
+	if err := db.Raw("SELECT COALESCE(SUM(clicks), 0) FROM all_phrase_clicks").Scan(&total).Error; err != nil {
+		t.Fatal(err)
+	}
+	return total
+}
+
+func readArchive(t *testing.T, file string) []model.PhraseClickModel {
+	t.Helper()
+
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var records []model.PhraseClickModel
+	scanner := bufio.NewScanner(zr)
+	for scanner.Scan() {
+		var record model.PhraseClickModel
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestRunArchive(t *testing.T) {
+	db := openSQLite(t)
+	now := time.Now()
+	addClicks(t, db, now)
+	cfg := testRetentionConfig(t, config.RetentionActionArchive)
+
+	plan, err := Preview(context.Background(), db, cfg, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Records != 4 || plan.Clicks != 18 || plan.Rollups != 2 || plan.Batches != 2 {
+		t.Fatalf("got plan %+v", plan)
+	}
+
+	result, err := Run(context.Background(), db, cfg, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Batches != 2 || result.Records != 4 || result.Clicks != 18 || len(result.Files) != 2 {
+		t.Fatalf("got result %+v", result)
+	}
+
+	var records int64
+	if err := db.Model(&model.PhraseClickModel{}).Count(&records).Error; err != nil || records != 1 {
+		t.Fatalf("got %d records left, %v, want the recent one", records, err)
+	}
+	var rollups []model.PhraseClickRollupModel
+	if err := db.Order("open_id").Find(&rollups).Error; err != nil {
+		t.Fatal(err)
+	}
+	// alice's records of both batches are merged into one rollup
+	if len(rollups) != 2 || rollups[0].OpenID != "alice" || rollups[0].Clicks != 13 || rollups[0].Records != 3 || rollups[1].Clicks != 5 {
+		t.Fatalf("got rollups %+v", rollups)
+	}
+	if total := totalClicks(t, db); total != 25 {
+		t.Fatalf("got %d clicks in all_phrase_clicks, want 25", total)
+	}
+
+	// archived users are pseudonyms, the same within the run
+	var archived []model.PhraseClickModel
+	for _, file := range result.Files {
+		archived = append(archived, readArchive(t, file)...)
+	}
+	if len(archived) != 4 {
+		t.Fatalf("got %d archived records, want 4", len(archived))
+	}
+	pseudonyms := make(map[string]int)
+	for _, record := range archived {
+		if record.OpenID == "alice" || record.OpenID == "bob" || !strings.HasPrefix(record.OpenID, "u-") {
+			t.Fatalf("archived open_id %q, want a pseudonym", record.OpenID)
+		}
+		pseudonyms[record.OpenID]++
+	}
+	if len(pseudonyms) != 2 {
+		t.Fatalf("got pseudonyms %v, want one per user", pseudonyms)
+	}
+
+	// nothing is left to compact
+	if result, err = Run(context.Background(), db, cfg, now); err != nil || result.Records != 0 {
+		t.Fatalf("got %+v, %v on the second run", result, err)
+	}
+}
+
+func TestRunDelete(t *testing.T) {
+	db := openSQLite(t)
+	now := time.Now()
+	addClicks(t, db, now)
+	cfg := testRetentionConfig(t, config.RetentionActionDelete)
+
+	result, err := Run(context.Background(), db, cfg, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Records != 4 || len(result.Files) != 0 {
+		t.Fatalf("got result %+v, want no archives", result)
+	}
+	if entries, err := os.ReadDir(cfg.ArchiveDir); err != nil || len(entries) != 0 {
+		t.Fatalf("got %d files in the archive dir, %v", len(entries), err)
+	}
+	if total := totalClicks(t, db); total != 25 {
+		t.Fatalf("got %d clicks in all_phrase_clicks, want 25", total)
+	}
+}
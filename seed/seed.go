@@ -0,0 +1,267 @@
+package seed
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/YiniXu9506/devconG/model"
+	"github.com/YiniXu9506/devconG/store"
+)
+
+// OpenIDPrefix starts the open_id of generated users
+const OpenIDPrefix = "seed-"
+
+// clicks generated before they are written in one batch
+const clickBatchSize = 1000
+
+var (
+	provinces       = []string{"北京", "上海", "广东", "浙江", "江苏", "四川", "湖北", "山东", "福建", "陕西"}
+	provinceWeights = []float64{18, 16, 14, 10, 10, 8, 7, 7, 5, 5}
+	syllables       = []string{"xiao", "ming", "hua", "li", "wei", "jun", "fang", "tao", "lin", "yu", "chen", "hao"}
+	subjects        = []string{"TiDB", "DevCon", "分布式", "HTAP", "TiKV", "TiFlash", "PD", "云原生", "开源", "社区"}
+	predicates      = []string{"加油", "太强了", "永远的神", "yyds", "冲冲冲", "我来了", "稳如老狗", "真香", "666", "起飞"}
+	// share of generated phrases in each status
+	statuses      = []model.PhraseStatus{model.StatusApproved, model.StatusPending, model.StatusRejected, model.StatusHidden}
+	statusWeights = []float64{75, 15, 7, 3}
+)
+
+// Options sizes the generated data and the time it spans
+type Options struct {
+	Phrases int
+	Clicks  int
+	Users   int
+	// the same seed generates the same data for the same options
+	Seed int64
+	// groups phrases and users belong to, numbered from 1
+	Groups int
+	// the data spans Duration up to End
+	End      time.Time
+	Duration time.Duration
+}
+
+// Result counts the generated records
+type Result struct {
+	Phrases int `json:"phrases"`
+	Clicks  int `json:"clicks"`
+	Users   int `json:"users"`
+}
+
+// generator draws the data of one run
+type generator struct {
+	opts  Options
+	rand  *rand.Rand
+	start int64
+	end   int64
+	// moments of the event attracting most activity, like the breaks between talks
+	peaks []int64
+}
+
+// Generate writes users, phrases and clicks through the store.
+// Activity gathers around a few peaks of the time span, a few phrases get most of the clicks
+// and a few users click the most, clicks land after the phrase got on the wall.
+func Generate(st store.Store, opts Options) (Result, error) {
+	var result Result
+	if opts.Phrases < 0 || opts.Clicks < 0 || opts.Users < 0 {
+		return result, errors.New("counts must not be negative")
+	}
+	if opts.Users == 0 && (opts.Phrases > 0 || opts.Clicks > 0) {
+		return result, errors.New("phrases and clicks need users")
+	}
+	if opts.Groups <= 0 || opts.Duration <= 0 {
+		return result, errors.New("groups and duration must be positive")
+	}
+
+	g := &generator{
+		opts:  opts,
+		rand:  rand.New(rand.NewSource(opts.Seed)),
+		start: opts.End.Add(-opts.Duration).Unix(),
+		end:   opts.End.Unix(),
+	}
+	for i := 1; i <= 3; i++ {
+		g.peaks = append(g.peaks, g.start+int64(opts.Duration.Seconds())*int64(i)/4)
+	}
+
+	users, err := g.users(st)
+	result.Users = len(users)
+	if err != nil {
+		return result, err
+	}
+	phrases, err := g.phrases(st, users)
+	result.Phrases = len(phrases)
+	if err != nil {
+		return result, err
+	}
+	result.Clicks, err = g.clicks(st, users, phrases)
+	return result, err
+}
+
+// eventTime draws a time of the span, most of them around a peak
+func (g *generator) eventTime() int64 {
+	if g.rand.Float64() < 0.3 {
+		return g.start + g.rand.Int63n(g.end-g.start+1)
+	}
+	peak := g.peaks[g.rand.Intn(len(g.peaks))]
+	t := peak + int64(g.rand.NormFloat64()*g.opts.Duration.Seconds()/12)
+	return clamp(t, g.start, g.end)
+}
+
+// after draws a time between t and the end of the span, closer to t more likely
+func (g *generator) after(t int64, mean float64) int64 {
+	if t >= g.end {
+		return g.end
+	}
+	if next := t + int64(g.rand.ExpFloat64()*mean); next <= g.end {
+		return next
+	}
+	// past the end, spread evenly instead of piling up at the end
+	return t + g.rand.Int63n(g.end-t+1)
+}
+
+func clamp(t, min, max int64) int64 {
+	if t < min {
+		return min
+	}
+	if t > max {
+		return max
+	}
+	return t
+}
+
+func (g *generator) pick(weights []float64) int {
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	x := g.rand.Float64() * total
+	for i, w := range weights {
+		if x < w {
+			return i
+		}
+		x -= w
+	}
+	return len(weights) - 1
+}
+
+// zipf draws indexes below n, small indexes far more often
+func (g *generator) zipf(n int) func() int {
+	if n == 1 {
+		return func() int { return 0 }
+	}
+	z := rand.NewZipf(g.rand, 1.2, 1, uint64(n-1))
+	return func() int { return int(z.Uint64()) }
+}
+
+func (g *generator) users(st store.Store) ([]model.UserModel, error) {
+	var users []model.UserModel
+	for i := 1; i <= g.opts.Users; i++ {
+		nickName := ""
+		for j := 0; j < 2+g.rand.Intn(2); j++ {
+			nickName += syllables[g.rand.Intn(len(syllables))]
+		}
+		user := model.UserModel{
+			OpenID:   fmt.Sprintf("%s%d-%d", OpenIDPrefix, g.opts.Seed, i),
+			NickName: nickName,
+			// 1 male, 2 female, 3 not shared
+			Sex:      []int{1, 2, 3}[g.pick([]float64{48, 47, 5})],
+			Province: provinces[g.pick(provinceWeights)],
+		}
+		user.City = user.Province
+		if err := st.Users.Upsert(user); err != nil {
+			return users, err
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+// group of a user, users of a group sit together and cheer for their own phrases
+func (g *generator) group(userIndex int) int {
+	return userIndex%g.opts.Groups + 1
+}
+
+func (g *generator) phrases(st store.Store, users []model.UserModel) ([]model.PhraseModel, error) {
+	author := g.zipf(len(users))
+	used := make(map[string]int)
+	var phrases []model.PhraseModel
+	for i := 1; i <= g.opts.Phrases; i++ {
+		authorIndex := author()
+		phrase := model.PhraseModel{
+			Text:       subjects[g.rand.Intn(len(subjects))] + predicates[g.rand.Intn(len(predicates))],
+			GroupID:    g.group(authorIndex),
+			OpenID:     users[authorIndex].OpenID,
+			Status:     statuses[g.pick(statusWeights)],
+			CreateTime: g.eventTime(),
+		}
+		phrase.UpdateTime = phrase.CreateTime
+		if phrase.Status != model.StatusPending {
+			// reviewed a few minutes after submission
+			phrase.UpdateTime = g.after(phrase.CreateTime, 120)
+		}
+
+		// texts are unique, the same words get a number
+		words := phrase.Text
+		for {
+			used[words]++
+			if used[words] > 1 {
+				phrase.Text = fmt.Sprintf("%s %d", words, used[words])
+			}
+			err := st.Phrases.Create(&phrase)
+			if err == nil {
+				break
+			}
+			// texts of an earlier run are skipped
+			if !errors.Is(err, store.ErrDuplicate) {
+				return phrases, err
+			}
+		}
+		phrases = append(phrases, phrase)
+	}
+	return phrases, nil
+}
+
+func (g *generator) clicks(st store.Store, users []model.UserModel, phrases []model.PhraseModel) (int, error) {
+	if g.opts.Clicks == 0 {
+		return 0, nil
+	}
+	// only phrases on the wall are clicked, the order decides which become hot
+	var approved []model.PhraseModel
+	for _, phrase := range phrases {
+		if phrase.Status == model.StatusApproved {
+			approved = append(approved, phrase)
+		}
+	}
+	if len(approved) == 0 {
+		return 0, errors.New("clicks need approved phrases, generate more phrases")
+	}
+	g.rand.Shuffle(len(approved), func(i, j int) { approved[i], approved[j] = approved[j], approved[i] })
+
+	phrase := g.zipf(len(approved))
+	clicker := g.zipf(len(users))
+	// a phrase keeps getting clicks for about a sixth of the span
+	mean := g.opts.Duration.Seconds() / 6
+
+	written := 0
+	batch := make([]model.PhraseClickModel, 0, clickBatchSize)
+	for i := 0; i < g.opts.Clicks; i++ {
+		p := approved[phrase()]
+		userIndex := clicker()
+		batch = append(batch, model.PhraseClickModel{
+			PhraseID: p.PhraseID,
+			GroupID:  g.group(userIndex),
+			OpenID:   users[userIndex].OpenID,
+			// clients send the clicks of a few seconds together
+			Clicks:    1 + int(g.rand.ExpFloat64()*1.5),
+			ClickTime: g.after(p.UpdateTime, mean),
+		})
+		if len(batch) == clickBatchSize || i == g.opts.Clicks-1 {
+			if err := st.Clicks.AddMany(batch); err != nil {
+				return written, err
+			}
+			written += len(batch)
+			batch = batch[:0]
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/YiniXu9506/devconG/config"
+	"github.com/YiniXu9506/devconG/provider"
+	"github.com/YiniXu9506/devconG/response"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func redactedSnapshot(snapshot *config.Snapshot) config.Snapshot {
+	return config.Snapshot{
+		Config:   snapshot.Config.Redacted(),
+		Version:  snapshot.Version,
+		LoadedAt: snapshot.LoadedAt,
+	}
+}
+
+// get the effective config and its version
+func (s *Service) GetConfigHandler(c *gin.Context) {
+	if !s.checkToken(c) {
+		return
+	}
+
+	response.OK(c, redactedSnapshot(s.config.Snapshot()))
+}
+
+// list display profiles
+func (s *Service) GetProfilesHandler(c *gin.Context) {
+	if !s.checkToken(c) {
+		return
+	}
+
+	response.OK(c, s.profilesProvider.List())
+}
+
+// create or replace a display profile, omitted settings inherit from the default profile
+func (s *Service) PutProfileHandler(c *gin.Context) {
+	if !s.checkToken(c) {
+		return
+	}
+
+	var req config.ProfileConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Fail(c, response.ErrBadRequest.WithDetail("invalid profile: %v", err))
+		return
+	}
+
+	name := c.Param("name")
+	if err := s.profilesProvider.Save(name, req); err != nil {
+		zap.L().Sugar().Errorf("Error! Save display profile %v: %v", name, err)
+		response.Fail(c, response.ErrBadRequest.WithDetail("%v", err))
+		return
+	}
+
+	profile, _ := s.profilesProvider.Get(name)
+	response.OK(c, profile)
+}
+
+// delete a display profile edited at runtime
+func (s *Service) DeleteProfileHandler(c *gin.Context) {
+	if !s.checkToken(c) {
+		return
+	}
+
+	name := c.Param("name")
+	if err := s.profilesProvider.Delete(name); err != nil {
+		if errors.Is(err, provider.ErrUnknownProfile) {
+			response.Fail(c, response.ErrNotFound)
+			return
+		}
+		zap.L().Sugar().Errorf("Error! Delete display profile %v: %v", name, err)
+		response.Fail(c, err)
+		return
+	}
+
+	response.OK(c, nil)
+}
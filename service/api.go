@@ -1,36 +1,32 @@
 package service
 
 import (
-	"database/sql"
+	"context"
+	"crypto/subtle"
 	"errors"
-	"fmt"
-	"math/rand"
-	"net/http"
+	"io"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/YiniXu9506/devconG/model"
+	"github.com/YiniXu9506/devconG/provider"
+	"github.com/YiniXu9506/devconG/response"
+	"github.com/YiniXu9506/devconG/store"
 	"github.com/YiniXu9506/devconG/utils"
 	"github.com/gin-gonic/gin"
-	"github.com/go-sql-driver/mysql"
 	"go.uber.org/zap"
 )
 
-type distributionModel struct {
-	GroupID int `json:"group_id"`
-	Clicks  int `json:"clicks"`
-}
-
 type phraseWithDistributionModel struct {
 	model.PhraseModel
-	Distributions []distributionModel `json:"distributions"`
+	Clicks        int                 `json:"clicks"`
+	Distributions []store.GroupClicks `json:"distributions"`
 }
 
 type topNPhrasesWithDistribution struct {
 	PhraseID      int                 `json:"phrase_id"`
 	Text          string              `json:"text"`
-	Distributions []distributionModel `json:"distributions"`
+	Distributions []store.GroupClicks `json:"distributions"`
 }
 
 type PagiInfo struct {
@@ -41,222 +37,210 @@ type PagiInfo struct {
 type allPhraseResponse struct {
 	Pagi PagiInfo                      `json:"pagi"`
 	List []phraseWithDistributionModel `json:"list"`
+	// cursor of the next page, empty on the last page
+	NextCursor string `json:"next_cursor"`
 }
 
-func phraseDistribution(distributions []distributionModel) []distributionModel {
+// phraseDistribution pads the clicks of a phrase with the groups of the event without clicks
+func phraseDistribution(distributions []store.GroupClicks, groups int) []store.GroupClicks {
 	distributionGroupIDs := make(map[int]bool)
 
 	for _, dist := range distributions {
 		distributionGroupIDs[dist.GroupID] = true
 	}
 
-	for i := 0; i < 5; i++ {
+	for i := 0; i < groups; i++ {
 		if _, ok := distributionGroupIDs[i+1]; !ok {
-			var phraseDistribution distributionModel
-			phraseDistribution.GroupID = i + 1
-			phraseDistribution.Clicks = 0
-			distributions = append(distributions, phraseDistribution)
+			distributions = append(distributions, store.GroupClicks{GroupID: i + 1, Clicks: 0})
 		}
 	}
 
 	return distributions
 }
 
-var token = "XVlBzgbaiCMRAjWwhTHctcuAxhxKQF"
+// checkToken responds with an error unless the request carries the admin token
+func (s *Service) checkToken(c *gin.Context) bool {
+	reqToken := c.Request.Header.Get("token")
+
+	if subtle.ConstantTimeCompare([]byte(reqToken), []byte(s.config.Get().Auth.AdminToken)) != 1 {
+		response.Fail(c, response.ErrInvalidToken)
+
+		return false
+	}
+
+	return true
+}
+
+// phraseStatusChanged notifies the author and the webhook subscriptions, phrase holds the new status
+func (s *Service) phraseStatusChanged(ctx context.Context, phrase model.PhraseModel, fromStatus model.PhraseStatus) {
+	if s.notifier != nil {
+		s.notifier.PhraseStatusChanged(ctx, phrase, fromStatus)
+	}
+	if s.webhooks != nil {
+		s.webhooks.PhraseStatusChanged(ctx, phrase, fromStatus)
+	}
+}
 
-// return phrases to wechat
+// return phrases to wechat, laid out for the display profile given by ?profile=
 func (s *Service) GetScrollingPhrasesHandler(c *gin.Context) {
-	const defaultLimit = "100"
-	limit, err := strconv.Atoi(c.DefaultQuery("limit", defaultLimit))
+	event := requestEvent(c)
+	profile, err := s.eventsProvider.Profile(event, c.Query("profile"))
+	if err != nil {
+		response.Fail(c, response.ErrUnknownProfile)
+		return
+	}
+
+	defaultLimit := profile.PhrasesLimit
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultLimit)))
 
 	if err != nil {
-		fmt.Printf("failed to convert string to int")
-		limit = 100
+		zap.L().Sugar().Warnf("invalid limit %q of scrolling phrases, using %v", c.Query("limit"), defaultLimit)
+		limit = defaultLimit
 	}
 
-	scrollingPhrasesRes := s.phraseCacheProvider.GetScrollingPhrases(limit)
+	scrollingPhrasesRes := s.phraseCacheProvider.GetScrollingPhrases(event.ID, limit, profile.Mix)
+	provider.ResolveAppearance(scrollingPhrasesRes, profile.H5Config)
 
-	c.JSON(http.StatusOK, gin.H{
-		"c": 0,
-		"d": scrollingPhrasesRes,
-		"m": "",
-	})
+	response.OK(c, scrollingPhrasesRes)
 }
 
 // add a new phrase
 func (s *Service) AddPhraseHandler(c *gin.Context) {
 	type phraseRequest struct {
 		Text    string `form:"text" json:"text" binding:"required"`
-		OpenID  string `form:"open_id" json:"open_id" binding:"required"`
 		GroupID int    `form:"group_id" json:"group_id" binding:"required"`
 	}
 
 	var req phraseRequest
 	// bind json
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"c": 2,
-			"d": "",
-			"m": "phrase_id, open_id, group_id are required!",
-		})
+		response.Fail(c, response.ErrBadRequest.WithDetail("text and group_id are required"))
+		return
+	}
+	if !requestEvent(c).Settings.HasGroup(req.GroupID) {
+		response.Fail(c, response.ErrUnknownGroup)
 		return
 	}
+	openID := sessionOpenID(c)
 
 	// check text maxium length
 	isValidate := utils.ValidateText(req.Text)
 
 	if !isValidate {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"c": 10002,
-			"d": "",
-			"m": "Maximum 10 characters",
-		})
+		response.Fail(c, response.ErrInvalidText)
 
 		return
 	}
 
 	start := time.Now()
 
-	if err := s.db.Table("phrase_models").
-		Create(&model.PhraseModel{Text: req.Text, OpenID: req.OpenID, GroupID: req.GroupID, Status: 1, CreateTime: time.Now().Unix(), UpdateTime: time.Now().Unix()}).Error; err != nil {
-		mysqlErr := &mysql.MySQLError{}
-		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"c": 10001,
-				"d": "",
-				"m": "An existing item already exists",
-			})
+	phrase := model.PhraseModel{Text: req.Text, OpenID: openID, GroupID: req.GroupID, Status: model.StatusPending, CreateTime: time.Now().Unix(), UpdateTime: time.Now().Unix()}
+	if err := s.eventStore(c).Phrases.Create(&phrase); err != nil {
+		if errors.Is(err, store.ErrDuplicate) {
+			response.Fail(c, response.ErrDuplicate)
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"c": 1,
-				"d": "",
-				"m": err.Error(),
-			})
+			response.Fail(c, err)
 		}
 		return
 	}
 
+	if s.webhooks != nil {
+		s.webhooks.PhraseSubmitted(c.Request.Context(), phrase)
+	}
+
 	zap.L().Sugar().Infof("add new phrase cost: %v", time.Since(start))
-	c.JSON(http.StatusOK, gin.H{
-		"c": 0,
-		"d": "",
-		"m": "",
-	})
+	response.OK(c, nil)
 }
 
 // update phrase click counts
 func (s *Service) UpdateClickedPhraseHandler(c *gin.Context) {
 	type latestClickedPhraseRequest struct {
-		PhraseID int    `form:"phrase_id" json:"phrase_id" binding:"required"`
-		Clicks   int    `form:"clicks" json:"clicks" binding:"required"`
-		OpenID   string `form:"open_id" json:"open_id" binding:"required"`
-		GroupID  int    `form:"group_id" json:"group_id" binding:"required"`
+		PhraseID int `form:"phrase_id" json:"phrase_id" binding:"required"`
+		Clicks   int `form:"clicks" json:"clicks" binding:"required"`
+		GroupID  int `form:"group_id" json:"group_id" binding:"required"`
 	}
 
 	var req []latestClickedPhraseRequest
 
 	// bind json
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"c": 2,
-			"d": "",
-			"m": "phrase_id, clicks, open_id and group_id are required!",
-		})
+		response.Fail(c, response.ErrBadRequest.WithDetail("phrase_id, clicks and group_id are required"))
 		return
 	}
+	event := requestEvent(c)
+	for _, phrase := range req {
+		if !event.Settings.HasGroup(phrase.GroupID) {
+			response.Fail(c, response.ErrUnknownGroup)
+			return
+		}
+	}
+	open_id := sessionOpenID(c)
 
 	// start := time.Now()
 
 	for _, phrase := range req {
-		var phraseRecord model.PhraseModel
 		phrase_id := phrase.PhraseID
 		clicks := phrase.Clicks
-		open_id := phrase.OpenID
 		group_id := phrase.GroupID
 
 		// check validation of phrase in phrase_models
-		phraseRecordRe := s.db.Table("phrase_models").Where("phrase_id = ? AND status = ?", phrase_id, 2).Find(&phraseRecord)
-
-		if phraseRecordRe.Error != nil {
-			zap.L().Sugar().Error("Error! Check validation of phrase in phrase_models:", phraseRecordRe.Error)
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"c": 1,
-				"d": "",
-				"m": phraseRecordRe.Error.Error(),
-			})
+		phraseRecord, found, err := s.eventStore(c).Phrases.Get(phrase_id)
+		if err != nil {
+			zap.L().Sugar().Error("Error! Check validation of phrase in phrase_models:", err)
+			response.Fail(c, err)
 			return
 		}
 
 		// if find the reviewed phrase exist in phrase_models, then insert the click stats
-		if phraseRecordRe.RowsAffected > 0 {
-			if err := s.db.Create(&model.PhraseClickModel{PhraseID: phrase_id, Clicks: clicks, OpenID: open_id, GroupID: group_id, ClickTime: time.Now().Unix()}).Error; err != nil {
+		if found && phraseRecord.Status == model.StatusApproved {
+			if err := s.eventStore(c).Clicks.Add(model.PhraseClickModel{PhraseID: phrase_id, Clicks: clicks, OpenID: open_id, GroupID: group_id, ClickTime: time.Now().Unix()}); err != nil {
 				zap.L().Sugar().Error("Error! Failed to update phrase click model: ", err)
-				c.JSON(http.StatusInternalServerError, gin.H{
-					"c": 1,
-					"d": "",
-					"m": err.Error(),
-				})
+				response.Fail(c, err)
 				return
 			}
+			if s.notifier != nil {
+				s.notifier.ClicksAdded(phrase_id)
+			}
+			if s.webhooks != nil {
+				s.webhooks.ClicksAdded(event.ID, phrase_id)
+			}
 		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"c": 0,
-		"d": "",
-		"m": "",
-	})
+	response.OK(c, nil)
 }
 
+// create or update the profile of the logged in user
 func (s *Service) AddUserHandler(c *gin.Context) {
-	var req model.UserModel
+	type userRequest struct {
+		NickName   string `json:"nick_name"`
+		Sex        int    `json:"sex"`
+		Province   string `json:"province"`
+		City       string `json:"city"`
+		HeadImgURL string `json:"headimgurl"`
+	}
+
+	var req userRequest
 	// bind json
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"c": 2,
-			"d": "",
-			"m": "open_id is required!",
-		})
-		return
-	}
-
-	if err := s.db.Table("user_models").
-		Create(&model.UserModel{OpenID: req.OpenID, NickName: req.NickName, Sex: req.Sex, Province: req.Province, City: req.City, HeadImgURL: req.HeadImgURL}).Error; err != nil {
-		mysqlErr := &mysql.MySQLError{}
-		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
-			c.JSON(http.StatusOK, gin.H{
-				"c": 0,
-				"d": "",
-				"m": "",
-			})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"c": 1,
-				"d": "",
-				"m": err.Error(),
-			})
-		}
+		response.Fail(c, response.ErrBadRequest.WithDetail("invalid user info"))
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"c": 0,
-		"d": "",
-		"m": "",
-	})
+	// upsert, users change their nickname, avatar and location over time
+	if err := s.eventStore(c).Users.Upsert(model.UserModel{OpenID: sessionOpenID(c), NickName: req.NickName, Sex: req.Sex, Province: req.Province, City: req.City, HeadImgURL: req.HeadImgURL}); err != nil {
+		zap.L().Sugar().Error("Error! Upsert user: ", err)
+		response.Fail(c, err)
+		return
+	}
+
+	response.OK(c, nil)
 }
 
-// get all phrases
+// get all phrases, filtered and sorted as parsePhraseQuery describes. Pages continue from ?cursor=, the next_cursor
+// of the previous page, or skip ?offset= phrases when no cursor is given
 func (s *Service) GetAllPhrasesHandler(c *gin.Context) {
-	reqToken := c.Request.Header.Get("token")
-
-	if reqToken != token {
-		c.JSON(http.StatusOK, gin.H{
-			"c": -1,
-			"d": "",
-			"m": "invalid token",
-		})
-
+	if !s.checkToken(c) {
 		return
 	}
 
@@ -266,86 +250,64 @@ func (s *Service) GetAllPhrasesHandler(c *gin.Context) {
 
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", defaultLimit))
 	offset, _ := strconv.Atoi(c.DefaultQuery("offset", defaultOffset))
-	status := c.DefaultQuery("status", defaultStatus)
-
-	var statusMap [3]interface{}
-	str := strings.Split(status, ",")
 
-	for i := 0; i < 3; i++ {
-		if i < len(str) {
-			statusMap[i] = str[i]
-		} else {
-			statusMap[i] = 0
-		}
+	filters, err := parsePhraseQuery(c, defaultStatus)
+	if err != nil {
+		response.Fail(c, response.ErrBadRequest.WithDetail("%v", err))
+		return
+	}
+	if filters.After != nil {
+		offset = 0
 	}
 
-	var phraseList []model.PhraseModel
-	var distributions []distributionModel
 	var allPhrasesWithDistributions []phraseWithDistributionModel
 
 	var allPhrasesResp allPhraseResponse
 
-	var phraseTotalCount int
-
 	start := time.Now()
 
 	// get total counts of phrases
-	if err := s.db.Table("phrase_models").
-		Select("count(*)").
-		Where("status = @status1 OR status = @status2 OR status = @status3", sql.Named("status1", statusMap[0]), sql.Named("status2", statusMap[1]), sql.Named("status3", statusMap[2])).
-		Find(&phraseTotalCount).Error; err != nil {
+	phraseTotalCount, err := s.eventStore(c).Phrases.Count(filters)
+	if err != nil {
 		zap.L().Sugar().Error("Error! Get total counts of phrases: ", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"c": 1,
-			"d": "",
-			"m": err.Error(),
-		})
-		return
-	}
-	// get phrases with limit and offset
-	if err := s.db.Table("phrase_models").
-		Where("status = @status1 OR status = @status2 OR status = @status3", sql.Named("status1", statusMap[0]), sql.Named("status2", statusMap[1]), sql.Named("status3", statusMap[2])).
-		Order("create_time desc").
-		Limit(limit).
-		Offset(offset).
-		Find(&phraseList).Error; err != nil {
+		response.Fail(c, err)
+		return
+	}
+	// get phrases after the cursor or with limit and offset
+	phraseList, err := s.eventStore(c).Phrases.List(filters, limit, offset)
+	if err != nil {
 		zap.L().Sugar().Error("Error! Get phrases with limit and offset: ", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"c": 1,
-			"d": "",
-			"m": err.Error(),
-		})
+		response.Fail(c, err)
 		return
 	}
 
-	allPhrasesResp.Pagi.Total = phraseTotalCount
+	allPhrasesResp.Pagi.Total = int(phraseTotalCount)
 	allPhrasesResp.Pagi.Offset = offset
+	// a full page may be followed by more phrases
+	if limit > 0 && len(phraseList) == limit {
+		allPhrasesResp.NextCursor = nextPhraseCursor(filters, phraseList)
+	}
+
+	phraseIDs := make([]int, 0, len(phraseList))
+	for _, phrase := range phraseList {
+		phraseIDs = append(phraseIDs, phrase.PhraseID)
+	}
+
+	distributions, err := s.eventStore(c).Clicks.Distributions(phraseIDs)
+	if err != nil {
+		zap.L().Sugar().Error("Error! Get distributions of phrases: ", err)
+		response.Fail(c, err)
+		return
+	}
 
 	for _, phrase := range phraseList {
 		var phraseWithDistribution phraseWithDistributionModel
 
-		// get all phrases from phrase_models
-		if err := s.db.Table("phrase_click_models").
-			Select("group_id, SUM(clicks) as clicks").
-			Where("phrase_id = @phrase_id", sql.Named("phrase_id", phrase.PhraseID)).
-			Group("group_id").
-			Find(&distributions).Error; err != nil {
-			zap.L().Sugar().Error("Error! Get all phrases from phrase_models: ", err)
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"c": 1,
-				"d": "",
-				"m": err.Error(),
-			})
-			return
+		phraseWithDistribution.PhraseModel = phrase.PhraseModel
+		phraseWithDistribution.Distributions = phraseDistribution(distributions[phrase.PhraseID], requestEvent(c).Settings.Groups())
+		for _, dist := range distributions[phrase.PhraseID] {
+			phraseWithDistribution.Clicks += dist.Clicks
 		}
-		phraseWithDistribution.PhraseID = phrase.PhraseID
-		phraseWithDistribution.Text = phrase.Text
-		phraseWithDistribution.GroupID = phrase.GroupID
-		phraseWithDistribution.OpenID = phrase.OpenID
-		phraseWithDistribution.Status = phrase.Status
-		phraseWithDistribution.CreateTime = phrase.CreateTime
-		phraseWithDistribution.UpdateTime = phrase.UpdateTime
-		phraseWithDistribution.Distributions = phraseDistribution(distributions)
 
 		allPhrasesWithDistributions = append(allPhrasesWithDistributions, phraseWithDistribution)
 	}
@@ -354,11 +316,7 @@ func (s *Service) GetAllPhrasesHandler(c *gin.Context) {
 
 	allPhrasesResp.List = allPhrasesWithDistributions
 
-	c.JSON(http.StatusOK, gin.H{
-		"c": 0,
-		"d": allPhrasesResp,
-		"m": "",
-	})
+	response.OK(c, allPhrasesResp)
 }
 
 // get top-N phrases
@@ -366,196 +324,130 @@ func (s *Service) GetTopNPhrasesHandler(c *gin.Context) {
 	defaultLimit := "5"
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", defaultLimit))
 
-	type topPhraseID struct {
-		PhraseID int `json:"phrase_id"`
-		Clicks   int `json:"clicks"`
-	}
-
-	type textModel struct {
-		Text string `json:"text"`
-	}
-
-	var topPhraseIDs []topPhraseID
 	var topNPhrasesWithDistributions []topNPhrasesWithDistribution
 
 	start := time.Now()
 
-	// get top N phrases, which are reviewed
-	if err := s.db.Raw("SELECT sum(clicks) as clicks, a.phrase_id FROM phrase_models as a INNER JOIN phrase_click_models as b ON a.phrase_id = b.phrase_id and a.status = 2 group by a.phrase_id order by clicks desc limit @limit", sql.Named("limit", limit)).
-		Find(&topPhraseIDs).Error; err != nil {
+	// get top N phrases with their text, which are reviewed
+	topPhrases, err := s.eventStore(c).Stats.TopPhrases(limit)
+	if err != nil {
 		zap.L().Sugar().Error("Error! Get top N phrases, which are reviewed: ", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"c": 1,
-			"d": "",
-			"m": err.Error(),
-		})
+		response.Fail(c, err)
 		return
 	}
 
-	for _, phrase := range topPhraseIDs {
-		var distributions []distributionModel
-		var topPhraseText textModel
-		var phraseWithDistribution topNPhrasesWithDistribution
+	phraseIDs := make([]int, 0, len(topPhrases))
+	for _, phrase := range topPhrases {
+		phraseIDs = append(phraseIDs, phrase.PhraseID)
+	}
 
-		// get top N phrases from phrase_models
-		if err := s.db.Table("phrase_click_models").
-			Select("group_id, SUM(clicks) as clicks").
-			Where("phrase_id = ?", phrase.PhraseID).
-			Group("group_id").
-			Find(&distributions).Error; err != nil {
-			zap.L().Sugar().Error("Error! Get top N phrases from phrase_models: ", err)
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"c": 1,
-				"d": "",
-				"m": err.Error(),
-			})
-			return
-		}
+	distributions, err := s.eventStore(c).Clicks.Distributions(phraseIDs)
+	if err != nil {
+		zap.L().Sugar().Error("Error! Get distributions of top N phrases: ", err)
+		response.Fail(c, err)
+		return
+	}
 
-		// get text of top N phrases from phrase_models
-		if err := s.db.Table("phrase_models").
-			Select("text").
-			Where("phrase_id = ?", phrase.PhraseID).
-			Find(&topPhraseText).Error; err != nil {
-			zap.L().Sugar().Error("Error! Get text of top N phrases from phrase_models: ", err)
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"c": 1,
-				"d": "",
-				"m": err.Error(),
-			})
-			return
-		}
+	for _, phrase := range topPhrases {
+		var phraseWithDistribution topNPhrasesWithDistribution
 
 		phraseWithDistribution.PhraseID = phrase.PhraseID
-		phraseWithDistribution.Text = topPhraseText.Text
-		phraseWithDistribution.Distributions = phraseDistribution(distributions)
+		phraseWithDistribution.Text = phrase.Text
+		phraseWithDistribution.Distributions = phraseDistribution(distributions[phrase.PhraseID], requestEvent(c).Settings.Groups())
 
 		topNPhrasesWithDistributions = append(topNPhrasesWithDistributions, phraseWithDistribution)
 	}
 
 	zap.L().Sugar().Infof("get top phrase cost: %v", time.Since(start))
 
-	c.JSON(http.StatusOK, gin.H{
-		"c": 0,
-		"d": topNPhrasesWithDistributions,
-		"m": "",
-	})
+	response.OK(c, topNPhrasesWithDistributions)
 }
 
-// delete phrase by change status to 3
+// delete phrase by changing its status to deleted
 func (s *Service) DeletePhraseHandler(c *gin.Context) {
-	reqToken := c.Request.Header.Get("token")
-
-	if reqToken != token {
-		c.JSON(http.StatusOK, gin.H{
-			"c": -1,
-			"d": "",
-			"m": "invalid token",
-		})
-
+	if !s.checkToken(c) {
 		return
 	}
 
 	type phraseIDRequest struct {
-		PhraseID int `form:"id" json:"id" binding:"required"`
+		PhraseID int    `form:"id" json:"id" binding:"required"`
+		Reason   string `form:"reason" json:"reason"`
 	}
 
 	var req phraseIDRequest
 	// var deletePhrase model.PhraseModel
 
 	if err := c.ShouldBind(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"c": 2,
-			"d": "",
-			"m": "phrase_id is required!",
-		})
+		response.Fail(c, response.ErrBadRequest.WithDetail("phrase_id is required"))
 		return
 	}
 
 	start := time.Now()
 
-	deletePhraseRes := s.db.Table("phrase_models").
-		Where("phrase_id = ?", req.PhraseID).
-		Updates(map[string]interface{}{"status": 3, "update_time": time.Now().Unix()})
+	row, found, err := s.eventStore(c).Phrases.Get(req.PhraseID)
+	if err != nil {
+		zap.L().Sugar().Error("Error! Get phrase to delete: ", err)
+		response.Fail(c, err)
+		return
+	}
 
-	if deletePhraseRes.Error != nil {
-		zap.L().Sugar().Error("Error! Delete phrase: ", deletePhraseRes.Error)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"c": 1,
-			"d": "",
-			"m": deletePhraseRes.Error.Error(),
-		})
+	if !found {
+		response.Fail(c, response.ErrNotFound)
 		return
 	}
 
-	if deletePhraseRes.RowsAffected == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"c": 11001,
-			"d": "",
-			"m": "Nonexistent",
-		})
+	if err := row.Status.Transition(model.StatusDeleted); err != nil {
+		response.Fail(c, response.ErrBadRequest.WithDetail("%v", err))
 		return
 	}
 
+	old := row
+	row.Status = model.StatusDeleted
+	row.UpdateTime = time.Now().Unix()
+
+	if err := s.eventStore(c).Phrases.Update(row, phraseAudit(c, AuditActionDelete, old, row, req.Reason)); err != nil {
+		zap.L().Sugar().Error("Error! Delete phrase: ", err)
+		response.Fail(c, err)
+		return
+	}
+
+	s.phraseStatusChanged(c.Request.Context(), row, old.Status)
+
 	zap.L().Sugar().Infof("delete phrase cost: %v", time.Since(start))
 
-	c.JSON(http.StatusOK, gin.H{
-		"c": 0,
-		"d": "",
-		"m": "",
-	})
+	response.OK(c, nil)
 }
 
 // update phrase text or status
 func (s *Service) PatchPhraseHandler(c *gin.Context) {
-	reqToken := c.Request.Header.Get("token")
-
-	if reqToken != token {
-		c.JSON(http.StatusOK, gin.H{
-			"c": -1,
-			"d": "",
-			"m": "invalid token",
-		})
-
+	if !s.checkToken(c) {
 		return
 	}
 
 	type patchPhraseReq struct {
-		PhraseID int    `form:"id" json:"id" binding:"required"`
-		Text     string `form:"text" json:"text"`
-		Status   int    `form:"status" json:"status"`
+		PhraseID int                `form:"id" json:"id" binding:"required"`
+		Text     string             `form:"text" json:"text"`
+		Status   model.PhraseStatus `form:"status" json:"status"`
+		Reason   string             `form:"reason" json:"reason"`
 	}
 
 	var req patchPhraseReq
-	var row model.PhraseModel
 
 	if err := c.ShouldBind(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"c": 2,
-			"d": "",
-			"m": "phrase_id is required!",
-		})
+		response.Fail(c, response.ErrBadRequest.WithDetail("phrase_id is required"))
 		return
 	}
 
 	// check whether the phrase exist or not
-	phraseRes := s.db.Table("phrase_models").Where("phrase_id = ?", req.PhraseID).Find(&row)
-	if phraseRes.Error != nil {
-		zap.L().Sugar().Error("Error! Get phrase to update its text or status", phraseRes.Error)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"c": 1,
-			"d": "",
-			"m": phraseRes.Error.Error(),
-		})
+	row, found, err := s.eventStore(c).Phrases.Get(req.PhraseID)
+	if err != nil {
+		zap.L().Sugar().Error("Error! Get phrase to update its text or status", err)
+		response.Fail(c, err)
 		return
 	}
 
-	if phraseRes.RowsAffected == 0 {
-		c.JSON(http.StatusOK, gin.H{
-			"c": 0,
-			"d": "",
-			"m": "This phrase does not exist",
-		})
+	if !found {
+		response.Fail(c, response.ErrPhraseNotFound)
 		return
 	}
 
@@ -567,265 +459,195 @@ func (s *Service) PatchPhraseHandler(c *gin.Context) {
 		updates["text"] = req.Text
 		updates["update_time"] = time.Now().Unix()
 	}
-	// update status of phrase
-	if req.Status > 0 && req.Status <= 3 {
+	// update status of phrase, along the allowed transitions
+	if req.Status != 0 && req.Status != row.Status {
+		if err := row.Status.Transition(req.Status); err != nil {
+			response.Fail(c, response.ErrBadRequest.WithDetail("%v", err))
+			return
+		}
 		updates["status"] = req.Status
 		updates["update_time"] = time.Now().Unix()
 	}
 
 	if len(updates) > 0 {
-		if err := s.db.Table("phrase_models").
-			Where("phrase_id = ?", req.PhraseID).
-			Updates(updates).Error; err != nil {
+		old := row
+		row.UpdateTime = updates["update_time"].(int64)
+		if text, ok := updates["text"]; ok {
+			row.Text = text.(string)
+		}
+		if status, ok := updates["status"]; ok {
+			row.Status = status.(model.PhraseStatus)
+		}
+
+		if err := s.eventStore(c).Phrases.Update(row, phraseAudit(c, AuditActionUpdate, old, row, req.Reason)); err != nil {
+			if errors.Is(err, store.ErrDuplicate) {
+				response.Fail(c, response.ErrDuplicate)
+				return
+			}
 			zap.L().Sugar().Error("Error! Update phrase text or status", err)
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"c": 1,
-				"d": "",
-				"m": err.Error(),
-			})
+			response.Fail(c, err)
 			return
 		}
+
+		if _, ok := updates["status"]; ok {
+			s.phraseStatusChanged(c.Request.Context(), row, old.Status)
+		}
+	}
+
+	response.OK(c, nil)
+}
+
+// transitionPhrases moves the phrases of ids from fromStatus to toStatus with an audit record per phrase,
+// phrases in another status are skipped. It returns the changed phrases holding their new status.
+func (s *Service) transitionPhrases(c *gin.Context, ids []int, fromStatus, toStatus model.PhraseStatus, action, reasonCode, reason string) ([]model.PhraseModel, error) {
+	if err := fromStatus.Transition(toStatus); err != nil {
+		return nil, err
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"c": 0,
-		"d": "",
-		"m": "",
+	phrases, err := s.eventStore(c).Phrases.Transition(ids, fromStatus, toStatus, time.Now().Unix(), func(old, new model.PhraseModel) model.PhraseAuditModel {
+		audit := phraseAudit(c, action, old, new, reason)
+		audit.ReasonCode = reasonCode
+		return audit
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, phrase := range phrases {
+		s.phraseStatusChanged(c.Request.Context(), phrase, fromStatus)
+	}
+	return phrases, nil
+}
+
+// status of the phrases batch review selects, by the status they are changed to
+var batchReviewFrom = map[model.PhraseStatus]model.PhraseStatus{
+	model.StatusApproved: model.StatusPending,
+	model.StatusRejected: model.StatusPending,
+	model.StatusDeleted:  model.StatusApproved,
+	model.StatusHidden:   model.StatusApproved,
 }
 
 // batch update reviewed phrase
 func (s *Service) PatchBatchPhraseHandler(c *gin.Context) {
-	reqToken := c.Request.Header.Get("token")
-
-	if reqToken != token {
-		c.JSON(http.StatusOK, gin.H{
-			"c": -1,
-			"d": "",
-			"m": "invalid token",
-		})
-
+	if !s.checkToken(c) {
 		return
 	}
 
 	type batchReviewPhraseReq struct {
-		PhraseID []int `form:"ids" json:"ids" binding:"required"`
-		Status   int   `form:"status" json:"status" binding:"required"`
+		PhraseID []int              `form:"ids" json:"ids" binding:"required"`
+		Status   model.PhraseStatus `form:"status" json:"status" binding:"required"`
+		Reason   string             `form:"reason" json:"reason"`
 	}
 
 	var req batchReviewPhraseReq
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"c": 2,
-			"d": "",
-			"m": "phrase_id and status are required!",
-		})
+		response.Fail(c, response.ErrBadRequest.WithDetail("phrase_id and status are required"))
 		return
 	}
 
-	// batch review phrase
-	selectPhrasesWithStatus := 1
-	updateStatusTo := 2
-
-	// batch delete pharse
-	if req.Status == 3 {
-		selectPhrasesWithStatus = 2
-		updateStatusTo = 3
+	// batch approve and reject pending phrases, batch hide and delete approved phrases
+	selectPhrasesWithStatus, ok := batchReviewFrom[req.Status]
+	if !ok {
+		response.Fail(c, response.ErrBadRequest.WithDetail("status must be approved, rejected, deleted or hidden"))
+		return
 	}
 
-	if req.Status == 2 || req.Status == 3 {
-		if err := s.db.Table("phrase_models").Where("status = ? AND phrase_id IN ?", selectPhrasesWithStatus, req.PhraseID).Updates(map[string]interface{}{"status": updateStatusTo, "update_time": time.Now().Unix()}).Error; err != nil {
-			zap.L().Sugar().Error("Error! Update phrase text or status", err)
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"c": 1,
-				"d": "",
-				"m": err.Error(),
-			})
-			return
-		}
+	if _, err := s.transitionPhrases(c, req.PhraseID, selectPhrasesWithStatus, req.Status, AuditActionBatchReview, "", req.Reason); err != nil {
+		zap.L().Sugar().Error("Error! Batch update phrase status", err)
+		response.Fail(c, err)
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"c": 0,
-		"d": "",
-		"m": "",
-	})
+	response.OK(c, nil)
 }
 
-// get phrase font-size and speed
-func (s *Service) GetH5SettingHandler(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"c": 0,
-		"d": s.config.AllSettings(),
-		"m": "",
-	})
-}
-
-func (s *Service) TestPhrasePostHandler(c *gin.Context) {
-
-	const letterBytes = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+var errPhraseChanged = errors.New("the phrase was changed meanwhile, try again")
 
-	str := make([]byte, 10)
-	for i := range str {
-		str[i] = letterBytes[rand.Intn(len(letterBytes))]
+// restore a rejected, deleted or hidden phrase to the status it had before
+func (s *Service) RestorePhraseHandler(c *gin.Context) {
+	if !s.checkToken(c) {
+		return
 	}
 
-	type phrase struct {
-		Text    string `json:"text"`
-		OpenID  string `json:"open_id"`
-		GroupID int    `json:"group_id"`
+	id, ok := idParam(c)
+	if !ok {
+		return
 	}
 
-	newPhrase := phrase{
-		Text:    string(str),
-		GroupID: rand.Intn(5) + 1,
-		OpenID:  fmt.Sprintf("%d", (rand.Intn(5)+1)*100),
+	type restorePhraseReq struct {
+		Reason string `form:"reason" json:"reason"`
 	}
 
-	// start := time.Now()
-
-	if err := s.db.Table("phrase_models").
-		Create(&model.PhraseModel{Text: newPhrase.Text, OpenID: newPhrase.OpenID, GroupID: newPhrase.GroupID, Status: rand.Intn(3) + 1, CreateTime: time.Now().Unix(), UpdateTime: time.Now().Unix()}).Error; err != nil {
-		mysqlErr := &mysql.MySQLError{}
-		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"c": 10001,
-				"d": "",
-				"m": "An existing item already exists",
-			})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"c": 1,
-				"d": "",
-				"m": err.Error(),
-			})
-		}
+	var req restorePhraseReq
+	if err := c.ShouldBind(&req); err != nil && err != io.EOF {
+		response.Fail(c, response.ErrBadRequest.WithDetail("invalid reason"))
 		return
 	}
 
-	// zap.L().Sugar().Infof("test add new phrase cost: %v", time.Since(start))
-
-	c.JSON(http.StatusOK, gin.H{
-		"c": 0,
-		"d": "",
-		"m": "",
-	})
-}
-
-func (s *Service) TestPhraseHotPostHandler(c *gin.Context) {
-	type phraseClick struct {
-		PhraseID int    `json:"phrase_id"`
-		Clicks   int    `json:"clicks"`
-		OpenID   string `json:"open_id"`
-		GroupID  int    `json:"group_id"`
+	row, found, err := s.eventStore(c).Phrases.Get(id)
+	if err != nil {
+		zap.L().Sugar().Error("Error! Get phrase to restore: ", err)
+		response.Fail(c, err)
+		return
 	}
 
-	newPhraseClick := phraseClick{
-		PhraseID: rand.Intn(10000000) + 1,
-		GroupID:  rand.Intn(5) + 1,
-		OpenID:   fmt.Sprintf("%d", (rand.Intn(5)+1)*100),
-		Clicks:   rand.Intn(5) + 1,
+	if !found {
+		response.Fail(c, response.ErrNotFound)
+		return
 	}
 
-	var phraseRecord model.PhraseModel
-	phrase_id := newPhraseClick.PhraseID
-	clicks := newPhraseClick.Clicks
-	open_id := newPhraseClick.OpenID
-	group_id := newPhraseClick.GroupID
-
-	// start := time.Now()
-
-	// check validation of phrase in phrase_models
-	phraseRecordRe := s.db.Table("phrase_models").Where("phrase_id = ? AND status = ?", phrase_id, 2).Find(&phraseRecord)
-
-	if phraseRecordRe.Error != nil {
-		zap.L().Sugar().Error("Error! Check validation of phrase in phrase_models:", phraseRecordRe.Error)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"c": 1,
-			"d": "",
-			"m": phraseRecordRe.Error.Error(),
-		})
+	// the status before the last change into the current status
+	last, err := s.eventStore(c).Phrases.LastChange(id, row.Status)
+	if err != nil {
+		zap.L().Sugar().Error("Error! Get status of phrase before its last change: ", err)
+		response.Fail(c, err)
 		return
 	}
 
-	// if find the reviewed phrase exist in phrase_models, then insert the click stats
-	if phraseRecordRe.RowsAffected > 0 {
-		if err := s.db.Create(&model.PhraseClickModel{PhraseID: phrase_id, Clicks: clicks, OpenID: open_id, GroupID: group_id, ClickTime: time.Now().Unix()}).Error; err != nil {
-			zap.L().Sugar().Error("Error! Failed to update phrase click model: ", err)
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"c": 1,
-				"d": "",
-				"m": err.Error(),
-			})
-			return
-		}
+	toStatus, err := row.Status.Restore(last.OldStatus)
+	if err != nil {
+		response.Fail(c, response.ErrBadRequest.WithDetail("%v", err))
+		return
 	}
 
-	// zap.L().Sugar().Infof("Test update phrase click cost: %v", time.Since(start))
-
-	c.JSON(http.StatusOK, gin.H{
-		"c": 0,
-		"d": "",
-		"m": "",
+	restored, err := s.eventStore(c).Phrases.Transition([]int{id}, row.Status, toStatus, time.Now().Unix(), func(old, new model.PhraseModel) model.PhraseAuditModel {
+		return phraseAudit(c, AuditActionRestore, old, new, req.Reason)
 	})
-}
-
-func (s *Service) TestUserPostHandler(c *gin.Context) {
-	const letterBytes = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
-
-	str := make([]byte, 10)
-	for i := range str {
-		str[i] = letterBytes[rand.Intn(len(letterBytes))]
+	if err != nil {
+		zap.L().Sugar().Error("Error! Restore phrase: ", err)
+		response.Fail(c, err)
+		return
 	}
 
-	req := model.UserModel{
-		OpenID:     string(str),
-		NickName:   string(str),
-		Sex:        rand.Intn(2) + 1,
-		Province:   "广州",
-		City:       string(str),
-		HeadImgURL: string(str),
+	if len(restored) == 0 {
+		response.Fail(c, response.ErrBadRequest.WithDetail("%v", errPhraseChanged))
+		return
 	}
 
-	if err := s.db.Table("user_models").
-		Create(&model.UserModel{OpenID: req.OpenID, NickName: req.NickName, Sex: req.Sex, Province: req.Province, City: req.City, HeadImgURL: req.HeadImgURL}).Error; err != nil {
-		mysqlErr := &mysql.MySQLError{}
-		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
-			c.JSON(http.StatusOK, gin.H{
-				"c": 0,
-				"d": "",
-				"m": "",
-			})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"c": 1,
-				"d": "",
-				"m": err.Error(),
-			})
-		}
+	s.phraseStatusChanged(c.Request.Context(), restored[0], row.Status)
+	row = restored[0]
+
+	response.OK(c, row)
+}
+
+// get phrase font-size and speed of the display profile given by ?profile=
+func (s *Service) GetH5SettingHandler(c *gin.Context) {
+	profile, err := s.eventsProvider.Profile(requestEvent(c), c.Query("profile"))
+	if err != nil {
+		response.Fail(c, response.ErrUnknownProfile)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"c": 0,
-		"d": "",
-		"m": "",
-	})
+	response.OK(c, profile)
 }
 
 func (s *Service) GetOverviewHandler(c *gin.Context) {
 	// sex stats
-	type sexModel struct {
-		Sex   int `json:"sex"`
-		Count int `json:"count"`
-	}
-	var sexRecords []sexModel
-	if err := s.db.Table("user_models").
-		Select("sex, count(*) as count").
-		Group("sex").
-		Find(&sexRecords).Error; err != nil {
+	sexRecords, err := s.eventStore(c).Stats.SexCounts()
+	if err != nil {
 		zap.L().Sugar().Error("Error! Get user distrbution failed: ", err)
+		response.Fail(c, err)
 		return
 	}
 	type sexResponseModel struct {
@@ -849,21 +671,12 @@ func (s *Service) GetOverviewHandler(c *gin.Context) {
 	}
 
 	// location stats
-	type locationModel struct {
-		Province string `json:"province"`
-		Count    int    `json:"count"`
-	}
-	var locationsRecords []locationModel
-
 	start := time.Now()
 
-	if err := s.db.Table("user_models").
-		Select("province, count(*) as count").
-		Group("province").
-		Order("count desc, province desc").
-		Limit(5).
-		Find(&locationsRecords).Error; err != nil {
+	locationsRecords, err := s.eventStore(c).Stats.TopProvinces(5)
+	if err != nil {
 		zap.L().Sugar().Error("Error! Get user distrbution failed: ", err)
+		response.Fail(c, err)
 		return
 	}
 
@@ -873,7 +686,7 @@ func (s *Service) GetOverviewHandler(c *gin.Context) {
 	}
 
 	if top5LocationsCount > 0 {
-		otherLocations := locationModel{
+		otherLocations := store.ProvinceCount{
 			Province: "其他",
 			Count:    totalUser - top5LocationsCount,
 		}
@@ -882,31 +695,24 @@ func (s *Service) GetOverviewHandler(c *gin.Context) {
 	}
 
 	type responseModel struct {
-		TotalUser        int              `json:"total_users"`
-		TotalValidPhrase int              `json:"total_valid_phrases"`
-		TotalClicks      int              `json:"total_clicks"`
-		Sex              sexResponseModel `json:"sex"`
-		Localtions       []locationModel  `json:"locations"`
-	}
-
-	var totalValidPhrase int
-	if err := s.db.Table("phrase_models").
-		Select("count(*)").
-		Where("status = ?", 2).
-		Find(&totalValidPhrase).Error; err != nil {
-		zap.L().Sugar().Error("Error! Get total valid phrase failed: ", err)
-		return
+		TotalUser        int                   `json:"total_users"`
+		TotalValidPhrase int                   `json:"total_valid_phrases"`
+		TotalClicks      int                   `json:"total_clicks"`
+		Sex              sexResponseModel      `json:"sex"`
+		Localtions       []store.ProvinceCount `json:"locations"`
 	}
 
-	type sumClickModel struct {
-		Clicks int `json:"clicks"`
+	totalValidPhrase, err := s.eventStore(c).Phrases.CountByStatus(model.StatusApproved)
+	if err != nil {
+		zap.L().Sugar().Error("Error! Get total valid phrase failed: ", err)
+		response.Fail(c, err)
+		return
 	}
 
-	var totalClicks []sumClickModel
-	if err := s.db.Table("phrase_click_models").
-		Select("sum(clicks) as clicks").
-		Scan(&totalClicks).Error; err != nil {
+	totalClicks, err := s.eventStore(c).Stats.TotalClicks()
+	if err != nil {
 		zap.L().Sugar().Error("Error! Get total clicks failed: ", err)
+		response.Fail(c, err)
 		return
 	}
 
@@ -915,30 +721,24 @@ func (s *Service) GetOverviewHandler(c *gin.Context) {
 
 	resp.TotalUser = totalUser
 
-	resp.TotalClicks = totalClicks[0].Clicks
+	resp.TotalClicks = totalClicks
 	resp.TotalValidPhrase = totalValidPhrase
 	resp.Sex = sexRes
 	resp.Localtions = locationsRecords
 
-	c.JSON(http.StatusOK, gin.H{
-		"c": 0,
-		"d": resp,
-		"m": "",
-	})
+	response.OK(c, resp)
 }
 
 func (s *Service) GetClickTrendsHandler(c *gin.Context) {
-	type clickTrendsModel struct {
-		Time   int64 `json:"time"`
-		Clicks int   `json:"clicks"`
-	}
-
-	var clickTrendsRecords, clickTrendsResp []clickTrendsModel
+	var clickTrendsResp []store.TrendPoint
 
 	start := time.Now()
 
-	if err := s.db.Raw("select time, agg_clicks as clicks from (SELECT *, sum(clicks) over (partition by gid order by time) as agg_clicks from  (SELECT 1 as gid, ceiling(click_time/600)*600 as time, sum(clicks) as clicks FROM phrase_click_models GROUP BY  ceiling(click_time/600)) as t ) as tt WHERE tt.time > UNIX_TIMESTAMP(NOW() - INTERVAL 3 HOUR);").Scan(&clickTrendsRecords).Error; err != nil {
+	// clicks up to the end of each 10 minutes of the last 3 hours
+	clickTrendsRecords, err := s.eventStore(c).Stats.ClickTrends(time.Now().Add(-3*time.Hour).Unix(), 600)
+	if err != nil {
 		zap.L().Sugar().Error("Error! Get click trends failed: ", err)
+		response.Fail(c, err)
 		return
 	}
 
@@ -951,15 +751,19 @@ func (s *Service) GetClickTrendsHandler(c *gin.Context) {
 	}
 
 	for i, t := range timeArr {
-		trend := clickTrendsModel{
+		trend := store.TrendPoint{
 			Time:   t,
 			Clicks: 0,
 		}
 		if i != 0 {
 			trend.Clicks = clickTrendsResp[i-1].Clicks
 		} else {
-			var total int
-			s.db.Raw(fmt.Sprintf("select sum(clicks) from phrase_click_models where click_time < %d", t)).First(&total)
+			total, err := s.eventStore(c).Stats.ClicksBefore(t)
+			if err != nil {
+				zap.L().Sugar().Error("Error! Get clicks before click trends failed: ", err)
+				response.Fail(c, err)
+				return
+			}
 			trend.Clicks = total
 		}
 
@@ -975,9 +779,5 @@ func (s *Service) GetClickTrendsHandler(c *gin.Context) {
 
 	zap.L().Sugar().Infof("get click trends cost: %v", time.Since(start))
 
-	c.JSON(http.StatusOK, gin.H{
-		"c": 0,
-		"d": clickTrendsResp,
-		"m": "",
-	})
+	response.OK(c, clickTrendsResp)
 }
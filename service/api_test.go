@@ -0,0 +1,165 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/YiniXu9506/devconG/model"
+	"github.com/YiniXu9506/devconG/response"
+	"github.com/gin-gonic/gin"
+)
+
+type testPhrases struct {
+	Pagi PagiInfo `json:"pagi"`
+	List []struct {
+		PhraseID int    `json:"phrase_id"`
+		Text     string `json:"text"`
+		OpenID   string `json:"open_id"`
+	} `json:"list"`
+}
+
+func TestAddPhrase(t *testing.T) {
+	ts := newTestServer(t)
+	session := ts.login("", "author")
+
+	resp := ts.do(http.MethodPost, "/phrase", gin.H{"text": "hello", "group_id": 1}, session)
+	if resp.C != response.CodeOK {
+		t.Fatalf("add phrase: got code %d %q", resp.C, resp.M)
+	}
+
+	var phrases testPhrases
+	ts.admin(http.MethodGet, "/phrases_full", nil).decode(t, &phrases)
+	if phrases.Pagi.Total != 1 || len(phrases.List) != 1 {
+		t.Fatalf("got %d phrases, want 1", phrases.Pagi.Total)
+	}
+	if phrase := phrases.List[0]; phrase.Text != "hello" || phrase.OpenID != "fake-author" {
+		t.Fatalf("got phrase %q of %q, want hello of fake-author", phrase.Text, phrase.OpenID)
+	}
+
+	resp = ts.do(http.MethodPost, "/phrase", gin.H{"text": "hello", "group_id": 1}, session)
+	if resp.Status != http.StatusConflict || resp.C != response.CodeDuplicate {
+		t.Fatalf("add duplicate: got %d with code %d, want 409", resp.Status, resp.C)
+	}
+}
+
+func TestAddPhraseNeedsSession(t *testing.T) {
+	ts := newTestServer(t)
+
+	resp := ts.do(http.MethodPost, "/phrase", gin.H{"text": "hello", "group_id": 1}, nil)
+	if resp.Status != http.StatusUnauthorized {
+		t.Fatalf("got %d, want 401", resp.Status)
+	}
+}
+
+func TestPhrasesScopedToEvent(t *testing.T) {
+	ts := newTestServer(t)
+
+	if resp := ts.admin(http.MethodPost, "/admin/events", gin.H{"slug": "meetup"}); resp.C != response.CodeOK {
+		t.Fatalf("create event: got code %d %q", resp.C, resp.M)
+	}
+	if resp := ts.admin(http.MethodPost, "/admin/events", gin.H{"slug": "meetup"}); resp.C != response.CodeDuplicate {
+		t.Fatalf("create event twice: got code %d, want %d", resp.C, response.CodeDuplicate)
+	}
+
+	session := ts.login("/events/meetup", "author")
+	if resp := ts.do(http.MethodPost, "/events/meetup/phrase", gin.H{"text": "hello", "group_id": 1}, session); resp.C != response.CodeOK {
+		t.Fatalf("add phrase: got code %d %q", resp.C, resp.M)
+	}
+
+	var phrases testPhrases
+	ts.admin(http.MethodGet, "/events/meetup/phrases_full", nil).decode(t, &phrases)
+	if phrases.Pagi.Total != 1 {
+		t.Fatalf("got %d phrases in the event, want 1", phrases.Pagi.Total)
+	}
+	ts.admin(http.MethodGet, "/phrases_full", nil).decode(t, &phrases)
+	if phrases.Pagi.Total != 0 {
+		t.Fatalf("got %d phrases in the default event, want 0", phrases.Pagi.Total)
+	}
+
+	if resp := ts.admin(http.MethodGet, "/events/unknown/phrases_full", nil); resp.M != response.ErrUnknownEvent.Error() {
+		t.Fatalf("got %q, want %q", resp.M, response.ErrUnknownEvent.Error())
+	}
+}
+
+func TestPhrasesCursor(t *testing.T) {
+	ts := newTestServer(t)
+	ids := ts.addPendingPhrases("first", "second", "third", "fourth", "fifth")
+
+	var page struct {
+		testPhrases
+		NextCursor string `json:"next_cursor"`
+	}
+	var got []int
+	path := "/phrases_full?status=1&limit=2"
+	for i := 0; i < 5; i++ {
+		ts.admin(http.MethodGet, path, nil).decode(t, &page)
+		for _, phrase := range page.List {
+			got = append(got, phrase.PhraseID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		path = "/phrases_full?status=1&limit=2&cursor=" + page.NextCursor
+	}
+	// the pages hold the phrases of the unpaged list in its order, newest first
+	if fmt.Sprint(got) != fmt.Sprint(ids) {
+		t.Fatalf("got pages %v, want %v", got, ids)
+	}
+
+	ts.admin(http.MethodGet, "/phrases_full?status=1&limit=2", nil).decode(t, &page)
+	for _, query := range []string{"cursor=" + page.NextCursor + "&order=asc", "cursor=" + page.NextCursor + "&sort=clicks", "cursor=garbage"} {
+		if resp := ts.admin(http.MethodGet, "/phrases_full?status=1&"+query, nil); resp.Status != http.StatusBadRequest {
+			t.Fatalf("got %d for %s, want 400", resp.Status, query)
+		}
+	}
+}
+
+func TestPhraseStatusAndRestore(t *testing.T) {
+	ts := newTestServer(t)
+	ids := ts.addPendingPhrases("first", "second")
+
+	setStatus := func(id int, status model.PhraseStatus) testResponse {
+		return ts.admin(http.MethodPatch, "/phrase", gin.H{"id": id, "status": status.String()})
+	}
+	restore := func(id int, want model.PhraseStatus) {
+		t.Helper()
+
+		var phrase model.PhraseModel
+		ts.admin(http.MethodPost, fmt.Sprintf("/phrase/%d/restore", id), gin.H{"reason": "by mistake"}).decode(t, &phrase)
+		if phrase.Status != want {
+			t.Fatalf("restored phrase %d to %v, want %v", id, phrase.Status, want)
+		}
+	}
+
+	if resp := setStatus(ids[0], model.StatusHidden); resp.Status != http.StatusBadRequest {
+		t.Fatalf("hid a pending phrase: got %d, want 400", resp.Status)
+	}
+	for _, status := range []model.PhraseStatus{model.StatusApproved, model.StatusDeleted} {
+		if resp := setStatus(ids[0], status); resp.C != response.CodeOK {
+			t.Fatalf("set %v: got code %d %q", status, resp.C, resp.M)
+		}
+	}
+	// back to the status before the deletion
+	restore(ids[0], model.StatusApproved)
+	if resp := setStatus(ids[0], model.StatusHidden); resp.C != response.CodeOK {
+		t.Fatalf("hide: got code %d %q", resp.C, resp.M)
+	}
+	restore(ids[0], model.StatusApproved)
+	if resp := ts.admin(http.MethodPost, fmt.Sprintf("/phrase/%d/restore", ids[0]), nil); resp.Status != http.StatusBadRequest {
+		t.Fatalf("restored an approved phrase: got %d, want 400", resp.Status)
+	}
+
+	if resp := setStatus(ids[1], model.StatusRejected); resp.C != response.CodeOK {
+		t.Fatalf("reject: got code %d %q", resp.C, resp.M)
+	}
+	restore(ids[1], model.StatusPending)
+
+	var history struct {
+		History []model.PhraseAuditModel `json:"history"`
+	}
+	ts.admin(http.MethodGet, fmt.Sprintf("/phrase/%d/history", ids[1]), nil).decode(t, &history)
+	if records := history.History; len(records) != 2 || records[1].Action != AuditActionRestore || records[1].Reason != "by mistake" {
+		t.Fatalf("got history %+v, want the rejection and the restore", records)
+	}
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/YiniXu9506/devconG/model"
+	"github.com/YiniXu9506/devconG/response"
+	"github.com/YiniXu9506/devconG/store"
+	"github.com/YiniXu9506/devconG/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// actions of the phrase audit log
+const (
+	AuditActionDelete      = "delete"
+	AuditActionUpdate      = "update"
+	AuditActionBatchReview = "batch_review"
+	AuditActionApprove     = "approve"
+	AuditActionReject      = "reject"
+	AuditActionRestore     = "restore"
+)
+
+// the management portal names the admin making a change in the `actor` header, lengths are in characters
+const (
+	actorHeader  = "actor"
+	defaultActor = "admin"
+	maxActorLen  = 64
+	maxReasonLen = 255
+)
+
+// auditActor is the admin named by the request. The name isn't authenticated: holders of the admin token
+// are trusted to name themselves, any of them can act as another reviewer on claims, audit records and stats.
+func auditActor(c *gin.Context) string {
+	actor := c.Request.Header.Get(actorHeader)
+	if actor == "" {
+		return defaultActor
+	}
+	return utils.TruncateText(actor, maxActorLen)
+}
+
+// phraseAudit records the change of a phrase from old to new
+func phraseAudit(c *gin.Context, action string, old, new model.PhraseModel, reason string) model.PhraseAuditModel {
+	reason = utils.TruncateText(reason, maxReasonLen)
+	return model.PhraseAuditModel{
+		PhraseID:   old.PhraseID,
+		Actor:      auditActor(c),
+		Action:     action,
+		OldText:    old.Text,
+		NewText:    new.Text,
+		OldStatus:  old.Status,
+		NewStatus:  new.Status,
+		Reason:     reason,
+		CreateTime: new.UpdateTime,
+	}
+}
+
+// get a phrase with its changes, oldest first
+func (s *Service) GetPhraseHistoryHandler(c *gin.Context) {
+	if !s.checkToken(c) {
+		return
+	}
+
+	id, ok := idParam(c)
+	if !ok {
+		return
+	}
+
+	type phraseHistoryResponse struct {
+		Phrase  model.PhraseModel        `json:"phrase"`
+		History []model.PhraseAuditModel `json:"history"`
+	}
+
+	var resp phraseHistoryResponse
+	var found bool
+	var err error
+	resp.Phrase, found, err = s.eventStore(c).Phrases.Get(id)
+	if err != nil {
+		zap.L().Sugar().Error("Error! Get phrase for history: ", err)
+		response.Fail(c, err)
+		return
+	}
+
+	if !found {
+		response.Fail(c, response.ErrNotFound)
+		return
+	}
+
+	if resp.History, err = s.eventStore(c).Phrases.History(id); err != nil {
+		zap.L().Sugar().Error("Error! Get history of phrase: ", err)
+		response.Fail(c, err)
+		return
+	}
+
+	response.OK(c, resp)
+}
+
+// list changes of the phrases of the event newest first, filtered by ?actor=, ?action=, ?phrase_id=, ?status= (the new status)
+// and the unix time range ?since= and ?until=
+func (s *Service) GetAuditLogHandler(c *gin.Context) {
+	if !s.checkToken(c) {
+		return
+	}
+
+	defaultLimit := "50"
+	defaultOffset := "0"
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", defaultLimit))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", defaultOffset))
+
+	filter := store.AuditFilter{Actor: c.Query("actor"), Action: c.Query("action")}
+	filter.PhraseID, _ = strconv.Atoi(c.Query("phrase_id"))
+	if status, err := model.ParsePhraseStatus(c.Query("status")); err == nil {
+		filter.NewStatus = status
+	}
+	filter.Since, _ = strconv.ParseInt(c.Query("since"), 10, 64)
+	filter.Until, _ = strconv.ParseInt(c.Query("until"), 10, 64)
+
+	type auditLogResponse struct {
+		Pagi PagiInfo                 `json:"pagi"`
+		List []model.PhraseAuditModel `json:"list"`
+	}
+
+	var resp auditLogResponse
+	var total int64
+	var err error
+
+	start := time.Now()
+
+	if resp.List, total, err = s.eventStore(c).Audits.List(filter, limit, offset); err != nil {
+		zap.L().Sugar().Error("Error! Get audit log: ", err)
+		response.Fail(c, err)
+		return
+	}
+
+	zap.L().Sugar().Infof("get audit log cost: %v", time.Since(start))
+
+	resp.Pagi.Total = int(total)
+	resp.Pagi.Offset = offset
+
+	response.OK(c, resp)
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/YiniXu9506/devconG/auth"
+	"github.com/YiniXu9506/devconG/response"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// gin context key of the open_id of the logged in user
+const openIDKey = "open_id"
+
+// exchange a mini program login code for a session token
+func (s *Service) LoginHandler(c *gin.Context) {
+	type loginRequest struct {
+		Code string `form:"code" json:"code" binding:"required"`
+	}
+
+	var req loginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Fail(c, response.ErrBadRequest.WithDetail("code is required"))
+		return
+	}
+
+	identity, err := s.identity().Code2Session(c.Request.Context(), req.Code)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidCode) {
+			response.Fail(c, response.ErrInvalidCode)
+			return
+		}
+		zap.L().Sugar().Error("Error! Exchange login code: ", err)
+		response.Fail(c, err)
+		return
+	}
+
+	authConfig := s.config.Get().Auth
+	token, session, err := auth.IssueToken(authConfig.SessionSecret, identity.OpenID, time.Duration(authConfig.SessionTTLSeconds)*time.Second)
+	if err != nil {
+		zap.L().Sugar().Error("Error! Issue session token: ", err)
+		response.Fail(c, err)
+		return
+	}
+
+	response.OK(c, gin.H{
+		"token":      token,
+		"open_id":    session.OpenID,
+		"expires_at": session.ExpiresAt,
+	})
+}
+
+// requireSession rejects requests without a valid `Authorization: Bearer <token>` header
+func (s *Service) requireSession(c *gin.Context) {
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+
+	session, err := auth.VerifyToken(s.config.Get().Auth.SessionSecret, token)
+	if err != nil {
+		response.Abort(c, response.ErrInvalidSession)
+		return
+	}
+
+	c.Set(openIDKey, session.OpenID)
+	c.Next()
+}
+
+// open_id of the logged in user, set by requireSession
+func sessionOpenID(c *gin.Context) string {
+	return c.GetString(openIDKey)
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/YiniXu9506/devconG/config"
+	"github.com/YiniXu9506/devconG/provider"
+	"github.com/YiniXu9506/devconG/response"
+	"github.com/YiniXu9506/devconG/store"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	// requests are scoped to an event by the path prefix, or by the header without the prefix
+	eventPathPrefix = "/events/:event"
+	eventHeader     = "X-Devcon-Event-Slug"
+
+	eventContextKey = "event"
+)
+
+// eventSlug is the slug the request names, empty for the default event
+func eventSlug(c *gin.Context) string {
+	if slug := c.Param("event"); slug != "" {
+		return slug
+	}
+	return c.GetHeader(eventHeader)
+}
+
+// routePath is the route of the request without the event prefix
+func routePath(c *gin.Context) string {
+	return strings.TrimPrefix(c.FullPath(), eventPathPrefix)
+}
+
+// resolveEvent scopes the request to the event of its path prefix or header, the default event without either
+func (s *Service) resolveEvent(c *gin.Context) {
+	event := s.eventsProvider.Default()
+	if slug := eventSlug(c); slug != "" {
+		var err error
+		event, err = s.eventsProvider.Resolve(slug)
+		if errors.Is(err, provider.ErrUnknownEvent) {
+			response.Abort(c, response.ErrUnknownEvent)
+			return
+		}
+		if err != nil {
+			zap.L().Sugar().Errorf("Error! Resolve event %v: %v", slug, err)
+			response.Abort(c, err)
+			return
+		}
+	}
+	c.Set(eventContextKey, event)
+	c.Next()
+}
+
+// requestEvent is the event the request is scoped to
+func requestEvent(c *gin.Context) provider.Event {
+	return c.MustGet(eventContextKey).(provider.Event)
+}
+
+// eventStore is the store of the event the request is scoped to
+func (s *Service) eventStore(c *gin.Context) store.Store {
+	return s.store.Event(requestEvent(c).ID)
+}
+
+type eventRequest struct {
+	Slug     string             `json:"slug"`
+	Name     string             `json:"name"`
+	Settings config.EventConfig `json:"settings"`
+}
+
+// list events
+func (s *Service) GetEventsHandler(c *gin.Context) {
+	if !s.checkToken(c) {
+		return
+	}
+
+	response.OK(c, s.eventsProvider.List())
+}
+
+// get an event with its settings
+func (s *Service) GetEventHandler(c *gin.Context) {
+	if !s.checkToken(c) {
+		return
+	}
+
+	event, err := s.eventsProvider.Resolve(c.Param("slug"))
+	if err != nil {
+		s.eventError(c, err)
+		return
+	}
+
+	response.OK(c, event)
+}
+
+// create an event, omitted settings inherit from the config file
+func (s *Service) AddEventHandler(c *gin.Context) {
+	if !s.checkToken(c) {
+		return
+	}
+
+	var req eventRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Fail(c, response.ErrBadRequest.WithDetail("invalid event: %v", err))
+		return
+	}
+
+	event, err := s.eventsProvider.Create(req.Slug, req.Name, req.Settings)
+	if err != nil {
+		s.eventError(c, err)
+		return
+	}
+
+	response.OK(c, event)
+}
+
+// replace the name and the settings of an event
+func (s *Service) PutEventHandler(c *gin.Context) {
+	if !s.checkToken(c) {
+		return
+	}
+
+	var req eventRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Fail(c, response.ErrBadRequest.WithDetail("invalid event: %v", err))
+		return
+	}
+
+	event, err := s.eventsProvider.Update(c.Param("slug"), req.Name, req.Settings)
+	if err != nil {
+		s.eventError(c, err)
+		return
+	}
+
+	response.OK(c, event)
+}
+
+// eventError responds with the error of creating, updating or resolving an event
+func (s *Service) eventError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, provider.ErrUnknownEvent):
+		response.Fail(c, response.ErrNotFound)
+	case errors.Is(err, provider.ErrEventExists):
+		response.Fail(c, response.ErrDuplicate)
+	case errors.Is(err, provider.ErrInvalidEvent):
+		response.Fail(c, response.ErrBadRequest.WithDetail("%v", err))
+	default:
+		zap.L().Sugar().Error("Error! Save event: ", err)
+		response.Fail(c, err)
+	}
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/YiniXu9506/devconG/model"
+	"github.com/YiniXu9506/devconG/response"
+	"github.com/gin-gonic/gin"
+)
+
+func TestEventByHeader(t *testing.T) {
+	ts := newTestServer(t)
+	if resp := ts.admin(http.MethodPost, "/admin/events", gin.H{"slug": "meetup", "settings": gin.H{"group_count": 2}}); resp.C != response.CodeOK {
+		t.Fatalf("create event: got code %d %q", resp.C, resp.M)
+	}
+
+	session := ts.login("/events/meetup", "author")
+	session[eventHeader] = "meetup"
+	if resp := ts.do(http.MethodPost, "/phrase", gin.H{"text": "hello", "group_id": 3}, session); resp.M != response.ErrUnknownGroup.Error() {
+		t.Fatalf("add phrase of group 3: got code %d %q, want the group_count of the event to apply", resp.C, resp.M)
+	}
+	if resp := ts.do(http.MethodPost, "/phrase", gin.H{"text": "hello", "group_id": 2}, session); resp.C != response.CodeOK {
+		t.Fatalf("add phrase: got code %d %q", resp.C, resp.M)
+	}
+
+	var phrases testPhrases
+	ts.admin(http.MethodGet, "/events/meetup/phrases_full", nil).decode(t, &phrases)
+	if phrases.Pagi.Total != 1 {
+		t.Fatalf("got %d phrases in the event, want the one added with the header", phrases.Pagi.Total)
+	}
+
+	if resp := ts.do(http.MethodGet, "/phrases", nil, map[string]string{eventHeader: "unknown"}); resp.M != response.ErrUnknownEvent.Error() {
+		t.Fatalf("got %q, want %q", resp.M, response.ErrUnknownEvent.Error())
+	}
+}
+
+func TestClicksScopedToEvent(t *testing.T) {
+	ts := newTestServer(t)
+	if resp := ts.admin(http.MethodPost, "/admin/events", gin.H{"slug": "meetup"}); resp.C != response.CodeOK {
+		t.Fatalf("create event: got code %d %q", resp.C, resp.M)
+	}
+	session := ts.login("/events/meetup", "author")
+	if resp := ts.do(http.MethodPost, "/events/meetup/phrase", gin.H{"text": "hello", "group_id": 1}, session); resp.C != response.CodeOK {
+		t.Fatalf("add phrase: got code %d %q", resp.C, resp.M)
+	}
+
+	var phrases struct {
+		List []phraseWithDistributionModel `json:"list"`
+	}
+	ts.admin(http.MethodGet, "/events/meetup/phrases_full?status=1", nil).decode(t, &phrases)
+	id := phrases.List[0].PhraseID
+	if resp := ts.admin(http.MethodPatch, "/events/meetup/phrase", gin.H{"id": id, "status": model.StatusApproved.String()}); resp.C != response.CodeOK {
+		t.Fatalf("approve: got code %d %q", resp.C, resp.M)
+	}
+
+	// the phrase isn't on the wall of the default event
+	clicks := []gin.H{{"phrase_id": id, "clicks": 3, "group_id": 1}}
+	ts.do(http.MethodPost, "/phrase_hot", clicks, ts.login("", "author"))
+	ts.do(http.MethodPost, "/events/meetup/phrase_hot", clicks, session)
+
+	ts.admin(http.MethodGet, "/events/meetup/phrases_full?sort=clicks", nil).decode(t, &phrases)
+	if len(phrases.List) != 1 || phrases.List[0].Clicks != 3 {
+		t.Fatalf("got %+v, want the clicks sent to the event only", phrases.List)
+	}
+}
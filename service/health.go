@@ -0,0 +1,42 @@
+package service
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/YiniXu9506/devconG/response"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const readyCheckTimeout = 2 * time.Second
+
+// liveness probe, the process is up and serving http
+func (s *Service) HealthzHandler(c *gin.Context) {
+	response.OK(c, "ok")
+}
+
+// readiness probe, the server isn't draining, the database answers ping and the phrase cache has been populated
+func (s *Service) ReadyzHandler(c *gin.Context) {
+	if atomic.LoadInt32(&s.draining) == 1 {
+		response.Fail(c, response.ErrShuttingDown)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readyCheckTimeout)
+	defer cancel()
+
+	if err := s.store.Ping(ctx); err != nil {
+		zap.L().Sugar().Error("Error! Readiness check ping database: ", err)
+		response.Fail(c, response.ErrDatabase.Wrap(err))
+		return
+	}
+
+	if !s.phraseCacheProvider.IsPopulated() {
+		response.Fail(c, response.ErrNotReady)
+		return
+	}
+
+	response.OK(c, "ready")
+}
@@ -0,0 +1,230 @@
+package service
+
+import (
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/YiniXu9506/devconG/model"
+	"github.com/YiniXu9506/devconG/response"
+	"github.com/YiniXu9506/devconG/store"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// decisions of the moderation queue
+const (
+	decisionApprove = "approve"
+	decisionReject  = "reject"
+)
+
+// stats of the last hour unless ?since= is given
+const defaultStatsWindow = time.Hour
+
+type claimedPhrase struct {
+	model.PhraseModel
+	LeaseUntil int64 `json:"lease_until"`
+}
+
+// claim the next pending phrases, oldest first, the reviewer's own claims are renewed and returned first
+func (s *Service) ClaimPhrasesHandler(c *gin.Context) {
+	if !s.checkToken(c) {
+		return
+	}
+
+	type claimReq struct {
+		Count int `json:"count" binding:"required,min=1"`
+	}
+
+	var req claimReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Fail(c, response.ErrBadRequest.WithDetail("count is required"))
+		return
+	}
+
+	event := requestEvent(c)
+	moderationConfig := s.eventsProvider.Moderation(event)
+	if req.Count > moderationConfig.MaxClaim {
+		req.Count = moderationConfig.MaxClaim
+	}
+
+	reviewer := auditActor(c)
+	now := time.Now().Unix()
+	leaseUntil := now + int64(moderationConfig.LeaseSeconds)
+
+	// release expired leases, their phrases are back in the queue
+	claims := s.eventStore(c).Claims
+	if err := claims.ReleaseExpired(now); err != nil {
+		zap.L().Sugar().Error("Error! Release expired claims: ", err)
+	}
+
+	// candidates are over-fetched, other reviewers may claim some of them first
+	candidates, err := claims.Claimable(reviewer, now, req.Count*2)
+	if err != nil {
+		zap.L().Sugar().Error("Error! Get pending phrases to claim: ", err)
+		response.Fail(c, err)
+		return
+	}
+
+	claimed := make([]claimedPhrase, 0, req.Count)
+	for _, phrase := range candidates {
+		if len(claimed) == req.Count {
+			break
+		}
+
+		ok, err := claims.Claim(phrase.PhraseID, reviewer, now, leaseUntil)
+		if err != nil {
+			zap.L().Sugar().Error("Error! Claim phrase: ", err)
+			response.Fail(c, err)
+			return
+		}
+		if ok {
+			claimed = append(claimed, claimedPhrase{PhraseModel: phrase, LeaseUntil: leaseUntil})
+		}
+	}
+
+	response.OK(c, claimed)
+}
+
+// approve or reject phrases claimed by the reviewer, a rejection needs a reason code
+func (s *Service) DecidePhrasesHandler(c *gin.Context) {
+	if !s.checkToken(c) {
+		return
+	}
+
+	type decideReq struct {
+		PhraseID   []int  `json:"ids" binding:"required"`
+		Decision   string `json:"decision" binding:"required"`
+		ReasonCode string `json:"reason_code"`
+		Reason     string `json:"reason"`
+	}
+
+	var req decideReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Fail(c, response.ErrBadRequest.WithDetail("ids and decision are required"))
+		return
+	}
+
+	// the transitions of batch review from pending
+	var toStatus model.PhraseStatus
+	var action string
+	switch req.Decision {
+	case decisionApprove:
+		toStatus, action = model.StatusApproved, AuditActionApprove
+	case decisionReject:
+		toStatus, action = model.StatusRejected, AuditActionReject
+	default:
+		response.Fail(c, response.ErrBadRequest.WithDetail("decision must be approve or reject"))
+		return
+	}
+
+	if req.ReasonCode != "" || req.Decision == decisionReject {
+		known := false
+		for _, code := range s.eventsProvider.Moderation(requestEvent(c)).ReasonCodes {
+			if code == req.ReasonCode {
+				known = true
+			}
+		}
+		if !known {
+			response.Fail(c, response.ErrBadRequest.WithDetail("reason_code must be one of moderation.reason_codes"))
+			return
+		}
+	}
+
+	reviewer := auditActor(c)
+
+	// only phrases of the event whose lease the reviewer still holds are decided
+	phraseIDs, err := s.eventStore(c).Claims.Held(req.PhraseID, reviewer, time.Now().Unix())
+	if err != nil {
+		zap.L().Sugar().Error("Error! Get claims of reviewer: ", err)
+		response.Fail(c, err)
+		return
+	}
+
+	var decided []model.PhraseModel
+	if len(phraseIDs) > 0 {
+		decided, err = s.transitionPhrases(c, phraseIDs, model.StatusPending, toStatus, action, req.ReasonCode, req.Reason)
+		if err != nil {
+			zap.L().Sugar().Error("Error! Decide phrases: ", err)
+			response.Fail(c, err)
+			return
+		}
+
+		if err := s.eventStore(c).Claims.Release(reviewer, phraseIDs); err != nil {
+			zap.L().Sugar().Error("Error! Release decided claims: ", err)
+		}
+	}
+
+	decidedIDs := make([]int, 0, len(decided))
+	for _, phrase := range decided {
+		decidedIDs = append(decidedIDs, phrase.PhraseID)
+	}
+
+	// phrases not decided were claimed by someone else, their lease expired or they aren't pending anymore
+	response.OK(c, gin.H{"decided": decidedIDs})
+}
+
+// release phrases claimed by the reviewer back to the queue, no ids releases all of them
+func (s *Service) ReleasePhrasesHandler(c *gin.Context) {
+	if !s.checkToken(c) {
+		return
+	}
+
+	type releaseReq struct {
+		PhraseID []int `json:"ids"`
+	}
+
+	var req releaseReq
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		response.Fail(c, response.ErrBadRequest.WithDetail("ids must be a list of phrase ids"))
+		return
+	}
+
+	if err := s.eventStore(c).Claims.Release(auditActor(c), req.PhraseID); err != nil {
+		zap.L().Sugar().Error("Error! Release claims: ", err)
+		response.Fail(c, err)
+		return
+	}
+
+	response.OK(c, nil)
+}
+
+// throughput of each reviewer from the audit log: decisions on pending phrases in the unix time range ?since= and ?until=,
+// decisions per minute between their first and last decision, and average seconds from submission to approval
+func (s *Service) GetModerationStatsHandler(c *gin.Context) {
+	if !s.checkToken(c) {
+		return
+	}
+
+	until := time.Now().Unix()
+	since := until - int64(defaultStatsWindow.Seconds())
+	if value, err := strconv.ParseInt(c.Query("since"), 10, 64); err == nil {
+		since = value
+	}
+	if value, err := strconv.ParseInt(c.Query("until"), 10, 64); err == nil {
+		until = value
+	}
+
+	type reviewerStats struct {
+		store.ReviewerStats
+		DecisionsPerMinute float64 `json:"decisions_per_minute"`
+	}
+
+	decisions, err := s.eventStore(c).Audits.ReviewerStats(since, until)
+	if err != nil {
+		zap.L().Sugar().Error("Error! Get moderation stats: ", err)
+		response.Fail(c, err)
+		return
+	}
+
+	stats := make([]reviewerStats, 0, len(decisions))
+	for _, reviewer := range decisions {
+		minutes := float64(reviewer.LastDecisionTime-reviewer.FirstDecisionTime) / 60
+		if minutes < 1 {
+			minutes = 1
+		}
+		stats = append(stats, reviewerStats{ReviewerStats: reviewer, DecisionsPerMinute: float64(reviewer.Decisions) / minutes})
+	}
+
+	response.OK(c, stats)
+}
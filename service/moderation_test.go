@@ -0,0 +1,107 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/YiniXu9506/devconG/model"
+	"github.com/YiniXu9506/devconG/response"
+	"github.com/gin-gonic/gin"
+)
+
+// addPendingPhrases adds phrases of an author and returns their ids
+func (ts *testServer) addPendingPhrases(texts ...string) []int {
+	ts.t.Helper()
+
+	session := ts.login("", "author")
+	for _, text := range texts {
+		if resp := ts.do(http.MethodPost, "/phrase", gin.H{"text": text, "group_id": 1}, session); resp.C != response.CodeOK {
+			ts.t.Fatalf("add phrase: got code %d %q", resp.C, resp.M)
+		}
+	}
+
+	var phrases testPhrases
+	ts.admin(http.MethodGet, "/phrases_full?status=1", nil).decode(ts.t, &phrases)
+	var ids []int
+	for _, phrase := range phrases.List {
+		ids = append(ids, phrase.PhraseID)
+	}
+	return ids
+}
+
+func (ts *testServer) reviewer(method, path, reviewer string, body interface{}) testResponse {
+	ts.t.Helper()
+	return ts.do(method, path, body, map[string]string{"token": testAdminToken, actorHeader: reviewer})
+}
+
+func TestModerationClaims(t *testing.T) {
+	ts := newTestServer(t)
+	ids := ts.addPendingPhrases("first", "second")
+
+	var claimed []claimedPhrase
+	ts.reviewer(http.MethodPost, "/moderation/claim", "alice", gin.H{"count": 1}).decode(t, &claimed)
+	if len(claimed) != 1 {
+		t.Fatalf("alice claimed %d phrases, want 1", len(claimed))
+	}
+	alices := claimed[0].PhraseID
+
+	// alice's claim is skipped for bob
+	ts.reviewer(http.MethodPost, "/moderation/claim", "bob", gin.H{"count": 2}).decode(t, &claimed)
+	if len(claimed) != 1 || claimed[0].PhraseID == alices {
+		t.Fatalf("bob claimed %v, want the phrase alice didn't claim", claimed)
+	}
+
+	// bob can't decide alice's phrase
+	var decided struct {
+		Decided []int `json:"decided"`
+	}
+	ts.reviewer(http.MethodPost, "/moderation/decide", "bob", gin.H{"ids": ids, "decision": decisionApprove}).decode(t, &decided)
+	if len(decided.Decided) != 1 || decided.Decided[0] == alices {
+		t.Fatalf("bob decided %v, want only his own claim", decided.Decided)
+	}
+
+	// released phrases are back in the queue
+	if resp := ts.reviewer(http.MethodPost, "/moderation/release", "alice", nil); resp.C != response.CodeOK {
+		t.Fatalf("release: got code %d %q", resp.C, resp.M)
+	}
+	ts.reviewer(http.MethodPost, "/moderation/claim", "bob", gin.H{"count": 2}).decode(t, &claimed)
+	if len(claimed) != 1 || claimed[0].PhraseID != alices {
+		t.Fatalf("bob claimed %v after the release, want phrase %d", claimed, alices)
+	}
+}
+
+func TestModerationAuditLogAndStats(t *testing.T) {
+	ts := newTestServer(t)
+	ids := ts.addPendingPhrases("first", "second")
+
+	var claimed []claimedPhrase
+	ts.reviewer(http.MethodPost, "/moderation/claim", "alice", gin.H{"count": 2}).decode(t, &claimed)
+	if len(claimed) != 2 {
+		t.Fatalf("alice claimed %d phrases, want 2", len(claimed))
+	}
+	ts.reviewer(http.MethodPost, "/moderation/decide", "alice", gin.H{"ids": ids[:1], "decision": decisionApprove})
+	ts.reviewer(http.MethodPost, "/moderation/decide", "alice", gin.H{"ids": ids[1:], "decision": decisionReject, "reason_code": "spam"})
+
+	var log struct {
+		Pagi PagiInfo                 `json:"pagi"`
+		List []model.PhraseAuditModel `json:"list"`
+	}
+	ts.admin(http.MethodGet, "/audit_log?actor=alice&action="+AuditActionReject, nil).decode(t, &log)
+	if log.Pagi.Total != 1 || len(log.List) != 1 || log.List[0].PhraseID != ids[1] || log.List[0].ReasonCode != "spam" {
+		t.Fatalf("got audit log %+v, want the rejection of phrase %d", log.List, ids[1])
+	}
+
+	var stats []struct {
+		Reviewer   string `json:"reviewer"`
+		Decisions  int    `json:"decisions"`
+		Approvals  int    `json:"approvals"`
+		Rejections int    `json:"rejections"`
+	}
+	// the decisions were made this second, the end of the range is exclusive
+	ts.admin(http.MethodGet, fmt.Sprintf("/moderation/stats?until=%d", time.Now().Unix()+1), nil).decode(t, &stats)
+	if len(stats) != 1 || stats[0].Reviewer != "alice" || stats[0].Decisions != 2 || stats[0].Approvals != 1 || stats[0].Rejections != 1 {
+		t.Fatalf("got stats %+v, want alice with an approval and a rejection", stats)
+	}
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/YiniXu9506/devconG/model"
+	"github.com/YiniXu9506/devconG/store"
+	"github.com/gin-gonic/gin"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// phraseCursor is the position after the last phrase of a page, for keyset pagination
+type phraseCursor struct {
+	Sort     string `json:"s"`
+	Desc     bool   `json:"d"`
+	Value    int64  `json:"v"`
+	PhraseID int    `json:"id"`
+}
+
+func (c phraseCursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodePhraseCursor(value string) (*phraseCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	var cursor phraseCursor
+	if err := json.Unmarshal(b, &cursor); err != nil {
+		return nil, errInvalidCursor
+	}
+	return &cursor, nil
+}
+
+// sortValue is the value of the sort column of the phrase
+func sortValue(filter store.PhraseFilter, phrase store.PhraseWithClicks) int64 {
+	switch filter.Sort {
+	case store.SortClicks:
+		return int64(phrase.Clicks)
+	case store.SortUpdateTime:
+		return phrase.UpdateTime
+	}
+	return phrase.CreateTime
+}
+
+// parsePhraseQuery reads ?status=, ?q=, ?group_id=, ?open_id=, ?since=, ?until=, ?min_clicks=, ?sort=, ?order= and ?cursor=
+func parsePhraseQuery(c *gin.Context, defaultStatus string) (store.PhraseFilter, error) {
+	query := store.PhraseFilter{Sort: c.DefaultQuery("sort", store.SortCreateTime), Desc: true}
+
+	statuses, err := model.ParsePhraseStatuses(c.DefaultQuery("status", defaultStatus))
+	if err != nil {
+		return query, err
+	}
+	query.Statuses = statuses
+
+	query.Text = strings.TrimSpace(c.Query("q"))
+	query.OpenID = c.Query("open_id")
+
+	if value := c.Query("group_id"); value != "" {
+		if query.GroupID, err = strconv.Atoi(value); err != nil {
+			return query, fmt.Errorf("group_id must be a number, got %q", value)
+		}
+	}
+	if value := c.Query("since"); value != "" {
+		if query.Since, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return query, fmt.Errorf("since must be a unix time, got %q", value)
+		}
+	}
+	if value := c.Query("until"); value != "" {
+		if query.Until, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return query, fmt.Errorf("until must be a unix time, got %q", value)
+		}
+	}
+	if value := c.Query("min_clicks"); value != "" {
+		if query.MinClicks, err = strconv.Atoi(value); err != nil {
+			return query, fmt.Errorf("min_clicks must be a number, got %q", value)
+		}
+	}
+
+	if !knownSort(query.Sort) {
+		return query, fmt.Errorf("sort must be clicks, create_time or update_time, got %q", query.Sort)
+	}
+	switch order := c.DefaultQuery("order", "desc"); order {
+	case "desc":
+	case "asc":
+		query.Desc = false
+	default:
+		return query, fmt.Errorf("order must be asc or desc, got %q", order)
+	}
+
+	if value := c.Query("cursor"); value != "" {
+		cursor, err := decodePhraseCursor(value)
+		if err != nil {
+			return query, err
+		}
+		// a cursor is only valid for the order it was made for
+		if cursor.Sort != query.Sort || cursor.Desc != query.Desc {
+			return query, errInvalidCursor
+		}
+		query.After = &store.PhraseKey{Value: cursor.Value, PhraseID: cursor.PhraseID}
+	}
+
+	return query, nil
+}
+
+func knownSort(sort string) bool {
+	for _, known := range store.PhraseSorts {
+		if sort == known {
+			return true
+		}
+	}
+	return false
+}
+
+// nextPhraseCursor is the cursor after the last phrase of a page
+func nextPhraseCursor(filter store.PhraseFilter, phrases []store.PhraseWithClicks) string {
+	last := phrases[len(phrases)-1]
+	return phraseCursor{Sort: filter.Sort, Desc: filter.Desc, Value: sortValue(filter, last), PhraseID: last.PhraseID}.encode()
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/YiniXu9506/devconG/traffic"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// bodies longer than it are recorded without the body
+const maxRecordedBody = 4096
+
+// recorder returns the recorder of file, a recorder of another file is closed first
+func (s *Service) recorder(file string) (*traffic.Recorder, error) {
+	s.recorderMu.Lock()
+	defer s.recorderMu.Unlock()
+
+	if s.trafficRecorder != nil && s.trafficRecorder.File() == file {
+		return s.trafficRecorder, nil
+	}
+	if s.trafficRecorder != nil {
+		s.trafficRecorder.Close()
+		s.trafficRecorder = nil
+	}
+	recorder, err := traffic.NewRecorder(file)
+	if err != nil {
+		return nil, err
+	}
+	zap.L().Sugar().Infof("recording requests to %v", file)
+	s.trafficRecorder = recorder
+	return recorder, nil
+}
+
+// closeRecorder writes out the recorded requests
+func (s *Service) closeRecorder() {
+	s.recorderMu.Lock()
+	defer s.recorderMu.Unlock()
+
+	if s.trafficRecorder != nil {
+		s.trafficRecorder.Close()
+		s.trafficRecorder = nil
+	}
+}
+
+// recordTraffic records the requests to record.paths with users and texts anonymized while record.enabled is set
+func (s *Service) recordTraffic(c *gin.Context) {
+	cfg := s.config.Get().Record
+	if !cfg.Enabled || !containsString(cfg.Paths, routePath(c)) {
+		c.Next()
+		return
+	}
+	recorder, err := s.recorder(cfg.File)
+	if err != nil {
+		zap.L().Sugar().Error("Error! Open record file: ", err)
+		c.Next()
+		return
+	}
+
+	// read the start of the body and put it back for the handler
+	var body []byte
+	if c.Request.Body != nil {
+		head, err := ioutil.ReadAll(io.LimitReader(c.Request.Body, maxRecordedBody+1))
+		if err == nil && len(head) <= maxRecordedBody {
+			body = head
+		}
+		c.Request.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(head), c.Request.Body))
+	}
+
+	start := time.Now()
+	c.Next()
+
+	entry := traffic.Entry{
+		Time:      start.UnixNano() / int64(time.Millisecond),
+		Method:    c.Request.Method,
+		Path:      routePath(c),
+		Query:     c.Request.URL.RawQuery,
+		Event:     eventSlug(c),
+		Body:      recorder.AnonymizeBody(body),
+		Status:    c.Writer.Status(),
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if openID := sessionOpenID(c); openID != "" {
+		entry.User = recorder.AnonymizeUser(openID)
+	}
+	recorder.Record(entry)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -1,50 +1,153 @@
 package service
 
 import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/YiniXu9506/devconG/auth"
+	"github.com/YiniXu9506/devconG/config"
+	"github.com/YiniXu9506/devconG/notify"
 	"github.com/YiniXu9506/devconG/provider"
+	"github.com/YiniXu9506/devconG/response"
+	"github.com/YiniXu9506/devconG/retention"
+	"github.com/YiniXu9506/devconG/store"
+	"github.com/YiniXu9506/devconG/traffic"
+	"github.com/YiniXu9506/devconG/webhook"
 	"github.com/gin-gonic/gin"
-	"github.com/spf13/viper"
-	"gorm.io/gorm"
 )
 
+// Workers send notifications and webhooks and compact clicks in the background, a nil worker is off
+type Workers struct {
+	Notifier  *notify.Hub
+	Webhooks  *webhook.Dispatcher
+	Retention *retention.Job
+}
+
 type Service struct {
-	db                  *gorm.DB
-	cdb                 *gorm.DB
+	// handlers and providers read and write through the store, the workers write their own tables
+	store               store.Store
 	phraseCacheProvider *provider.PhrasesCacheProvider
+	profilesProvider    *provider.ProfilesProvider
+	eventsProvider      *provider.EventsProvider
+	// rebuilt when the auth settings are reloaded, guarded by identityMu
+	identityMu       sync.RWMutex
+	identityProvider auth.IdentityProvider
+	notifier         *notify.Hub
+	webhooks         *webhook.Dispatcher
+	retention        *retention.Job
 	// clickTrendsCacheProvider *provider.ClickTrendsCacheProvider
-	config *viper.Viper
+	config *config.Manager
+
+	// recorder of record.file, opened on the first recorded request
+	recorderMu      sync.Mutex
+	trafficRecorder *traffic.Recorder
+
+	// set by Drain, /readyz fails from then on
+	draining int32
 }
 
-func NewService(dbs []*gorm.DB, config *viper.Viper) *Service {
-	var db, cdb *gorm.DB
-	if len(dbs) > 0 {
-		db = dbs[0]
-		if len(dbs) == 2 {
-			cdb = dbs[1]
+func NewService(st store.Store, cfg *config.Manager, workers Workers) *Service {
+	phraseCacheProvider := provider.NewPhrasesCacheProvider(st, cfg.Get().Cache)
+	profilesProvider := provider.NewProfilesProvider(st.Profiles, cfg)
+	eventsProvider := provider.NewEventsProvider(st.Events, cfg, profilesProvider)
+	// clickTrendsCacheProvider := provider.NewClickTrendsCacheProvider(db)
+
+	// the notifier and the webhooks check hot phrases each on their own, either can be off
+	hotThresholds := func(eventID int) []config.SizeThreshold {
+		event, err := eventsProvider.Get(eventID)
+		if err != nil {
+			return cfg.Get().H5.LtClicksSize
+		}
+		profile, err := eventsProvider.Profile(event, "")
+		if err != nil {
+			return cfg.Get().H5.LtClicksSize
 		}
+		return profile.LtClicksSize
+	}
+	notifier, webhooks := workers.Notifier, workers.Webhooks
+	if notifier != nil {
+		notifier.HotThresholds(hotThresholds)
+	}
+	if webhooks != nil {
+		webhooks.HotThresholds(hotThresholds)
 	}
-	phraseCacheProvider := provider.NewPhrasesCacheProvider(db)
-	// clickTrendsCacheProvider := provider.NewClickTrendsCacheProvider(db)
 
-	return &Service{
-		db:                  db,
-		cdb:                 cdb,
+	s := &Service{
+		store:               st,
 		phraseCacheProvider: phraseCacheProvider,
+		profilesProvider:    profilesProvider,
+		eventsProvider:      eventsProvider,
+		identityProvider:    auth.NewIdentityProvider(cfg.Get().Auth),
+		notifier:            notifier,
+		webhooks:            webhooks,
+		retention:           workers.Retention,
 		// clickTrendsCacheProvider: clickTrendsCacheProvider,
-		config: config,
+		config: cfg,
 	}
+
+	// push reloaded settings to the components built from them, the others read the config on each use
+	cfg.Subscribe(func(newConfig *config.Config) {
+		phraseCacheProvider.ApplyConfig(newConfig.Cache)
+		if notifier != nil {
+			notifier.SetChannels(notify.NewChannels(cfg))
+		}
+
+		s.identityMu.Lock()
+		s.identityProvider = auth.NewIdentityProvider(newConfig.Auth)
+		s.identityMu.Unlock()
+	})
+	return s
+}
+
+// identity is the identity provider of the current auth settings
+func (s *Service) identity() auth.IdentityProvider {
+	s.identityMu.RLock()
+	defer s.identityMu.RUnlock()
+
+	return s.identityProvider
 }
 
 func (s *Service) Start(r *gin.Engine) {
+	r.Use(response.RequestID, s.recordTraffic)
+	r.NoRoute(func(c *gin.Context) {
+		response.Fail(c, response.ErrNotFound)
+	})
+
+	// APIs for load balancer
+	r.GET("/healthz", s.HealthzHandler)
+	r.GET("/readyz", s.ReadyzHandler)
+
+	// the APIs of an event are served under /events/<slug>, and without the prefix for the event
+	// named by the X-Devcon-Event-Slug header or the default event
+	s.eventRoutes(r.Group("", s.resolveEvent))
+	s.eventRoutes(r.Group(eventPathPrefix, s.resolveEvent))
+
+	// APIs for runtime config
+	r.GET("/admin/config", s.GetConfigHandler)
+	r.GET("/admin/profiles", s.GetProfilesHandler)
+	r.PUT("/admin/profiles/:name", s.PutProfileHandler)
+	r.DELETE("/admin/profiles/:name", s.DeleteProfileHandler)
+	r.GET("/admin/events", s.GetEventsHandler)
+	r.POST("/admin/events", s.AddEventHandler)
+	r.GET("/admin/events/:slug", s.GetEventHandler)
+	r.PUT("/admin/events/:slug", s.PutEventHandler)
+}
+
+// eventRoutes registers the APIs scoped to an event
+func (s *Service) eventRoutes(r *gin.RouterGroup) {
 	// APIs for wechat mini program
 	r.GET("/phrases", s.GetScrollingPhrasesHandler)
-	r.POST("/phrase", s.AddPhraseHandler)
-	r.POST("/phrase_hot", s.UpdateClickedPhraseHandler)
-	r.POST("/user", s.AddUserHandler)
+	r.POST("/login", s.LoginHandler)
+	r.POST("/phrase", s.requireSession, s.AddPhraseHandler)
+	r.POST("/phrase_hot", s.requireSession, s.UpdateClickedPhraseHandler)
+	r.POST("/user", s.requireSession, s.AddUserHandler)
+	r.GET("/user/me", s.requireSession, s.GetMyUserHandler)
+	r.DELETE("/user/me", s.requireSession, s.DeleteMyUserHandler)
+	r.GET("/user/me/phrases", s.requireSession, s.GetMyPhrasesHandler)
+	r.GET("/user/me/clicks", s.requireSession, s.GetMyClicksHandler)
+	r.GET("/user/me/notifications", s.requireSession, s.GetMyNotificationsHandler)
+	r.POST("/user/me/notifications/read", s.requireSession, s.ReadMyNotificationsHandler)
 	r.GET("/h5_settings", s.GetH5SettingHandler)
-	r.GET("/test-phrase-post", s.TestPhrasePostHandler)
-	r.GET("/test-phrase-hot-post", s.TestPhraseHotPostHandler)
-	r.GET("/test-user-post", s.TestUserPostHandler)
 
 	// APIs for management portal
 	r.GET("/phrases_full", s.GetAllPhrasesHandler)
@@ -52,8 +155,51 @@ func (s *Service) Start(r *gin.Engine) {
 	r.DELETE("/phrase", s.DeletePhraseHandler)
 	r.PATCH("/phrase", s.PatchPhraseHandler)
 	r.PATCH("/batch_review_phrase", s.PatchBatchPhraseHandler)
+	r.GET("/phrase/:id/history", s.GetPhraseHistoryHandler)
+	r.POST("/phrase/:id/restore", s.RestorePhraseHandler)
+	r.GET("/audit_log", s.GetAuditLogHandler)
+
+	// APIs for the moderation queue
+	r.POST("/moderation/claim", s.ClaimPhrasesHandler)
+	r.POST("/moderation/decide", s.DecidePhrasesHandler)
+	r.POST("/moderation/release", s.ReleasePhrasesHandler)
+	r.GET("/moderation/stats", s.GetModerationStatsHandler)
+
+	// rounds of the event and APIs for webhooks of event organizers' systems, served with a webhook dispatcher
+	if s.webhooks != nil {
+		r.POST("/admin/rounds/end", s.EndRoundHandler)
+		r.GET("/admin/webhooks", s.GetWebhooksHandler)
+		r.POST("/admin/webhooks", s.AddWebhookHandler)
+		r.PUT("/admin/webhooks/:id", s.PutWebhookHandler)
+		r.DELETE("/admin/webhooks/:id", s.DeleteWebhookHandler)
+		r.GET("/admin/webhooks/:id/deliveries", s.GetWebhookDeliveriesHandler)
+		r.GET("/admin/webhook_deliveries/:id", s.GetWebhookDeliveryHandler)
+		r.POST("/admin/webhook_deliveries/:id/redeliver", s.RedeliverWebhookHandler)
+	}
 
 	// API for BI
 	r.GET("/overview", s.GetOverviewHandler)
 	r.GET("/click_trends", s.GetClickTrendsHandler)
 }
+
+// Drain fails /readyz so the load balancer stops routing requests here while in-flight ones finish
+func (s *Service) Drain() {
+	atomic.StoreInt32(&s.draining, 1)
+}
+
+// Stop stops the providers and the workers, the database pools are left to the caller
+func (s *Service) Stop() {
+	s.phraseCacheProvider.Stop()
+	s.profilesProvider.Stop()
+	s.eventsProvider.Stop()
+	if s.notifier != nil {
+		s.notifier.Stop()
+	}
+	if s.webhooks != nil {
+		s.webhooks.Stop()
+	}
+	if s.retention != nil {
+		s.retention.Stop()
+	}
+	s.closeRecorder()
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/YiniXu9506/devconG/config"
+	"github.com/YiniXu9506/devconG/response"
+	"github.com/YiniXu9506/devconG/store"
+	"github.com/gin-gonic/gin"
+)
+
+const testAdminToken = "test-admin-token"
+
+// testServer serves the APIs on the memory store without background workers
+type testServer struct {
+	t       *testing.T
+	service *Service
+	router  *gin.Engine
+}
+
+func newTestServer(t *testing.T) *testServer {
+	gin.SetMode(gin.TestMode)
+
+	loader, err := config.NewLoader("../config.dev", map[string]interface{}{
+		"db.driver":           config.DBDriverSQLite,
+		"auth.admin_token":    testAdminToken,
+		"auth.session_secret": "test-session-secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.NewManager(loader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewService(store.NewMemory(), cfg, Workers{})
+	t.Cleanup(s.Stop)
+	r := gin.New()
+	s.Start(r)
+	return &testServer{t: t, service: s, router: r}
+}
+
+// testResponse is the envelope of a response with its data left to decode
+type testResponse struct {
+	Status int
+	C      response.Code   `json:"c"`
+	D      json.RawMessage `json:"d"`
+	M      string          `json:"m"`
+}
+
+// decode decodes the data of a successful response into v
+func (resp testResponse) decode(t *testing.T, v interface{}) {
+	t.Helper()
+	if resp.C != response.CodeOK {
+		t.Fatalf("got code %d %q, want success", resp.C, resp.M)
+	}
+	if err := json.Unmarshal(resp.D, v); err != nil {
+		t.Fatalf("decode %s: %v", resp.D, err)
+	}
+}
+
+// do sends the request with the headers, a non-nil body is sent as json
+func (ts *testServer) do(method, path string, body interface{}, headers map[string]string) testResponse {
+	ts.t.Helper()
+
+	var reader bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reader).Encode(body); err != nil {
+			ts.t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &reader)
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	w := httptest.NewRecorder()
+	ts.router.ServeHTTP(w, req)
+
+	resp := testResponse{Status: w.Code}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		ts.t.Fatalf("%s %s: decode %q: %v", method, path, w.Body.String(), err)
+	}
+	return resp
+}
+
+// admin sends the request with the admin token
+func (ts *testServer) admin(method, path string, body interface{}) testResponse {
+	ts.t.Helper()
+	return ts.do(method, path, body, map[string]string{"token": testAdminToken})
+}
+
+// login logs in with the code of the fake identity provider and returns the session header
+func (ts *testServer) login(prefix, code string) map[string]string {
+	ts.t.Helper()
+
+	var session struct {
+		Token string `json:"token"`
+	}
+	ts.do(http.MethodPost, prefix+"/login", gin.H{"code": code}, nil).decode(ts.t, &session)
+	return map[string]string{"Authorization": "Bearer " + session.Token}
+}
+
+func TestHealthz(t *testing.T) {
+	ts := newTestServer(t)
+
+	resp := ts.do(http.MethodGet, "/healthz", nil, nil)
+	if resp.Status != http.StatusOK || resp.C != response.CodeOK {
+		t.Fatalf("got %d with code %d, want 200", resp.Status, resp.C)
+	}
+}
+
+func TestReadyzDraining(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.service.Drain()
+	resp := ts.do(http.MethodGet, "/readyz", nil, nil)
+	if resp.Status != http.StatusServiceUnavailable || resp.M != response.ErrShuttingDown.Error() {
+		t.Fatalf("got %d %q, want 503 %q", resp.Status, resp.M, response.ErrShuttingDown.Error())
+	}
+}
+
+func TestWebhookRoutesNeedDispatcher(t *testing.T) {
+	ts := newTestServer(t)
+
+	resp := ts.admin(http.MethodGet, "/admin/webhooks", nil)
+	if resp.Status != http.StatusNotFound {
+		t.Fatalf("got %d, want 404 without a webhook dispatcher", resp.Status)
+	}
+}
@@ -0,0 +1,206 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"strconv"
+
+	"github.com/YiniXu9506/devconG/model"
+	"github.com/YiniXu9506/devconG/response"
+	"github.com/YiniXu9506/devconG/store"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// anonymousOpenID replaces the open_id of a deleted user, it is random so it can't be traced back to the user
+func anonymousOpenID() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return model.AnonymousOpenIDPrefix + hex.EncodeToString(b), nil
+}
+
+// get the profile of the logged in user
+func (s *Service) GetMyUserHandler(c *gin.Context) {
+	user, found, err := s.eventStore(c).Users.Get(sessionOpenID(c))
+	if err != nil {
+		zap.L().Sugar().Error("Error! Get user: ", err)
+		response.Fail(c, err)
+		return
+	}
+
+	if !found {
+		response.Fail(c, response.ErrNotFound)
+		return
+	}
+
+	response.OK(c, user)
+}
+
+// erase the profile of the logged in user and anonymize the phrases and clicks the user made,
+// the phrases and clicks are kept so aggregate stats don't change
+func (s *Service) DeleteMyUserHandler(c *gin.Context) {
+	openID := sessionOpenID(c)
+
+	anonID, err := anonymousOpenID()
+	if err != nil {
+		zap.L().Sugar().Error("Error! Generate anonymous open_id: ", err)
+		response.Fail(c, err)
+		return
+	}
+
+	if err := s.eventStore(c).Users.Delete(openID, anonID); err != nil {
+		zap.L().Sugar().Error("Error! Delete user: ", err)
+		response.Fail(c, err)
+		return
+	}
+
+	zap.L().Sugar().Infof("user deleted, phrases and clicks anonymized as %v", anonID)
+	response.OK(c, nil)
+}
+
+// list the phrases submitted by the logged in user with their status and clicks
+func (s *Service) GetMyPhrasesHandler(c *gin.Context) {
+	defaultLimit := "20"
+	defaultOffset := "0"
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", defaultLimit))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", defaultOffset))
+
+	type myPhraseModel struct {
+		PhraseID   int                `json:"phrase_id"`
+		Text       string             `json:"text"`
+		GroupID    int                `json:"group_id"`
+		Status     model.PhraseStatus `json:"status"`
+		StatusText string             `json:"status_text"`
+		Clicks     int                `json:"clicks"`
+		CreateTime int64              `json:"create_time"`
+		UpdateTime int64              `json:"update_time"`
+	}
+
+	type myPhrasesResponse struct {
+		Pagi PagiInfo        `json:"pagi"`
+		List []myPhraseModel `json:"list"`
+	}
+
+	var resp myPhrasesResponse
+	resp.Pagi.Offset = offset
+
+	phrases, total, err := s.eventStore(c).Phrases.ListByAuthor(sessionOpenID(c), limit, offset)
+	if err != nil {
+		zap.L().Sugar().Error("Error! Get my phrases: ", err)
+		response.Fail(c, err)
+		return
+	}
+
+	resp.Pagi.Total = int(total)
+	resp.List = make([]myPhraseModel, 0, len(phrases))
+	for _, phrase := range phrases {
+		resp.List = append(resp.List, myPhraseModel{
+			PhraseID:   phrase.PhraseID,
+			Text:       phrase.Text,
+			GroupID:    phrase.GroupID,
+			Status:     phrase.Status,
+			StatusText: phrase.Status.String(),
+			Clicks:     phrase.Clicks,
+			CreateTime: phrase.CreateTime,
+			UpdateTime: phrase.UpdateTime,
+		})
+	}
+
+	response.OK(c, resp)
+}
+
+// summarize the clicks of the logged in user by phrase and by group
+func (s *Service) GetMyClicksHandler(c *gin.Context) {
+	defaultLimit := "50"
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", defaultLimit))
+
+	type myClicksResponse struct {
+		TotalClicks int                      `json:"total_clicks"`
+		Groups      []store.GroupClicks      `json:"groups"`
+		Phrases     []store.UserPhraseClicks `json:"phrases"`
+	}
+
+	openID := sessionOpenID(c)
+	var resp myClicksResponse
+	var err error
+
+	if resp.Groups, err = s.eventStore(c).Clicks.UserGroups(openID); err != nil {
+		zap.L().Sugar().Error("Error! Get my clicks by group: ", err)
+		response.Fail(c, err)
+		return
+	}
+
+	for _, group := range resp.Groups {
+		resp.TotalClicks += group.Clicks
+	}
+
+	if resp.Phrases, err = s.eventStore(c).Clicks.UserPhrases(openID, limit); err != nil {
+		zap.L().Sugar().Error("Error! Get my clicks by phrase: ", err)
+		response.Fail(c, err)
+		return
+	}
+
+	response.OK(c, resp)
+}
+
+// list the in-app notifications of the logged in user in the event, newest first, ?unread=1 lists unread ones only
+func (s *Service) GetMyNotificationsHandler(c *gin.Context) {
+	defaultLimit := "20"
+	defaultOffset := "0"
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", defaultLimit))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", defaultOffset))
+
+	type myNotificationsResponse struct {
+		Pagi   PagiInfo                  `json:"pagi"`
+		Unread int                       `json:"unread"`
+		List   []model.NotificationModel `json:"list"`
+	}
+
+	notifications, openID := s.eventStore(c).Notifications, sessionOpenID(c)
+	var resp myNotificationsResponse
+	var total int64
+	var err error
+	resp.Pagi.Offset = offset
+
+	if resp.List, total, err = notifications.List(openID, c.Query("unread") == "1", limit, offset); err != nil {
+		zap.L().Sugar().Error("Error! Get my notifications: ", err)
+		response.Fail(c, err)
+		return
+	}
+	resp.Pagi.Total = int(total)
+
+	if resp.Unread, err = notifications.Unread(openID); err != nil {
+		zap.L().Sugar().Error("Error! Get unread counts of my notifications: ", err)
+		response.Fail(c, err)
+		return
+	}
+
+	response.OK(c, resp)
+}
+
+// mark notifications of the logged in user in the event as read, all of them if no ids are given
+func (s *Service) ReadMyNotificationsHandler(c *gin.Context) {
+	type readNotificationsReq struct {
+		IDs []int `form:"ids" json:"ids"`
+	}
+
+	var req readNotificationsReq
+	// an empty body marks all notifications as read
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		response.Fail(c, response.ErrBadRequest.WithDetail("ids must be a list of notification ids"))
+		return
+	}
+
+	if err := s.eventStore(c).Notifications.MarkRead(sessionOpenID(c), req.IDs); err != nil {
+		zap.L().Sugar().Error("Error! Mark my notifications as read: ", err)
+		response.Fail(c, err)
+		return
+	}
+
+	response.OK(c, nil)
+}
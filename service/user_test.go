@@ -0,0 +1,32 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/YiniXu9506/devconG/response"
+	"github.com/gin-gonic/gin"
+)
+
+func TestMyNotifications(t *testing.T) {
+	ts := newTestServer(t)
+	session := ts.login("", "author")
+
+	var notifications struct {
+		Pagi   PagiInfo      `json:"pagi"`
+		Unread int           `json:"unread"`
+		List   []interface{} `json:"list"`
+	}
+	ts.do(http.MethodGet, "/user/me/notifications", nil, session).decode(t, &notifications)
+	if notifications.Pagi.Total != 0 || notifications.Unread != 0 || len(notifications.List) != 0 {
+		t.Fatalf("got %+v, want no notifications", notifications)
+	}
+
+	if resp := ts.do(http.MethodPost, "/user/me/notifications/read", gin.H{"ids": []int{1}}, session); resp.C != response.CodeOK {
+		t.Fatalf("mark read: got code %d %q", resp.C, resp.M)
+	}
+
+	if resp := ts.do(http.MethodGet, "/user/me/notifications", nil, nil); resp.Status != http.StatusUnauthorized {
+		t.Fatalf("got %d without a session, want 401", resp.Status)
+	}
+}
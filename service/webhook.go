@@ -0,0 +1,226 @@
+package service
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/YiniXu9506/devconG/model"
+	"github.com/YiniXu9506/devconG/response"
+	"github.com/YiniXu9506/devconG/webhook"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// responds with an error unless the :id path parameter is a number
+func idParam(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		response.Fail(c, response.ErrBadRequest.WithDetail("id must be a number"))
+		return 0, false
+	}
+	return id, true
+}
+
+// responds to errors of the webhook dispatcher, unknown subscriptions and deliveries are bad requests
+func webhookError(c *gin.Context, action string, err error) {
+	if errors.Is(err, webhook.ErrUnknownSubscription) || errors.Is(err, webhook.ErrUnknownDelivery) {
+		response.Fail(c, response.ErrNotFound)
+		return
+	}
+
+	zap.L().Sugar().Errorf("Error! %v: %v", action, err)
+	response.Fail(c, err)
+}
+
+// list the webhook subscriptions of the event
+func (s *Service) GetWebhooksHandler(c *gin.Context) {
+	if !s.checkToken(c) {
+		return
+	}
+
+	subscriptions, err := s.webhooks.ListSubscriptions(requestEvent(c).ID)
+	if err != nil {
+		webhookError(c, "List webhook subscriptions", err)
+		return
+	}
+
+	response.OK(c, subscriptions)
+}
+
+// create a webhook subscription to the webhook events of the event, the signing secret is only returned here
+func (s *Service) AddWebhookHandler(c *gin.Context) {
+	if !s.checkToken(c) {
+		return
+	}
+
+	type webhookWithSecret struct {
+		model.WebhookSubscriptionModel
+		Secret string `json:"secret"`
+	}
+
+	var req webhook.SubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Fail(c, response.ErrBadRequest.WithDetail("url and events are required"))
+		return
+	}
+
+	subscription, err := s.webhooks.CreateSubscription(requestEvent(c).ID, req)
+	if err != nil {
+		response.Fail(c, response.ErrBadRequest.WithDetail("%v", err))
+		return
+	}
+
+	response.OK(c, webhookWithSecret{WebhookSubscriptionModel: subscription, Secret: subscription.Secret})
+}
+
+// replace url, events, description and enabled of a webhook subscription
+func (s *Service) PutWebhookHandler(c *gin.Context) {
+	if !s.checkToken(c) {
+		return
+	}
+
+	id, ok := idParam(c)
+	if !ok {
+		return
+	}
+
+	var req webhook.SubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Fail(c, response.ErrBadRequest.WithDetail("url and events are required"))
+		return
+	}
+
+	subscription, err := s.webhooks.UpdateSubscription(requestEvent(c).ID, id, req)
+	if err != nil {
+		if errors.Is(err, webhook.ErrUnknownSubscription) {
+			webhookError(c, "Update webhook subscription", err)
+			return
+		}
+		response.Fail(c, response.ErrBadRequest.WithDetail("%v", err))
+		return
+	}
+
+	response.OK(c, subscription)
+}
+
+// delete a webhook subscription, its pending deliveries fail
+func (s *Service) DeleteWebhookHandler(c *gin.Context) {
+	if !s.checkToken(c) {
+		return
+	}
+
+	id, ok := idParam(c)
+	if !ok {
+		return
+	}
+
+	if err := s.webhooks.DeleteSubscription(requestEvent(c).ID, id); err != nil {
+		webhookError(c, "Delete webhook subscription", err)
+		return
+	}
+
+	response.OK(c, nil)
+}
+
+// list the deliveries of a webhook subscription, newest first, ?status= filters by delivery status
+func (s *Service) GetWebhookDeliveriesHandler(c *gin.Context) {
+	if !s.checkToken(c) {
+		return
+	}
+
+	id, ok := idParam(c)
+	if !ok {
+		return
+	}
+
+	defaultLimit := "50"
+	defaultOffset := "0"
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", defaultLimit))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", defaultOffset))
+	status, _ := strconv.Atoi(c.Query("status"))
+
+	type deliveriesResponse struct {
+		Pagi PagiInfo                     `json:"pagi"`
+		List []model.WebhookDeliveryModel `json:"list"`
+	}
+
+	deliveries, total, err := s.webhooks.ListDeliveries(requestEvent(c).ID, id, status, limit, offset)
+	if err != nil {
+		webhookError(c, "List webhook deliveries", err)
+		return
+	}
+
+	response.OK(c, deliveriesResponse{Pagi: PagiInfo{Total: int(total), Offset: offset}, List: deliveries})
+}
+
+// get a webhook delivery with its event and the log of its attempts
+func (s *Service) GetWebhookDeliveryHandler(c *gin.Context) {
+	if !s.checkToken(c) {
+		return
+	}
+
+	id, ok := idParam(c)
+	if !ok {
+		return
+	}
+
+	delivery, err := s.webhooks.GetDelivery(requestEvent(c).ID, id)
+	if err != nil {
+		webhookError(c, "Get webhook delivery", err)
+		return
+	}
+
+	response.OK(c, delivery)
+}
+
+// deliver the event of a webhook delivery again
+func (s *Service) RedeliverWebhookHandler(c *gin.Context) {
+	if !s.checkToken(c) {
+		return
+	}
+
+	id, ok := idParam(c)
+	if !ok {
+		return
+	}
+
+	delivery, err := s.webhooks.Redeliver(requestEvent(c).ID, id)
+	if err != nil {
+		webhookError(c, "Redeliver webhook", err)
+		return
+	}
+
+	response.OK(c, delivery)
+}
+
+// end a round of the event, round.ended is sent with the clicks of the groups and the top phrases
+func (s *Service) EndRoundHandler(c *gin.Context) {
+	if !s.checkToken(c) {
+		return
+	}
+
+	type endRoundReq struct {
+		Round string `json:"round" binding:"required,max=64"`
+	}
+
+	var req endRoundReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Fail(c, response.ErrBadRequest.WithDetail("round is required"))
+		return
+	}
+
+	ended, err := s.webhooks.EndRound(c.Request.Context(), requestEvent(c).ID, req.Round)
+	if err != nil {
+		zap.L().Sugar().Error("Error! End round: ", err)
+		response.Fail(c, err)
+		return
+	}
+
+	if !ended {
+		response.Fail(c, response.ErrRoundEnded)
+		return
+	}
+
+	response.OK(c, nil)
+}
@@ -0,0 +1,689 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/YiniXu9506/devconG/model"
+	"github.com/go-sql-driver/mysql"
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// NewGorm stores in TiDB, MySQL or SQLite through gorm, it is the store of the default event
+func NewGorm(db *gorm.DB) Store {
+	return newGorm(db, model.DefaultEventID)
+}
+
+func newGorm(db *gorm.DB, event int) Store {
+	return Store{
+		Phrases:       &gormPhrases{db: db, event: event},
+		Clicks:        &gormClicks{db: db, event: event},
+		Users:         &gormUsers{db: db, event: event},
+		Stats:         &gormStats{db: db, event: event},
+		Audits:        &gormAudits{db: db, event: event},
+		Claims:        &gormClaims{db: db, event: event},
+		Notifications: &gormNotifications{db: db, event: event},
+		Events:        &gormEvents{db: db},
+		Profiles:      &gormProfiles{db: db},
+		ping: func(ctx context.Context) error {
+			sqlDB, err := db.DB()
+			if err != nil {
+				return err
+			}
+			return sqlDB.PingContext(ctx)
+		},
+		scope: func(eventID int) Store {
+			return newGorm(db, eventID)
+		},
+	}
+}
+
+// eventPhraseIDs is a subquery of the ids of the phrases of the event
+func eventPhraseIDs(db *gorm.DB, event int) *gorm.DB {
+	return db.Table("phrase_models").Select("phrase_id").Where("event_id = ?", event)
+}
+
+// isDuplicate reports whether err is a violation of a unique key
+func isDuplicate(err error) bool {
+	mysqlErr := &mysql.MySQLError{}
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1062
+	}
+	sqliteErr := sqlite3.Error{}
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	}
+	return false
+}
+
+// isSQLite reports whether db is a SQLite database
+func isSQLite(db *gorm.DB) bool {
+	return db.Dialector.Name() == "sqlite"
+}
+
+// columns the phrase list sorts by
+var phraseSortColumns = map[string]string{
+	SortClicks:     "COALESCE(b.clicks, 0)",
+	SortCreateTime: "a.create_time",
+	SortUpdateTime: "a.update_time",
+}
+
+// total clicks of each phrase, joined when phrases are filtered or sorted by clicks
+const phraseClicksJoin = "LEFT JOIN phrase_click_total_models as b ON a.event_id = b.event_id AND a.phrase_id = b.phrase_id"
+
+// escapeLike escapes the wildcards of a LIKE pattern with !, SQLite has no default escape character
+func escapeLike(text string) string {
+	return strings.NewReplacer(`!`, `!!`, `%`, `!%`, `_`, `!_`).Replace(text)
+}
+
+type gormPhrases struct {
+	db    *gorm.DB
+	event int
+}
+
+func (r *gormPhrases) Get(id int) (model.PhraseModel, bool, error) {
+	var phrase model.PhraseModel
+	res := r.db.Table("phrase_models").Where("event_id = ? AND phrase_id = ?", r.event, id).Find(&phrase)
+	return phrase, res.RowsAffected > 0, res.Error
+}
+
+func (r *gormPhrases) GetMany(ids []int) ([]model.PhraseModel, error) {
+	var phrases []model.PhraseModel
+	if len(ids) == 0 {
+		return phrases, nil
+	}
+	err := r.db.Table("phrase_models").Where("event_id = ? AND phrase_id IN ?", r.event, ids).Find(&phrases).Error
+	return phrases, err
+}
+
+func (r *gormPhrases) Create(phrase *model.PhraseModel) error {
+	phrase.EventID = r.event
+	if err := r.db.Table("phrase_models").Create(phrase).Error; err != nil {
+		if isDuplicate(err) {
+			return ErrDuplicate
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *gormPhrases) Update(phrase model.PhraseModel, audit model.PhraseAuditModel) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table("phrase_models").
+			Where("event_id = ? AND phrase_id = ?", r.event, phrase.PhraseID).
+			Updates(map[string]interface{}{"text": phrase.Text, "status": phrase.Status, "update_time": phrase.UpdateTime}).Error; err != nil {
+			if isDuplicate(err) {
+				return ErrDuplicate
+			}
+			return err
+		}
+		return tx.Create(&audit).Error
+	})
+}
+
+func (r *gormPhrases) Transition(ids []int, fromStatus, toStatus model.PhraseStatus, updateTime int64, audit AuditFunc) ([]model.PhraseModel, error) {
+	var phrases []model.PhraseModel
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table("phrase_models").
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("event_id = ? AND status = ? AND phrase_id IN ?", r.event, fromStatus, ids).
+			Find(&phrases).Error; err != nil {
+			return err
+		}
+		if len(phrases) == 0 {
+			return nil
+		}
+
+		phraseIDs := make([]int, 0, len(phrases))
+		audits := make([]model.PhraseAuditModel, 0, len(phrases))
+		for i, phrase := range phrases {
+			phrases[i].Status = toStatus
+			phrases[i].UpdateTime = updateTime
+			phraseIDs = append(phraseIDs, phrase.PhraseID)
+			audits = append(audits, audit(phrase, phrases[i]))
+		}
+
+		if err := tx.Table("phrase_models").Where("phrase_id IN ?", phraseIDs).Updates(map[string]interface{}{"status": toStatus, "update_time": updateTime}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&audits).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return phrases, nil
+}
+
+// the audit records have no event, they are scoped through the event of their phrase
+func (r *gormPhrases) History(id int) ([]model.PhraseAuditModel, error) {
+	var history []model.PhraseAuditModel
+	err := r.db.Where("phrase_id = ? AND phrase_id IN (?)", id, eventPhraseIDs(r.db, r.event)).Order("create_time, id").Find(&history).Error
+	return history, err
+}
+
+func (r *gormPhrases) LastChange(id int, status model.PhraseStatus) (model.PhraseAuditModel, error) {
+	var last model.PhraseAuditModel
+	err := r.db.Where("phrase_id = ? AND new_status = ? AND phrase_id IN (?)", id, status, eventPhraseIDs(r.db, r.event)).Order("id desc").Limit(1).Find(&last).Error
+	return last, err
+}
+
+// filter adds the filters to a query on `phrase_models as a`
+func (r *gormPhrases) filter(filter PhraseFilter) *gorm.DB {
+	db := r.db.Table("phrase_models as a")
+	if filter.NeedsClicks() {
+		db = db.Joins(phraseClicksJoin)
+	}
+
+	db = db.Where("a.event_id = ? AND a.status IN ?", r.event, filter.Statuses)
+	if filter.Text != "" {
+		db = db.Where("a.text LIKE ? ESCAPE '!'", "%"+escapeLike(filter.Text)+"%")
+	}
+	if filter.GroupID > 0 {
+		db = db.Where("a.group_id = ?", filter.GroupID)
+	}
+	if filter.OpenID != "" {
+		db = db.Where("a.open_id = ?", filter.OpenID)
+	}
+	if filter.Since > 0 {
+		db = db.Where("a.create_time >= ?", filter.Since)
+	}
+	if filter.Until > 0 {
+		db = db.Where("a.create_time < ?", filter.Until)
+	}
+	if filter.MinClicks > 0 {
+		db = db.Where("COALESCE(b.clicks, 0) >= ?", filter.MinClicks)
+	}
+	return db
+}
+
+func (r *gormPhrases) Count(filter PhraseFilter) (int64, error) {
+	var total int64
+	err := r.filter(filter).Count(&total).Error
+	return total, err
+}
+
+func (r *gormPhrases) List(filter PhraseFilter, limit, offset int) ([]PhraseWithClicks, error) {
+	column := phraseSortColumns[filter.Sort]
+	direction, operator := "desc", "<"
+	if !filter.Desc {
+		direction, operator = "asc", ">"
+	}
+
+	db := r.filter(filter)
+	// keyset pagination, ties of the sort column are broken by phrase_id
+	if filter.After != nil {
+		db = db.Where(fmt.Sprintf("(%s %s ? OR (%s = ? AND a.phrase_id %s ?))", column, operator, column, operator),
+			filter.After.Value, filter.After.Value, filter.After.PhraseID)
+	}
+	selects := "a.*"
+	if filter.NeedsClicks() {
+		selects = "a.*, COALESCE(b.clicks, 0) as clicks"
+	}
+
+	var phrases []PhraseWithClicks
+	err := db.Select(selects).
+		Order(fmt.Sprintf("%s %s, a.phrase_id %s", column, direction, direction)).
+		Limit(limit).
+		Offset(offset).
+		Find(&phrases).Error
+	return phrases, err
+}
+
+func (r *gormPhrases) ListByAuthor(openID string, limit, offset int) ([]PhraseWithClicks, int64, error) {
+	var total int64
+	if err := r.db.Table("phrase_models").Where("event_id = ? AND open_id = ?", r.event, openID).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var phrases []PhraseWithClicks
+	err := r.db.Raw("SELECT a.phrase_id, a.text, a.group_id, a.open_id, a.status, a.create_time, a.update_time, COALESCE(SUM(b.clicks), 0) as clicks FROM phrase_models as a LEFT JOIN all_phrase_clicks as b ON a.phrase_id = b.phrase_id WHERE a.event_id = ? AND a.open_id = ? GROUP BY a.phrase_id, a.text, a.group_id, a.open_id, a.status, a.create_time, a.update_time ORDER BY a.create_time desc LIMIT ? OFFSET ?", r.event, openID, limit, offset).
+		Scan(&phrases).Error
+	return phrases, total, err
+}
+
+func (r *gormPhrases) CountByStatus(status model.PhraseStatus) (int, error) {
+	var count int
+	err := r.db.Raw("Select count(*) from phrase_models where event_id = ? and status = ?", r.event, status).Find(&count).Error
+	return count, err
+}
+
+func (r *gormPhrases) Newest(status model.PhraseStatus, limit int) ([]model.PhraseModel, error) {
+	var phrases []model.PhraseModel
+	err := r.db.Table("phrase_models").
+		Where("event_id = ? AND status = ?", r.event, status).
+		Order("update_time desc").
+		Limit(limit).
+		Find(&phrases).Error
+	return phrases, err
+}
+
+func (r *gormPhrases) Random(status model.PhraseStatus, limit int) ([]model.PhraseModel, error) {
+	random := "RAND()"
+	if isSQLite(r.db) {
+		random = "RANDOM()"
+	}
+
+	var phrases []model.PhraseModel
+	err := r.db.Raw("SELECT * FROM phrase_models where event_id = ? and status = ? ORDER BY "+random+" LIMIT ?", r.event, status, limit).
+		Scan(&phrases).Error
+	return phrases, err
+}
+
+type gormClicks struct {
+	db    *gorm.DB
+	event int
+}
+
+func (r *gormClicks) Add(click model.PhraseClickModel) error {
+	return r.AddMany([]model.PhraseClickModel{click})
+}
+
+func (r *gormClicks) AddMany(clicks []model.PhraseClickModel) error {
+	if len(clicks) == 0 {
+		return nil
+	}
+	totals := make(map[int]int)
+	var phraseIDs []int
+	for i := range clicks {
+		clicks[i].EventID = r.event
+		if _, ok := totals[clicks[i].PhraseID]; !ok {
+			phraseIDs = append(phraseIDs, clicks[i].PhraseID)
+		}
+		totals[clicks[i].PhraseID] += clicks[i].Clicks
+	}
+	// the same order in all instances, concurrent requests don't deadlock on the totals
+	sort.Ints(phraseIDs)
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.CreateInBatches(clicks, 500).Error; err != nil {
+			return err
+		}
+		for _, phraseID := range phraseIDs {
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "event_id"}, {Name: "phrase_id"}},
+				DoUpdates: clause.Assignments(map[string]interface{}{"clicks": gorm.Expr("phrase_click_total_models.clicks + ?", totals[phraseID])}),
+			}).Create(&model.PhraseClickTotalModel{EventID: r.event, PhraseID: phraseID, Clicks: totals[phraseID]}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *gormClicks) Reset() (int64, error) {
+	var deleted int64
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		for _, table := range []interface{}{&model.PhraseClickModel{}, &model.PhraseClickRollupModel{}} {
+			result := tx.Where("event_id = ?", r.event).Delete(table)
+			if result.Error != nil {
+				return result.Error
+			}
+			deleted += result.RowsAffected
+		}
+		return tx.Where("event_id = ?", r.event).Delete(&model.PhraseClickTotalModel{}).Error
+	})
+	return deleted, err
+}
+
+func (r *gormClicks) Distributions(phraseIDs []int) (map[int][]GroupClicks, error) {
+	type phraseGroupClicks struct {
+		PhraseID int
+		GroupID  int
+		Clicks   int
+	}
+
+	distributions := make(map[int][]GroupClicks, len(phraseIDs))
+	if len(phraseIDs) == 0 {
+		return distributions, nil
+	}
+
+	var rows []phraseGroupClicks
+	if err := r.db.Table("all_phrase_clicks").
+		Select("phrase_id, group_id, SUM(clicks) as clicks").
+		Where("event_id = ? AND phrase_id IN ?", r.event, phraseIDs).
+		Group("phrase_id, group_id").
+		Order("clicks desc").
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		distributions[row.PhraseID] = append(distributions[row.PhraseID], GroupClicks{GroupID: row.GroupID, Clicks: row.Clicks})
+	}
+	return distributions, nil
+}
+
+func (r *gormClicks) UserGroups(openID string) ([]GroupClicks, error) {
+	var groups []GroupClicks
+	err := r.db.Table("all_phrase_clicks").
+		Select("group_id, SUM(clicks) as clicks").
+		Where("event_id = ? AND open_id = ?", r.event, openID).
+		Group("group_id").
+		Order("clicks desc").
+		Find(&groups).Error
+	return groups, err
+}
+
+func (r *gormClicks) UserPhrases(openID string, limit int) ([]UserPhraseClicks, error) {
+	var phrases []UserPhraseClicks
+	err := r.db.Raw("SELECT b.phrase_id, a.text, b.group_id, SUM(b.clicks) as clicks, MAX(b.click_time) as last_click_time FROM all_phrase_clicks as b LEFT JOIN phrase_models as a ON a.phrase_id = b.phrase_id WHERE b.event_id = ? AND b.open_id = ? GROUP BY b.phrase_id, a.text, b.group_id ORDER BY clicks desc LIMIT ?", r.event, openID, limit).
+		Scan(&phrases).Error
+	return phrases, err
+}
+
+type gormUsers struct {
+	db    *gorm.DB
+	event int
+}
+
+func (r *gormUsers) Get(openID string) (model.UserModel, bool, error) {
+	var user model.UserModel
+	res := r.db.Table("user_models").Where("event_id = ? AND open_id = ?", r.event, openID).Find(&user)
+	return user, res.RowsAffected > 0, res.Error
+}
+
+func (r *gormUsers) Upsert(user model.UserModel) error {
+	user.EventID = r.event
+	// users change their nickname, avatar and location over time
+	return r.db.Table("user_models").
+		Clauses(clause.OnConflict{UpdateAll: true}).
+		Create(&user).Error
+}
+
+func (r *gormUsers) Delete(openID, anonID string) error {
+	// a user is erased from all events at once
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("open_id = ?", openID).Delete(&model.UserModel{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Table("phrase_models").Where("open_id = ?", openID).Update("open_id", anonID).Error; err != nil {
+			return err
+		}
+		if err := tx.Table("phrase_click_models").Where("open_id = ?", openID).Update("open_id", anonID).Error; err != nil {
+			return err
+		}
+		if err := tx.Table("phrase_click_rollup_models").Where("open_id = ?", openID).Update("open_id", anonID).Error; err != nil {
+			return err
+		}
+		// notifications quote the user's phrases, they are dropped with their pending deliveries
+		notifications := tx.Table("notification_models").Select("id").Where("open_id = ?", openID)
+		if err := tx.Where("notification_id IN (?)", notifications).Delete(&model.NotificationDeliveryModel{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("open_id = ?", openID).Delete(&model.NotificationModel{}).Error
+	})
+}
+
+type gormStats struct {
+	db    *gorm.DB
+	event int
+}
+
+func (r *gormStats) SexCounts() ([]SexCount, error) {
+	var counts []SexCount
+	err := r.db.Table("user_models").
+		Select("sex, count(*) as count").
+		Where("event_id = ?", r.event).
+		Group("sex").
+		Find(&counts).Error
+	return counts, err
+}
+
+func (r *gormStats) TopProvinces(limit int) ([]ProvinceCount, error) {
+	var counts []ProvinceCount
+	err := r.db.Table("user_models").
+		Select("province, count(*) as count").
+		Where("event_id = ?", r.event).
+		Group("province").
+		Order("count desc, province desc").
+		Limit(limit).
+		Find(&counts).Error
+	return counts, err
+}
+
+func (r *gormStats) TotalClicks() (int, error) {
+	var total sql.NullInt64
+	err := r.db.Table("all_phrase_clicks").Select("sum(clicks)").Where("event_id = ?", r.event).Row().Scan(&total)
+	return int(total.Int64), err
+}
+
+func (r *gormStats) ClicksBefore(t int64) (int, error) {
+	var total sql.NullInt64
+	err := r.db.Raw("select sum(clicks) from all_phrase_clicks where event_id = ? and click_time < ?", r.event, t).Row().Scan(&total)
+	return int(total.Int64), err
+}
+
+func (r *gormStats) ClickTrends(since int64, interval int64) ([]TrendPoint, error) {
+	// clicks of the intervals up to since, the intervals end at multiples of interval
+	total, err := r.ClicksBefore(since - since%interval + 1)
+	if err != nil {
+		return nil, err
+	}
+
+	// the clicks of each later interval, rounding click_time up to the end of its interval with integer
+	// arithmetic both MySQL and SQLite do the same
+	var points []TrendPoint
+	if err := r.db.Raw("SELECT click_time + (@interval - click_time % @interval) % @interval as time, sum(clicks) as clicks FROM all_phrase_clicks WHERE event_id = @event AND click_time > @start GROUP BY click_time + (@interval - click_time % @interval) % @interval ORDER BY time",
+		sql.Named("interval", interval), sql.Named("event", r.event), sql.Named("start", since-since%interval)).
+		Scan(&points).Error; err != nil {
+		return nil, err
+	}
+
+	// running total
+	for i := range points {
+		total += points[i].Clicks
+		points[i].Clicks = total
+	}
+	return points, nil
+}
+
+func (r *gormStats) TopPhrases(limit int) ([]PhraseClicks, error) {
+	var phrases []PhraseClicks
+	err := r.db.Raw("SELECT sum(clicks) as clicks, a.phrase_id, a.text FROM phrase_models as a INNER JOIN all_phrase_clicks as b ON a.phrase_id = b.phrase_id and a.event_id = @event and a.status = @status group by a.phrase_id, a.text order by clicks desc, a.phrase_id limit @limit", sql.Named("event", r.event), sql.Named("status", model.StatusApproved), sql.Named("limit", limit)).
+		Scan(&phrases).Error
+	return phrases, err
+}
+
+type gormAudits struct {
+	db    *gorm.DB
+	event int
+}
+
+func (r *gormAudits) List(filter AuditFilter, limit, offset int) ([]model.PhraseAuditModel, int64, error) {
+	query := r.db.Model(&model.PhraseAuditModel{}).Where("phrase_id IN (?)", eventPhraseIDs(r.db, r.event))
+	if filter.Actor != "" {
+		query = query.Where("actor = ?", filter.Actor)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.PhraseID != 0 {
+		query = query.Where("phrase_id = ?", filter.PhraseID)
+	}
+	if filter.NewStatus != 0 {
+		query = query.Where("new_status = ?", filter.NewStatus)
+	}
+	if filter.Since != 0 {
+		query = query.Where("create_time >= ?", filter.Since)
+	}
+	if filter.Until != 0 {
+		query = query.Where("create_time < ?", filter.Until)
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var audits []model.PhraseAuditModel
+	err := query.Session(&gorm.Session{}).Order("create_time desc, id desc").Limit(limit).Offset(offset).Find(&audits).Error
+	return audits, total, err
+}
+
+func (r *gormAudits) ReviewerStats(since, until int64) ([]ReviewerStats, error) {
+	var stats []ReviewerStats
+	err := r.db.Raw("SELECT a.actor as reviewer, COUNT(*) as decisions, SUM(CASE WHEN a.new_status = @approved THEN 1 ELSE 0 END) as approvals, SUM(CASE WHEN a.new_status = @rejected THEN 1 ELSE 0 END) as rejections, SUM(CASE WHEN a.new_status NOT IN (@approved, @rejected) THEN 1 ELSE 0 END) as others, MIN(a.create_time) as first_decision_time, MAX(a.create_time) as last_decision_time, COALESCE(AVG(CASE WHEN a.new_status = @approved THEN a.create_time - b.create_time END), 0) as avg_time_to_approve FROM phrase_audit_models as a INNER JOIN phrase_models as b ON a.phrase_id = b.phrase_id WHERE b.event_id = @event AND a.old_status = @pending AND a.new_status <> @pending AND a.create_time >= @since AND a.create_time < @until GROUP BY a.actor ORDER BY decisions desc",
+		sql.Named("event", r.event), sql.Named("approved", model.StatusApproved), sql.Named("rejected", model.StatusRejected), sql.Named("pending", model.StatusPending), sql.Named("since", since), sql.Named("until", until)).
+		Scan(&stats).Error
+	return stats, err
+}
+
+type gormClaims struct {
+	db    *gorm.DB
+	event int
+}
+
+func (r *gormClaims) ReleaseExpired(now int64) error {
+	return r.db.Where("lease_until < ?", now).Delete(&model.PhraseClaimModel{}).Error
+}
+
+func (r *gormClaims) Claimable(reviewer string, now int64, limit int) ([]model.PhraseModel, error) {
+	var phrases []model.PhraseModel
+	err := r.db.Raw("SELECT a.* FROM phrase_models as a LEFT JOIN phrase_claim_models as b ON a.phrase_id = b.phrase_id WHERE a.event_id = ? AND a.status = ? AND (b.phrase_id IS NULL OR b.lease_until < ? OR b.reviewer = ?) ORDER BY b.reviewer = ? desc, a.create_time LIMIT ?", r.event, model.StatusPending, now, reviewer, reviewer, limit).
+		Scan(&phrases).Error
+	return phrases, err
+}
+
+func (r *gormClaims) Claim(phraseID int, reviewer string, now, leaseUntil int64) (bool, error) {
+	// the claims have no event, the phrase is checked to be in the event
+	var phrases int64
+	if err := r.db.Table("phrase_models").Where("event_id = ? AND phrase_id = ?", r.event, phraseID).Count(&phrases).Error; err != nil {
+		return false, err
+	}
+	if phrases == 0 {
+		return false, nil
+	}
+
+	res := r.db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&model.PhraseClaimModel{PhraseID: phraseID, Reviewer: reviewer, ClaimTime: now, LeaseUntil: leaseUntil})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	if res.RowsAffected > 0 {
+		return true, nil
+	}
+
+	// the phrase was claimed before, take it over if the lease expired or renew our own lease
+	res = r.db.Model(&model.PhraseClaimModel{}).
+		Where("phrase_id = ? AND (lease_until < ? OR reviewer = ?)", phraseID, now, reviewer).
+		Updates(map[string]interface{}{"reviewer": reviewer, "claim_time": now, "lease_until": leaseUntil})
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *gormClaims) Held(ids []int, reviewer string, now int64) ([]int, error) {
+	var phraseIDs []int
+	err := r.db.Model(&model.PhraseClaimModel{}).
+		Where("phrase_id IN ? AND reviewer = ? AND lease_until >= ?", ids, reviewer, now).
+		Where("phrase_id IN (?)", eventPhraseIDs(r.db, r.event)).
+		Pluck("phrase_id", &phraseIDs).Error
+	return phraseIDs, err
+}
+
+func (r *gormClaims) Release(reviewer string, ids []int) error {
+	query := r.db.Where("reviewer = ? AND phrase_id IN (?)", reviewer, eventPhraseIDs(r.db, r.event))
+	if len(ids) > 0 {
+		query = query.Where("phrase_id IN ?", ids)
+	}
+	return query.Delete(&model.PhraseClaimModel{}).Error
+}
+
+type gormNotifications struct {
+	db    *gorm.DB
+	event int
+}
+
+func (r *gormNotifications) List(openID string, unreadOnly bool, limit, offset int) ([]model.NotificationModel, int64, error) {
+	query := r.db.Model(&model.NotificationModel{}).Where("event_id = ? AND open_id = ?", r.event, openID)
+	if unreadOnly {
+		query = query.Where("is_read = ?", false)
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var notifications []model.NotificationModel
+	err := query.Session(&gorm.Session{}).Order("create_time desc, id desc").Limit(limit).Offset(offset).Find(&notifications).Error
+	return notifications, total, err
+}
+
+func (r *gormNotifications) Unread(openID string) (int, error) {
+	var unread int64
+	err := r.db.Model(&model.NotificationModel{}).
+		Where("event_id = ? AND open_id = ? AND is_read = ?", r.event, openID, false).
+		Count(&unread).Error
+	return int(unread), err
+}
+
+func (r *gormNotifications) MarkRead(openID string, ids []int) error {
+	query := r.db.Model(&model.NotificationModel{}).Where("event_id = ? AND open_id = ? AND is_read = ?", r.event, openID, false)
+	if len(ids) > 0 {
+		query = query.Where("id IN ?", ids)
+	}
+	return query.Update("is_read", true).Error
+}
+
+type gormEvents struct {
+	db *gorm.DB
+}
+
+func (r *gormEvents) Get(id int) (model.EventModel, bool, error) {
+	var event model.EventModel
+	res := r.db.Where("event_id = ?", id).Limit(1).Find(&event)
+	return event, res.RowsAffected > 0, res.Error
+}
+
+func (r *gormEvents) GetBySlug(slug string) (model.EventModel, bool, error) {
+	var event model.EventModel
+	res := r.db.Where("slug = ?", slug).Limit(1).Find(&event)
+	return event, res.RowsAffected > 0, res.Error
+}
+
+func (r *gormEvents) List() ([]model.EventModel, error) {
+	var events []model.EventModel
+	err := r.db.Order("event_id").Find(&events).Error
+	return events, err
+}
+
+func (r *gormEvents) Create(event *model.EventModel) error {
+	if err := r.db.Create(event).Error; err != nil {
+		if isDuplicate(err) {
+			return ErrDuplicate
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *gormEvents) Update(event model.EventModel) error {
+	return r.db.Model(&model.EventModel{}).
+		Where("event_id = ?", event.EventID).
+		Updates(map[string]interface{}{"name": event.Name, "settings": event.Settings, "update_time": event.UpdateTime}).Error
+}
+
+type gormProfiles struct {
+	db *gorm.DB
+}
+
+func (r *gormProfiles) List() ([]model.DisplayProfileModel, error) {
+	var profiles []model.DisplayProfileModel
+	err := r.db.Order("name").Find(&profiles).Error
+	return profiles, err
+}
+
+func (r *gormProfiles) Save(profile model.DisplayProfileModel) error {
+	return r.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&profile).Error
+}
+
+func (r *gormProfiles) Delete(name string) (bool, error) {
+	res := r.db.Where("name = ?", name).Delete(&model.DisplayProfileModel{})
+	return res.RowsAffected > 0, res.Error
+}
@@ -0,0 +1,1015 @@
+package store
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/YiniXu9506/devconG/model"
+)
+
+// memory holds the tables of the in-memory store
+type memory struct {
+	mu            sync.RWMutex
+	phrases       map[int]model.PhraseModel
+	clicks        []model.PhraseClickModel
+	users         map[userKey]model.UserModel
+	audits        []model.PhraseAuditModel
+	claims        map[int]model.PhraseClaimModel
+	notifications []model.NotificationModel
+	events        map[int]model.EventModel
+	profiles      map[string]model.DisplayProfileModel
+	nextID        int
+	nextClick     int
+	nextAudit     int
+	nextEvent     int
+}
+
+// userKey is the primary key of a user, a user has a profile per event
+type userKey struct {
+	event  int
+	openID string
+}
+
+// NewMemory stores in memory, for tests and trying the service out without a database,
+// it is the store of the default event
+func NewMemory() Store {
+	m := &memory{
+		phrases:  make(map[int]model.PhraseModel),
+		users:    make(map[userKey]model.UserModel),
+		claims:   make(map[int]model.PhraseClaimModel),
+		events:   make(map[int]model.EventModel),
+		profiles: make(map[string]model.DisplayProfileModel),
+	}
+	// the default event is created by the migrations in a database
+	m.nextEvent = model.DefaultEventID
+	m.events[model.DefaultEventID] = model.EventModel{EventID: model.DefaultEventID, Slug: model.DefaultEventSlug, Name: "Default", Settings: "{}"}
+	return m.store(model.DefaultEventID)
+}
+
+func (m *memory) store(event int) Store {
+	return Store{
+		Phrases:       &memoryPhrases{m, event},
+		Clicks:        &memoryClicks{m, event},
+		Users:         &memoryUsers{m, event},
+		Stats:         &memoryStats{m, event},
+		Audits:        &memoryAudits{m, event},
+		Claims:        &memoryClaims{m, event},
+		Notifications: &memoryNotifications{m, event},
+		Events:        &memoryEvents{m},
+		Profiles:      &memoryProfiles{m},
+		ping: func(ctx context.Context) error {
+			return nil
+		},
+		scope: m.store,
+	}
+}
+
+// inEvent reports whether the phrase of the id is in the event, callers hold the lock
+func (m *memory) inEvent(phraseID, event int) bool {
+	phrase, ok := m.phrases[phraseID]
+	return ok && phrase.EventID == event
+}
+
+// phraseClicks sums the clicks of each phrase of the event, callers hold the lock
+func (m *memory) phraseClicks(event int) map[int]int {
+	clicks := make(map[int]int)
+	for _, click := range m.clicks {
+		if click.EventID == event {
+			clicks[click.PhraseID] += click.Clicks
+		}
+	}
+	return clicks
+}
+
+// audit appends an audit record, callers hold the write lock
+func (m *memory) audit(audit model.PhraseAuditModel) {
+	m.nextAudit++
+	audit.ID = m.nextAudit
+	m.audits = append(m.audits, audit)
+}
+
+// sortedPhrases lists the phrases of the event matching keep in the order of less, callers hold the lock
+func (m *memory) sortedPhrases(event int, keep func(model.PhraseModel) bool, less func(a, b model.PhraseModel) bool) []model.PhraseModel {
+	var phrases []model.PhraseModel
+	for _, phrase := range m.phrases {
+		if phrase.EventID == event && keep(phrase) {
+			phrases = append(phrases, phrase)
+		}
+	}
+	sort.Slice(phrases, func(i, j int) bool {
+		return less(phrases[i], phrases[j])
+	})
+	return phrases
+}
+
+// page cuts a page of n items out of a list
+func page(n, limit, offset int) (int, int) {
+	if offset > n {
+		offset = n
+	}
+	end := n
+	if limit >= 0 && offset+limit < n {
+		end = offset + limit
+	}
+	return offset, end
+}
+
+type memoryPhrases struct {
+	*memory
+	event int
+}
+
+// phrase returns the phrase of the id if it is in the event, callers hold the lock
+func (r *memoryPhrases) phrase(id int) (model.PhraseModel, bool) {
+	phrase, ok := r.phrases[id]
+	return phrase, ok && phrase.EventID == r.event
+}
+
+func (r *memoryPhrases) Get(id int) (model.PhraseModel, bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	phrase, ok := r.phrase(id)
+	return phrase, ok, nil
+}
+
+func (r *memoryPhrases) GetMany(ids []int) ([]model.PhraseModel, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var phrases []model.PhraseModel
+	for _, id := range ids {
+		if phrase, ok := r.phrase(id); ok {
+			phrases = append(phrases, phrase)
+		}
+	}
+	return phrases, nil
+}
+
+func (r *memoryPhrases) Create(phrase *model.PhraseModel) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.phrases {
+		if existing.EventID == r.event && existing.Text == phrase.Text {
+			return ErrDuplicate
+		}
+	}
+	phrase.EventID = r.event
+	r.nextID++
+	phrase.PhraseID = r.nextID
+	r.phrases[phrase.PhraseID] = *phrase
+	return nil
+}
+
+func (r *memoryPhrases) Update(phrase model.PhraseModel, audit model.PhraseAuditModel) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.phrase(phrase.PhraseID)
+	if !ok {
+		return nil
+	}
+	for _, other := range r.phrases {
+		if other.EventID == r.event && other.PhraseID != phrase.PhraseID && other.Text == phrase.Text {
+			return ErrDuplicate
+		}
+	}
+	existing.Text = phrase.Text
+	existing.Status = phrase.Status
+	existing.UpdateTime = phrase.UpdateTime
+	r.phrases[phrase.PhraseID] = existing
+	r.audit(audit)
+	return nil
+}
+
+func (r *memoryPhrases) Transition(ids []int, fromStatus, toStatus model.PhraseStatus, updateTime int64, audit AuditFunc) ([]model.PhraseModel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var phrases []model.PhraseModel
+	seen := make(map[int]bool)
+	for _, id := range ids {
+		old, ok := r.phrase(id)
+		if !ok || seen[id] || old.Status != fromStatus {
+			continue
+		}
+		seen[id] = true
+
+		phrase := old
+		phrase.Status = toStatus
+		phrase.UpdateTime = updateTime
+		r.phrases[id] = phrase
+		r.audit(audit(old, phrase))
+		phrases = append(phrases, phrase)
+	}
+	return phrases, nil
+}
+
+func (r *memoryPhrases) History(id int) ([]model.PhraseAuditModel, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var history []model.PhraseAuditModel
+	if _, ok := r.phrase(id); !ok {
+		return history, nil
+	}
+	for _, audit := range r.audits {
+		if audit.PhraseID == id {
+			history = append(history, audit)
+		}
+	}
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].CreateTime < history[j].CreateTime
+	})
+	return history, nil
+}
+
+func (r *memoryPhrases) LastChange(id int, status model.PhraseStatus) (model.PhraseAuditModel, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, ok := r.phrase(id); !ok {
+		return model.PhraseAuditModel{}, nil
+	}
+	for i := len(r.audits) - 1; i >= 0; i-- {
+		if r.audits[i].PhraseID == id && r.audits[i].NewStatus == status {
+			return r.audits[i], nil
+		}
+	}
+	return model.PhraseAuditModel{}, nil
+}
+
+// filter lists the phrases of the filter in its order with their clicks, callers hold the lock
+func (r *memoryPhrases) filter(filter PhraseFilter) []PhraseWithClicks {
+	clicks := r.phraseClicks(r.event)
+	statuses := make(map[model.PhraseStatus]bool)
+	for _, status := range filter.Statuses {
+		statuses[status] = true
+	}
+
+	var phrases []PhraseWithClicks
+	for _, phrase := range r.phrases {
+		switch {
+		case phrase.EventID != r.event,
+			!statuses[phrase.Status],
+			filter.Text != "" && !strings.Contains(phrase.Text, filter.Text),
+			filter.GroupID > 0 && phrase.GroupID != filter.GroupID,
+			filter.OpenID != "" && phrase.OpenID != filter.OpenID,
+			filter.Since > 0 && phrase.CreateTime < filter.Since,
+			filter.Until > 0 && phrase.CreateTime >= filter.Until,
+			clicks[phrase.PhraseID] < filter.MinClicks:
+			continue
+		}
+		phrases = append(phrases, PhraseWithClicks{PhraseModel: phrase, Clicks: clicks[phrase.PhraseID]})
+	}
+
+	key := func(phrase PhraseWithClicks) PhraseKey {
+		switch filter.Sort {
+		case SortClicks:
+			return PhraseKey{Value: int64(phrase.Clicks), PhraseID: phrase.PhraseID}
+		case SortUpdateTime:
+			return PhraseKey{Value: phrase.UpdateTime, PhraseID: phrase.PhraseID}
+		}
+		return PhraseKey{Value: phrase.CreateTime, PhraseID: phrase.PhraseID}
+	}
+	// before reports whether a comes first in the order of the filter
+	before := func(a, b PhraseKey) bool {
+		if a.Value != b.Value {
+			return (a.Value < b.Value) != filter.Desc
+		}
+		if a.PhraseID != b.PhraseID {
+			return (a.PhraseID < b.PhraseID) != filter.Desc
+		}
+		return false
+	}
+
+	sort.Slice(phrases, func(i, j int) bool {
+		return before(key(phrases[i]), key(phrases[j]))
+	})
+
+	if filter.After != nil {
+		i := sort.Search(len(phrases), func(i int) bool {
+			return before(*filter.After, key(phrases[i]))
+		})
+		phrases = phrases[i:]
+	}
+	return phrases
+}
+
+func (r *memoryPhrases) Count(filter PhraseFilter) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	filter.After = nil
+	return int64(len(r.filter(filter))), nil
+}
+
+func (r *memoryPhrases) List(filter PhraseFilter, limit, offset int) ([]PhraseWithClicks, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	phrases := r.filter(filter)
+	start, end := page(len(phrases), limit, offset)
+	return phrases[start:end], nil
+}
+
+func (r *memoryPhrases) ListByAuthor(openID string, limit, offset int) ([]PhraseWithClicks, int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	clicks := r.phraseClicks(r.event)
+	phrases := r.sortedPhrases(r.event, func(phrase model.PhraseModel) bool {
+		return phrase.OpenID == openID
+	}, func(a, b model.PhraseModel) bool {
+		return a.CreateTime > b.CreateTime
+	})
+
+	start, end := page(len(phrases), limit, offset)
+	list := make([]PhraseWithClicks, 0, end-start)
+	for _, phrase := range phrases[start:end] {
+		list = append(list, PhraseWithClicks{PhraseModel: phrase, Clicks: clicks[phrase.PhraseID]})
+	}
+	return list, int64(len(phrases)), nil
+}
+
+func (r *memoryPhrases) CountByStatus(status model.PhraseStatus) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	count := 0
+	for _, phrase := range r.phrases {
+		if phrase.EventID == r.event && phrase.Status == status {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *memoryPhrases) Newest(status model.PhraseStatus, limit int) ([]model.PhraseModel, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	phrases := r.sortedPhrases(r.event, func(phrase model.PhraseModel) bool {
+		return phrase.Status == status
+	}, func(a, b model.PhraseModel) bool {
+		return a.UpdateTime > b.UpdateTime
+	})
+	_, end := page(len(phrases), limit, 0)
+	return phrases[:end], nil
+}
+
+func (r *memoryPhrases) Random(status model.PhraseStatus, limit int) ([]model.PhraseModel, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var phrases []model.PhraseModel
+	for _, phrase := range r.phrases {
+		if phrase.EventID == r.event && phrase.Status == status {
+			phrases = append(phrases, phrase)
+		}
+	}
+	rand.Shuffle(len(phrases), func(i, j int) {
+		phrases[i], phrases[j] = phrases[j], phrases[i]
+	})
+	_, end := page(len(phrases), limit, 0)
+	return phrases[:end], nil
+}
+
+type memoryClicks struct {
+	*memory
+	event int
+}
+
+func (r *memoryClicks) Add(click model.PhraseClickModel) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	click.EventID = r.event
+	r.nextClick++
+	click.ID = r.nextClick
+	r.clicks = append(r.clicks, click)
+	return nil
+}
+
+func (r *memoryClicks) AddMany(clicks []model.PhraseClickModel) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, click := range clicks {
+		click.EventID = r.event
+		r.nextClick++
+		click.ID = r.nextClick
+		r.clicks = append(r.clicks, click)
+	}
+	return nil
+}
+
+func (r *memoryClicks) Reset() (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var kept []model.PhraseClickModel
+	for _, click := range r.clicks {
+		if click.EventID != r.event {
+			kept = append(kept, click)
+		}
+	}
+	deleted := int64(len(r.clicks) - len(kept))
+	r.clicks = kept
+	return deleted, nil
+}
+
+// groupClicks sums clicks by group, most clicks first
+func groupClicks(clicks map[int]int) []GroupClicks {
+	groups := make([]GroupClicks, 0, len(clicks))
+	for groupID, count := range clicks {
+		groups = append(groups, GroupClicks{GroupID: groupID, Clicks: count})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Clicks != groups[j].Clicks {
+			return groups[i].Clicks > groups[j].Clicks
+		}
+		return groups[i].GroupID < groups[j].GroupID
+	})
+	return groups
+}
+
+func (r *memoryClicks) Distributions(phraseIDs []int) (map[int][]GroupClicks, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	byPhrase := make(map[int]map[int]int, len(phraseIDs))
+	for _, id := range phraseIDs {
+		byPhrase[id] = make(map[int]int)
+	}
+	for _, click := range r.clicks {
+		if groups, ok := byPhrase[click.PhraseID]; ok && click.EventID == r.event {
+			groups[click.GroupID] += click.Clicks
+		}
+	}
+
+	distributions := make(map[int][]GroupClicks, len(phraseIDs))
+	for id, groups := range byPhrase {
+		if len(groups) > 0 {
+			distributions[id] = groupClicks(groups)
+		}
+	}
+	return distributions, nil
+}
+
+func (r *memoryClicks) UserGroups(openID string) ([]GroupClicks, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	groups := make(map[int]int)
+	for _, click := range r.clicks {
+		if click.EventID == r.event && click.OpenID == openID {
+			groups[click.GroupID] += click.Clicks
+		}
+	}
+	return groupClicks(groups), nil
+}
+
+func (r *memoryClicks) UserPhrases(openID string, limit int) ([]UserPhraseClicks, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	type phraseGroup struct {
+		phraseID int
+		groupID  int
+	}
+
+	byPhraseGroup := make(map[phraseGroup]*UserPhraseClicks)
+	var phrases []*UserPhraseClicks
+	for _, click := range r.clicks {
+		if click.EventID != r.event || click.OpenID != openID {
+			continue
+		}
+		key := phraseGroup{click.PhraseID, click.GroupID}
+		item, ok := byPhraseGroup[key]
+		if !ok {
+			item = &UserPhraseClicks{PhraseID: click.PhraseID, Text: r.phrases[click.PhraseID].Text, GroupID: click.GroupID}
+			byPhraseGroup[key] = item
+			phrases = append(phrases, item)
+		}
+		item.Clicks += click.Clicks
+		if click.ClickTime > item.LastClickTime {
+			item.LastClickTime = click.ClickTime
+		}
+	}
+
+	sort.SliceStable(phrases, func(i, j int) bool {
+		return phrases[i].Clicks > phrases[j].Clicks
+	})
+	_, end := page(len(phrases), limit, 0)
+
+	list := make([]UserPhraseClicks, 0, end)
+	for _, item := range phrases[:end] {
+		list = append(list, *item)
+	}
+	return list, nil
+}
+
+type memoryUsers struct {
+	*memory
+	event int
+}
+
+func (r *memoryUsers) Get(openID string) (model.UserModel, bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[userKey{r.event, openID}]
+	return user, ok, nil
+}
+
+func (r *memoryUsers) Upsert(user model.UserModel) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user.EventID = r.event
+	r.users[userKey{r.event, user.OpenID}] = user
+	return nil
+}
+
+func (r *memoryUsers) Delete(openID, anonID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// a user is erased from all events at once
+	for key := range r.users {
+		if key.openID == openID {
+			delete(r.users, key)
+		}
+	}
+	for id, phrase := range r.phrases {
+		if phrase.OpenID == openID {
+			phrase.OpenID = anonID
+			r.phrases[id] = phrase
+		}
+	}
+	for i := range r.clicks {
+		if r.clicks[i].OpenID == openID {
+			r.clicks[i].OpenID = anonID
+		}
+	}
+	notifications := r.notifications[:0]
+	for _, notification := range r.notifications {
+		if notification.OpenID != openID {
+			notifications = append(notifications, notification)
+		}
+	}
+	r.notifications = notifications
+	return nil
+}
+
+type memoryStats struct {
+	*memory
+	event int
+}
+
+func (r *memoryStats) SexCounts() ([]SexCount, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	bySex := make(map[int]int)
+	for _, user := range r.users {
+		if user.EventID == r.event {
+			bySex[user.Sex]++
+		}
+	}
+	counts := make([]SexCount, 0, len(bySex))
+	for sex, count := range bySex {
+		counts = append(counts, SexCount{Sex: sex, Count: count})
+	}
+	return counts, nil
+}
+
+func (r *memoryStats) TopProvinces(limit int) ([]ProvinceCount, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	byProvince := make(map[string]int)
+	for _, user := range r.users {
+		if user.EventID == r.event {
+			byProvince[user.Province]++
+		}
+	}
+	counts := make([]ProvinceCount, 0, len(byProvince))
+	for province, count := range byProvince {
+		counts = append(counts, ProvinceCount{Province: province, Count: count})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Province > counts[j].Province
+	})
+	_, end := page(len(counts), limit, 0)
+	return counts[:end], nil
+}
+
+func (r *memoryStats) TotalClicks() (int, error) {
+	return r.ClicksBefore(math.MaxInt64)
+}
+
+func (r *memoryStats) ClicksBefore(t int64) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	total := 0
+	for _, click := range r.clicks {
+		if click.EventID == r.event && click.ClickTime < t {
+			total += click.Clicks
+		}
+	}
+	return total, nil
+}
+
+func (r *memoryStats) ClickTrends(since int64, interval int64) ([]TrendPoint, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// clicks by the end of their interval
+	byTime := make(map[int64]int)
+	for _, click := range r.clicks {
+		if click.EventID != r.event {
+			continue
+		}
+		end := (click.ClickTime + interval - 1) / interval * interval
+		byTime[end] += click.Clicks
+	}
+	times := make([]int64, 0, len(byTime))
+	for t := range byTime {
+		times = append(times, t)
+	}
+	sort.Slice(times, func(i, j int) bool {
+		return times[i] < times[j]
+	})
+
+	var points []TrendPoint
+	total := 0
+	for _, t := range times {
+		total += byTime[t]
+		if t > since {
+			points = append(points, TrendPoint{Time: t, Clicks: total})
+		}
+	}
+	return points, nil
+}
+
+func (r *memoryStats) TopPhrases(limit int) ([]PhraseClicks, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var phrases []PhraseClicks
+	for id, clicks := range r.phraseClicks(r.event) {
+		if phrase, ok := r.phrases[id]; ok && phrase.Status == model.StatusApproved {
+			phrases = append(phrases, PhraseClicks{PhraseID: id, Text: phrase.Text, Clicks: clicks})
+		}
+	}
+	sort.Slice(phrases, func(i, j int) bool {
+		if phrases[i].Clicks != phrases[j].Clicks {
+			return phrases[i].Clicks > phrases[j].Clicks
+		}
+		return phrases[i].PhraseID < phrases[j].PhraseID
+	})
+	_, end := page(len(phrases), limit, 0)
+	return phrases[:end], nil
+}
+
+type memoryAudits struct {
+	*memory
+	event int
+}
+
+func (r *memoryAudits) List(filter AuditFilter, limit, offset int) ([]model.PhraseAuditModel, int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var audits []model.PhraseAuditModel
+	for _, audit := range r.audits {
+		if !r.inEvent(audit.PhraseID, r.event) ||
+			filter.Actor != "" && audit.Actor != filter.Actor ||
+			filter.Action != "" && audit.Action != filter.Action ||
+			filter.PhraseID != 0 && audit.PhraseID != filter.PhraseID ||
+			filter.NewStatus != 0 && audit.NewStatus != filter.NewStatus ||
+			filter.Since != 0 && audit.CreateTime < filter.Since ||
+			filter.Until != 0 && audit.CreateTime >= filter.Until {
+			continue
+		}
+		audits = append(audits, audit)
+	}
+	sort.Slice(audits, func(i, j int) bool {
+		if audits[i].CreateTime != audits[j].CreateTime {
+			return audits[i].CreateTime > audits[j].CreateTime
+		}
+		return audits[i].ID > audits[j].ID
+	})
+
+	start, end := page(len(audits), limit, offset)
+	return audits[start:end], int64(len(audits)), nil
+}
+
+func (r *memoryAudits) ReviewerStats(since, until int64) ([]ReviewerStats, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	byReviewer := make(map[string]*ReviewerStats)
+	var stats []*ReviewerStats
+	timeToApprove := make(map[string]int64)
+	for _, audit := range r.audits {
+		phrase, ok := r.phrases[audit.PhraseID]
+		if !ok || phrase.EventID != r.event || audit.OldStatus != model.StatusPending || audit.NewStatus == model.StatusPending ||
+			audit.CreateTime < since || audit.CreateTime >= until {
+			continue
+		}
+
+		reviewer, ok := byReviewer[audit.Actor]
+		if !ok {
+			reviewer = &ReviewerStats{Reviewer: audit.Actor, FirstDecisionTime: audit.CreateTime, LastDecisionTime: audit.CreateTime}
+			byReviewer[audit.Actor] = reviewer
+			stats = append(stats, reviewer)
+		}
+		reviewer.Decisions++
+		switch audit.NewStatus {
+		case model.StatusApproved:
+			reviewer.Approvals++
+			timeToApprove[audit.Actor] += audit.CreateTime - phrase.CreateTime
+		case model.StatusRejected:
+			reviewer.Rejections++
+		default:
+			reviewer.Others++
+		}
+		if audit.CreateTime < reviewer.FirstDecisionTime {
+			reviewer.FirstDecisionTime = audit.CreateTime
+		}
+		if audit.CreateTime > reviewer.LastDecisionTime {
+			reviewer.LastDecisionTime = audit.CreateTime
+		}
+	}
+
+	sort.SliceStable(stats, func(i, j int) bool {
+		return stats[i].Decisions > stats[j].Decisions
+	})
+	list := make([]ReviewerStats, 0, len(stats))
+	for _, reviewer := range stats {
+		if reviewer.Approvals > 0 {
+			reviewer.AvgTimeToApprove = float64(timeToApprove[reviewer.Reviewer]) / float64(reviewer.Approvals)
+		}
+		list = append(list, *reviewer)
+	}
+	return list, nil
+}
+
+type memoryClaims struct {
+	*memory
+	event int
+}
+
+func (r *memoryClaims) ReleaseExpired(now int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, claim := range r.claims {
+		if claim.LeaseUntil < now {
+			delete(r.claims, id)
+		}
+	}
+	return nil
+}
+
+func (r *memoryClaims) Claimable(reviewer string, now int64, limit int) ([]model.PhraseModel, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	own := func(phrase model.PhraseModel) bool {
+		claim, ok := r.claims[phrase.PhraseID]
+		return ok && claim.Reviewer == reviewer
+	}
+	phrases := r.sortedPhrases(r.event, func(phrase model.PhraseModel) bool {
+		claim, ok := r.claims[phrase.PhraseID]
+		return phrase.Status == model.StatusPending && (!ok || claim.LeaseUntil < now || claim.Reviewer == reviewer)
+	}, func(a, b model.PhraseModel) bool {
+		if own(a) != own(b) {
+			return own(a)
+		}
+		if a.CreateTime != b.CreateTime {
+			return a.CreateTime < b.CreateTime
+		}
+		return a.PhraseID < b.PhraseID
+	})
+
+	_, end := page(len(phrases), limit, 0)
+	return phrases[:end], nil
+}
+
+func (r *memoryClaims) Claim(phraseID int, reviewer string, now, leaseUntil int64) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.inEvent(phraseID, r.event) {
+		return false, nil
+	}
+	if claim, ok := r.claims[phraseID]; ok && claim.LeaseUntil >= now && claim.Reviewer != reviewer {
+		return false, nil
+	}
+	r.claims[phraseID] = model.PhraseClaimModel{PhraseID: phraseID, Reviewer: reviewer, ClaimTime: now, LeaseUntil: leaseUntil}
+	return true, nil
+}
+
+func (r *memoryClaims) Held(ids []int, reviewer string, now int64) ([]int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var held []int
+	seen := make(map[int]bool)
+	for _, id := range ids {
+		claim, ok := r.claims[id]
+		if !ok || seen[id] || claim.Reviewer != reviewer || claim.LeaseUntil < now || !r.inEvent(id, r.event) {
+			continue
+		}
+		seen[id] = true
+		held = append(held, id)
+	}
+	return held, nil
+}
+
+func (r *memoryClaims) Release(reviewer string, ids []int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	release := make(map[int]bool)
+	for _, id := range ids {
+		release[id] = true
+	}
+	for id, claim := range r.claims {
+		if claim.Reviewer == reviewer && r.inEvent(id, r.event) && (len(ids) == 0 || release[id]) {
+			delete(r.claims, id)
+		}
+	}
+	return nil
+}
+
+type memoryNotifications struct {
+	*memory
+	event int
+}
+
+func (r *memoryNotifications) List(openID string, unreadOnly bool, limit, offset int) ([]model.NotificationModel, int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var notifications []model.NotificationModel
+	for _, notification := range r.notifications {
+		if notification.EventID == r.event && notification.OpenID == openID && !(unreadOnly && notification.IsRead) {
+			notifications = append(notifications, notification)
+		}
+	}
+	sort.Slice(notifications, func(i, j int) bool {
+		if notifications[i].CreateTime != notifications[j].CreateTime {
+			return notifications[i].CreateTime > notifications[j].CreateTime
+		}
+		return notifications[i].ID > notifications[j].ID
+	})
+
+	start, end := page(len(notifications), limit, offset)
+	return notifications[start:end], int64(len(notifications)), nil
+}
+
+func (r *memoryNotifications) Unread(openID string) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	unread := 0
+	for _, notification := range r.notifications {
+		if notification.EventID == r.event && notification.OpenID == openID && !notification.IsRead {
+			unread++
+		}
+	}
+	return unread, nil
+}
+
+func (r *memoryNotifications) MarkRead(openID string, ids []int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	read := make(map[int]bool)
+	for _, id := range ids {
+		read[id] = true
+	}
+	for i, notification := range r.notifications {
+		if notification.EventID == r.event && notification.OpenID == openID && (len(ids) == 0 || read[notification.ID]) {
+			r.notifications[i].IsRead = true
+		}
+	}
+	return nil
+}
+
+type memoryEvents struct {
+	*memory
+}
+
+func (r *memoryEvents) Get(id int) (model.EventModel, bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	event, ok := r.events[id]
+	return event, ok, nil
+}
+
+func (r *memoryEvents) GetBySlug(slug string) (model.EventModel, bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, event := range r.events {
+		if event.Slug == slug {
+			return event, true, nil
+		}
+	}
+	return model.EventModel{}, false, nil
+}
+
+func (r *memoryEvents) List() ([]model.EventModel, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	events := make([]model.EventModel, 0, len(r.events))
+	for _, event := range r.events {
+		events = append(events, event)
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].EventID < events[j].EventID
+	})
+	return events, nil
+}
+
+func (r *memoryEvents) Create(event *model.EventModel) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.events {
+		if existing.Slug == event.Slug {
+			return ErrDuplicate
+		}
+	}
+	r.nextEvent++
+	event.EventID = r.nextEvent
+	r.events[event.EventID] = *event
+	return nil
+}
+
+func (r *memoryEvents) Update(event model.EventModel) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.events[event.EventID]
+	if !ok {
+		return nil
+	}
+	existing.Name = event.Name
+	existing.Settings = event.Settings
+	existing.UpdateTime = event.UpdateTime
+	r.events[event.EventID] = existing
+	return nil
+}
+
+type memoryProfiles struct {
+	*memory
+}
+
+func (r *memoryProfiles) List() ([]model.DisplayProfileModel, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	profiles := make([]model.DisplayProfileModel, 0, len(r.profiles))
+	for _, profile := range r.profiles {
+		profiles = append(profiles, profile)
+	}
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].Name < profiles[j].Name
+	})
+	return profiles, nil
+}
+
+func (r *memoryProfiles) Save(profile model.DisplayProfileModel) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.profiles[profile.Name] = profile
+	return nil
+}
+
+func (r *memoryProfiles) Delete(name string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, ok := r.profiles[name]
+	delete(r.profiles, name)
+	return ok, nil
+}
@@ -0,0 +1,264 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/YiniXu9506/devconG/model"
+)
+
+// ErrDuplicate is returned when a phrase with the same text already exists
+var ErrDuplicate = errors.New("an existing item already exists")
+
+// orders of the phrase list
+const (
+	SortClicks     = "clicks"
+	SortCreateTime = "create_time"
+	SortUpdateTime = "update_time"
+)
+
+// PhraseSorts are the orders PhraseRepo.List supports
+var PhraseSorts = []string{SortClicks, SortCreateTime, SortUpdateTime}
+
+// Store bundles the repositories handlers and providers read and write through,
+// they see the phrases, clicks, users, audit records, claims and notifications of one event
+type Store struct {
+	Phrases       PhraseRepo
+	Clicks        ClickRepo
+	Users         UserRepo
+	Stats         StatsRepo
+	Audits        AuditRepo
+	Claims        ClaimRepo
+	Notifications NotificationRepo
+	// events and display profiles are shared by all events
+	Events   EventRepo
+	Profiles ProfileRepo
+
+	ping func(ctx context.Context) error
+	// scope makes the store of another event on the same tables
+	scope func(eventID int) Store
+}
+
+// Event is the store of the event on the same tables
+func (s Store) Event(eventID int) Store {
+	return s.scope(eventID)
+}
+
+// Ping checks the database answers
+func (s Store) Ping(ctx context.Context) error {
+	return s.ping(ctx)
+}
+
+// PhraseKey is the position of a phrase in the phrase list, the value of the sort column and the phrase id
+type PhraseKey struct {
+	Value    int64
+	PhraseID int
+}
+
+// PhraseFilter holds the filters and the order of the phrase list
+type PhraseFilter struct {
+	Statuses []model.PhraseStatus
+	// phrases whose text contains it
+	Text      string
+	GroupID   int
+	OpenID    string
+	Since     int64
+	Until     int64
+	MinClicks int
+	Sort      string
+	Desc      bool
+	// list phrases after this position, Count ignores it
+	After *PhraseKey
+}
+
+// NeedsClicks reports whether the filter filters or sorts by clicks
+func (f PhraseFilter) NeedsClicks() bool {
+	return f.MinClicks > 0 || f.Sort == SortClicks
+}
+
+// PhraseWithClicks is a phrase with its total clicks
+type PhraseWithClicks struct {
+	model.PhraseModel
+	Clicks int `json:"clicks"`
+}
+
+// PhraseClicks is the total clicks of a phrase
+type PhraseClicks struct {
+	PhraseID int    `json:"phrase_id"`
+	Text     string `json:"text"`
+	Clicks   int    `json:"clicks"`
+}
+
+// GroupClicks is the clicks of a group
+type GroupClicks struct {
+	GroupID int `json:"group_id"`
+	Clicks  int `json:"clicks"`
+}
+
+// UserPhraseClicks is the clicks of a user on a phrase
+type UserPhraseClicks struct {
+	PhraseID      int    `json:"phrase_id"`
+	Text          string `json:"text"`
+	GroupID       int    `json:"group_id"`
+	Clicks        int    `json:"clicks"`
+	LastClickTime int64  `json:"last_click_time"`
+}
+
+// SexCount is the number of users of a sex
+type SexCount struct {
+	Sex   int `json:"sex"`
+	Count int `json:"count"`
+}
+
+// ProvinceCount is the number of users in a province
+type ProvinceCount struct {
+	Province string `json:"province"`
+	Count    int    `json:"count"`
+}
+
+// TrendPoint is the clicks up to the end of an interval
+type TrendPoint struct {
+	Time   int64 `json:"time"`
+	Clicks int   `json:"clicks"`
+}
+
+// AuditFilter holds the filters of the audit log, zero fields don't filter
+type AuditFilter struct {
+	Actor    string
+	Action   string
+	PhraseID int
+	// the status the phrase changed into
+	NewStatus model.PhraseStatus
+	Since     int64
+	Until     int64
+}
+
+// ReviewerStats is the decisions of a reviewer on pending phrases
+type ReviewerStats struct {
+	Reviewer   string `json:"reviewer"`
+	Decisions  int    `json:"decisions"`
+	Approvals  int    `json:"approvals"`
+	Rejections int    `json:"rejections"`
+	// decisions other than approving and rejecting, such as deleting or hiding
+	Others            int   `json:"others"`
+	FirstDecisionTime int64 `json:"first_decision_time"`
+	LastDecisionTime  int64 `json:"last_decision_time"`
+	// average seconds from the submission to the approval of the approved phrases
+	AvgTimeToApprove float64 `json:"avg_time_to_approve"`
+}
+
+// AuditFunc makes the audit record of a phrase changed from old to new
+type AuditFunc func(old, new model.PhraseModel) model.PhraseAuditModel
+
+type PhraseRepo interface {
+	// Get returns false if there is no phrase with the id
+	Get(id int) (model.PhraseModel, bool, error)
+	GetMany(ids []int) ([]model.PhraseModel, error)
+	// Create sets the id and the event of the phrase, ErrDuplicate if its text exists in the event
+	Create(phrase *model.PhraseModel) error
+	// Update writes the text, status and update time of the phrase and its audit record in one transaction
+	Update(phrase model.PhraseModel, audit model.PhraseAuditModel) error
+	// Transition moves the phrases of ids in fromStatus to toStatus with an audit record per phrase in one transaction,
+	// phrases in another status, such as changed meanwhile, are skipped. It returns the changed phrases holding their new status.
+	Transition(ids []int, fromStatus, toStatus model.PhraseStatus, updateTime int64, audit AuditFunc) ([]model.PhraseModel, error)
+	// History lists the audit records of a phrase, oldest first, none if the phrase is in another event
+	History(id int) ([]model.PhraseAuditModel, error)
+	// LastChange returns the audit record of the last change of the phrase into status, a zero record if there is none
+	// or the phrase is in another event
+	LastChange(id int, status model.PhraseStatus) (model.PhraseAuditModel, error)
+	Count(filter PhraseFilter) (int64, error)
+	// List pages through the phrases of the filter, Clicks is only set when the filter NeedsClicks
+	List(filter PhraseFilter, limit, offset int) ([]PhraseWithClicks, error)
+	// ListByAuthor lists the phrases of a user newest first, with their clicks and the total count
+	ListByAuthor(openID string, limit, offset int) ([]PhraseWithClicks, int64, error)
+	CountByStatus(status model.PhraseStatus) (int, error)
+	// Newest lists phrases of the status, last updated first
+	Newest(status model.PhraseStatus, limit int) ([]model.PhraseModel, error)
+	Random(status model.PhraseStatus, limit int) ([]model.PhraseModel, error)
+}
+
+type ClickRepo interface {
+	Add(click model.PhraseClickModel) error
+	// AddMany stores the clicks in batches and adds them to the totals of their phrases in one transaction
+	AddMany(clicks []model.PhraseClickModel) error
+	// Reset deletes all clicks of the event with their rollups and totals, it returns how many click records were deleted
+	Reset() (int64, error)
+	// Distributions returns the clicks of each group on the phrases, keyed by phrase id
+	Distributions(phraseIDs []int) (map[int][]GroupClicks, error)
+	// UserGroups sums the clicks of a user by group, most clicks first
+	UserGroups(openID string) ([]GroupClicks, error)
+	// UserPhrases sums the clicks of a user by phrase and group, most clicks first
+	UserPhrases(openID string, limit int) ([]UserPhraseClicks, error)
+}
+
+type UserRepo interface {
+	// Get returns false if there is no user with the open_id
+	Get(openID string) (model.UserModel, bool, error)
+	// Upsert creates the user or replaces its profile
+	Upsert(user model.UserModel) error
+	// Delete erases the user and its notifications in all events and moves its phrases and clicks to anonID
+	Delete(openID, anonID string) error
+}
+
+type StatsRepo interface {
+	SexCounts() ([]SexCount, error)
+	// TopProvinces lists the provinces with the most users
+	TopProvinces(limit int) ([]ProvinceCount, error)
+	TotalClicks() (int, error)
+	// ClicksBefore sums the clicks before t
+	ClicksBefore(t int64) (int, error)
+	// ClickTrends lists the clicks up to the end of each interval after since that has clicks
+	ClickTrends(since int64, interval int64) ([]TrendPoint, error)
+	// TopPhrases lists the approved phrases with the most clicks
+	TopPhrases(limit int) ([]PhraseClicks, error)
+}
+
+type AuditRepo interface {
+	// List pages through the audit records of the phrases of the event newest first, with the total count
+	List(filter AuditFilter, limit, offset int) ([]model.PhraseAuditModel, int64, error)
+	// ReviewerStats sums the decisions on pending phrases in [since, until) by reviewer, most decisions first
+	ReviewerStats(since, until int64) ([]ReviewerStats, error)
+}
+
+type ClaimRepo interface {
+	// ReleaseExpired deletes the claims of all events whose lease ended before now
+	ReleaseExpired(now int64) error
+	// Claimable lists pending phrases not claimed by other reviewers at now, the reviewer's own claims first, then oldest first
+	Claimable(reviewer string, now int64, limit int) ([]model.PhraseModel, error)
+	// Claim claims the phrase for the reviewer until leaseUntil, it returns false if another reviewer's lease hasn't ended
+	// or the phrase is in another event
+	Claim(phraseID int, reviewer string, now, leaseUntil int64) (bool, error)
+	// Held returns the phrases of ids whose lease the reviewer holds at now
+	Held(ids []int, reviewer string, now int64) ([]int, error)
+	// Release deletes the claims of the reviewer on the phrases of ids, all its claims without ids
+	Release(reviewer string, ids []int) error
+}
+
+type NotificationRepo interface {
+	// List pages through the notifications of the user newest first, with the total count
+	List(openID string, unreadOnly bool, limit, offset int) ([]model.NotificationModel, int64, error)
+	// Unread counts the unread notifications of the user
+	Unread(openID string) (int, error)
+	// MarkRead marks the notifications of ids of the user as read, all of them without ids
+	MarkRead(openID string, ids []int) error
+}
+
+type EventRepo interface {
+	// Get returns false if there is no event with the id
+	Get(id int) (model.EventModel, bool, error)
+	// GetBySlug returns false if there is no event with the slug
+	GetBySlug(slug string) (model.EventModel, bool, error)
+	List() ([]model.EventModel, error)
+	// Create sets the id of the event, ErrDuplicate if its slug exists
+	Create(event *model.EventModel) error
+	// Update writes the name, settings and update time of the event
+	Update(event model.EventModel) error
+}
+
+type ProfileRepo interface {
+	List() ([]model.DisplayProfileModel, error)
+	// Save creates the profile or replaces the profile of the same name
+	Save(profile model.DisplayProfileModel) error
+	// Delete returns false if there is no profile with the name
+	Delete(name string) (bool, error)
+}
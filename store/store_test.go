@@ -0,0 +1,199 @@
+package store
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/YiniXu9506/devconG/config"
+	"github.com/YiniXu9506/devconG/model"
+	"github.com/YiniXu9506/devconG/utils"
+	"gorm.io/gorm"
+)
+
+// openSQLite opens a migrated SQLite database in the test's temporary directory
+func openSQLite(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := utils.Open(config.DBConfig{Driver: config.DBDriverSQLite, Path: filepath.Join(t.TempDir(), "devcon.db"), MaxIdleConns: 2, MaxOpenConns: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		utils.Close(db)
+	})
+	if err := utils.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// eachStore runs the test on the memory store and on the gorm store over SQLite
+func eachStore(t *testing.T, test func(t *testing.T, st Store)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, NewMemory())
+	})
+	t.Run("gorm", func(t *testing.T) {
+		test(t, NewGorm(openSQLite(t)))
+	})
+}
+
+// createPhrase creates a phrase of the store's event or fails the test
+func createPhrase(t *testing.T, st Store, phrase model.PhraseModel) model.PhraseModel {
+	t.Helper()
+
+	if phrase.Status == 0 {
+		phrase.Status = model.StatusPending
+	}
+	if phrase.GroupID == 0 {
+		phrase.GroupID = 1
+	}
+	if err := st.Phrases.Create(&phrase); err != nil {
+		t.Fatal(err)
+	}
+	return phrase
+}
+
+func TestAuditsScopedToEvent(t *testing.T) {
+	eachStore(t, func(t *testing.T, st Store) {
+		other := st.Event(2)
+		phrase := createPhrase(t, st, model.PhraseModel{Text: "hello", CreateTime: 1, UpdateTime: 1})
+
+		approved := phrase
+		approved.Status = model.StatusApproved
+		approved.UpdateTime = 2
+		if err := st.Phrases.Update(approved, model.PhraseAuditModel{PhraseID: phrase.PhraseID, Action: "approve", OldStatus: phrase.Status, NewStatus: approved.Status, CreateTime: 2}); err != nil {
+			t.Fatal(err)
+		}
+
+		history, err := st.Phrases.History(phrase.PhraseID)
+		if err != nil || len(history) != 1 {
+			t.Fatalf("got history %v, %v, want one record", history, err)
+		}
+		if history, err = other.Phrases.History(phrase.PhraseID); err != nil || len(history) != 0 {
+			t.Fatalf("got history %v, %v in another event, want none", history, err)
+		}
+
+		last, err := other.Phrases.LastChange(phrase.PhraseID, model.StatusApproved)
+		if err != nil || last.ID != 0 {
+			t.Fatalf("got last change %v, %v in another event, want none", last, err)
+		}
+		if last, err = st.Phrases.LastChange(phrase.PhraseID, model.StatusApproved); err != nil || last.ID == 0 {
+			t.Fatalf("got last change %v, %v, want the approval", last, err)
+		}
+	})
+}
+
+func TestClaimsScopedToEvent(t *testing.T) {
+	eachStore(t, func(t *testing.T, st Store) {
+		phrase := createPhrase(t, st, model.PhraseModel{Text: "hello", CreateTime: 1, UpdateTime: 1})
+
+		if ok, err := st.Event(2).Claims.Claim(phrase.PhraseID, "alice", 10, 20); err != nil || ok {
+			t.Fatalf("claimed a phrase of another event: %v, %v", ok, err)
+		}
+		if ok, err := st.Claims.Claim(phrase.PhraseID, "alice", 10, 20); err != nil || !ok {
+			t.Fatalf("claim: %v, %v", ok, err)
+		}
+		if ok, err := st.Claims.Claim(phrase.PhraseID, "bob", 15, 25); err != nil || ok {
+			t.Fatalf("bob took over a running lease: %v, %v", ok, err)
+		}
+		if ok, err := st.Claims.Claim(phrase.PhraseID, "bob", 21, 31); err != nil || !ok {
+			t.Fatalf("bob didn't take over an ended lease: %v, %v", ok, err)
+		}
+
+		held, err := st.Claims.Held([]int{phrase.PhraseID}, "bob", 30)
+		if err != nil || len(held) != 1 {
+			t.Fatalf("got held %v, %v, want the phrase", held, err)
+		}
+		if held, err = st.Event(2).Claims.Held([]int{phrase.PhraseID}, "bob", 30); err != nil || len(held) != 0 {
+			t.Fatalf("got held %v, %v in another event, want none", held, err)
+		}
+	})
+}
+
+func TestReviewerStats(t *testing.T) {
+	eachStore(t, func(t *testing.T, st Store) {
+		decide := func(text string, status model.PhraseStatus, at int64) {
+			phrase := createPhrase(t, st, model.PhraseModel{Text: text, CreateTime: 100, UpdateTime: 100})
+			changed, err := st.Phrases.Transition([]int{phrase.PhraseID}, model.StatusPending, status, at, func(old, new model.PhraseModel) model.PhraseAuditModel {
+				return model.PhraseAuditModel{PhraseID: old.PhraseID, Actor: "alice", OldStatus: old.Status, NewStatus: new.Status, CreateTime: at}
+			})
+			if err != nil || len(changed) != 1 {
+				t.Fatalf("transition: %v, %v", changed, err)
+			}
+		}
+		decide("approved", model.StatusApproved, 160)
+		decide("rejected", model.StatusRejected, 170)
+		decide("deleted", model.StatusDeleted, 180)
+		decide("too late", model.StatusApproved, 300)
+
+		stats, err := st.Audits.ReviewerStats(0, 300)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := ReviewerStats{Reviewer: "alice", Decisions: 3, Approvals: 1, Rejections: 1, Others: 1, FirstDecisionTime: 160, LastDecisionTime: 180, AvgTimeToApprove: 60}
+		if len(stats) != 1 || stats[0] != want {
+			t.Fatalf("got %+v, want %+v", stats, want)
+		}
+
+		if stats, err = st.Event(2).Audits.ReviewerStats(0, 300); err != nil || len(stats) != 0 {
+			t.Fatalf("got %+v, %v in another event, want none", stats, err)
+		}
+	})
+}
+
+func TestListPagesByClicks(t *testing.T) {
+	eachStore(t, func(t *testing.T, st Store) {
+		clicks := []int{5, 0, 9, 5, 2}
+		var ids []int
+		for i, n := range clicks {
+			phrase := createPhrase(t, st, model.PhraseModel{Text: fmt.Sprintf("phrase %d", i), Status: model.StatusApproved, CreateTime: int64(i), UpdateTime: int64(i)})
+			ids = append(ids, phrase.PhraseID)
+			if n == 0 {
+				continue
+			}
+			// two requests, the totals add up
+			if err := st.Clicks.AddMany([]model.PhraseClickModel{{PhraseID: phrase.PhraseID, GroupID: 1, Clicks: n - 1}, {PhraseID: phrase.PhraseID, GroupID: 2, Clicks: 1}}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// clicks of another event don't count
+		if err := st.Event(2).Clicks.Add(model.PhraseClickModel{PhraseID: ids[4], GroupID: 1, Clicks: 100}); err != nil {
+			t.Fatal(err)
+		}
+
+		// ties of the clicks are broken by phrase_id
+		want := []int{ids[2], ids[3], ids[0], ids[4], ids[1]}
+		filter := PhraseFilter{Statuses: []model.PhraseStatus{model.StatusApproved}, Sort: SortClicks, Desc: true}
+		var got []int
+		for page := 0; page < 5; page++ {
+			phrases, err := st.Phrases.List(filter, 2, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(phrases) == 0 {
+				break
+			}
+			for _, phrase := range phrases {
+				got = append(got, phrase.PhraseID)
+			}
+			last := phrases[len(phrases)-1]
+			filter.After = &PhraseKey{Value: int64(last.Clicks), PhraseID: last.PhraseID}
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("got pages %v, want %v", got, want)
+		}
+
+		filter = PhraseFilter{Statuses: []model.PhraseStatus{model.StatusApproved}, Sort: SortCreateTime, MinClicks: 5}
+		if count, err := st.Phrases.Count(filter); err != nil || count != 3 {
+			t.Fatalf("got %d, %v phrases with 5 clicks, want 3", count, err)
+		}
+
+		if _, err := st.Clicks.Reset(); err != nil {
+			t.Fatal(err)
+		}
+		if count, err := st.Phrases.Count(filter); err != nil || count != 0 {
+			t.Fatalf("got %d, %v phrases with 5 clicks after the reset, want none", count, err)
+		}
+	})
+}
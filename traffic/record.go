@@ -0,0 +1,181 @@
+package traffic
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// entries waiting to be written, requests are not slowed down by the file, entries beyond it are dropped
+	queueSize = 4096
+	// letters of anonymized phrase texts
+	textLetters = "abcdefghijklmnopqrstuvwxyz0123456789"
+)
+
+// Entry is a recorded request, a line of the record file
+type Entry struct {
+	// unix milliseconds the request arrived at
+	Time   int64  `json:"time"`
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Query  string `json:"query,omitempty"`
+	// slug of the event the request was scoped to, empty for the default event
+	Event string `json:"event,omitempty"`
+	// anonymized user of the session, empty for requests without one
+	User string          `json:"user,omitempty"`
+	Body json.RawMessage `json:"body,omitempty"`
+	// response status and time taken when recorded
+	Status    int     `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+}
+
+// Recorder appends entries to a file in the background
+type Recorder struct {
+	file string
+	// key of the anonymization, it is never written so users and texts can't be recovered
+	salt    []byte
+	entries chan Entry
+	dropped int64
+	done    chan struct{}
+	// held to send entries, entries recorded after Close are dropped
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewRecorder appends to file, it is created if it doesn't exist
+func NewRecorder(file string) (*Recorder, error) {
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	r := &Recorder{
+		file:    file,
+		salt:    salt,
+		entries: make(chan Entry, queueSize),
+		done:    make(chan struct{}),
+	}
+	go r.write(f)
+	return r, nil
+}
+
+// File is the path entries are appended to
+func (r *Recorder) File() string {
+	return r.file
+}
+
+func (r *Recorder) write(f *os.File) {
+	defer close(r.done)
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	encoder := json.NewEncoder(w)
+	for entry := range r.entries {
+		if err := encoder.Encode(entry); err != nil {
+			zap.L().Sugar().Error("Error! Write recorded request: ", err)
+		}
+		// write out when the queue is drained, a crash loses little
+		if len(r.entries) == 0 {
+			if err := w.Flush(); err != nil {
+				zap.L().Sugar().Error("Error! Flush recorded requests: ", err)
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		zap.L().Sugar().Error("Error! Flush recorded requests: ", err)
+	}
+}
+
+// Record queues the entry, it is dropped if the writer falls behind
+func (r *Recorder) Record(entry Entry) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed {
+		return
+	}
+
+	select {
+	case r.entries <- entry:
+	default:
+		if atomic.AddInt64(&r.dropped, 1)%1000 == 1 {
+			zap.L().Sugar().Warnf("recorder of %v is behind, %d requests dropped", r.file, atomic.LoadInt64(&r.dropped))
+		}
+	}
+}
+
+// Close writes the queued entries and closes the file
+func (r *Recorder) Close() {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.entries)
+	}
+	r.mu.Unlock()
+	<-r.done
+}
+
+func (r *Recorder) hash(value string) []byte {
+	mac := hmac.New(sha256.New, r.salt)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+// AnonymizeUser maps an open_id to the same pseudonym within the recording
+func (r *Recorder) AnonymizeUser(openID string) string {
+	return "u-" + hex.EncodeToString(r.hash("user:" + openID)[:8])
+}
+
+// anonymizeText maps a phrase text to a text of the same length, the same text maps to the same one
+// so duplicates stay duplicates
+func (r *Recorder) anonymizeText(text string) string {
+	sum := r.hash("text:" + text)
+	anonymized := make([]byte, utf8.RuneCountInString(text))
+	for i := range anonymized {
+		anonymized[i] = textLetters[int(sum[i%len(sum)])%len(textLetters)]
+	}
+	return string(anonymized)
+}
+
+// fields of request bodies written by users, replaced by anonymized texts
+var userTextFields = []string{"text", "nick_name", "province", "city", "headimgurl"}
+
+// AnonymizeBody replaces the texts users wrote in a json object, other json like the clicks
+// of /phrase_hot is kept as it is and bodies that aren't json are left out
+func (r *Recorder) AnonymizeBody(body []byte) json.RawMessage {
+	if len(body) == 0 {
+		return nil
+	}
+	var object map[string]interface{}
+	if err := json.Unmarshal(body, &object); err != nil {
+		if json.Valid(body) {
+			return body
+		}
+		// not json, the body is kept out of the record
+		return nil
+	}
+	for _, field := range userTextFields {
+		if text, ok := object[field].(string); ok {
+			object[field] = r.anonymizeText(text)
+		}
+	}
+	anonymized, err := json.Marshal(object)
+	if err != nil {
+		return nil
+	}
+	return anonymized
+}
@@ -0,0 +1,94 @@
+package traffic
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func newTestRecorder(t *testing.T) *Recorder {
+	t.Helper()
+
+	r, err := NewRecorder(filepath.Join(t.TempDir(), "record.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(r.Close)
+	return r
+}
+
+func TestAnonymizeUser(t *testing.T) {
+	r, other := newTestRecorder(t), newTestRecorder(t)
+
+	alice := r.AnonymizeUser("alice")
+	if alice != r.AnonymizeUser("alice") {
+		t.Fatal("the same user got different pseudonyms")
+	}
+	if alice == r.AnonymizeUser("bob") || strings.Contains(alice, "alice") {
+		t.Fatalf("got pseudonym %q", alice)
+	}
+	// the key isn't shared between recordings
+	if alice == other.AnonymizeUser("alice") {
+		t.Fatal("two recordings share a pseudonym")
+	}
+}
+
+func TestAnonymizeBody(t *testing.T) {
+	r := newTestRecorder(t)
+
+	body := r.AnonymizeBody([]byte(`{"text":"你好 DevCon","group_id":2,"nick_name":"Alice"}`))
+	var object map[string]interface{}
+	if err := json.Unmarshal(body, &object); err != nil {
+		t.Fatal(err)
+	}
+	text := object["text"].(string)
+	if text == "你好 DevCon" || utf8.RuneCountInString(text) != utf8.RuneCountInString("你好 DevCon") {
+		t.Fatalf("got text %q, want random letters of the same length", text)
+	}
+	if object["nick_name"] == "Alice" || object["group_id"] != float64(2) {
+		t.Fatalf("got body %s, want the nick name replaced and the group kept", body)
+	}
+	// duplicates stay duplicates
+	if again := r.AnonymizeBody([]byte(`{"text":"你好 DevCon"}`)); !strings.Contains(string(again), text) {
+		t.Fatalf("got %s, want the same text %q", again, text)
+	}
+
+	clicks := `[{"phrase_id":1,"clicks":3}]`
+	if got := r.AnonymizeBody([]byte(clicks)); string(got) != clicks {
+		t.Fatalf("got %s, want the clicks kept", got)
+	}
+	if got := r.AnonymizeBody([]byte("text=hello")); got != nil {
+		t.Fatalf("got %s, want a body which isn't json left out", got)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	r := newTestRecorder(t)
+	r.Record(Entry{Time: 1, Method: "GET", Path: "/phrases", Status: 200})
+	r.Record(Entry{Time: 2, Method: "POST", Path: "/phrase", User: r.AnonymizeUser("alice"), Status: 200})
+	r.Close()
+	// dropped after Close
+	r.Record(Entry{Time: 3, Method: "GET", Path: "/phrases", Status: 200})
+
+	f, err := os.Open(r.File())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) != 2 || entries[1].Path != "/phrase" || entries[1].User == "" {
+		t.Fatalf("got entries %+v", entries)
+	}
+}
@@ -0,0 +1,349 @@
+package traffic
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/YiniXu9506/devconG/auth"
+	"github.com/YiniXu9506/devconG/loadtest"
+)
+
+const (
+	// how often the wall of the target is read to map phrase ids
+	wallRefreshInterval = 10 * time.Second
+	// requests sent later than this behind their time count as late
+	lateThreshold = 100 * time.Millisecond
+	// longest line of a record file
+	maxLineSize = 1 << 20
+)
+
+// ReplayOptions describes a replay of a record file
+type ReplayOptions struct {
+	// base url of the API
+	Target string
+	// 1 replays at the recorded pace, 5 five times faster
+	Speed float64
+	// requests in flight at most, requests wait for a free slot and are late
+	Concurrency int
+	// secret the target signs session tokens with, users get tokens for their pseudonyms
+	SessionSecret string
+	// send the recorded phrase ids instead of mapping them onto the phrases on the wall of the target,
+	// for targets restored from a backup of the recorded instance
+	KeepPhraseIDs bool
+	// slug of the event all requests are sent to, empty keeps the recorded events
+	Event string
+}
+
+// ReplayReport is the result of a replay
+type ReplayReport struct {
+	loadtest.Report
+	Requests int `json:"requests"`
+	// requests sent more than lateThreshold behind their time at the speed
+	Late   int           `json:"late"`
+	MaxLag time.Duration `json:"max_lag"`
+}
+
+// replayer sends the entries of a record file
+type replayer struct {
+	opts   ReplayOptions
+	client *http.Client
+	stats  *loadtest.Stats
+
+	mu sync.RWMutex
+	// ids of the phrases on the wall of each event of the target, by slug
+	walls  map[string][]int
+	tokens map[string]string
+}
+
+// Replay sends the requests of a record file at their recorded pace scaled by the speed.
+// A request counts as an error if it fails, gets a 5xx or fails where the recorded one succeeded.
+func Replay(ctx context.Context, record io.Reader, opts ReplayOptions) (ReplayReport, error) {
+	var report ReplayReport
+	if opts.Speed <= 0 || opts.Concurrency <= 0 {
+		return report, errors.New("speed and concurrency must be positive")
+	}
+	if opts.SessionSecret == "" {
+		return report, errors.New("replaying needs the session secret of the target")
+	}
+
+	r := &replayer{
+		opts: opts,
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{MaxIdleConns: opts.Concurrency, MaxIdleConnsPerHost: opts.Concurrency},
+		},
+		stats:  loadtest.NewStats(),
+		walls:  make(map[string][]int),
+		tokens: make(map[string]string),
+	}
+
+	if !opts.KeepPhraseIDs {
+		if err := r.refreshWall(ctx, opts.Event); err != nil {
+			return report, fmt.Errorf("read the wall of the target: %w", err)
+		}
+		refreshCtx, stopRefresh := context.WithCancel(ctx)
+		defer stopRefresh()
+		go func() {
+			ticker := time.NewTicker(wallRefreshInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-refreshCtx.Done():
+					return
+				case <-ticker.C:
+					for _, event := range r.events() {
+						_ = r.refreshWall(refreshCtx, event)
+					}
+				}
+			}
+		}()
+	}
+
+	scanner := bufio.NewScanner(record)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	slots := make(chan struct{}, opts.Concurrency)
+	var wg sync.WaitGroup
+	var start time.Time
+	var firstTime int64
+
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return report, fmt.Errorf("line %d of the record: %w", report.Requests+1, err)
+		}
+		if opts.Event != "" {
+			entry.Event = opts.Event
+		}
+		if start.IsZero() {
+			start = time.Now()
+			firstTime = entry.Time
+		}
+
+		due := start.Add(time.Duration(float64(time.Duration(entry.Time-firstTime)*time.Millisecond) / opts.Speed))
+		if wait := time.Until(due); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+			case <-timer.C:
+			}
+		}
+		select {
+		case <-ctx.Done():
+		case slots <- struct{}{}:
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		if lag := time.Since(due); lag > lateThreshold {
+			report.Late++
+			if lag > report.MaxLag {
+				report.MaxLag = lag
+			}
+		}
+		report.Requests++
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			r.send(ctx, entry)
+		}()
+	}
+	wg.Wait()
+	if err := scanner.Err(); err != nil {
+		return report, err
+	}
+
+	elapsed := time.Duration(0)
+	if !start.IsZero() {
+		elapsed = time.Since(start)
+	}
+	report.Report = r.stats.Report(elapsed)
+	return report, nil
+}
+
+// url of a path of the API scoped to an event, the default event without a slug
+func (r *replayer) url(event, path string) string {
+	url := strings.TrimRight(r.opts.Target, "/")
+	if event != "" {
+		url += "/events/" + event
+	}
+	return url + path
+}
+
+// events whose wall was read
+func (r *replayer) events() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	events := make([]string, 0, len(r.walls))
+	for event := range r.walls {
+		events = append(events, event)
+	}
+	return events
+}
+
+// refreshWall reads the ids of the phrases on the wall of an event of the target
+func (r *replayer) refreshWall(ctx context.Context, event string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url(event, "/phrases"), nil)
+	if err != nil {
+		return err
+	}
+	var wall []struct {
+		PhraseID int `json:"phrase_id"`
+	}
+	if _, err := r.do(req, &wall); err != nil {
+		return err
+	}
+	if len(wall) == 0 {
+		return errors.New("no phrases on the wall to map the recorded clicks to")
+	}
+
+	ids := make([]int, len(wall))
+	for i, phrase := range wall {
+		ids[i] = phrase.PhraseID
+	}
+	r.mu.Lock()
+	r.walls[event] = ids
+	r.mu.Unlock()
+	return nil
+}
+
+// mapPhrase maps a recorded phrase id onto a phrase of the wall of the event on the target, the same id to the
+// same phrase. The wall of an event is read when its first click is sent.
+func (r *replayer) mapPhrase(ctx context.Context, event string, id int) (int, error) {
+	r.mu.RLock()
+	wall, ok := r.walls[event]
+	r.mu.RUnlock()
+	if !ok {
+		if err := r.refreshWall(ctx, event); err != nil {
+			return 0, fmt.Errorf("read the wall of event %q: %w", event, err)
+		}
+		r.mu.RLock()
+		wall = r.walls[event]
+		r.mu.RUnlock()
+	}
+
+	h := fnv.New32a()
+	fmt.Fprint(h, id)
+	return wall[int(h.Sum32()%uint32(len(wall)))], nil
+}
+
+func (r *replayer) token(user string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if token, ok := r.tokens[user]; ok {
+		return token, nil
+	}
+	token, _, err := auth.IssueToken(r.opts.SessionSecret, "replay-"+user, 24*time.Hour)
+	if err != nil {
+		return "", err
+	}
+	r.tokens[user] = token
+	return token, nil
+}
+
+// body of the entry to send, with the phrase ids of clicks mapped onto the target
+func (r *replayer) body(ctx context.Context, entry Entry) ([]byte, error) {
+	if r.opts.KeepPhraseIDs || len(entry.Body) == 0 || entry.Body[0] != '[' {
+		return entry.Body, nil
+	}
+	var clicks []map[string]interface{}
+	if err := json.Unmarshal(entry.Body, &clicks); err != nil {
+		return entry.Body, nil
+	}
+	for _, click := range clicks {
+		if id, ok := click["phrase_id"].(float64); ok {
+			mapped, err := r.mapPhrase(ctx, entry.Event, int(id))
+			if err != nil {
+				return nil, err
+			}
+			click["phrase_id"] = mapped
+		}
+	}
+	return json.Marshal(clicks)
+}
+
+func (r *replayer) send(ctx context.Context, entry Entry) {
+	endpoint := entry.Method + " " + entry.Path
+	body, err := r.body(ctx, entry)
+	if err != nil {
+		r.stats.Record(endpoint, 0, err)
+		return
+	}
+	url := r.url(entry.Event, entry.Path)
+	if entry.Query != "" {
+		url += "?" + entry.Query
+	}
+	req, err := http.NewRequestWithContext(ctx, entry.Method, url, bytes.NewReader(body))
+	if err != nil {
+		r.stats.Record(endpoint, 0, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if entry.User != "" {
+		token, err := r.token(entry.User)
+		if err != nil {
+			r.stats.Record(endpoint, 0, err)
+			return
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	start := time.Now()
+	status, err := r.do(req, nil)
+	if ctx.Err() != nil {
+		// cut off at the end of the replay
+		return
+	}
+	if err != nil && status != 0 && status/100 != 5 && entry.Status/100 != 2 {
+		// failing like the recorded request did is not an error of the target
+		err = nil
+	}
+	r.stats.Record(endpoint, time.Since(start), err)
+}
+
+// do sends a request and decodes `d` of the response into data
+func (r *replayer) do(req *http.Request, data interface{}) (int, error) {
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	var envelope struct {
+		C int             `json:"c"`
+		D json.RawMessage `json:"d"`
+	}
+	if err := json.Unmarshal(b, &envelope); err != nil {
+		return resp.StatusCode, fmt.Errorf("status %d, response is not json", resp.StatusCode)
+	}
+	if resp.StatusCode/100 != 2 || envelope.C != 0 {
+		return resp.StatusCode, fmt.Errorf("status %d, c %d", resp.StatusCode, envelope.C)
+	}
+	if data != nil {
+		return resp.StatusCode, json.Unmarshal(envelope.D, data)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,20 @@
+package utils
+
+import "time"
+
+// MaxBackoff is the longest wait between two attempts of a delivery
+const MaxBackoff = time.Hour
+
+// Backoff is the seconds to wait after the failed attempts of a delivery, the interval doubles after
+// each attempt up to MaxBackoff, so a large max_attempts can't overflow the delay
+func Backoff(intervalSeconds, attempts int) int64 {
+	backoff := int64(intervalSeconds)
+	limit := int64(MaxBackoff / time.Second)
+	for i := 0; i < attempts && backoff < limit; i++ {
+		backoff *= 2
+	}
+	if backoff > limit {
+		backoff = limit
+	}
+	return backoff
+}
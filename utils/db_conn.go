@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/YiniXu9506/devconG/config"
+	"github.com/YiniXu9506/devconG/migrate"
+	"go.uber.org/zap"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// dialector picks the gorm driver of the database
+func dialector(dbConfig config.DBConfig) gorm.Dialector {
+	if dbConfig.Driver == config.DBDriverSQLite {
+		return sqlite.Open(dbConfig.DSN())
+	}
+	return mysql.Open(dbConfig.DSN())
+}
+
+// Open connects to the database and sizes its connection pool
+func Open(dbConfig config.DBConfig) (*gorm.DB, error) {
+	newLogger := logger.New(
+		log.New(os.Stdout, "\r\n", log.LstdFlags), // io writer
+		logger.Config{
+			SlowThreshold:             6 * time.Second, // Slow SQL threshold
+			LogLevel:                  logger.Silent,   // Log level
+			IgnoreRecordNotFoundError: true,            // Ignore ErrRecordNotFound error for logger
+			Colorful:                  false,           // Disable color
+		},
+	)
+	if dbConfig.Driver == config.DBDriverSQLite {
+		zap.L().Sugar().Infof("connect database sqlite:%v", dbConfig.Path)
+	} else {
+		zap.L().Sugar().Infof("connect database %v@%v:%v/%v", dbConfig.User, dbConfig.Host, dbConfig.Port, dbConfig.Database)
+	}
+	db, err := gorm.Open(dialector(dbConfig), &gorm.Config{Logger: newLogger})
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	// SetMaxIdleConns sets the maximum number of connections in the idle connection pool.
+	sqlDB.SetMaxIdleConns(dbConfig.MaxIdleConns)
+
+	// SetMaxOpenConns sets the maximum number of open connections to the database.
+	sqlDB.SetMaxOpenConns(dbConfig.MaxOpenConns)
+
+	// SetConnMaxLifetime sets the maximum amount of time a connection may be reused.
+	sqlDB.SetConnMaxLifetime(time.Duration(dbConfig.ConnMaxLifetimeSeconds) * time.Second)
+	return db, nil
+}
+
+// Connect opens the primary database and the cloud database if it is configured,
+// applying pending migrations to those with auto_migrate
+func Connect(primary config.DBConfig, cloud config.DBConfig) []*gorm.DB {
+	dbConfigs := []config.DBConfig{primary}
+	if cloud.Enabled() {
+		dbConfigs = append(dbConfigs, cloud)
+	}
+
+	var dbs []*gorm.DB
+	for _, dbConfig := range dbConfigs {
+		db, err := Open(dbConfig)
+		if err != nil {
+			panic(fmt.Sprintf("failed to connect database %v", err))
+		}
+		if dbConfig.AutoMigrate {
+			start := time.Now()
+			if err := Migrate(db); err != nil {
+				panic(fmt.Sprintf("failed to migrate database %v", err))
+			}
+			zap.L().Sugar().Infof("migrate db cost: %v", time.Since(start))
+		}
+		dbs = append(dbs, db)
+	}
+	return dbs
+}
+
+// Close closes the connection pools of the databases, nil databases are skipped
+func Close(dbs ...*gorm.DB) {
+	for _, db := range dbs {
+		if db == nil {
+			continue
+		}
+		sqlDB, err := db.DB()
+		if err != nil {
+			zap.L().Sugar().Error("Error! Get database pool to close: ", err)
+			continue
+		}
+		if err := sqlDB.Close(); err != nil {
+			zap.L().Sugar().Error("Error! Close database pool: ", err)
+		}
+	}
+}
+
+// Migrate applies the pending migrations of the database
+func Migrate(db *gorm.DB) error {
+	migrator, err := migrate.New(db)
+	if err != nil {
+		return err
+	}
+	applied, err := migrator.Up(0)
+	for _, migration := range applied {
+		zap.L().Sugar().Infof("applied %v migration %04d_%v", migrator.Dialect(), migration.Version, migration.Name)
+	}
+	return err
+}
+
+// MySQLError is an error type which represents a single MySQL error
+type MySQLError struct {
+	Number  uint16
+	Message string
+}
+
+func (me MySQLError) Error() string {
+	return fmt.Sprintf("Error %d: %s", me.Number, me.Message)
+}
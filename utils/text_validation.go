@@ -4,12 +4,23 @@ import (
 	"unicode/utf8"
 )
 
+// MaxTextLength is the most characters of the text of a phrase
+const MaxTextLength = 20
+
 func ValidateText(text string) bool {
 	count := utf8.RuneCountInString(text)
 
-	if count > 20 || count <= 0 {
+	if count > MaxTextLength || count <= 0 {
 		return false
 	}
 
 	return true
-}
\ No newline at end of file
+}
+
+// TruncateText cuts the text to at most max characters, never in the middle of a character
+func TruncateText(text string, max int) string {
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+	return string([]rune(text)[:max])
+}
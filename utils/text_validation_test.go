@@ -0,0 +1,21 @@
+package utils
+
+import "testing"
+
+func TestTruncateText(t *testing.T) {
+	tests := []struct {
+		text string
+		max  int
+		want string
+	}{
+		{"admin", 64, "admin"},
+		{"reviewer", 6, "review"},
+		{"审核员小王", 3, "审核员"},
+		{"", 3, ""},
+	}
+	for _, test := range tests {
+		if got := TruncateText(test.text, test.max); got != test.want {
+			t.Errorf("TruncateText(%q, %d) = %q, want %q", test.text, test.max, got, test.want)
+		}
+	}
+}
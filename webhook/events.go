@@ -0,0 +1,224 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/YiniXu9506/devconG/model"
+	"github.com/YiniXu9506/devconG/notify"
+	"go.uber.org/zap"
+)
+
+// webhook events
+const (
+	EventPhraseSubmitted  = "phrase.submitted"
+	EventPhraseApproved   = notify.EventPhraseApproved
+	EventPhraseRejected   = notify.EventPhraseRejected
+	EventPhraseDeleted    = notify.EventPhraseDeleted
+	EventPhraseHot        = notify.EventPhraseHot
+	EventGroupLeadChanged = "group.lead_changed"
+	EventRoundEnded       = "round.ended"
+)
+
+// Events are the events subscriptions can subscribe to
+var Events = []string{
+	EventPhraseSubmitted,
+	EventPhraseApproved,
+	EventPhraseRejected,
+	EventPhraseDeleted,
+	EventPhraseHot,
+	EventGroupLeadChanged,
+	EventRoundEnded,
+}
+
+// phrases of the top list sent with round.ended
+const roundTopPhrases = 5
+
+// PhraseData is the data of phrase events, the author is left out
+type PhraseData struct {
+	EventID    int                `json:"event_id"`
+	PhraseID   int                `json:"phrase_id"`
+	Text       string             `json:"text"`
+	GroupID    int                `json:"group_id,omitempty"`
+	Status     model.PhraseStatus `json:"status,omitempty"`
+	Clicks     int                `json:"clicks,omitempty"`
+	UpdateTime int64              `json:"update_time,omitempty"`
+}
+
+type GroupClicks struct {
+	GroupID int `json:"group_id"`
+	Clicks  int `json:"clicks"`
+}
+
+type GroupLeadData struct {
+	EventID         int           `json:"event_id"`
+	GroupID         int           `json:"group_id"`
+	Clicks          int           `json:"clicks"`
+	PreviousGroupID int           `json:"previous_group_id"`
+	Groups          []GroupClicks `json:"groups"`
+}
+
+type RoundData struct {
+	EventID    int           `json:"event_id"`
+	Round      string        `json:"round"`
+	EndedAt    int64         `json:"ended_at"`
+	Groups     []GroupClicks `json:"groups"`
+	TopPhrases []PhraseData  `json:"top_phrases"`
+}
+
+func knownEvent(event string) bool {
+	for _, name := range Events {
+		if name == event {
+			return true
+		}
+	}
+	return false
+}
+
+// PhraseSubmitted emits phrase.submitted for a new phrase
+func (d *Dispatcher) PhraseSubmitted(ctx context.Context, phrase model.PhraseModel) {
+	d.emit(ctx, Event{
+		Name:     EventPhraseSubmitted,
+		EventID:  phrase.EventID,
+		Data:     PhraseData{EventID: phrase.EventID, PhraseID: phrase.PhraseID, Text: phrase.Text, GroupID: phrase.GroupID, Status: phrase.Status},
+		DedupKey: fmt.Sprintf("%s:%d", EventPhraseSubmitted, phrase.PhraseID),
+	})
+}
+
+// PhraseStatusChanged emits the event of a status transition, phrase holds the new status
+func (d *Dispatcher) PhraseStatusChanged(ctx context.Context, phrase model.PhraseModel, fromStatus model.PhraseStatus) {
+	event := notify.StatusEvent(fromStatus, phrase.Status)
+	if event == "" || fromStatus == phrase.Status {
+		return
+	}
+
+	d.emit(ctx, Event{
+		Name:     event,
+		EventID:  phrase.EventID,
+		Data:     PhraseData{EventID: phrase.EventID, PhraseID: phrase.PhraseID, Text: phrase.Text, GroupID: phrase.GroupID, Status: phrase.Status, UpdateTime: phrase.UpdateTime},
+		DedupKey: fmt.Sprintf("%s:%d:%d", event, phrase.PhraseID, phrase.UpdateTime),
+	})
+}
+
+// checkHot emits phrase.hot when the clicks of the phrase reached a threshold of lt_clicks_size,
+// only the highest threshold reached is emitted and each threshold once
+func (d *Dispatcher) checkHot(phraseID int) {
+	var phrase PhraseData
+	if err := d.db.Raw("SELECT a.event_id, a.phrase_id, a.text, sum(b.clicks) as clicks FROM phrase_models as a INNER JOIN all_phrase_clicks as b ON a.phrase_id = b.phrase_id WHERE a.phrase_id = ? GROUP BY a.event_id, a.phrase_id, a.text", phraseID).
+		Scan(&phrase).Error; err != nil {
+		zap.L().Sugar().Error("Error! Get clicks of phrase for hot check: ", err)
+		return
+	}
+
+	d.mu.Lock()
+	thresholdsOf := d.thresholds
+	d.mu.Unlock()
+
+	thresholds := d.config.Get().H5.LtClicksSize
+	if thresholdsOf != nil {
+		thresholds = thresholdsOf(phrase.EventID)
+	}
+	reached := notify.HotThreshold(phrase.Clicks, thresholds)
+	if reached == 0 {
+		return
+	}
+
+	d.emit(context.Background(), Event{
+		Name:     EventPhraseHot,
+		EventID:  phrase.EventID,
+		Data:     PhraseData{EventID: phrase.EventID, PhraseID: phraseID, Text: phrase.Text, Clicks: reached},
+		DedupKey: fmt.Sprintf("%s:%d:%d", EventPhraseHot, phraseID, reached),
+	})
+}
+
+// EndRound emits round.ended with the clicks of the groups and the top phrases of an event,
+// it returns false if the round of the event had already ended
+func (d *Dispatcher) EndRound(ctx context.Context, eventID int, round string) (bool, error) {
+	data := RoundData{EventID: eventID, Round: round, EndedAt: time.Now().Unix()}
+
+	groups, err := d.groupClicks(eventID)
+	if err != nil {
+		return false, err
+	}
+	data.Groups = groups
+
+	if err := d.db.WithContext(ctx).
+		Raw("SELECT a.event_id, a.phrase_id, a.text, a.group_id, sum(b.clicks) as clicks FROM phrase_models as a INNER JOIN all_phrase_clicks as b ON a.phrase_id = b.phrase_id and a.event_id = ? and a.status = ? GROUP BY a.event_id, a.phrase_id, a.text, a.group_id ORDER BY clicks desc LIMIT ?", eventID, model.StatusApproved, roundTopPhrases).
+		Scan(&data.TopPhrases).Error; err != nil {
+		return false, err
+	}
+
+	return d.Emit(ctx, Event{
+		Name:     EventRoundEnded,
+		EventID:  eventID,
+		Data:     data,
+		DedupKey: fmt.Sprintf("%s:%s", eventKey(EventRoundEnded, eventID), round),
+	})
+}
+
+// eventKey prefixes the dedup keys of the events of an event, the keys of the default event are kept as
+// they were before events existed
+func eventKey(name string, eventID int) string {
+	if eventID == model.DefaultEventID {
+		return name
+	}
+	return fmt.Sprintf("%s@%d", name, eventID)
+}
+
+func (d *Dispatcher) groupClicks(eventID int) ([]GroupClicks, error) {
+	var groups []GroupClicks
+	err := d.db.Table("all_phrase_clicks").
+		Select("group_id, SUM(clicks) as clicks").
+		Where("event_id = ?", eventID).
+		Group("group_id").
+		Order("clicks desc").
+		Scan(&groups).Error
+	return groups, err
+}
+
+// checkGroupLead emits group.lead_changed when another group of an event got the most clicks, a tie keeps the
+// leader. The leader is the group of the last emitted event, instances seeing the same change emit it once.
+func (d *Dispatcher) checkGroupLead(eventID int) {
+	groups, err := d.groupClicks(eventID)
+	if err != nil {
+		zap.L().Sugar().Error("Error! Get clicks of groups for lead check: ", err)
+		return
+	}
+	if len(groups) == 0 || (len(groups) > 1 && groups[0].Clicks == groups[1].Clicks) {
+		return
+	}
+
+	var last model.WebhookEventModel
+	key := eventKey(EventGroupLeadChanged, eventID)
+	lastRes := d.db.Where("event = ? AND dedup_key LIKE ?", EventGroupLeadChanged, key+":%").Order("id desc").Limit(1).Find(&last)
+	if lastRes.Error != nil {
+		zap.L().Sugar().Error("Error! Get last group lead: ", lastRes.Error)
+		return
+	}
+
+	var lead GroupLeadData
+	if lastRes.RowsAffected > 0 {
+		if err := json.Unmarshal([]byte(last.Payload), &lead); err != nil {
+			zap.L().Sugar().Error("Error! Decode last group lead: ", err)
+			return
+		}
+	}
+	if lead.GroupID == groups[0].GroupID {
+		return
+	}
+
+	d.emit(context.Background(), Event{
+		Name:    EventGroupLeadChanged,
+		EventID: eventID,
+		Data: GroupLeadData{
+			EventID:         eventID,
+			GroupID:         groups[0].GroupID,
+			Clicks:          groups[0].Clicks,
+			PreviousGroupID: lead.GroupID,
+			Groups:          groups,
+		},
+		DedupKey: fmt.Sprintf("%s:%d:%d", key, last.ID, groups[0].GroupID),
+	})
+}
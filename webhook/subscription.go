@@ -0,0 +1,228 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/YiniXu9506/devconG/model"
+	"gorm.io/gorm"
+)
+
+// subscribes to all events
+const AllEvents = "*"
+
+var (
+	ErrUnknownSubscription = errors.New("unknown webhook subscription")
+	ErrUnknownDelivery     = errors.New("unknown webhook delivery")
+)
+
+// SubscriptionRequest creates or replaces a subscription
+type SubscriptionRequest struct {
+	URL         string   `json:"url" binding:"required"`
+	Events      []string `json:"events" binding:"required"`
+	Description string   `json:"description"`
+	Enabled     *bool    `json:"enabled"`
+}
+
+// DeliveryInfo is a delivery with its event and the log of its attempts
+type DeliveryInfo struct {
+	model.WebhookDeliveryModel
+	Event    model.WebhookEventModel     `json:"event"`
+	Attempts []model.WebhookAttemptModel `json:"attempt_log"`
+}
+
+func subscribed(subscription model.WebhookSubscriptionModel, event string) bool {
+	for _, name := range strings.Split(subscription.Events, ",") {
+		if name == AllEvents || name == event {
+			return true
+		}
+	}
+	return false
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (req SubscriptionRequest) validate() error {
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an http or https url, got %q", req.URL)
+	}
+	if len(req.Events) == 0 {
+		return errors.New("events must not be empty")
+	}
+	for _, event := range req.Events {
+		if event != AllEvents && !knownEvent(event) {
+			return fmt.Errorf("events must be %v or %v, got %q", strings.Join(Events, ", "), AllEvents, event)
+		}
+	}
+	return nil
+}
+
+// subscriptionIDs selects the ids of the subscriptions of the event
+func (d *Dispatcher) subscriptionIDs(eventID int) *gorm.DB {
+	return d.db.Model(&model.WebhookSubscriptionModel{}).Select("id").Where("event_id = ?", eventID)
+}
+
+// ListSubscriptions returns the subscriptions of the event, secrets are left out
+func (d *Dispatcher) ListSubscriptions(eventID int) ([]model.WebhookSubscriptionModel, error) {
+	var subscriptions []model.WebhookSubscriptionModel
+	err := d.db.Where("event_id = ?", eventID).Order("id").Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+// CreateSubscription stores the subscription to the webhook events of the event with a new signing secret
+func (d *Dispatcher) CreateSubscription(eventID int, req SubscriptionRequest) (model.WebhookSubscriptionModel, error) {
+	if err := req.validate(); err != nil {
+		return model.WebhookSubscriptionModel{}, err
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		return model.WebhookSubscriptionModel{}, err
+	}
+
+	now := time.Now().Unix()
+	subscription := model.WebhookSubscriptionModel{
+		EventID:     eventID,
+		URL:         req.URL,
+		Secret:      secret,
+		Events:      strings.Join(req.Events, ","),
+		Description: req.Description,
+		Enabled:     req.Enabled == nil || *req.Enabled,
+		CreateTime:  now,
+		UpdateTime:  now,
+	}
+	err = d.db.Create(&subscription).Error
+	return subscription, err
+}
+
+// UpdateSubscription replaces url, events, description and enabled of a subscription of the event, the secret is kept
+func (d *Dispatcher) UpdateSubscription(eventID, id int, req SubscriptionRequest) (model.WebhookSubscriptionModel, error) {
+	if err := req.validate(); err != nil {
+		return model.WebhookSubscriptionModel{}, err
+	}
+
+	var subscription model.WebhookSubscriptionModel
+	subscriptionRes := d.db.Where("id = ? AND event_id = ?", id, eventID).Find(&subscription)
+	if subscriptionRes.Error != nil {
+		return subscription, subscriptionRes.Error
+	}
+	if subscriptionRes.RowsAffected == 0 {
+		return subscription, ErrUnknownSubscription
+	}
+
+	subscription.URL = req.URL
+	subscription.Events = strings.Join(req.Events, ",")
+	subscription.Description = req.Description
+	if req.Enabled != nil {
+		subscription.Enabled = *req.Enabled
+	}
+	subscription.UpdateTime = time.Now().Unix()
+
+	err := d.db.Model(&model.WebhookSubscriptionModel{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"url":         subscription.URL,
+			"events":      subscription.Events,
+			"description": subscription.Description,
+			"enabled":     subscription.Enabled,
+			"update_time": subscription.UpdateTime,
+		}).Error
+	return subscription, err
+}
+
+// DeleteSubscription removes the subscription of the event, its pending deliveries fail
+func (d *Dispatcher) DeleteSubscription(eventID, id int) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("id = ? AND event_id = ?", id, eventID).Delete(&model.WebhookSubscriptionModel{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrUnknownSubscription
+		}
+
+		return tx.Model(&model.WebhookDeliveryModel{}).
+			Where("subscription_id = ? AND status = ?", id, DeliveryPending).
+			Updates(map[string]interface{}{"status": DeliveryFailed, "last_error": errSubscriptionGone.Error(), "update_time": time.Now().Unix()}).Error
+	})
+}
+
+// ListDeliveries returns the deliveries of a subscription of the event newest first, status 0 lists all of them
+func (d *Dispatcher) ListDeliveries(eventID, subscriptionID, status, limit, offset int) ([]model.WebhookDeliveryModel, int64, error) {
+	query := d.db.Model(&model.WebhookDeliveryModel{}).
+		Where("subscription_id = ? AND subscription_id IN (?)", subscriptionID, d.subscriptionIDs(eventID))
+	if status > 0 {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var deliveries []model.WebhookDeliveryModel
+	err := query.Session(&gorm.Session{}).Order("id desc").Limit(limit).Offset(offset).Find(&deliveries).Error
+	return deliveries, total, err
+}
+
+// GetDelivery returns the delivery to a subscription of the event with its webhook event and attempts
+func (d *Dispatcher) GetDelivery(eventID, id int) (DeliveryInfo, error) {
+	var info DeliveryInfo
+	deliveryRes := d.db.Where("id = ? AND subscription_id IN (?)", id, d.subscriptionIDs(eventID)).Find(&info.WebhookDeliveryModel)
+	if deliveryRes.Error != nil {
+		return info, deliveryRes.Error
+	}
+	if deliveryRes.RowsAffected == 0 {
+		return info, ErrUnknownDelivery
+	}
+
+	if err := d.db.Where("id = ?", info.EventID).Find(&info.Event).Error; err != nil {
+		return info, err
+	}
+	err := d.db.Where("delivery_id = ?", id).Order("attempt").Find(&info.Attempts).Error
+	return info, err
+}
+
+// Redeliver queues the webhook event of a delivery to a subscription of the event again as a new delivery
+func (d *Dispatcher) Redeliver(eventID, id int) (model.WebhookDeliveryModel, error) {
+	var delivery model.WebhookDeliveryModel
+	deliveryRes := d.db.Where("id = ? AND subscription_id IN (?)", id, d.subscriptionIDs(eventID)).Find(&delivery)
+	if deliveryRes.Error != nil {
+		return delivery, deliveryRes.Error
+	}
+	if deliveryRes.RowsAffected == 0 {
+		return delivery, ErrUnknownDelivery
+	}
+
+	var subscriptions int64
+	if err := d.db.Model(&model.WebhookSubscriptionModel{}).Where("id = ?", delivery.SubscriptionID).Count(&subscriptions).Error; err != nil {
+		return delivery, err
+	}
+	if subscriptions == 0 {
+		return delivery, ErrUnknownSubscription
+	}
+
+	now := time.Now().Unix()
+	redelivery := model.WebhookDeliveryModel{
+		EventID:         delivery.EventID,
+		SubscriptionID:  delivery.SubscriptionID,
+		Status:          DeliveryPending,
+		NextAttemptTime: now,
+		CreateTime:      now,
+		UpdateTime:      now,
+	}
+	err := d.db.Create(&redelivery).Error
+	return redelivery, err
+}
@@ -0,0 +1,343 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/YiniXu9506/devconG/config"
+	"github.com/YiniXu9506/devconG/model"
+	"github.com/YiniXu9506/devconG/notify"
+	"github.com/YiniXu9506/devconG/utils"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// delivery status of an event to a subscription
+const (
+	DeliveryPending = 1
+	DeliverySent    = 2
+	DeliveryFailed  = 3
+)
+
+// request headers of a webhook delivery
+const (
+	HeaderEvent     = "X-Devcon-Event"
+	HeaderDelivery  = "X-Devcon-Delivery"
+	HeaderTimestamp = "X-Devcon-Timestamp"
+	// sha256=hex(hmac_sha256(secret, timestamp + "." + body))
+	HeaderSignature = "X-Devcon-Signature"
+)
+
+const (
+	// how often due deliveries and the group lead are processed
+	pollInterval = 3 * time.Second
+	// deliveries picked per poll
+	deliveryBatchSize = 100
+	// bytes of an error response kept in the attempt log
+	maxResponseLog = 256
+)
+
+// the subscription was deleted or disabled, the delivery is not retried
+var errSubscriptionGone = errors.New("subscription is deleted or disabled")
+
+// Event is emitted to all enabled subscriptions of its name and of the event it happened in
+type Event struct {
+	Name string
+	// the event of the wall it happened on
+	EventID int
+	Data    interface{}
+	// events with the same key are emitted once
+	DedupKey string
+}
+
+// payload is the request body of a delivery
+type payload struct {
+	ID        int             `json:"id"`
+	Event     string          `json:"event"`
+	CreatedAt int64           `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Sign returns the signature of a delivery, receivers compare it with the X-Devcon-Signature header
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatcher stores events with a delivery per subscription, and delivers them with retries.
+// Deliveries live in the database, so events emitted by any instance are delivered once.
+type Dispatcher struct {
+	db     *gorm.DB
+	config *config.Manager
+	client *http.Client
+
+	// events and phrases with clicks added since the last group lead and hot check, guarded by mu
+	clicked        map[int]bool
+	clickedPhrases map[int]bool
+	// thresholds of the events, h5.lt_clicks_size of the config file when unset, guarded by mu
+	thresholds notify.ThresholdsFunc
+	mu         sync.Mutex
+	stopOnce   sync.Once
+	stopCh     chan struct{}
+	doneCh     chan struct{}
+}
+
+func NewDispatcher(db *gorm.DB, cfg *config.Manager) *Dispatcher {
+	dispatcher := &Dispatcher{
+		db:             db,
+		config:         cfg,
+		client:         &http.Client{},
+		clicked:        make(map[int]bool),
+		clickedPhrases: make(map[int]bool),
+		stopCh:         make(chan struct{}),
+		doneCh:         make(chan struct{}),
+	}
+	go periodDispatch(dispatcher)
+	return dispatcher
+}
+
+// Emit stores the event and queues it for the enabled subscriptions of the event's name and event,
+// it returns false if an event with the same dedup key was emitted before
+func (d *Dispatcher) Emit(ctx context.Context, event Event) (bool, error) {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return false, err
+	}
+
+	var subscriptions []model.WebhookSubscriptionModel
+	if err := d.db.WithContext(ctx).Where("enabled = ? AND event_id = ?", true, event.EventID).Find(&subscriptions).Error; err != nil {
+		return false, err
+	}
+
+	now := time.Now().Unix()
+	record := model.WebhookEventModel{
+		Event:      event.Name,
+		Payload:    string(data),
+		DedupKey:   event.DedupKey,
+		CreateTime: now,
+	}
+
+	emitted := false
+	err = d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return nil
+		}
+		emitted = true
+
+		for _, subscription := range subscriptions {
+			if !subscribed(subscription, event.Name) {
+				continue
+			}
+			if err := tx.Create(&model.WebhookDeliveryModel{
+				EventID:         record.ID,
+				SubscriptionID:  subscription.ID,
+				Status:          DeliveryPending,
+				NextAttemptTime: now,
+				CreateTime:      now,
+				UpdateTime:      now,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return emitted && err == nil, err
+}
+
+// emit logs the error of Emit, events are a side effect of the request which triggered them
+func (d *Dispatcher) emit(ctx context.Context, event Event) {
+	if _, err := d.Emit(ctx, event); err != nil {
+		zap.L().Sugar().Errorf("Error! Emit webhook event %v: %v", event.Name, err)
+	}
+}
+
+// ClicksAdded marks the group lead of the event and the phrase for a check at the next poll, it never blocks the caller
+func (d *Dispatcher) ClicksAdded(eventID, phraseID int) {
+	d.mu.Lock()
+	d.clicked[eventID] = true
+	d.clickedPhrases[phraseID] = true
+	d.mu.Unlock()
+}
+
+// HotThresholds sets the thresholds phrase.hot is checked against, by the event of the phrase
+func (d *Dispatcher) HotThresholds(fn notify.ThresholdsFunc) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.thresholds = fn
+}
+
+// takeClicked returns the events and phrases with clicks added since the last call
+func (d *Dispatcher) takeClicked() (map[int]bool, map[int]bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	clicked, clickedPhrases := d.clicked, d.clickedPhrases
+	d.clicked = make(map[int]bool)
+	d.clickedPhrases = make(map[int]bool)
+	return clicked, clickedPhrases
+}
+
+// Stop terminates the background delivery goroutine and waits for it to exit
+func (d *Dispatcher) Stop() {
+	d.stopOnce.Do(func() {
+		close(d.stopCh)
+	})
+	<-d.doneCh
+}
+
+// deliverDue sends the pending deliveries whose next attempt is due
+func (d *Dispatcher) deliverDue() {
+	webhooksConfig := d.config.Get().Webhooks
+	now := time.Now().Unix()
+
+	var deliveries []model.WebhookDeliveryModel
+	if err := d.db.Where("status = ? AND next_attempt_time <= ?", DeliveryPending, now).
+		Order("next_attempt_time").
+		Limit(deliveryBatchSize).
+		Find(&deliveries).Error; err != nil {
+		zap.L().Sugar().Error("Error! Get due webhook deliveries: ", err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		attempts := delivery.Attempts + 1
+		// backoff doubles the retry interval after each failed attempt, up to an hour
+		backoff := utils.Backoff(webhooksConfig.RetryIntervalSeconds, delivery.Attempts)
+
+		// claim the delivery, other instances skip it until the next attempt is due
+		claim := d.db.Model(&model.WebhookDeliveryModel{}).
+			Where("id = ? AND attempts = ?", delivery.ID, delivery.Attempts).
+			Updates(map[string]interface{}{"attempts": attempts, "next_attempt_time": now + backoff, "update_time": now})
+		if claim.Error != nil || claim.RowsAffected == 0 {
+			continue
+		}
+
+		start := time.Now()
+		statusCode, err := d.send(delivery, time.Duration(webhooksConfig.TimeoutSeconds)*time.Second)
+
+		attempt := model.WebhookAttemptModel{
+			DeliveryID:  delivery.ID,
+			Attempt:     attempts,
+			StatusCode:  statusCode,
+			DurationMs:  time.Since(start).Milliseconds(),
+			AttemptTime: start.Unix(),
+		}
+		updates := map[string]interface{}{"last_status_code": statusCode, "update_time": time.Now().Unix()}
+		switch {
+		case err == nil:
+			updates["status"] = DeliverySent
+			updates["last_error"] = ""
+		case errors.Is(err, errSubscriptionGone) || attempts >= webhooksConfig.MaxAttempts:
+			updates["status"] = DeliveryFailed
+			updates["last_error"] = err.Error()
+		default:
+			updates["last_error"] = err.Error()
+		}
+		if err != nil {
+			attempt.Error = err.Error()
+			zap.L().Sugar().Warnf("deliver webhook %v to subscription %v, attempt %v: %v", delivery.ID, delivery.SubscriptionID, attempts, err)
+		}
+
+		if err := d.db.Create(&attempt).Error; err != nil {
+			zap.L().Sugar().Error("Error! Log webhook attempt: ", err)
+		}
+		if err := d.db.Model(&model.WebhookDeliveryModel{}).Where("id = ?", delivery.ID).Updates(updates).Error; err != nil {
+			zap.L().Sugar().Error("Error! Update webhook delivery: ", err)
+		}
+	}
+}
+
+// send posts the signed event to the subscription and returns the response status code
+func (d *Dispatcher) send(delivery model.WebhookDeliveryModel, timeout time.Duration) (int, error) {
+	var subscription model.WebhookSubscriptionModel
+	subscriptionRes := d.db.Where("id = ? AND enabled = ?", delivery.SubscriptionID, true).Find(&subscription)
+	if subscriptionRes.Error != nil {
+		return 0, subscriptionRes.Error
+	}
+	if subscriptionRes.RowsAffected == 0 {
+		return 0, errSubscriptionGone
+	}
+
+	var event model.WebhookEventModel
+	if err := d.db.Where("id = ?", delivery.EventID).First(&event).Error; err != nil {
+		return 0, err
+	}
+
+	body, err := json.Marshal(payload{
+		ID:        event.ID,
+		Event:     event.Event,
+		CreatedAt: event.CreateTime,
+		Data:      json.RawMessage(event.Payload),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, event.Event)
+	req.Header.Set(HeaderDelivery, strconv.Itoa(delivery.ID))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(subscription.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseLog))
+		return resp.StatusCode, fmt.Errorf("webhook responded %v: %s", resp.Status, respBody)
+	}
+	return resp.StatusCode, nil
+}
+
+func periodDispatch(dispatcher *Dispatcher) {
+	defer close(dispatcher.doneCh)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			clicked, clickedPhrases := dispatcher.takeClicked()
+			for eventID := range clicked {
+				dispatcher.checkGroupLead(eventID)
+			}
+			for phraseID := range clickedPhrases {
+				dispatcher.checkHot(phraseID)
+			}
+			dispatcher.deliverDue()
+		case <-dispatcher.stopCh:
+			return
+		}
+	}
+}
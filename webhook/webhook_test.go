@@ -0,0 +1,275 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/YiniXu9506/devconG/config"
+	"github.com/YiniXu9506/devconG/model"
+	"github.com/YiniXu9506/devconG/utils"
+	"gorm.io/gorm"
+)
+
+func newTestDispatcher(t *testing.T, overrides map[string]interface{}) (*Dispatcher, *gorm.DB) {
+	t.Helper()
+
+	settings := map[string]interface{}{
+		"db.driver":           config.DBDriverSQLite,
+		"auth.admin_token":    "test-admin-token",
+		"auth.session_secret": "test-session-secret",
+	}
+	for key, value := range overrides {
+		settings[key] = value
+	}
+	loader, err := config.NewLoader("../config.dev", settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.NewManager(loader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := utils.Open(config.DBConfig{Driver: config.DBDriverSQLite, Path: filepath.Join(t.TempDir(), "devcon.db"), MaxIdleConns: 2, MaxOpenConns: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		utils.Close(db)
+	})
+	if err := utils.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	// the tests run the polls themselves
+	dispatcher := NewDispatcher(db, cfg)
+	dispatcher.Stop()
+	return dispatcher, db
+}
+
+// receiver records the deliveries and answers with the queued status codes, 200 when none is left
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+	status := http.StatusOK
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func subscribe(t *testing.T, d *Dispatcher, url string, events ...string) model.WebhookSubscriptionModel {
+	t.Helper()
+
+	subscription, err := d.CreateSubscription(model.DefaultEventID, SubscriptionRequest{URL: url, Events: events})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return subscription
+}
+
+func emitSubmitted(t *testing.T, d *Dispatcher, phraseID int) {
+	t.Helper()
+
+	if emitted, err := d.Emit(context.Background(), Event{Name: EventPhraseSubmitted, EventID: model.DefaultEventID, Data: PhraseData{PhraseID: phraseID}, DedupKey: strconv.Itoa(phraseID)}); err != nil || !emitted {
+		t.Fatalf("emit: %v, %v", emitted, err)
+	}
+}
+
+// retryNow makes the pending deliveries due
+func retryNow(t *testing.T, db *gorm.DB) {
+	t.Helper()
+
+	if err := db.Model(&model.WebhookDeliveryModel{}).Where("status = ?", DeliveryPending).Update("next_attempt_time", 0).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSign(t *testing.T) {
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("1633072800.{}"))
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	if got := Sign("secret", 1633072800, []byte("{}")); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestDeliverySigned(t *testing.T) {
+	d, _ := newTestDispatcher(t, nil)
+	recv := &receiver{}
+	server := httptest.NewServer(recv)
+	defer server.Close()
+
+	subscription := subscribe(t, d, server.URL, EventPhraseSubmitted)
+	subscribe(t, d, server.URL, EventRoundEnded)
+	emitSubmitted(t, d, 7)
+	// the same dedup key is emitted once
+	if emitted, err := d.Emit(context.Background(), Event{Name: EventPhraseSubmitted, EventID: model.DefaultEventID, DedupKey: "7"}); err != nil || emitted {
+		t.Fatalf("emitted a duplicate: %v, %v", emitted, err)
+	}
+	d.deliverDue()
+
+	if len(recv.requests) != 1 {
+		t.Fatalf("got %d requests, want one to the subscription of %v", len(recv.requests), EventPhraseSubmitted)
+	}
+	req, body := recv.requests[0], recv.bodies[0]
+	timestamp, err := strconv.ParseInt(req.Header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signature := req.Header.Get(HeaderSignature); signature != Sign(subscription.Secret, timestamp, body) {
+		t.Fatalf("got signature %q, want the signature of the body with the secret of the subscription", signature)
+	}
+	if event := req.Header.Get(HeaderEvent); event != EventPhraseSubmitted {
+		t.Fatalf("got event header %q", event)
+	}
+
+	var p struct {
+		Event string     `json:"event"`
+		Data  PhraseData `json:"data"`
+	}
+	if err := json.Unmarshal(body, &p); err != nil || p.Event != EventPhraseSubmitted || p.Data.PhraseID != 7 {
+		t.Fatalf("got payload %s, %v", body, err)
+	}
+}
+
+func TestDeliveryRetries(t *testing.T) {
+	d, db := newTestDispatcher(t, map[string]interface{}{"webhooks.max_attempts": 3})
+	recv := &receiver{statuses: []int{http.StatusInternalServerError, http.StatusBadGateway}}
+	server := httptest.NewServer(recv)
+	defer server.Close()
+
+	subscribe(t, d, server.URL, AllEvents)
+	emitSubmitted(t, d, 1)
+
+	d.deliverDue()
+	// the retry isn't due yet
+	d.deliverDue()
+	var delivery model.WebhookDeliveryModel
+	if err := db.First(&delivery).Error; err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Status != DeliveryPending || delivery.Attempts != 1 || delivery.LastStatusCode != http.StatusInternalServerError {
+		t.Fatalf("got delivery %+v after a failed attempt, want it pending", delivery)
+	}
+
+	retryNow(t, db)
+	d.deliverDue()
+	retryNow(t, db)
+	d.deliverDue()
+	if err := db.First(&delivery).Error; err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Status != DeliverySent || delivery.Attempts != 3 || delivery.LastError != "" {
+		t.Fatalf("got delivery %+v, want it sent at the third attempt", delivery)
+	}
+
+	var attempts []model.WebhookAttemptModel
+	if err := db.Where("delivery_id = ?", delivery.ID).Order("attempt").Find(&attempts).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(attempts) != 3 || attempts[0].StatusCode != http.StatusInternalServerError || attempts[2].StatusCode != http.StatusOK {
+		t.Fatalf("got attempt log %+v", attempts)
+	}
+}
+
+func TestDeliveryFailsAfterMaxAttempts(t *testing.T) {
+	d, db := newTestDispatcher(t, map[string]interface{}{"webhooks.max_attempts": 2})
+	recv := &receiver{statuses: []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError}}
+	server := httptest.NewServer(recv)
+	defer server.Close()
+
+	subscribe(t, d, server.URL, AllEvents)
+	emitSubmitted(t, d, 1)
+	for i := 0; i < 3; i++ {
+		retryNow(t, db)
+		d.deliverDue()
+	}
+
+	var delivery model.WebhookDeliveryModel
+	if err := db.First(&delivery).Error; err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Status != DeliveryFailed || delivery.Attempts != 2 || len(recv.requests) != 2 {
+		t.Fatalf("got delivery %+v after %d requests, want it failed after 2", delivery, len(recv.requests))
+	}
+}
+
+func TestPhraseHot(t *testing.T) {
+	d, db := newTestDispatcher(t, nil)
+	subscribe(t, d, "http://example.com/hook", EventPhraseHot)
+
+	phrase := model.PhraseModel{EventID: model.DefaultEventID, Text: "hello", GroupID: 1, Status: model.StatusApproved}
+	if err := db.Create(&phrase).Error; err != nil {
+		t.Fatal(err)
+	}
+	click := func(clicks int) {
+		if err := db.Create(&model.PhraseClickModel{EventID: model.DefaultEventID, PhraseID: phrase.PhraseID, GroupID: 1, Clicks: clicks}).Error; err != nil {
+			t.Fatal(err)
+		}
+		d.ClicksAdded(model.DefaultEventID, phrase.PhraseID)
+		_, clickedPhrases := d.takeClicked()
+		for phraseID := range clickedPhrases {
+			d.checkHot(phraseID)
+		}
+	}
+
+	hot := func() []PhraseData {
+		var events []model.WebhookEventModel
+		if err := db.Where("event = ?", EventPhraseHot).Order("id").Find(&events).Error; err != nil {
+			t.Fatal(err)
+		}
+		var data []PhraseData
+		for _, event := range events {
+			var phraseData PhraseData
+			if err := json.Unmarshal([]byte(event.Payload), &phraseData); err != nil {
+				t.Fatal(err)
+			}
+			data = append(data, phraseData)
+		}
+		return data
+	}
+
+	// the thresholds of lt_clicks_size in config.dev.json start at 20 and 50 clicks
+	click(10)
+	if events := hot(); len(events) != 0 {
+		t.Fatalf("got %+v below the thresholds", events)
+	}
+	click(15)
+	click(5)
+	click(40)
+	events := hot()
+	if len(events) != 2 || events[0].Clicks != 20 || events[1].Clicks != 50 || events[0].PhraseID != phrase.PhraseID {
+		t.Fatalf("got %+v, want each threshold once", events)
+	}
+
+	d.HotThresholds(func(eventID int) []config.SizeThreshold {
+		return []config.SizeThreshold{{Clicks: 60, Size: 40}}
+	})
+	click(1)
+	if events := hot(); len(events) != 3 || events[2].Clicks != 60 {
+		t.Fatalf("got %+v, want the threshold of the event", events)
+	}
+}